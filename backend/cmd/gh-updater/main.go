@@ -81,6 +81,7 @@ func main() {
 	slog.Info("connected to Redis database", "address", redisAddr)
 
 	buildRepo := data.NewPostgresBuildRepo(postgresDB)
+	jobRepo := data.NewPostgresJobRepo(postgresDB)
 	userRepo := data.NewPostgresUserRepo(postgresDB)
 	repoRepo := data.NewPostgresRepoRepo(postgresDB)
 
@@ -89,7 +90,7 @@ func main() {
 	minReconnectInterval := 10 * time.Second
 	maxReconnectInterval := time.Minute
 	dbListener := pq.NewListener(psqlInfo, minReconnectInterval, maxReconnectInterval, nil)
-	ghUpdater := updater.New(dbListener, repoRepo, userRepo, buildRepo, githubService, frontendURL)
+	ghUpdater := updater.New(dbListener, repoRepo, userRepo, buildRepo, jobRepo, githubService, frontendURL)
 
 	err = ghUpdater.Start(ctx)
 	if err != nil {
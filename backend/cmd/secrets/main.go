@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/envelope"
+)
+
+// rotateBatchSize is how many secrets are rewrapped per query.
+const rotateBatchSize = 100
+
+func main() {
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "generate-key":
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(key)
+	case "rotate":
+		rotate()
+	case "help", "-h", "--help":
+		printUsage()
+	default:
+		printUsage()
+		log.Fatalf("unknown command: %s", command)
+	}
+}
+
+// rotate wraps the data keys of all secrets with the current master key, so
+// that the previous master keys can be removed.
+func rotate() {
+	ctx := context.Background()
+
+	keyring, err := envelope.NewKeyring(mustGetenv("SECRETS_MASTER_KEY"), strings.Fields(os.Getenv("SECRETS_PREVIOUS_MASTER_KEYS"))...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sqlx.Connect("postgres", postgresConnectionString())
+	if err != nil {
+		log.Fatalf("error connecting to Postgres database: %v", err)
+	}
+	defer db.Close()
+
+	secretRepo := data.NewPostgresSecretRepo(db)
+
+	rotated := 0
+	for {
+		secrets, err := secretRepo.GetNotWrappedWith(ctx, keyring.CurrentKeyID(), rotateBatchSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(secrets) == 0 {
+			break
+		}
+
+		for _, secret := range secrets {
+			sealed, err := keyring.Rewrap(envelope.Sealed{
+				Ciphertext:   secret.Ciphertext,
+				EncryptedKey: secret.EncryptedKey,
+				KeyID:        secret.KeyID,
+			})
+			if err != nil {
+				log.Fatalf("error rewrapping secret with id %d: %v", secret.ID, err)
+			}
+
+			err = secretRepo.Rewrap(ctx, secret.ID, secret.KeyID, sealed.EncryptedKey, sealed.KeyID)
+			if err != nil {
+				// Secrets replaced in the meantime use the current key already.
+				if errors.Is(err, data.ErrNotFound) {
+					continue
+				}
+				log.Fatalf("error storing secret with id %d: %v", secret.ID, err)
+			}
+			rotated++
+		}
+	}
+
+	log.Printf("rotated %d secret(s) to master key %s", rotated, keyring.CurrentKeyID())
+}
+
+func postgresConnectionString() string {
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		return databaseURL
+	}
+
+	dbHost := mustGetenv("DB_HOST")
+	dbPort := mustGetenv("DB_PORT")
+	dbUser := mustGetenv("DB_USER")
+	dbPassword := mustGetenv("DB_PASSWORD")
+	dbName := mustGetenv("DB_NAME")
+	dbOpts := mustGetenv("DB_OPTS")
+
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s %s", dbHost, dbPort, dbUser, dbPassword, dbName, dbOpts)
+}
+
+func mustGetenv(name string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		log.Fatalf("%s env var is empty or not set", name)
+	}
+	return value
+}
+
+func printUsage() {
+	log.Printf(`usage:
+  secrets generate-key
+  secrets rotate
+
+generate-key prints a new random master key.
+
+rotate encrypts the data keys of all secrets with SECRETS_MASTER_KEY. Secrets
+whose data keys are encrypted with a key that is neither SECRETS_MASTER_KEY nor
+in SECRETS_PREVIOUS_MASTER_KEYS can't be rotated. Once rotate succeeded, the
+previous master keys can be removed.
+
+environment:
+  SECRETS_MASTER_KEY            required for rotate, the new master key
+  SECRETS_PREVIOUS_MASTER_KEYS  whitespace-separated master keys to rotate from
+  DATABASE_URL                  optional Postgres URL, used if set
+  DB_HOST                       required if DATABASE_URL is not set
+  DB_PORT                       required if DATABASE_URL is not set
+  DB_USER                       required if DATABASE_URL is not set
+  DB_PASSWORD                   required if DATABASE_URL is not set
+  DB_NAME                       required if DATABASE_URL is not set
+  DB_OPTS                       required if DATABASE_URL is not set, for example "sslmode=require"`)
+}
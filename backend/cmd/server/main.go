@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
@@ -9,7 +10,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bee-ci/bee-ci-system/internal/common/ghservice"
@@ -18,12 +21,25 @@ import (
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 
+	"github.com/bee-ci/bee-ci-system/internal/artifact"
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/cache"
 	"github.com/bee-ci/bee-ci-system/internal/common/middleware"
+	"github.com/bee-ci/bee-ci-system/internal/dashboard"
 	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/envelope"
+	"github.com/bee-ci/bee-ci-system/internal/logarchive"
+	"github.com/bee-ci/bee-ci-system/internal/redact"
+	"github.com/bee-ci/bee-ci-system/internal/repopurge"
+	"github.com/bee-ci/bee-ci-system/internal/reposync"
+	"github.com/bee-ci/bee-ci-system/internal/scheduler"
 	"github.com/bee-ci/bee-ci-system/internal/server/api"
+	"github.com/bee-ci/bee-ci-system/internal/server/badge"
+	"github.com/bee-ci/bee-ci-system/internal/server/runner"
 	"github.com/bee-ci/bee-ci-system/internal/server/webhook"
+	"github.com/bee-ci/bee-ci-system/internal/watchdog"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/lmittmann/tint"
 )
 
@@ -55,6 +71,30 @@ func main() {
 	githubAppWebhookSecret := mustGetenv("GITHUB_APP_WEBHOOK_SECRET")
 	githubAppClientSecret := mustGetenv("GITHUB_APP_CLIENT_SECRET")
 
+	// Runners can't register if the token is empty. Runners that read the
+	// queue from the database directly keep working either way.
+	runnerRegistrationToken := os.Getenv("RUNNER_REGISTRATION_TOKEN")
+
+	logRetentionDays := int(getenvInt64("LOG_RETENTION_DAYS", 90))
+
+	// Patterns are separated by whitespace, use \s to match it.
+	redactPatterns, err := redact.CompilePatterns(slices.Concat(redact.DefaultPatterns, strings.Fields(os.Getenv("LOG_REDACT_PATTERNS"))))
+	if err != nil {
+		slog.Error("error compiling LOG_REDACT_PATTERNS", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Secrets can't be created, and aren't passed to jobs, without a master
+	// key.
+	var keyring *envelope.Keyring
+	if masterKey := os.Getenv("SECRETS_MASTER_KEY"); masterKey != "" {
+		keyring, err = envelope.NewKeyring(masterKey, strings.Fields(os.Getenv("SECRETS_PREVIOUS_MASTER_KEYS"))...)
+		if err != nil {
+			slog.Error("error reading SECRETS_MASTER_KEY", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
 	dbHost := mustGetenv("DB_HOST")
 	dbPort := mustGetenv("DB_PORT")
 	dbUser := mustGetenv("DB_USER")
@@ -91,33 +131,212 @@ func main() {
 	}
 	slog.Info("connected to Redis database", "address", redisAddr)
 
-	influxURL := mustGetenv("INFLUXDB_URL")
-	influxToken := mustGetenv("INFLUXDB_TOKEN")
-	influxBucket := mustGetenv("INFLUXDB_BUCKET")
-	influxOrg := mustGetenv("INFLUXDB_ORG")
-	influxClient := influxdb2.NewClient(influxURL, influxToken)
-	_, err = influxClient.Health(ctx)
-	if err != nil {
-		slog.Error("error connecting to Influx database", slog.Any("error", err))
+	var logsRepo data.LogsRepo
+	logBackend := os.Getenv("LOG_BACKEND")
+	switch logBackend {
+	case "", "influx":
+		influxURL := mustGetenv("INFLUXDB_URL")
+		influxToken := mustGetenv("INFLUXDB_TOKEN")
+		influxBucket := mustGetenv("INFLUXDB_BUCKET")
+		influxOrg := mustGetenv("INFLUXDB_ORG")
+		influxClient := influxdb2.NewClient(influxURL, influxToken)
+		_, err = influxClient.Health(ctx)
+		if err != nil {
+			slog.Error("error connecting to Influx database", slog.Any("error", err))
+			os.Exit(1)
+
+		} else {
+			slog.Info("connected to Influx database", "url", influxURL)
+		}
+		logsRepo = data.NewInfluxLogsRepo(influxClient, influxOrg, influxBucket)
+	case "postgres":
+		logsRepo = data.NewPostgresLogsRepo(db)
+	case "filesystem":
+		logsDir := mustGetenv("LOG_DIR")
+		logsRepo, err = data.NewFilesystemLogsRepo(logsDir)
+		if err != nil {
+			slog.Error("error creating filesystem logs backend", slog.Any("error", err))
+			os.Exit(1)
+		}
+	default:
+		slog.Error("LOG_BACKEND env var must be one of influx, postgres or filesystem", slog.String("value", logBackend))
 		os.Exit(1)
+	}
+	slog.Info("using logs backend", "backend", cmp.Or(logBackend, "influx"))
 
-	} else {
-		slog.Info("connected to Influx database", "url", influxURL)
+	// Logs of completed builds are archived to blob storage if it's
+	// configured, and kept in the logs backend otherwise. Artifacts and caches
+	// are only enabled if it's configured.
+	var blobs blob.Store
+	blobBackend := os.Getenv("BLOB_BACKEND")
+	switch blobBackend {
+	case "":
+	case "filesystem":
+		blobs, err = blob.NewFilesystemStore(mustGetenv("BLOB_DIR"))
+		if err != nil {
+			slog.Error("error creating filesystem blob store", slog.Any("error", err))
+			os.Exit(1)
+		}
+	case "s3":
+		blobs, err = blob.NewS3Store(blob.S3Config{
+			Endpoint:        mustGetenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          mustGetenv("S3_BUCKET"),
+			AccessKeyID:     mustGetenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: mustGetenv("S3_SECRET_ACCESS_KEY"),
+		})
+		if err != nil {
+			slog.Error("error creating S3 blob store", slog.Any("error", err))
+			os.Exit(1)
+		}
+	default:
+		slog.Error("BLOB_BACKEND env var must be empty or one of filesystem or s3", slog.String("value", blobBackend))
+		os.Exit(1)
 	}
 
 	buildRepo := data.NewPostgresBuildRepo(db)
+	jobRepo := data.NewPostgresJobRepo(db)
 	userRepo := data.NewPostgresUserRepo(db)
 	repoRepo := data.NewPostgresRepoRepo(db)
-	logsRepo := data.NewInfluxLogsRepo(influxClient, influxOrg, influxBucket)
+	runnerRepo := data.NewPostgresRunnerRepo(db)
+	queueRepo := data.NewPostgresQueueRepo(db)
+	installationRepo := data.NewPostgresInstallationRepo(db)
+	logsBroker := data.NewRedisLogsBroker(redisDB)
+	logMaskRepo := data.NewRedisLogMaskRepo(redisDB)
+	heldLogsRepo := data.NewRedisHeldLogsRepo(redisDB)
+	secretRepo := data.NewPostgresSecretRepo(db)
+	variableRepo := data.NewPostgresVariableRepo(db)
+	artifactRepo := data.NewPostgresArtifactRepo(db)
+	cacheRepo := data.NewPostgresCacheRepo(db)
+	buildEventRepo := data.NewPostgresBuildEventRepo(db)
+	analyticsRepo := data.NewPostgresAnalyticsRepo(db)
+
+	// Dashboards are cached if DASHBOARD_CACHE_TTL is set, and invalidated
+	// when builds are updated.
+	var dashboardRepo data.DashboardRepo = data.NewPostgresDashboardRepo(db)
+	var dashboardCache *data.RedisCachedDashboardRepo
+	if ttl := getenvDuration("DASHBOARD_CACHE_TTL", 0); ttl > 0 {
+		dashboardCache = data.NewRedisCachedDashboardRepo(dashboardRepo, redisDB, ttl)
+		dashboardRepo = dashboardCache
+		slog.Info("caching dashboards", "ttl", ttl)
+	}
+
+	var logArchiveRepo data.LogArchiveRepo
+	var logsReader data.LogsReader = logsRepo
+	if blobs != nil {
+		logArchiveRepo = data.NewPostgresLogArchiveRepo(db)
+		logsReader = logarchive.NewReader(logArchiveRepo, logsRepo, blobs)
+		slog.Info("archiving logs to blob storage", "backend", blobBackend)
+	}
+	logsReader = redact.NewReader(logsReader, logMaskRepo, redactPatterns)
 
 	githubService := ghservice.NewGithubService(githubAppID, rsaPrivateKey, redisDB)
 
-	webhooks, err := webhook.NewHandler(userRepo, repoRepo, buildRepo, githubService, mainDomain, frontendURL, githubAppClientID, githubAppClientSecret, githubAppWebhookSecret, jwtSecret)
+	webhooks, err := webhook.NewHandler(userRepo, repoRepo, buildRepo, jobRepo, installationRepo, githubService, mainDomain, frontendURL, githubAppClientID, githubAppClientSecret, githubAppWebhookSecret, jwtSecret)
 	if err != nil {
 		slog.Error("error creating webhook handler", slog.Any("error", err))
 		os.Exit(1)
 	}
-	app := api.NewApp(buildRepo, logsRepo, repoRepo, userRepo, jwtSecret)
+	repoSyncer := reposync.New(installationRepo, repoRepo, githubService, getenvDuration("REPO_SYNC_INTERVAL", 6*time.Hour))
+	app := api.NewApp(buildRepo, jobRepo, logsReader, logsBroker, repoRepo, userRepo, runnerRepo, queueRepo, dashboardRepo, buildEventRepo, analyticsRepo, installationRepo, repoSyncer, logArchiveRepo, blobs, artifactRepo, secretRepo, variableRepo, keyring, logRetentionDays, jwtSecret)
+	queueLimits := data.QueueLimits{
+		MaxBuildsPerInstallation: int(getenvInt64("MAX_CONCURRENT_BUILDS_PER_INSTALLATION", 0)),
+		MaxBuildsPerRepo:         int(getenvInt64("MAX_CONCURRENT_BUILDS_PER_REPO", 0)),
+	}
+	artifactConfig := artifact.DefaultConfig()
+	artifactConfig.Retention = time.Duration(getenvInt64("ARTIFACT_RETENTION_DAYS", int64(artifactConfig.Retention/(24*time.Hour)))) * 24 * time.Hour
+	artifactConfig.MaxSize = getenvInt64("ARTIFACT_MAX_SIZE", artifactConfig.MaxSize)
+	var caches *cache.Store
+	if blobs != nil {
+		cacheConfig := cache.DefaultConfig()
+		cacheConfig.MaxSizePerRepo = getenvInt64("CACHE_MAX_SIZE_PER_REPO", cacheConfig.MaxSizePerRepo)
+		caches = cache.New(cacheRepo, blobs, cacheConfig)
+	}
+	runners := runner.NewHandler(runnerRepo, jobRepo, buildRepo, repoRepo, userRepo, logsRepo, logsBroker, logMaskRepo, heldLogsRepo, redactPatterns, secretRepo, variableRepo, keyring, artifactRepo, blobs, artifactConfig, caches, runnerRegistrationToken, queueLimits)
+
+	minReconnectInterval := 10 * time.Second
+	maxReconnectInterval := time.Minute
+	dbListener := pq.NewListener(psqlInfo, minReconnectInterval, maxReconnectInterval, nil)
+	jobScheduler := scheduler.New(dbListener, jobRepo, buildRepo, logsRepo)
+	go func() {
+		err := jobScheduler.Start(ctx)
+		if err != nil {
+			slog.Error("error while scheduling jobs", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}()
+
+	if dashboardCache != nil {
+		invalidator := dashboard.NewInvalidator(pq.NewListener(psqlInfo, minReconnectInterval, maxReconnectInterval, nil), repoRepo, dashboardCache)
+		go func() {
+			err := invalidator.Start(ctx)
+			if err != nil {
+				slog.Error("error while invalidating dashboards", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}()
+	}
+
+	watchdogConfig := watchdog.DefaultConfig()
+	watchdogConfig.BuildTimeout = getenvDuration("BUILD_TIMEOUT", watchdogConfig.BuildTimeout)
+	watchdogConfig.QueueTimeout = getenvDuration("QUEUE_TIMEOUT", watchdogConfig.QueueTimeout)
+	watchdogConfig.JobTimeoutGrace = getenvDuration("JOB_TIMEOUT_GRACE", watchdogConfig.JobTimeoutGrace)
+	watchdogConfig.MaxAttempts = int(getenvInt64("JOB_MAX_ATTEMPTS", int64(watchdogConfig.MaxAttempts)))
+	go func() {
+		err := repoSyncer.Start(ctx)
+		if err != nil {
+			slog.Error("error while syncing repositories", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}()
+
+	// Removed repositories are kept, with their builds, unless
+	// REPO_PURGE_AFTER_DAYS is set.
+	if days := getenvInt64("REPO_PURGE_AFTER_DAYS", 0); days > 0 {
+		purgerConfig := repopurge.DefaultConfig()
+		purgerConfig.After = time.Duration(days) * 24 * time.Hour
+		purger := repopurge.New(repoRepo, logsRepo, blobs, purgerConfig)
+		go func() {
+			err := purger.Start(ctx)
+			if err != nil {
+				slog.Error("error while purging removed repositories", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}()
+	}
+
+	stuckWatchdog := watchdog.New(buildRepo, jobRepo, watchdogConfig)
+	go func() {
+		err := stuckWatchdog.Start(ctx)
+		if err != nil {
+			slog.Error("error while watching for stuck builds", slog.Any("error", err))
+			os.Exit(1)
+		}
+	}()
+
+	if blobs != nil {
+		archiverConfig := logarchive.DefaultConfig()
+		archiverConfig.After = getenvDuration("LOG_ARCHIVE_AFTER", archiverConfig.After)
+		// Archives are redacted, as they are downloaded as they are.
+		archivedLogs := redact.NewReader(logsRepo, logMaskRepo, redactPatterns)
+		archiver := logarchive.New(logArchiveRepo, archivedLogs, logsRepo, blobs, archiverConfig)
+		go func() {
+			err := archiver.Start(ctx)
+			if err != nil {
+				slog.Error("error while archiving logs", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}()
+
+		sweeper := artifact.NewSweeper(artifactRepo, blobs, artifactConfig.SweepInterval)
+		go func() {
+			err := sweeper.Start(ctx)
+			if err != nil {
+				slog.Error("error while sweeping expired artifacts", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}()
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
@@ -126,6 +345,8 @@ func main() {
 	})
 	mux.Handle("/webhook/", http.StripPrefix("/webhook", webhooks.Mux()))
 	mux.Handle("/api/", http.StripPrefix("/api", app.Mux()))
+	mux.Handle("/runner/", http.StripPrefix("/runner", runners.Mux()))
+	mux.Handle("/badge/", http.StripPrefix("/badge", badge.NewHandler(repoRepo, buildRepo).Mux()))
 
 	corsMux := middleware.WithCORS(mux)
 	loggingMux := middleware.WithTrailingSlashes(middleware.WithLogger(corsMux))
@@ -201,3 +422,33 @@ func mustGetenvInt64(varname string) int64 {
 	}
 	return i
 }
+
+// getenvDuration returns the duration in varname, for example "90s" or "6h",
+// or fallback if it's not set.
+func getenvDuration(varname string, fallback time.Duration) time.Duration {
+	value := os.Getenv(varname)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		slog.Error(varname+" env var is not a valid positive duration", slog.Any("error", err))
+		os.Exit(1)
+	}
+	return d
+}
+
+// getenvInt64 returns the positive integer in varname, or fallback if it's not
+// set.
+func getenvInt64(varname string, fallback int64) int64 {
+	value := os.Getenv(varname)
+	if value == "" {
+		return fallback
+	}
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || i <= 0 {
+		slog.Error(varname+" env var is not a valid positive int64", slog.Any("error", err))
+		os.Exit(1)
+	}
+	return i
+}
@@ -0,0 +1,45 @@
+// Package artifact stores files produced by jobs, such as binaries and test
+// reports, in blob storage, and deletes them once they expire.
+package artifact
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// namePattern matches valid artifact names. Names are used as file names of
+// downloads and in blob keys, so they can't contain slashes.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]{0,254}$`)
+
+type Config struct {
+	// Retention is how long artifacts are kept after they're uploaded.
+	// Uploads may ask for a shorter retention, but not for a longer one.
+	Retention time.Duration
+
+	// MaxSize is the largest artifact that can be uploaded, in bytes.
+	MaxSize int64
+
+	// SweepInterval is how often expired artifacts are deleted.
+	SweepInterval time.Duration
+}
+
+// DefaultConfig returns the configuration used when none is configured.
+func DefaultConfig() Config {
+	return Config{
+		Retention:     30 * 24 * time.Hour,
+		MaxSize:       1 << 30,
+		SweepInterval: time.Hour,
+	}
+}
+
+// ValidName reports whether name can be used as the name of an artifact.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Key returns the key of the blob the artifact with name of the job with
+// jobID is stored as.
+func Key(buildID, jobID int64, name string) string {
+	return "artifacts/" + strconv.FormatInt(buildID, 10) + "/" + strconv.FormatInt(jobID, 10) + "/" + name
+}
@@ -0,0 +1,88 @@
+package artifact
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// sweepBatchSize is how many expired artifacts are deleted per query.
+const sweepBatchSize = 100
+
+// Sweeper deletes expired artifacts from blob storage and the database.
+type Sweeper struct {
+	logger       *slog.Logger
+	artifactRepo data.ArtifactRepo
+	blobs        blob.Store
+	interval     time.Duration
+}
+
+func NewSweeper(artifactRepo data.ArtifactRepo, blobs blob.Store, interval time.Duration) *Sweeper {
+	return &Sweeper{
+		logger:       slog.Default().With(slog.String("subsystem", "artifact")),
+		artifactRepo: artifactRepo,
+		blobs:        blobs,
+		interval:     interval,
+	}
+}
+
+// Start starts the sweeper. It is safe to run multiple sweepers against the
+// same database.
+//
+// To shut down the sweeper, cancel the context.
+func (s Sweeper) Start(ctx context.Context) error {
+	s.logger.Info("sweeper started", slog.Duration("interval", s.interval))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("context cancelled, sweeper will stop")
+			return nil
+		case <-ticker.C:
+			err := s.SweepExpired(ctx)
+			if err != nil {
+				s.logger.Error("failed to sweep expired artifacts", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// SweepExpired deletes all artifacts that expired. The blob is deleted before
+// the row, so that no blob is left behind if deleting the row fails.
+func (s Sweeper) SweepExpired(ctx context.Context) error {
+	deleted := 0
+	for {
+		artifacts, err := s.artifactRepo.GetExpired(ctx, time.Now(), sweepBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(artifacts) == 0 {
+			break
+		}
+
+		for _, artifact := range artifacts {
+			err = s.blobs.Delete(ctx, artifact.BlobKey)
+			if err != nil {
+				return fmt.Errorf("delete blob of artifact with id %d: %w", artifact.ID, err)
+			}
+
+			err = s.artifactRepo.Delete(ctx, artifact.ID)
+			if err != nil {
+				return err
+			}
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		s.logger.Debug("expired artifacts deleted", slog.Int("count", deleted))
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Package blob stores opaque binary objects, such as archived logs, under
+// string keys. Keys are slash-separated paths, for example "logs/12.log.gz".
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when no blob with the key exists.
+var ErrNotFound = errors.New("blob not found")
+
+// Object is an opened blob. Seeking is cheap, so it can be passed to
+// [net/http.ServeContent] to serve range requests.
+type Object interface {
+	io.ReadSeekCloser
+
+	Size() int64
+	ModTime() time.Time
+}
+
+type Store interface {
+	// Put stores size bytes read from r under key, replacing the blob with
+	// key if it exists.
+	Put(ctx context.Context, key string, r io.Reader, size int64) (err error)
+
+	// Open opens the blob with key. Returns ErrNotFound if it doesn't exist.
+	Open(ctx context.Context, key string) (object Object, err error)
+
+	// Delete deletes the blob with key. Deleting a blob that doesn't exist is
+	// not an error.
+	Delete(ctx context.Context, key string) (err error)
+}
+
+// validateKey rejects keys that could escape the store, such as "../x".
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FilesystemStore stores blobs as files in a directory.
+type FilesystemStore struct {
+	dir string
+}
+
+func (s FilesystemStore) Put(ctx context.Context, key string, r io.Reader, size int64) (err error) {
+	err = validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	dst := s.path(key)
+	err = os.MkdirAll(filepath.Dir(dst), 0o755)
+	if err != nil {
+		return fmt.Errorf("create blob directory: %w", err)
+	}
+
+	// Write to a temporary file first, so that readers never see a
+	// half-written blob.
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write temporary blob file: %w", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("close temporary blob file: %w", err)
+	}
+	if n != size {
+		return fmt.Errorf("blob %q has %d bytes, expected %d", key, n, size)
+	}
+
+	err = os.Rename(tmp.Name(), dst)
+	if err != nil {
+		return fmt.Errorf("rename temporary blob file: %w", err)
+	}
+
+	return nil
+}
+
+func (s FilesystemStore) Open(ctx context.Context, key string) (Object, error) {
+	err := validateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("open blob file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("stat blob file: %w", err)
+	}
+
+	return fileObject{File: f, info: info}, nil
+}
+
+func (s FilesystemStore) Delete(ctx context.Context, key string) (err error) {
+	err = validateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove blob file: %w", err)
+	}
+
+	return nil
+}
+
+func (s FilesystemStore) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+type fileObject struct {
+	*os.File
+	info fs.FileInfo
+}
+
+func (o fileObject) Size() int64 {
+	return o.info.Size()
+}
+
+func (o fileObject) ModTime() time.Time {
+	return o.info.ModTime()
+}
+
+var _ Store = FilesystemStore{}
+
+// NewFilesystemStore returns a store that keeps blobs in dir, which is
+// created if it doesn't exist.
+func NewFilesystemStore(dir string) (*FilesystemStore, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("create blob directory: %w", err)
+	}
+
+	return &FilesystemStore{dir: dir}, nil
+}
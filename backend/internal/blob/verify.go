@@ -0,0 +1,45 @@
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrChecksumMismatch is returned by a [VerifyingReader] if the content
+// doesn't match the expected checksum.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// VerifyingReader computes the SHA-256 checksum of the content read through
+// it. If an expected checksum is given, reading the end of content that
+// doesn't match it fails with ErrChecksumMismatch instead of io.EOF, so that
+// [Store.Put] discards the blob.
+type VerifyingReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+// NewVerifyingReader returns a reader that reads from r and verifies the
+// content against expected, the hex-encoded SHA-256 checksum. The content is
+// not verified if expected is empty.
+func NewVerifyingReader(r io.Reader, expected string) *VerifyingReader {
+	return &VerifyingReader{r: r, hash: sha256.New(), expected: expected}
+}
+
+func (v *VerifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	if errors.Is(err, io.EOF) && v.expected != "" && v.Sum() != v.expected {
+		return n, fmt.Errorf("%w: got %s, expected %s", ErrChecksumMismatch, v.Sum(), v.expected)
+	}
+	return n, err
+}
+
+// Sum returns the hex-encoded SHA-256 checksum of the content read so far.
+func (v *VerifyingReader) Sum() string {
+	return hex.EncodeToString(v.hash.Sum(nil))
+}
@@ -0,0 +1,86 @@
+// Package buildstate defines the statuses of builds and jobs, and which
+// changes between them are legal. Completed builds and jobs never change
+// status again, so late updates, for example from a runner that lost its
+// lease, can't revive them.
+package buildstate
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Statuses of builds and jobs. Only jobs can be pending.
+const (
+	Pending    = "pending"
+	Queued     = "queued"
+	InProgress = "in_progress"
+	Completed  = "completed"
+)
+
+// buildTransitions maps the status of a build to the statuses it can change
+// to. A build is in progress once any of its jobs started, and completed
+// once all of them completed or it was timed out.
+var buildTransitions = map[string][]string{
+	Queued:     {InProgress, Completed},
+	InProgress: {Completed},
+}
+
+// jobTransitions maps the status of a job to the statuses it can change to. A
+// job is pending until the jobs it depends on completed. Jobs in progress
+// return to the queue when their lease expires.
+var jobTransitions = map[string][]string{
+	Pending:    {Queued, Completed},
+	Queued:     {InProgress, Completed},
+	InProgress: {Queued, Completed},
+}
+
+// CanChangeBuild reports whether a build can change from status from to
+// status to.
+func CanChangeBuild(from, to string) bool {
+	return slices.Contains(buildTransitions[from], to)
+}
+
+// CanChangeJob reports whether a job can change from status from to status to.
+func CanChangeJob(from, to string) bool {
+	return slices.Contains(jobTransitions[from], to)
+}
+
+// BuildStatusesBefore returns the statuses a build can change to status to
+// from.
+func BuildStatusesBefore(to string) []string {
+	return statusesBefore(buildTransitions, to)
+}
+
+// JobStatusesBefore returns the statuses a job can change to status to from.
+func JobStatusesBefore(to string) []string {
+	return statusesBefore(jobTransitions, to)
+}
+
+func statusesBefore(transitions map[string][]string, to string) []string {
+	from := make([]string, 0)
+	for status, next := range transitions {
+		if slices.Contains(next, to) {
+			from = append(from, status)
+		}
+	}
+	slices.Sort(from)
+	return from
+}
+
+// ConflictError is returned when a build or job can't change to a status
+// because of the status it has, usually because it changed concurrently.
+type ConflictError struct {
+	// Kind is "build" or "job".
+	Kind string
+	ID   int64
+
+	// Status is the status the build or job has.
+	Status string
+
+	// To is the status it was asked to change to.
+	To string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s with id %d can't change from %s to %s", e.Kind, e.ID, e.Status, e.To)
+}
@@ -0,0 +1,209 @@
+// Package cache stores dependency caches, such as tarballs of node_modules,
+// that jobs save and restore to speed up later builds.
+//
+// Entries are scoped to a repository and branch. Builds restore the entries
+// of their own branch, falling back to those of the default branch. An entry
+// is saved under a key, usually derived from the hash of a lock file, and is
+// never replaced. If no entry matches the key exactly, the newest entry
+// whose key starts with one of the restore keys is restored instead.
+//
+// Once the entries of a repository exceed its size limit, the least recently
+// used ones are evicted.
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// ErrTooLarge is returned when saving an entry larger than the size limit of
+// a repository.
+var ErrTooLarge = errors.New("cache entry too large")
+
+// keyPattern matches valid keys: up to 512 printable ASCII characters other
+// than spaces.
+var keyPattern = regexp.MustCompile(`^[!-~]{1,512}$`)
+
+type Config struct {
+	// MaxSizePerRepo is how many bytes the entries of a repository may take up
+	// in total.
+	MaxSizePerRepo int64
+}
+
+// DefaultConfig returns the configuration used when none is configured.
+func DefaultConfig() Config {
+	return Config{
+		MaxSizePerRepo: 10 << 30,
+	}
+}
+
+// ValidKey reports whether key can be used as a key or restore key.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+type Store struct {
+	logger    *slog.Logger
+	cacheRepo data.CacheRepo
+	blobs     blob.Store
+	config    Config
+}
+
+func New(cacheRepo data.CacheRepo, blobs blob.Store, config Config) *Store {
+	return &Store{
+		logger:    slog.Default().With(slog.String("subsystem", "cache")),
+		cacheRepo: cacheRepo,
+		blobs:     blobs,
+		config:    config,
+	}
+}
+
+// Find returns the entry to restore for a build of the repository with
+// repoID. Each of branches is searched in turn, first for an entry with key,
+// then for the newest entry whose key starts with one of restoreKeys, in
+// order. exact reports whether the entry matched key exactly.
+//
+// Returns data.ErrNotFound if no entry matches.
+func (s *Store) Find(ctx context.Context, repoID int64, branches []string, key string, restoreKeys []string) (entry *data.CacheEntry, exact bool, err error) {
+	for _, branch := range branches {
+		entry, err = s.cacheRepo.Get(ctx, repoID, branch, key)
+		if err == nil {
+			return entry, true, nil
+		}
+		if !errors.Is(err, data.ErrNotFound) {
+			return nil, false, err
+		}
+
+		for _, restoreKey := range restoreKeys {
+			entry, err = s.cacheRepo.GetLatestWithPrefix(ctx, repoID, branch, restoreKey)
+			if err == nil {
+				return entry, entry.Key == key, nil
+			}
+			if !errors.Is(err, data.ErrNotFound) {
+				return nil, false, err
+			}
+		}
+	}
+
+	return nil, false, data.ErrNotFound
+}
+
+// Open opens the content of entry, and marks it as used.
+func (s *Store) Open(ctx context.Context, entry data.CacheEntry) (blob.Object, error) {
+	object, err := s.blobs.Open(ctx, entry.BlobKey)
+	if err != nil {
+		return nil, fmt.Errorf("open cache entry: %w", err)
+	}
+
+	err = s.cacheRepo.Touch(ctx, entry.ID)
+	if err != nil {
+		_ = object.Close()
+		return nil, err
+	}
+
+	return object, nil
+}
+
+// Save saves size bytes read from r under key in the branch of the repository
+// with repoID. If checksum is not empty, content that doesn't match it is
+// rejected with blob.ErrChecksumMismatch.
+//
+// Returns data.ErrAlreadyExists if the branch has an entry with key already,
+// and ErrTooLarge if the entry exceeds the size limit of the repository.
+func (s *Store) Save(ctx context.Context, repoID int64, branch, key string, r io.Reader, size int64, checksum string) (*data.CacheEntry, error) {
+	if size > s.config.MaxSizePerRepo {
+		return nil, ErrTooLarge
+	}
+
+	// Don't upload content that would be thrown away.
+	_, err := s.cacheRepo.Get(ctx, repoID, branch, key)
+	if err == nil {
+		return nil, data.ErrAlreadyExists
+	}
+	if !errors.Is(err, data.ErrNotFound) {
+		return nil, err
+	}
+
+	// Concurrent saves of the same key each upload to their own blob, so
+	// that the losers can't overwrite the content of the winner.
+	blobKey, err := newBlobKey(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	content := blob.NewVerifyingReader(r, checksum)
+	err = s.blobs.Put(ctx, blobKey, content, size)
+	if err != nil {
+		return nil, fmt.Errorf("upload cache entry: %w", err)
+	}
+
+	entry := data.CacheEntry{
+		RepoID:  repoID,
+		Branch:  branch,
+		Key:     key,
+		BlobKey: blobKey,
+		Size:    size,
+		SHA256:  content.Sum(),
+	}
+	entry.ID, err = s.cacheRepo.Create(ctx, entry)
+	if err != nil {
+		deleteErr := s.blobs.Delete(ctx, blobKey)
+		if deleteErr != nil {
+			s.logger.Error("failed to delete unused cache blob", slog.String("blob_key", blobKey), slog.Any("error", deleteErr))
+		}
+		return nil, err
+	}
+
+	s.evict(ctx, repoID)
+
+	return &entry, nil
+}
+
+// evict deletes the least recently used entries of the repository with
+// repoID until the rest fit in its size limit. Errors are logged, as the
+// next save evicts again.
+func (s *Store) evict(ctx context.Context, repoID int64) {
+	entries, err := s.cacheRepo.GetEvictable(ctx, repoID, s.config.MaxSizePerRepo)
+	if err != nil {
+		s.logger.Error("failed to get cache entries to evict", slog.Int64("repo_id", repoID), slog.Any("error", err))
+		return
+	}
+
+	for _, entry := range entries {
+		// The row is deleted first, so that the entry is never restored from
+		// a deleted blob. A blob left behind is only wasted space.
+		err = s.cacheRepo.Delete(ctx, entry.ID)
+		if err != nil {
+			s.logger.Error("failed to evict cache entry", slog.Int64("id", entry.ID), slog.Any("error", err))
+			return
+		}
+
+		err = s.blobs.Delete(ctx, entry.BlobKey)
+		if err != nil {
+			s.logger.Error("failed to delete blob of evicted cache entry", slog.String("blob_key", entry.BlobKey), slog.Any("error", err))
+		}
+	}
+
+	if len(entries) > 0 {
+		s.logger.Debug("cache entries evicted", slog.Int64("repo_id", repoID), slog.Int("count", len(entries)))
+	}
+}
+
+func newBlobKey(repoID int64) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generate cache blob key: %w", err)
+	}
+	return "caches/" + strconv.FormatInt(repoID, 10) + "/" + hex.EncodeToString(b), nil
+}
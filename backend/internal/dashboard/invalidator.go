@@ -0,0 +1,83 @@
+// Package dashboard keeps cached dashboards up to date.
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/lib/pq"
+
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+const channelName = "builds_channel"
+
+// Invalidator listens the database for build updates and invalidates the
+// cached dashboards of the owners of the builds' repositories.
+type Invalidator struct {
+	logger     *slog.Logger
+	dbListener *pq.Listener
+	repoRepo   data.RepoRepo
+	cache      *data.RedisCachedDashboardRepo
+}
+
+func NewInvalidator(dbListener *pq.Listener, repoRepo data.RepoRepo, cache *data.RedisCachedDashboardRepo) *Invalidator {
+	return &Invalidator{
+		logger:     slog.Default().With(slog.String("subsystem", "dashboard")),
+		dbListener: dbListener,
+		repoRepo:   repoRepo,
+		cache:      cache,
+	}
+}
+
+// Start starts the invalidator.
+//
+// To shut down the invalidator, cancel the context.
+func (i Invalidator) Start(ctx context.Context) error {
+	err := i.dbListener.Listen(channelName)
+	if err != nil {
+		return fmt.Errorf("listen on channel %s: %w", channelName, err)
+	}
+
+	i.logger.Info("invalidator started, listens to db changes", slog.String("channel", channelName))
+
+	for {
+		select {
+		case <-ctx.Done():
+			i.logger.Debug("context cancelled, db listener will be closed")
+			err = i.dbListener.Close()
+			if err != nil {
+				i.logger.Error("failed to close db listener", slog.Any("error", err))
+				return err
+			}
+			return nil
+		case msg := <-i.dbListener.Notify:
+			if msg == nil {
+				// The connection was re-established. Notifications sent in the
+				// meantime are lost, so the dashboards may be stale until they
+				// expire.
+				continue
+			}
+
+			updatedBuild := data.Build{}
+			err := json.Unmarshal([]byte(msg.Extra), &updatedBuild)
+			if err != nil {
+				i.logger.Error("db listener got notification but it failed to unmarshal build", slog.Any("error", err))
+				break
+			}
+
+			repo, err := i.repoRepo.Get(ctx, updatedBuild.RepoID)
+			if err != nil {
+				i.logger.Error("failed to get repo of build", slog.Int64("build_id", updatedBuild.ID), slog.Any("error", err))
+				break
+			}
+
+			err = i.cache.Invalidate(ctx, repo.UserID)
+			if err != nil {
+				i.logger.Error("failed to invalidate dashboard", slog.Int64("user_id", repo.UserID), slog.Any("error", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Granularities are the sizes of the time buckets that analytics can be
+// grouped by, as understood by date_trunc.
+var Granularities = []string{"hour", "day", "week", "month"}
+
+// AnalyticsQuery selects the builds that analytics are computed over: the
+// builds of the user's repositories that were created in [From, To).
+type AnalyticsQuery struct {
+	// RepoID is 0 for all repositories of the user.
+	RepoID int64
+
+	// Branch is empty for all branches.
+	Branch string
+
+	From time.Time
+	To   time.Time
+
+	// Granularity is one of Granularities. It's only used by analytics that
+	// are grouped by time.
+	Granularity string
+}
+
+// SuccessRateBucket counts the completed builds created in the bucket that
+// starts at Start.
+type SuccessRateBucket struct {
+	Start      time.Time `db:"start"`
+	Total      int       `db:"total"`
+	Successful int       `db:"successful"`
+
+	// Failed counts builds that failed or timed out. Builds that were
+	// canceled are neither successful nor failed.
+	Failed int `db:"failed"`
+}
+
+// DurationBucket holds the percentiles of how long the completed builds
+// created in the bucket that starts at Start waited in the queue and ran, in
+// seconds. Percentiles are nil if no build in the bucket started.
+type DurationBucket struct {
+	Start  time.Time `db:"start"`
+	Builds int       `db:"builds"`
+
+	QueueP50 *float64 `db:"queue_p50"`
+	QueueP90 *float64 `db:"queue_p90"`
+	QueueP99 *float64 `db:"queue_p99"`
+	RunP50   *float64 `db:"run_p50"`
+	RunP90   *float64 `db:"run_p90"`
+	RunP99   *float64 `db:"run_p99"`
+}
+
+// JobFailures counts the failures of the jobs with the same name in a
+// repository. Jobs of a matrix are counted under the name of the matrix.
+type JobFailures struct {
+	RepoID   int64  `db:"repo_id"`
+	RepoName string `db:"repo_name"`
+	JobName  string `db:"job_name"`
+	Runs     int    `db:"runs"`
+	Failures int    `db:"failures"`
+
+	// Share is the fraction of all failures in the query that are failures
+	// of this job.
+	Share        float64   `db:"share"`
+	LastFailedAt time.Time `db:"last_failed_at"`
+}
+
+// Recovery describes how quickly builds on a branch of a repository went
+// from failing back to passing. A branch is failing from when a build
+// completes with a failure until a build completes successfully.
+type Recovery struct {
+	RepoID   int64  `db:"repo_id"`
+	RepoName string `db:"repo_name"`
+	Branch   string `db:"branch"`
+
+	// Failures is how many times the branch started failing, and Recoveries
+	// how many of those times it passed again.
+	Failures   int `db:"failures"`
+	Recoveries int `db:"recoveries"`
+
+	// MeanSeconds is the mean time to recovery. Nil if the branch never
+	// recovered.
+	MeanSeconds *float64 `db:"mean_seconds"`
+
+	// FailingSince is when the branch started failing, if it's still
+	// failing.
+	FailingSince *time.Time `db:"failing_since"`
+}
+
+type AnalyticsRepo interface {
+	// SuccessRates returns the counts of completed builds per bucket of
+	// q.Granularity, oldest first. Buckets without builds are included.
+	SuccessRates(ctx context.Context, userID int64, q AnalyticsQuery) (buckets []SuccessRateBucket, err error)
+
+	// Durations returns the percentiles of queue and run durations of
+	// completed builds per bucket of q.Granularity, oldest first. Buckets
+	// without builds are included.
+	Durations(ctx context.Context, userID int64, q AnalyticsQuery) (buckets []DurationBucket, err error)
+
+	// JobFailures returns the jobs that failed or timed out at least once,
+	// most failures first.
+	JobFailures(ctx context.Context, userID int64, q AnalyticsQuery) (failures []JobFailures, err error)
+
+	// Recovery returns the recovery of every branch that failed at least
+	// once, slowest to recover first. Failures that started before q.From
+	// are counted from the first build in the range.
+	Recovery(ctx context.Context, userID int64, q AnalyticsQuery) (recoveries []Recovery, err error)
+}
+
+// analyticsBuildsQuery selects the builds of AnalyticsQuery, with their
+// repository's name. Its parameters are userID, From, To, RepoID and Branch.
+const analyticsBuildsQuery = `
+	SELECT builds.*, repos.name AS repo_name
+	FROM bee_schema.builds builds
+	JOIN bee_schema.repos repos ON builds.repo_id = repos.id
+	WHERE repos.user_id = $1 AND repos.removed_at IS NULL
+	  AND builds.created_at >= $2 AND builds.created_at < $3
+	  AND ($4::bigint = 0 OR builds.repo_id = $4)
+	  AND ($5::text = '' OR builds.branch = $5)
+	  AND builds.status = 'completed'
+`
+
+// analyticsBucketsQuery generates the start of every bucket of AnalyticsQuery.
+// Its parameters are those of analyticsBuildsQuery, then Granularity.
+const analyticsBucketsQuery = `
+	SELECT generate_series(
+		date_trunc($6::text, $2::timestamptz),
+		$3::timestamptz - INTERVAL '1 microsecond',
+		('1 ' || $6::text)::interval
+	) AS start
+`
+
+type PostgresAnalyticsRepo struct {
+	db *sqlx.DB
+}
+
+var _ AnalyticsRepo = &PostgresAnalyticsRepo{}
+
+func NewPostgresAnalyticsRepo(db *sqlx.DB) *PostgresAnalyticsRepo {
+	return &PostgresAnalyticsRepo{db: db}
+}
+
+func (p PostgresAnalyticsRepo) SuccessRates(ctx context.Context, userID int64, q AnalyticsQuery) ([]SuccessRateBucket, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("AnalyticsRepo.SuccessRates", slog.Any("userID", userID), slog.Any("query", q))
+
+	buckets := make([]SuccessRateBucket, 0)
+	err := p.db.SelectContext(ctx, &buckets, `
+		WITH buckets AS (`+analyticsBucketsQuery+`),
+		builds AS (`+analyticsBuildsQuery+`)
+		SELECT buckets.start,
+		       COUNT(builds.id) AS total,
+		       COUNT(builds.id) FILTER (WHERE builds.conclusion = 'success') AS successful,
+		       COUNT(builds.id) FILTER (WHERE builds.conclusion IN ('failure', 'timed_out')) AS failed
+		FROM buckets
+		LEFT JOIN builds ON date_trunc($6::text, builds.created_at) = buckets.start
+		GROUP BY buckets.start
+		ORDER BY buckets.start
+	`, userID, q.From, q.To, q.RepoID, q.Branch, q.Granularity)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for success rates of userID %d: %v", userID, err)
+	}
+
+	return buckets, nil
+}
+
+func (p PostgresAnalyticsRepo) Durations(ctx context.Context, userID int64, q AnalyticsQuery) ([]DurationBucket, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("AnalyticsRepo.Durations", slog.Any("userID", userID), slog.Any("query", q))
+
+	// A build starts when its first job starts, and runs until it's
+	// completed, as in the queue's estimates.
+	buckets := make([]DurationBucket, 0)
+	err := p.db.SelectContext(ctx, &buckets, `
+		WITH buckets AS (`+analyticsBucketsQuery+`),
+		builds AS (`+analyticsBuildsQuery+`),
+		durations AS (
+			SELECT date_trunc($6::text, builds.created_at) AS start,
+			       EXTRACT(EPOCH FROM MIN(jobs.started_at) - builds.created_at)::float8 AS queue_seconds,
+			       EXTRACT(EPOCH FROM builds.updated_at - MIN(jobs.started_at))::float8 AS run_seconds
+			FROM builds
+			JOIN bee_schema.jobs jobs ON jobs.build_id = builds.id
+			WHERE jobs.started_at IS NOT NULL
+			GROUP BY builds.id, builds.created_at, builds.updated_at
+		)
+		SELECT buckets.start,
+		       COUNT(durations.start) AS builds,
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY durations.queue_seconds) AS queue_p50,
+		       percentile_cont(0.9) WITHIN GROUP (ORDER BY durations.queue_seconds) AS queue_p90,
+		       percentile_cont(0.99) WITHIN GROUP (ORDER BY durations.queue_seconds) AS queue_p99,
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY durations.run_seconds) AS run_p50,
+		       percentile_cont(0.9) WITHIN GROUP (ORDER BY durations.run_seconds) AS run_p90,
+		       percentile_cont(0.99) WITHIN GROUP (ORDER BY durations.run_seconds) AS run_p99
+		FROM buckets
+		LEFT JOIN durations ON durations.start = buckets.start
+		GROUP BY buckets.start
+		ORDER BY buckets.start
+	`, userID, q.From, q.To, q.RepoID, q.Branch, q.Granularity)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for durations of userID %d: %v", userID, err)
+	}
+
+	return buckets, nil
+}
+
+func (p PostgresAnalyticsRepo) JobFailures(ctx context.Context, userID int64, q AnalyticsQuery) ([]JobFailures, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("AnalyticsRepo.JobFailures", slog.Any("userID", userID), slog.Any("query", q))
+
+	failures := make([]JobFailures, 0)
+	err := p.db.SelectContext(ctx, &failures, `
+		WITH builds AS (`+analyticsBuildsQuery+`)
+		SELECT builds.repo_id, builds.repo_name, jobs.parent_name AS job_name,
+		       COUNT(*) AS runs,
+		       COUNT(*) FILTER (WHERE jobs.conclusion IN ('failure', 'timed_out')) AS failures,
+		       COUNT(*) FILTER (WHERE jobs.conclusion IN ('failure', 'timed_out'))::float8
+		           / SUM(COUNT(*) FILTER (WHERE jobs.conclusion IN ('failure', 'timed_out'))) OVER () AS share,
+		       MAX(jobs.updated_at) FILTER (WHERE jobs.conclusion IN ('failure', 'timed_out')) AS last_failed_at
+		FROM builds
+		JOIN bee_schema.jobs jobs ON jobs.build_id = builds.id
+		WHERE jobs.status = 'completed'
+		GROUP BY builds.repo_id, builds.repo_name, jobs.parent_name
+		HAVING COUNT(*) FILTER (WHERE jobs.conclusion IN ('failure', 'timed_out')) > 0
+		ORDER BY failures DESC, runs DESC, builds.repo_name, job_name
+	`, userID, q.From, q.To, q.RepoID, q.Branch)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for job failures of userID %d: %v", userID, err)
+	}
+
+	return failures, nil
+}
+
+func (p PostgresAnalyticsRepo) Recovery(ctx context.Context, userID int64, q AnalyticsQuery) ([]Recovery, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("AnalyticsRepo.Recovery", slog.Any("userID", userID), slog.Any("query", q))
+
+	// Builds of each branch are ordered by when they completed. A failure
+	// after a success (or first) starts a streak, which is numbered by
+	// counting the streaks started so far. The success that ends a streak
+	// gets its number too, so the streak's first failure is in its window.
+	// Canceled builds neither fail nor recover a branch.
+	recoveries := make([]Recovery, 0)
+	err := p.db.SelectContext(ctx, &recoveries, `
+		WITH builds AS (`+analyticsBuildsQuery+`),
+		outcomes AS (
+			SELECT builds.id, builds.repo_id, builds.repo_name, builds.branch, builds.updated_at AS completed_at,
+			       builds.conclusion IN ('failure', 'timed_out') AS failed
+			FROM builds
+			WHERE builds.conclusion IN ('success', 'failure', 'timed_out')
+		),
+		changes AS (
+			SELECT outcomes.*,
+			       COALESCE(LAG(outcomes.failed) OVER per_branch, FALSE) AS previously_failed
+			FROM outcomes
+			WINDOW per_branch AS (PARTITION BY outcomes.repo_id, outcomes.branch ORDER BY outcomes.completed_at, outcomes.id)
+		),
+		streaks AS (
+			SELECT changes.*,
+			       SUM(CASE WHEN changes.failed AND NOT changes.previously_failed THEN 1 ELSE 0 END) OVER per_branch AS streak
+			FROM changes
+			WINDOW per_branch AS (PARTITION BY changes.repo_id, changes.branch ORDER BY changes.completed_at, changes.id)
+		),
+		recoveries AS (
+			SELECT streaks.*,
+			       MIN(streaks.completed_at) FILTER (WHERE streaks.failed)
+			           OVER (PARTITION BY streaks.repo_id, streaks.branch, streaks.streak) AS failed_at
+			FROM streaks
+		)
+		SELECT recoveries.repo_id, recoveries.repo_name, recoveries.branch,
+		       COUNT(*) FILTER (WHERE recoveries.failed AND NOT recoveries.previously_failed) AS failures,
+		       COUNT(*) FILTER (WHERE NOT recoveries.failed AND recoveries.previously_failed) AS recoveries,
+		       AVG(EXTRACT(EPOCH FROM recoveries.completed_at - recoveries.failed_at)::float8)
+		           FILTER (WHERE NOT recoveries.failed AND recoveries.previously_failed) AS mean_seconds,
+		       (ARRAY_AGG(CASE WHEN recoveries.failed THEN recoveries.failed_at END
+		                  ORDER BY recoveries.completed_at DESC, recoveries.id DESC))[1] AS failing_since
+		FROM recoveries
+		GROUP BY recoveries.repo_id, recoveries.repo_name, recoveries.branch
+		HAVING COUNT(*) FILTER (WHERE recoveries.failed) > 0
+		ORDER BY mean_seconds DESC NULLS FIRST, recoveries.repo_name, recoveries.branch
+	`, userID, q.From, q.To, q.RepoID, q.Branch)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for recovery of userID %d: %v", userID, err)
+	}
+
+	return recoveries, nil
+}
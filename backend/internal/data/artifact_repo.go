@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Artifact represents a row in the "artifacts" table.
+type Artifact struct {
+	ID      int64  `db:"id"`
+	BuildID int64  `db:"build_id"`
+	JobID   int64  `db:"job_id"`
+	Name    string `db:"name"`
+	BlobKey string `db:"blob_key"`
+	Size    int64  `db:"size"`
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the content.
+	SHA256 string `db:"sha256"`
+
+	CreatedAt time.Time `db:"created_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+type ArtifactRepo interface {
+	// Put records the artifact, replacing the artifact of the job with the
+	// same name if it exists.
+	Put(ctx context.Context, artifact Artifact) (id int64, err error)
+
+	// GetAll returns the artifacts of the build with buildID that haven't
+	// expired, ordered by job and name.
+	GetAll(ctx context.Context, buildID int64) (artifacts []Artifact, err error)
+
+	// Get returns the artifact with id of the build with buildID, if it
+	// hasn't expired.
+	Get(ctx context.Context, buildID, id int64) (artifact *Artifact, err error)
+
+	// GetExpired returns up to limit artifacts that expired before now.
+	GetExpired(ctx context.Context, now time.Time, limit int) (artifacts []Artifact, err error)
+
+	// Delete deletes the artifact with id.
+	Delete(ctx context.Context, id int64) (err error)
+}
+
+type PostgresArtifactRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresArtifactRepo) Put(ctx context.Context, artifact Artifact) (id int64, err error) {
+	err = p.db.GetContext(ctx, &id, `
+		INSERT INTO bee_schema.artifacts (build_id, job_id, name, blob_key, size, sha256, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (job_id, name) DO UPDATE
+		SET blob_key = excluded.blob_key,
+		    size = excluded.size,
+		    sha256 = excluded.sha256,
+		    created_at = CURRENT_TIMESTAMP,
+		    expires_at = excluded.expires_at
+		RETURNING id
+	`, artifact.BuildID, artifact.JobID, artifact.Name, artifact.BlobKey, artifact.Size, artifact.SHA256, artifact.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("executing INSERT query: %v", err)
+	}
+
+	return id, nil
+}
+
+func (p PostgresArtifactRepo) GetAll(ctx context.Context, buildID int64) (artifacts []Artifact, err error) {
+	artifacts = make([]Artifact, 0)
+	err = p.db.SelectContext(ctx, &artifacts, `
+		SELECT *
+		FROM bee_schema.artifacts
+		WHERE build_id = $1 AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY job_id, name
+	`, buildID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from artifacts: %v", err)
+	}
+
+	return artifacts, nil
+}
+
+func (p PostgresArtifactRepo) Get(ctx context.Context, buildID, id int64) (*Artifact, error) {
+	artifact := Artifact{}
+	err := p.db.GetContext(ctx, &artifact, `
+		SELECT *
+		FROM bee_schema.artifacts
+		WHERE id = $1 AND build_id = $2 AND expires_at > CURRENT_TIMESTAMP
+	`, id, buildID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from artifacts: %v", err)
+	}
+
+	return &artifact, nil
+}
+
+func (p PostgresArtifactRepo) GetExpired(ctx context.Context, now time.Time, limit int) (artifacts []Artifact, err error) {
+	artifacts = make([]Artifact, 0)
+	err = p.db.SelectContext(ctx, &artifacts, `
+		SELECT *
+		FROM bee_schema.artifacts
+		WHERE expires_at <= $1
+		ORDER BY expires_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from artifacts: %v", err)
+	}
+
+	return artifacts, nil
+}
+
+func (p PostgresArtifactRepo) Delete(ctx context.Context, id int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `DELETE FROM bee_schema.artifacts WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("executing DELETE query: %v", err)
+	}
+
+	return nil
+}
+
+var _ ArtifactRepo = &PostgresArtifactRepo{}
+
+func NewPostgresArtifactRepo(db *sqlx.DB) *PostgresArtifactRepo {
+	return &PostgresArtifactRepo{db: db}
+}
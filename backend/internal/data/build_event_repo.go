@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Types of build events.
+const (
+	// BuildQueued is recorded when the build is created. Its actor is the
+	// GitHub user who triggered the build.
+	BuildQueued = "queued"
+
+	// BuildStarted is recorded when the first job of the build starts.
+	BuildStarted = "started"
+
+	// BuildCancelRequested is recorded when the build is asked to stop before
+	// its jobs completed, for example by the watchdog.
+	BuildCancelRequested = "cancel_requested"
+
+	// BuildCompleted is recorded with the conclusion of the build.
+	BuildCompleted = "completed"
+
+	// JobQueued is recorded when the job is released to the queue, including
+	// when it's returned to it after its lease expired.
+	JobQueued = "job_queued"
+
+	// JobClaimed is recorded when a runner claims the job, which starts it.
+	JobClaimed = "job_claimed"
+
+	// JobStarted is recorded when the job is started without being claimed.
+	JobStarted = "job_started"
+
+	// JobCompleted is recorded with the conclusion of the job.
+	JobCompleted = "job_completed"
+)
+
+// BuildEvent represents a row in the "build_events" table.
+type BuildEvent struct {
+	ID      int64  `db:"id"`
+	BuildID int64  `db:"build_id"`
+	JobID   *int64 `db:"job_id"`
+
+	// RunnerID is set for events caused by a runner.
+	RunnerID *int64 `db:"runner_id"`
+
+	Type string `db:"type"`
+
+	// Actor is who caused the event, if it isn't a runner or the system
+	// itself.
+	Actor string `db:"actor"`
+
+	// Conclusion is set for BuildCompleted and JobCompleted events.
+	Conclusion *string `db:"conclusion"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// FatBuildEvent is a BuildEvent with the names of its job and runner.
+type FatBuildEvent struct {
+	BuildEvent
+	JobName    *string `db:"job_name"`
+	RunnerName *string `db:"runner_name"`
+}
+
+type BuildEventRepo interface {
+	// Create records an event that doesn't change the state of the build.
+	// Events of state changes are recorded by BuildRepo and JobRepo.
+	Create(ctx context.Context, event BuildEvent) (err error)
+
+	// GetAll returns the events of the build with buildID in the order they
+	// were recorded.
+	GetAll(ctx context.Context, buildID int64) (events []FatBuildEvent, err error)
+}
+
+type PostgresBuildEventRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresBuildEventRepo) Create(ctx context.Context, event BuildEvent) (err error) {
+	return insertBuildEvents(ctx, p.db, event)
+}
+
+func (p PostgresBuildEventRepo) GetAll(ctx context.Context, buildID int64) (events []FatBuildEvent, err error) {
+	events = make([]FatBuildEvent, 0)
+	err = p.db.SelectContext(ctx, &events, `
+		SELECT build_events.*, jobs.name AS job_name, runners.name AS runner_name
+		FROM bee_schema.build_events build_events
+		LEFT JOIN bee_schema.jobs jobs ON jobs.id = build_events.job_id
+		LEFT JOIN bee_schema.runners runners ON runners.id = build_events.runner_id
+		WHERE build_events.build_id = $1
+		ORDER BY build_events.id
+	`, buildID)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for buildID %d: %v", buildID, err)
+	}
+
+	return events, nil
+}
+
+var _ BuildEventRepo = &PostgresBuildEventRepo{}
+
+func NewPostgresBuildEventRepo(db *sqlx.DB) *PostgresBuildEventRepo {
+	return &PostgresBuildEventRepo{db: db}
+}
+
+// insertBuildEvents records events, usually within the transaction that
+// makes the state changes they describe.
+func insertBuildEvents(ctx context.Context, db sqlx.ExecerContext, events ...BuildEvent) error {
+	for _, event := range events {
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO bee_schema.build_events (build_id, job_id, runner_id, type, actor, conclusion)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, event.BuildID, event.JobID, event.RunnerID, event.Type, event.Actor, event.Conclusion)
+		if err != nil {
+			return fmt.Errorf("inserting %s event of build %d: %v", event.Type, event.BuildID, err)
+		}
+	}
+
+	return nil
+}
+
+// buildStatusEvent returns the event recorded when a build changes to status,
+// or an empty type if none is.
+func buildStatusEvent(buildID int64, status string, conclusion *string) BuildEvent {
+	event := BuildEvent{BuildID: buildID}
+	switch status {
+	case "in_progress":
+		event.Type = BuildStarted
+	case "completed":
+		event.Type = BuildCompleted
+		event.Conclusion = conclusion
+	}
+	return event
+}
+
+// jobStatusEvent returns the event recorded when a job changes to status, or
+// an empty type if none is.
+func jobStatusEvent(job Job, status string, conclusion *string) BuildEvent {
+	event := BuildEvent{BuildID: job.BuildID, JobID: &job.ID}
+	switch status {
+	case "queued":
+		event.Type = JobQueued
+	case "in_progress":
+		event.Type = JobStarted
+	case "completed":
+		event.Type = JobCompleted
+		event.Conclusion = conclusion
+	}
+	return event
+}
@@ -6,10 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
 	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type NewBuild struct {
@@ -17,22 +21,45 @@ type NewBuild struct {
 	CommitSHA      string
 	CommitMsg      string
 	InstallationID int64
+	Branch         string
+	Event          string // for example "push" or "pull_request"
+	Labels         []string
+	Inputs         StringMap
+	Priority       int // see package queue
+
+	// FromFork is true for builds of pull requests from forks.
+	FromFork bool
+
+	// Actor is the login of the GitHub user who triggered the build.
+	Actor string
+
+	// Jobs are created together with the build. All jobs start as "pending"
+	// and wait until they are released to the queue by the scheduler.
+	Jobs []NewJob
 }
 
 // Build represents a row in the "builds" table.
 //
 // The JSON struct tags are only to be used when receiving a row from LISTEN/NOTIFY.
 type Build struct {
-	ID             int64     `db:"id" json:"id"`
-	RepoID         int64     `db:"repo_id" json:"repo_id"`
-	CommitSHA      string    `db:"commit_sha" json:"commit_sha"`
-	CommitMsg      string    `db:"commit_message" json:"commit_message"`
-	InstallationID int64     `db:"installation_id" json:"installation_id"`
-	CheckRunID     *int64    `db:"check_run_id" json:"check_run_id"`
-	Status         string    `db:"status" json:"status"`
-	Conclusion     *string   `db:"conclusion" json:"conclusion"`
-	CreatedAt      time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt      time.Time `db:"updated_at" json:"updated_at"`
+	ID             int64          `db:"id" json:"id"`
+	Number         int64          `db:"number" json:"number"` // increases per repository, starting at 1
+	RepoID         int64          `db:"repo_id" json:"repo_id"`
+	CommitSHA      string         `db:"commit_sha" json:"commit_sha"`
+	CommitMsg      string         `db:"commit_message" json:"commit_message"`
+	InstallationID int64          `db:"installation_id" json:"installation_id"`
+	CheckRunID     *int64         `db:"check_run_id" json:"check_run_id"`
+	Status         string         `db:"status" json:"status"`
+	Conclusion     *string        `db:"conclusion" json:"conclusion"`
+	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time      `db:"updated_at" json:"updated_at"`
+	Branch         string         `db:"branch" json:"branch"`
+	Event          string         `db:"event" json:"event"`
+	Labels         pq.StringArray `db:"labels" json:"labels"`
+	Inputs         StringMap      `db:"inputs" json:"inputs"`
+	Priority       int            `db:"priority" json:"priority"`
+	FromFork       bool           `db:"from_fork" json:"from_fork"`
+	Actor          string         `db:"actor" json:"actor"`
 }
 
 func (b Build) LogValue() slog.Value {
@@ -48,6 +75,7 @@ func (b Build) LogValue() slog.Value {
 
 	return slog.GroupValue(
 		slog.Int64("id", b.ID),
+		slog.Int64("number", b.Number),
 		slog.Int64("repo_id", b.RepoID),
 		slog.String("commit_sha", b.CommitSHA),
 		// slog.String("commit_message", b.CommitMsg), // Purposefully don't log the commit message
@@ -57,6 +85,8 @@ func (b Build) LogValue() slog.Value {
 		conclusionValue,
 		slog.Time("created_at", b.CreatedAt),
 		slog.Time("updated_at", b.UpdatedAt),
+		slog.String("branch", b.Branch),
+		slog.String("event", b.Event),
 	)
 }
 
@@ -72,12 +102,52 @@ type FatBuild struct {
 	UserName string `db:"user_name" json:"user_name"`
 }
 
+// Outcome is the status and conclusion of a build or job.
+type Outcome struct {
+	Status     string  `db:"status"`
+	Conclusion *string `db:"conclusion"`
+}
+
+// BuildFilter selects builds when listing them. Zero fields match all
+// builds.
+type BuildFilter struct {
+	RepoID     int64
+	Status     string
+	Conclusion string
+	Branch     string
+	Event      string
+	Actor      string
+
+	// CreatedAfter and CreatedBefore select the builds created in the range
+	// [CreatedAfter, CreatedBefore).
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// CommitSHAPrefix selects builds whose commit SHA starts with it.
+	CommitSHAPrefix string
+}
+
+var buildSortColumns = map[string]sortColumn{
+	"created_at": timeColumn("builds.created_at"),
+	"updated_at": timeColumn("builds.updated_at"),
+	"id":         intColumn("builds.id"),
+}
+
 type BuildRepo interface {
+	// Create creates the build and its jobs, and numbers the build after the
+	// last build of its repository.
 	Create(ctx context.Context, build NewBuild) (id int64, err error)
+
+	// UpdateStatus sets the status of a build. Available values are: "queued", "in_progress", "completed".
+	// Returns a [buildstate.ConflictError] if the build can't change from its
+	// current status to status.
+	//
+	// See https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28#create-a-check-run
 	UpdateStatus(ctx context.Context, buildID int64, status string) (err error)
 
-	// SetConclusion sets the conclusion of a build.
+	// SetConclusion sets the conclusion of a build and marks it as completed.
 	// Available values are: "canceled", "failure", "success", "timed_out".
+	// Returns a [buildstate.ConflictError] if the build completed already.
 	//
 	// See https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28#create-a-check-run
 	SetConclusion(ctx context.Context, buildID int64, conclusion string) (err error)
@@ -88,14 +158,54 @@ type BuildRepo interface {
 	// Get return the build associated with the specified userID and buildID.
 	Get(ctx context.Context, userID, buildID int64) (build *FatBuild, err error)
 
+	// GetByNumber returns the build with number in the repository with repoID
+	// of userID.
+	GetByNumber(ctx context.Context, userID, repoID, number int64) (build *FatBuild, err error)
+
+	// GetByID returns the build with buildID. It does not take user ownership into account, so be careful using it
+	// as to not expose additional data.
+	GetByID(ctx context.Context, buildID int64) (build *Build, err error)
+
+	// GetStuck returns the builds that haven't completed within their
+	// repository's build timeout since they started, which is when their first
+	// job started. Repositories without their own timeout use timeout. Builds
+	// none of whose jobs started are returned once they were queued for longer
+	// than queueTimeout instead.
+	GetStuck(ctx context.Context, timeout, queueTimeout time.Duration) (builds []Build, err error)
+
 	// GetAllByUserID returns all builds for all repositories of userID.
+	//
+	// Like the other methods that list or look up builds by repository, it
+	// leaves out the builds of removed repositories. Builds are still found
+	// by their ID.
 	GetAllByUserID(ctx context.Context, userID int64) (builds []FatBuild, err error)
 
-	// GetAllByRepoID returns all builds for the repository of repoID.
-	GetAllByRepoID(ctx context.Context, userID, repoID int64) (builds []FatBuild, err error)
+	// List returns a page of the builds of the repositories of userID that
+	// match filter, and the cursor of the next page, which is empty if it's
+	// the last page.
+	//
+	// Builds can be sorted by "created_at" (the default is "-created_at"),
+	// "updated_at" and "id".
+	List(ctx context.Context, userID int64, filter BuildFilter, opts ListOptions) (builds []FatBuild, nextCursor string, err error)
 
 	// GetLatestByRepoID returns the most recent build for the specified repository and user.
 	GetLatestByRepoID(ctx context.Context, userID, repoID int64) (build *FatBuild, err error)
+
+	// GetLatestByRepoIDs returns the most recent build of each of the
+	// repositories of the user with repoIDs, by repository ID. Repositories
+	// without builds are missing.
+	GetLatestByRepoIDs(ctx context.Context, userID int64, repoIDs []int64) (builds map[int64]Build, err error)
+
+	// GetLatestOutcomes returns the outcome of the most recent completed build
+	// of the repository with repoID on branch, or on any branch if branch is
+	// empty. Builds that are still running are ignored, so that the outcome is
+	// that of the last result.
+	//
+	// If job isn't empty, it returns the outcomes of the jobs of the most
+	// recent completed build that has jobs named job instead. Jobs expanded from a
+	// matrix are matched by the name of the matrix job, too. Returns
+	// ErrNotFound if there's no such build.
+	GetLatestOutcomes(ctx context.Context, repoID int64, branch, job string) (outcomes []Outcome, err error)
 }
 
 type PostgresBuildRepo struct {
@@ -103,59 +213,114 @@ type PostgresBuildRepo struct {
 }
 
 func (p PostgresBuildRepo) Create(ctx context.Context, build NewBuild) (id int64, err error) {
-	stmt, err := p.db.PreparexContext(ctx, `
-		INSERT INTO bee_schema.builds (repo_id, commit_sha, commit_message, installation_id, status)
-		VALUES ($1, $2, $3, $4, 'queued')
-		RETURNING id
-	`)
+	tx, err := p.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("preparing query: %v", err)
+		return 0, fmt.Errorf("beginning transaction: %v", err)
 	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The row of the repository stays locked until the transaction ends, so
+	// concurrent builds of the same repository get consecutive numbers.
+	var number int64
+	err = tx.GetContext(ctx, &number, `
+		UPDATE bee_schema.repos
+		SET last_build_number = last_build_number + 1
+		WHERE id = $1
+		RETURNING last_build_number
+	`, build.RepoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("executing UPDATE query to allocate build number for repoID %d: %v", build.RepoID, err)
+	}
+
+	labels := pq.StringArray{}
+	labels = append(labels, build.Labels...)
 
-	err = stmt.GetContext(ctx, &id, build.RepoID, build.CommitSHA, build.CommitMsg, build.InstallationID)
+	err = tx.GetContext(ctx, &id, `
+		INSERT INTO bee_schema.builds (repo_id, number, commit_sha, commit_message, installation_id, branch, event, labels, inputs, priority, from_fork, actor, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, 'queued')
+		RETURNING id
+	`, build.RepoID, number, build.CommitSHA, build.CommitMsg, build.InstallationID, build.Branch, build.Event, labels, build.Inputs, build.Priority, build.FromFork, build.Actor)
 	if err != nil {
 		return 0, fmt.Errorf("executing INSERT query: %v", err)
 	}
 
-	return id, nil
-}
+	for _, job := range build.Jobs {
+		dependsOn := pq.StringArray{}
+		dependsOn = append(dependsOn, job.DependsOn...)
+		runsOn := pq.StringArray{}
+		runsOn = append(runsOn, job.RunsOn...)
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO bee_schema.jobs (build_id, name, parent_name, matrix, image, commands, timeout_seconds, depends_on, condition, runs_on, max_parallel, fail_fast, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, 'pending')
+		`, id, job.Name, job.ParentName, job.Matrix, job.Image, pq.StringArray(job.Commands), job.Timeout, dependsOn, job.Condition, runsOn, job.MaxParallel, job.FailFast)
+		if err != nil {
+			return 0, fmt.Errorf("executing INSERT query for job %q: %v", job.Name, err)
+		}
+	}
 
-// UpdateStatus sets the status of a build. Available values are: "queued", "in_progress", "completed".
-//
-// See https://docs.github.com/en/rest/checks/runs?apiVersion=2022-11-28#create-a-check-run
-func (p PostgresBuildRepo) UpdateStatus(ctx context.Context, buildID int64, status string) (err error) {
-	stmt, err := p.db.PreparexContext(ctx, `
-		UPDATE bee_schema.builds
-		SET status = $2
-		WHERE id = $1
-	`)
+	err = insertBuildEvents(ctx, tx, BuildEvent{BuildID: id, Type: BuildQueued, Actor: build.Actor})
 	if err != nil {
-		return fmt.Errorf("preparing query: %v", err)
+		return 0, err
 	}
 
-	_, err = stmt.ExecContext(ctx, buildID, status)
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("executing UPDATE query: %v", err)
+		return 0, fmt.Errorf("committing transaction: %v", err)
 	}
 
-	return nil
+	return id, nil
+}
+
+func (p PostgresBuildRepo) UpdateStatus(ctx context.Context, buildID int64, status string) (err error) {
+	return p.update(ctx, buildID, status, nil)
 }
 
 func (p PostgresBuildRepo) SetConclusion(ctx context.Context, buildID int64, conclusion string) (err error) {
-	stmt, err := p.db.PreparexContext(ctx, `
-		UPDATE bee_schema.builds
-		SET status = 'completed', conclusion = $2
-		WHERE id = $1
-	`)
+	return p.update(ctx, buildID, buildstate.Completed, &conclusion)
+}
+
+// update sets the status and conclusion of a build if it can change to
+// status, and records the event of the change.
+func (p PostgresBuildRepo) update(ctx context.Context, buildID int64, status string, conclusion *string) (err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("preparing query: %v", err)
+		return fmt.Errorf("beginning transaction: %v", err)
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	_, err = stmt.ExecContext(ctx, buildID, conclusion)
+	result, err := tx.ExecContext(ctx, `
+		UPDATE bee_schema.builds
+		SET status = $2, conclusion = $3, updated_at = NOW()
+		WHERE id = $1 AND status::TEXT = ANY($4)
+	`, buildID, status, conclusion, pq.StringArray(buildstate.BuildStatusesBefore(status)))
 	if err != nil {
 		return fmt.Errorf("executing UPDATE query: %v", err)
 	}
 
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %v", err)
+	}
+	if rows == 0 {
+		return statusConflict(ctx, tx, "build", buildID, status)
+	}
+
+	if event := buildStatusEvent(buildID, status, conclusion); event.Type != "" {
+		err = insertBuildEvents(ctx, tx, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
 	return nil
 }
 
@@ -201,6 +366,76 @@ func (p PostgresBuildRepo) Get(ctx context.Context, userID, buildID int64) (*Fat
 	return &build, nil
 }
 
+func (p PostgresBuildRepo) GetByNumber(ctx context.Context, userID, repoID, number int64) (*FatBuild, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("BuildRepo.GetByNumber", slog.Any("userID", userID), slog.Any("repoID", repoID), slog.Any("number", number))
+
+	build := FatBuild{}
+	err := p.db.GetContext(ctx, &build, `
+		SELECT builds.*, repos.name AS repo_name, users.id AS user_id, users.username AS user_name
+		FROM bee_schema.builds builds
+		JOIN bee_schema.repos repos ON builds.repo_id = repos.id
+		JOIN bee_schema.users users ON repos.user_id = users.id
+		WHERE users.id = $1 AND repos.id = $2 AND repos.removed_at IS NULL AND builds.number = $3
+	`, userID, repoID, number)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("executing SELECT query for repoID %d and number %d: %v", repoID, number, err)
+	}
+
+	return &build, nil
+}
+
+func (p PostgresBuildRepo) GetByID(ctx context.Context, buildID int64) (*Build, error) {
+	build := Build{}
+	err := p.db.GetContext(ctx, &build, `
+		SELECT *
+		FROM bee_schema.builds
+		WHERE id = $1
+	`, buildID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("executing SELECT query for buildID %d: %v", buildID, err)
+	}
+
+	return &build, nil
+}
+
+func (p PostgresBuildRepo) GetStuck(ctx context.Context, timeout, queueTimeout time.Duration) (builds []Build, err error) {
+	builds = make([]Build, 0)
+	// The started_at of a job moves when it's returned to the queue and
+	// claimed again, so the build's started event is taken into account too.
+	// Jobs of runners that update the database directly don't record it.
+	err = p.db.SelectContext(ctx, &builds, `
+		SELECT builds.*
+		FROM bee_schema.builds builds
+		JOIN bee_schema.repos repos ON repos.id = builds.repo_id
+		CROSS JOIN LATERAL (
+			SELECT LEAST(
+				(SELECT MIN(jobs.started_at) FROM bee_schema.jobs jobs WHERE jobs.build_id = builds.id),
+				(SELECT MIN(build_events.created_at) FROM bee_schema.build_events build_events
+				 WHERE build_events.build_id = builds.id AND build_events.type = 'started')
+			) AS started_at
+		) started
+		WHERE builds.status <> 'completed'
+		  AND CASE
+		      WHEN started.started_at IS NULL
+		          THEN builds.created_at + make_interval(secs => $2) < NOW()
+		      ELSE started.started_at + make_interval(secs => COALESCE(repos.build_timeout_seconds, $1)) < NOW()
+		      END
+		ORDER BY builds.id
+	`, timeout.Seconds(), queueTimeout.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query: %v", err)
+	}
+
+	return builds, nil
+}
+
 func (p PostgresBuildRepo) GetAllByUserID(ctx context.Context, userID int64) (builds []FatBuild, err error) {
 	logger, _ := l.FromContext(ctx)
 	logger.Debug("BuildRepo.GetAllByUserID", slog.Any("userID", userID))
@@ -211,7 +446,7 @@ func (p PostgresBuildRepo) GetAllByUserID(ctx context.Context, userID int64) (bu
          		FROM bee_schema.builds builds
          		JOIN bee_schema.repos repos ON builds.repo_id = repos.id
          		JOIN bee_schema.users users ON repos.user_id = users.id
-         		WHERE users.id = $1
+         		WHERE users.id = $1 AND repos.removed_at IS NULL
          		ORDER BY builds.created_at DESC
 		 	`, userID)
 	if err != nil {
@@ -221,24 +456,75 @@ func (p PostgresBuildRepo) GetAllByUserID(ctx context.Context, userID int64) (bu
 	return builds, nil
 }
 
-func (p PostgresBuildRepo) GetAllByRepoID(ctx context.Context, userID, repoID int64) (builds []FatBuild, err error) {
-	logger, _ := l.FromContext(ctx)
-	logger.Debug("BuildRepo.GetAllByRepoID", slog.Any("userID", userID), slog.Any("repoID", repoID))
+func (p PostgresBuildRepo) List(ctx context.Context, userID int64, filter BuildFilter, opts ListOptions) (builds []FatBuild, nextCursor string, err error) {
+	k, err := newKeyset(opts, buildSortColumns, "-created_at", "builds.id")
+	if err != nil {
+		return nil, "", err
+	}
+
+	conditions := []string{"users.id = $1", "repos.removed_at IS NULL"}
+	args := []any{userID}
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.RepoID != 0 {
+		addCondition("builds.repo_id = $%d", filter.RepoID)
+	}
+	if filter.Status != "" {
+		addCondition("builds.status = $%d", filter.Status)
+	}
+	if filter.Conclusion != "" {
+		addCondition("builds.conclusion = $%d", filter.Conclusion)
+	}
+	if filter.Branch != "" {
+		addCondition("builds.branch = $%d", filter.Branch)
+	}
+	if filter.Event != "" {
+		addCondition("builds.event = $%d", filter.Event)
+	}
+	if filter.Actor != "" {
+		addCondition("builds.actor = $%d", filter.Actor)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		addCondition("builds.created_at >= $%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		addCondition("builds.created_at < $%d", filter.CreatedBefore)
+	}
+	if filter.CommitSHAPrefix != "" {
+		addCondition("builds.commit_sha LIKE $%d", escapeLike(strings.ToLower(filter.CommitSHAPrefix))+"%")
+	}
+
+	after, args, err := k.where(args)
+	if err != nil {
+		return nil, "", err
+	}
+	conditions = append(conditions, after)
 
 	builds = make([]FatBuild, 0)
 	err = p.db.SelectContext(ctx, &builds, `
-         		SELECT builds.*, repos.name AS repo_name, users.id AS user_id, users.username AS user_name
-         		FROM bee_schema.builds builds
-         		JOIN bee_schema.repos repos ON builds.repo_id = repos.id
-         		JOIN bee_schema.users users ON repos.user_id = users.id
-         		WHERE users.id = $1 AND repos.id = $2
-         		ORDER BY builds.created_at DESC
-		 	`, userID, repoID)
+		SELECT builds.*, repos.name AS repo_name, users.id AS user_id, users.username AS user_name
+		FROM bee_schema.builds builds
+		JOIN bee_schema.repos repos ON builds.repo_id = repos.id
+		JOIN bee_schema.users users ON repos.user_id = users.id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		`+k.orderBy(), args...)
 	if err != nil {
-		return nil, fmt.Errorf("executing SELECT query for userID %d and repo ID %d: %v", userID, repoID, err)
+		return nil, "", fmt.Errorf("executing SELECT query for userID %d: %v", userID, err)
 	}
 
-	return builds, nil
+	builds, nextCursor = page(k, builds, func(build FatBuild) (string, int64) {
+		switch k.field {
+		case "updated_at":
+			return formatTime(build.UpdatedAt), build.ID
+		case "id":
+			return strconv.FormatInt(build.ID, 10), build.ID
+		default:
+			return formatTime(build.CreatedAt), build.ID
+		}
+	})
+	return builds, nextCursor, nil
 }
 
 func (p PostgresBuildRepo) GetLatestByRepoID(ctx context.Context, userID, repoID int64) (*FatBuild, error) {
@@ -251,7 +537,7 @@ func (p PostgresBuildRepo) GetLatestByRepoID(ctx context.Context, userID, repoID
 				FROM bee_schema.builds builds
 				JOIN bee_schema.repos repos ON builds.repo_id = repos.id
 				JOIN bee_schema.users users ON repos.user_id = users.id
-				WHERE users.id = $1 AND repos.id = $2
+				WHERE users.id = $1 AND repos.id = $2 AND repos.removed_at IS NULL
 				ORDER BY builds.created_at DESC
 				LIMIT 1
 		`, userID, repoID)
@@ -265,6 +551,66 @@ func (p PostgresBuildRepo) GetLatestByRepoID(ctx context.Context, userID, repoID
 	return &build, nil
 }
 
+func (p PostgresBuildRepo) GetLatestByRepoIDs(ctx context.Context, userID int64, repoIDs []int64) (map[int64]Build, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("BuildRepo.GetLatestByRepoIDs", slog.Any("userID", userID), slog.Any("repoIDs", repoIDs))
+
+	latest := make([]Build, 0, len(repoIDs))
+	err := p.db.SelectContext(ctx, &latest, `
+		SELECT latest.*
+		FROM (`+latestBuildsQuery+`) latest
+		WHERE latest.repo_id = ANY($2)
+	`, userID, pq.Int64Array(repoIDs))
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for userID %d and repo IDs %v: %v", userID, repoIDs, err)
+	}
+
+	builds := make(map[int64]Build, len(latest))
+	for _, build := range latest {
+		builds[build.RepoID] = build
+	}
+	return builds, nil
+}
+
+func (p PostgresBuildRepo) GetLatestOutcomes(ctx context.Context, repoID int64, branch, job string) (outcomes []Outcome, err error) {
+	outcomes = make([]Outcome, 0)
+	if job == "" {
+		err = p.db.SelectContext(ctx, &outcomes, `
+			SELECT status, conclusion
+			FROM bee_schema.builds
+			WHERE repo_id = $1 AND ($2 = '' OR branch = $2) AND status = 'completed'
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		`, repoID, branch)
+	} else {
+		err = p.db.SelectContext(ctx, &outcomes, `
+			WITH latest AS (
+				SELECT builds.id
+				FROM bee_schema.builds builds
+				WHERE builds.repo_id = $1 AND ($2 = '' OR builds.branch = $2) AND builds.status = 'completed' AND EXISTS (
+					SELECT 1
+					FROM bee_schema.jobs jobs
+					WHERE jobs.build_id = builds.id AND (jobs.name = $3 OR jobs.parent_name = $3)
+				)
+				ORDER BY builds.created_at DESC, builds.id DESC
+				LIMIT 1
+			)
+			SELECT jobs.status, jobs.conclusion
+			FROM bee_schema.jobs jobs
+			JOIN latest ON latest.id = jobs.build_id
+			WHERE jobs.name = $3 OR jobs.parent_name = $3
+		`, repoID, branch, job)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for repoID %d: %v", repoID, err)
+	}
+	if len(outcomes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return outcomes, nil
+}
+
 var _ BuildRepo = &PostgresBuildRepo{}
 
 func NewPostgresBuildRepo(db *sqlx.DB) *PostgresBuildRepo {
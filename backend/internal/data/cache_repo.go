@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CacheEntry represents a row in the "caches" table.
+type CacheEntry struct {
+	ID      int64  `db:"id"`
+	RepoID  int64  `db:"repo_id"`
+	Branch  string `db:"branch"`
+	Key     string `db:"key"`
+	BlobKey string `db:"blob_key"`
+	Size    int64  `db:"size"`
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the content.
+	SHA256 string `db:"sha256"`
+
+	CreatedAt  time.Time `db:"created_at"`
+	LastUsedAt time.Time `db:"last_used_at"`
+}
+
+type CacheRepo interface {
+	// Get returns the entry with key of the branch of the repository with
+	// repoID.
+	Get(ctx context.Context, repoID int64, branch, key string) (entry *CacheEntry, err error)
+
+	// GetLatestWithPrefix returns the newest entry of the branch of the
+	// repository with repoID whose key starts with prefix.
+	GetLatestWithPrefix(ctx context.Context, repoID int64, branch, prefix string) (entry *CacheEntry, err error)
+
+	// Create creates the entry. Returns ErrAlreadyExists if the branch has an
+	// entry with the same key.
+	Create(ctx context.Context, entry CacheEntry) (id int64, err error)
+
+	// Touch marks the entry with id as used now.
+	Touch(ctx context.Context, id int64) (err error)
+
+	// GetEvictable returns the least recently used entries of the repository
+	// with repoID that have to be evicted for the rest to fit in maxSize bytes.
+	GetEvictable(ctx context.Context, repoID int64, maxSize int64) (entries []CacheEntry, err error)
+
+	// Delete deletes the entry with id.
+	Delete(ctx context.Context, id int64) (err error)
+}
+
+type PostgresCacheRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresCacheRepo) Get(ctx context.Context, repoID int64, branch, key string) (*CacheEntry, error) {
+	entry := CacheEntry{}
+	err := p.db.GetContext(ctx, &entry, `
+		SELECT *
+		FROM bee_schema.caches
+		WHERE repo_id = $1 AND branch = $2 AND key = $3
+	`, repoID, branch, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from caches: %v", err)
+	}
+
+	return &entry, nil
+}
+
+func (p PostgresCacheRepo) GetLatestWithPrefix(ctx context.Context, repoID int64, branch, prefix string) (*CacheEntry, error) {
+	entry := CacheEntry{}
+	err := p.db.GetContext(ctx, &entry, `
+		SELECT *
+		FROM bee_schema.caches
+		WHERE repo_id = $1 AND branch = $2 AND key LIKE $3
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, repoID, branch, escapeLike(prefix)+"%")
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from caches: %v", err)
+	}
+
+	return &entry, nil
+}
+
+func (p PostgresCacheRepo) Create(ctx context.Context, entry CacheEntry) (id int64, err error) {
+	err = p.db.GetContext(ctx, &id, `
+		INSERT INTO bee_schema.caches (repo_id, branch, key, blob_key, size, sha256)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (repo_id, branch, key) DO NOTHING
+		RETURNING id
+	`, entry.RepoID, entry.Branch, entry.Key, entry.BlobKey, entry.Size, entry.SHA256)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrAlreadyExists
+		}
+		return 0, fmt.Errorf("executing INSERT query: %v", err)
+	}
+
+	return id, nil
+}
+
+func (p PostgresCacheRepo) Touch(ctx context.Context, id int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.caches
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresCacheRepo) GetEvictable(ctx context.Context, repoID int64, maxSize int64) (entries []CacheEntry, err error) {
+	entries = make([]CacheEntry, 0)
+	err = p.db.SelectContext(ctx, &entries, `
+		SELECT id, repo_id, branch, key, blob_key, size, sha256, created_at, last_used_at
+		FROM (
+			SELECT *, SUM(size) OVER (ORDER BY last_used_at DESC, id DESC) AS total_size
+			FROM bee_schema.caches
+			WHERE repo_id = $1
+		) AS caches
+		WHERE total_size > $2
+		ORDER BY last_used_at, id
+	`, repoID, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from caches: %v", err)
+	}
+
+	return entries, nil
+}
+
+func (p PostgresCacheRepo) Delete(ctx context.Context, id int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `DELETE FROM bee_schema.caches WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("executing DELETE query: %v", err)
+	}
+
+	return nil
+}
+
+// escapeLike escapes the wildcards of LIKE patterns in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+var _ CacheRepo = &PostgresCacheRepo{}
+
+func NewPostgresCacheRepo(db *sqlx.DB) *PostgresCacheRepo {
+	return &PostgresCacheRepo{db: db}
+}
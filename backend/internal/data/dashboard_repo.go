@@ -0,0 +1,168 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+)
+
+// Dashboard summarizes the builds of all repositories of a user.
+type Dashboard struct {
+	Stats DashboardStats `json:"stats"`
+	Repos []RepoSummary  `json:"repos"`
+}
+
+type DashboardStats struct {
+	TotalBuilds      int `db:"total_builds" json:"total_builds"`
+	SuccessfulBuilds int `db:"successful_builds" json:"successful_builds"`
+}
+
+// RepoSummary is a repository with its latest build. The build fields
+// are nil if the repository has no builds.
+type RepoSummary struct {
+	RepoID          int64      `db:"repo_id" json:"repo_id"`
+	RepoName        string     `db:"repo_name" json:"repo_name"`
+	BuildID         *int64     `db:"build_id" json:"build_id"`
+	BuildNumber     *int64     `db:"build_number" json:"build_number"`
+	BuildCommitMsg  *string    `db:"build_commit_message" json:"build_commit_message"`
+	BuildStatus     *string    `db:"build_status" json:"build_status"`
+	BuildConclusion *string    `db:"build_conclusion" json:"build_conclusion"`
+	BuildUpdatedAt  *time.Time `db:"build_updated_at" json:"build_updated_at"`
+}
+
+type DashboardRepo interface {
+	// Get returns the dashboard of userID. Repos are sorted by when their
+	// latest build was last updated, most recent first, and repos without
+	// builds come last.
+	Get(ctx context.Context, userID int64) (dashboard *Dashboard, err error)
+}
+
+// latestBuildsQuery selects the latest build of every repository of the user
+// with the ID in $1. DISTINCT ON keeps the first build of each repo in the
+// order, which is the latest one. It's served by
+// builds_repo_id_created_at_idx.
+const latestBuildsQuery = `
+	SELECT DISTINCT ON (builds.repo_id) builds.*
+	FROM bee_schema.builds builds
+	JOIN bee_schema.repos repos ON builds.repo_id = repos.id
+	WHERE repos.user_id = $1 AND repos.removed_at IS NULL
+	ORDER BY builds.repo_id, builds.created_at DESC, builds.id DESC
+`
+
+type PostgresDashboardRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresDashboardRepo) Get(ctx context.Context, userID int64) (*Dashboard, error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("DashboardRepo.Get", slog.Any("userID", userID))
+
+	dashboard := Dashboard{}
+	err := p.db.GetContext(ctx, &dashboard.Stats, `
+		SELECT COUNT(*) AS total_builds, COUNT(*) FILTER (WHERE builds.conclusion = 'success') AS successful_builds
+		FROM bee_schema.builds builds
+		JOIN bee_schema.repos repos ON builds.repo_id = repos.id
+		WHERE repos.user_id = $1 AND repos.removed_at IS NULL
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for stats of userID %d: %v", userID, err)
+	}
+
+	dashboard.Repos = make([]RepoSummary, 0)
+	err = p.db.SelectContext(ctx, &dashboard.Repos, `
+		SELECT repos.id AS repo_id, repos.name AS repo_name,
+		       latest.id AS build_id, latest.number AS build_number, latest.commit_message AS build_commit_message, latest.status AS build_status,
+		       latest.conclusion AS build_conclusion, latest.updated_at AS build_updated_at
+		FROM bee_schema.repos repos
+		LEFT JOIN (`+latestBuildsQuery+`) latest ON latest.repo_id = repos.id
+		WHERE repos.user_id = $1 AND repos.removed_at IS NULL
+		ORDER BY latest.updated_at DESC NULLS LAST, repos.name, repos.id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for latest builds of userID %d: %v", userID, err)
+	}
+
+	return &dashboard, nil
+}
+
+var _ DashboardRepo = &PostgresDashboardRepo{}
+
+func NewPostgresDashboardRepo(db *sqlx.DB) *PostgresDashboardRepo {
+	return &PostgresDashboardRepo{db: db}
+}
+
+// RedisCachedDashboardRepo caches dashboards for a short time, as they're
+// loaded on every visit of the dashboard page. Dashboards are invalidated when
+// builds of the user change, but not when repositories are added or removed,
+// so the TTL bounds how stale they can be.
+//
+// Redis errors aren't returned; the dashboard is read from the database
+// instead.
+type RedisCachedDashboardRepo struct {
+	next    DashboardRepo
+	redisDB *redis.Client
+	ttl     time.Duration
+}
+
+func (r RedisCachedDashboardRepo) Get(ctx context.Context, userID int64) (*Dashboard, error) {
+	logger, _ := l.FromContext(ctx)
+
+	key := dashboardKey(userID)
+	cached, err := r.redisDB.Get(ctx, key).Bytes()
+	if err == nil {
+		dashboard := Dashboard{}
+		err = json.Unmarshal(cached, &dashboard)
+		if err == nil {
+			return &dashboard, nil
+		}
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logger.Error("failed to get dashboard from redis", slog.Int64("user_id", userID), slog.Any("error", err))
+	}
+
+	dashboard, err := r.next.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(dashboard)
+	if err != nil {
+		return nil, fmt.Errorf("marshal dashboard: %w", err)
+	}
+	err = r.redisDB.Set(ctx, key, encoded, r.ttl).Err()
+	if err != nil {
+		logger.Error("failed to set dashboard in redis", slog.Int64("user_id", userID), slog.Any("error", err))
+	}
+
+	return dashboard, nil
+}
+
+// Invalidate removes the cached dashboard of userID.
+func (r RedisCachedDashboardRepo) Invalidate(ctx context.Context, userID int64) (err error) {
+	err = r.redisDB.Del(ctx, dashboardKey(userID)).Err()
+	if err != nil {
+		return fmt.Errorf("delete dashboard from redis: %w", err)
+	}
+
+	return nil
+}
+
+// dashboardKey is versioned so dashboards cached before a field was added to
+// RepoSummary aren't read back without it.
+func dashboardKey(userID int64) string {
+	return "dashboard:v2:" + strconv.FormatInt(userID, 10)
+}
+
+var _ DashboardRepo = RedisCachedDashboardRepo{}
+
+func NewRedisCachedDashboardRepo(next DashboardRepo, redisDB *redis.Client, ttl time.Duration) *RedisCachedDashboardRepo {
+	return &RedisCachedDashboardRepo{next: next, redisDB: redisDB, ttl: ttl}
+}
@@ -0,0 +1,135 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// seedUserID is the ID of the user created to seed the database for
+// benchmarks. GitHub IDs are positive, so it can't belong to a real user.
+const seedUserID = -1
+
+// BenchmarkDashboard compares loading the dashboard with one query per
+// repository, as it used to be loaded, with the aggregate queries of
+// DashboardRepo. It seeds the database of TEST_POSTGRES_URL with 300
+// repositories with 20 builds each. Don't run it against a database that the
+// server and gh-updater use: they're notified of the seeded builds.
+func BenchmarkDashboard(b *testing.B) {
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		b.Skip("TEST_POSTGRES_URL isn't set")
+	}
+
+	ctx := context.Background()
+
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { _ = db.Close() })
+
+	// The seed is deleted even if seeding fails halfway, so that the next run
+	// can seed again.
+	b.Cleanup(func() {
+		_, err := db.ExecContext(ctx, `DELETE FROM bee_schema.users WHERE id = $1`, seedUserID)
+		if err != nil {
+			b.Errorf("deleting seeded user: %v", err)
+		}
+	})
+	err = seedDashboard(ctx, db, 300, 20)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	buildRepo := NewPostgresBuildRepo(db)
+	repoRepo := NewPostgresRepoRepo(db)
+	dashboardRepo := NewPostgresDashboardRepo(db)
+
+	b.Run("per repository", func(b *testing.B) {
+		for b.Loop() {
+			err := getDashboardPerRepo(ctx, buildRepo, repoRepo, seedUserID)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("aggregate", func(b *testing.B) {
+		for b.Loop() {
+			_, err := dashboardRepo.Get(ctx, seedUserID)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// getDashboardPerRepo loads the dashboard the way it was loaded before
+// DashboardRepo: all builds to count the successful ones in Go, and the latest
+// build of every repository twice.
+func getDashboardPerRepo(ctx context.Context, buildRepo BuildRepo, repoRepo RepoRepo, userID int64) error {
+	_, err := buildRepo.GetAllByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	repos, err := repoRepo.GetAllForUser(ctx, "", userID)
+	if err != nil {
+		return err
+	}
+
+	for range 2 {
+		for _, repo := range repos {
+			_, err := buildRepo.GetLatestByRepoID(ctx, userID, repo.ID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// seedDashboard creates a user with repos repositories with builds completed
+// builds each. Every fifth build failed.
+func seedDashboard(ctx context.Context, db *sqlx.DB, repos, builds int) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO bee_schema.users (id, username) VALUES ($1, 'bench-dashboard')`, seedUserID)
+	if err != nil {
+		return fmt.Errorf("insert user (is a previous run still seeded?): %w", err)
+	}
+
+	// Repository IDs are negative too, so they can't belong to real
+	// repositories.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO bee_schema.repos (id, name, full_name, user_id, last_build_number)
+		SELECT -r, 'repo-' || r, 'bench-dashboard/repo-' || r, $1, $3
+		FROM generate_series(1, $2) r
+	`, seedUserID, repos, builds)
+	if err != nil {
+		return fmt.Errorf("insert repos: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO bee_schema.builds (repo_id, number, commit_sha, commit_message, installation_id, status, conclusion, created_at, updated_at)
+		SELECT -r, $2 + 1 - b, md5(r || '-' || b)::VARCHAR(40), 'commit ' || b, 0, 'completed',
+		       CASE WHEN b % 5 = 0 THEN 'failure' ELSE 'success' END::bee_schema.build_conclusion,
+		       now() - make_interval(mins => b), now() - make_interval(mins => b)
+		FROM generate_series(1, $1) r, generate_series(1, $2) b
+	`, repos, builds)
+	if err != nil {
+		return fmt.Errorf("insert builds: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -1,6 +1,40 @@
 // Package data provides the data access layer for the application.
 package data
 
-import "errors"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
+)
 
 var ErrNotFound = errors.New("not found")
+
+// ErrLeaseLost is returned when a runner acts on a job it no longer holds the
+// lease for, for example because the lease expired and the job was requeued.
+var ErrLeaseLost = errors.New("lease lost")
+
+// ErrAlreadyExists is returned when creating something that can't be
+// replaced, and already exists.
+var ErrAlreadyExists = errors.New("already exists")
+
+// statusConflict returns why a conditional update of the status of the build
+// or job with id to status to didn't change any row: ErrNotFound if it doesn't
+// exist, and a [buildstate.ConflictError] with its status otherwise. kind is
+// "build" or "job".
+func statusConflict(ctx context.Context, q sqlx.QueryerContext, kind string, id int64, to string) error {
+	var status string
+	err := sqlx.GetContext(ctx, q, &status, `SELECT status FROM bee_schema.`+kind+`s WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("selecting status of %s %d: %v", kind, id, err)
+	}
+
+	return &buildstate.ConflictError{Kind: kind, ID: id, Status: status, To: to}
+}
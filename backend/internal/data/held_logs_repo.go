@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// heldLogsTTL is how long held back lines are kept if the job never pushes
+// more lines nor completes, for example because its runner died.
+const heldLogsTTL = 24 * time.Hour
+
+// heldLogsLockTTL is how long the lines of a job stay locked if the server
+// holding the lock dies before releasing it.
+const heldLogsLockTTL = 30 * time.Second
+
+// heldLogsLockRetry is how often a locked job is tried again.
+const heldLogsLockRetry = 20 * time.Millisecond
+
+// unlockScript releases a lock only if it's still held with the token it was
+// acquired with, and didn't expire and get acquired by someone else meanwhile.
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// HeldLogsRepo holds log lines of a job that can't be stored yet, because
+// they may end with the beginning of a secret that is only masked once the
+// rest of it arrives.
+type HeldLogsRepo interface {
+	// Hold replaces the lines held for the job with jobID with lines.
+	Hold(ctx context.Context, jobID int64, lines []LogLine) (err error)
+
+	// Get returns the lines held for the job with jobID.
+	Get(ctx context.Context, jobID int64) (lines []LogLine, err error)
+
+	// Lock waits until no one else holds the lines of the job with jobID, so
+	// that getting, storing and holding them again isn't interleaved with
+	// another request of the job. unlock must be called once done.
+	Lock(ctx context.Context, jobID int64) (unlock func(), err error)
+}
+
+type RedisHeldLogsRepo struct {
+	redisDB *redis.Client
+}
+
+func (r RedisHeldLogsRepo) Hold(ctx context.Context, jobID int64, lines []LogLine) (err error) {
+	if len(lines) == 0 {
+		err = r.redisDB.Del(ctx, heldLogsKey(jobID)).Err()
+		if err != nil {
+			return fmt.Errorf("delete held log lines from redis: %w", err)
+		}
+		return nil
+	}
+
+	payload, err := json.Marshal(lines)
+	if err != nil {
+		return fmt.Errorf("marshal log lines: %w", err)
+	}
+
+	err = r.redisDB.Set(ctx, heldLogsKey(jobID), payload, heldLogsTTL).Err()
+	if err != nil {
+		return fmt.Errorf("hold log lines in redis: %w", err)
+	}
+
+	return nil
+}
+
+func (r RedisHeldLogsRepo) Get(ctx context.Context, jobID int64) (lines []LogLine, err error) {
+	payload, err := r.redisDB.Get(ctx, heldLogsKey(jobID)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get held log lines from redis: %w", err)
+	}
+
+	err = json.Unmarshal(payload, &lines)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal log lines: %w", err)
+	}
+
+	return lines, nil
+}
+
+func (r RedisHeldLogsRepo) Lock(ctx context.Context, jobID int64) (unlock func(), err error) {
+	key := heldLogsKey(jobID) + ":lock"
+	token := rand.Text()
+
+	for {
+		locked, err := r.redisDB.SetNX(ctx, key, token, heldLogsLockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("lock held log lines in redis: %w", err)
+		}
+		if locked {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(heldLogsLockRetry):
+		}
+	}
+
+	unlock = func() {
+		// The lock is released even if the request was canceled meanwhile.
+		_ = unlockScript.Run(context.WithoutCancel(ctx), r.redisDB, []string{key}, token).Err()
+	}
+	return unlock, nil
+}
+
+func heldLogsKey(jobID int64) string {
+	return "logs:held:" + strconv.FormatInt(jobID, 10)
+}
+
+var _ HeldLogsRepo = RedisHeldLogsRepo{}
+
+func NewRedisHeldLogsRepo(redisDB *redis.Client) *RedisHeldLogsRepo {
+	return &RedisHeldLogsRepo{redisDB: redisDB}
+}
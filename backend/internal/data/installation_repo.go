@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Installation represents a row in the "installations" table.
+type Installation struct {
+	ID     int64 `db:"id"`
+	UserID int64 `db:"user_id"`
+
+	// LogRetentionDays is how many days the logs of a build are kept after it
+	// completed. Nil means the server-wide default.
+	LogRetentionDays *int `db:"log_retention_days"`
+
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type InstallationRepo interface {
+	// Upsert creates the installation with id, or moves it to the user with
+	// userID if it exists.
+	Upsert(ctx context.Context, id, userID int64) (err error)
+
+	// Get returns the installation with id. It does not take user ownership
+	// into account.
+	Get(ctx context.Context, id int64) (installation *Installation, err error)
+
+	// GetAll returns all installations.
+	GetAll(ctx context.Context) (installations []Installation, err error)
+
+	// GetForUser returns the installation with id belonging to the user with
+	// userID.
+	GetForUser(ctx context.Context, userID, id int64) (installation *Installation, err error)
+
+	// UpdateLogRetention sets the log retention of the installation with id.
+	// Nil means the server-wide default.
+	UpdateLogRetention(ctx context.Context, id int64, days *int) (err error)
+}
+
+type PostgresInstallationRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresInstallationRepo) Upsert(ctx context.Context, id, userID int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO bee_schema.installations (id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id
+	`, id, userID)
+	if err != nil {
+		return fmt.Errorf("executing INSERT query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresInstallationRepo) Get(ctx context.Context, id int64) (*Installation, error) {
+	installation := Installation{}
+	err := p.db.GetContext(ctx, &installation, `
+		SELECT *
+		FROM bee_schema.installations
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from installations: %v", err)
+	}
+
+	return &installation, nil
+}
+
+func (p PostgresInstallationRepo) GetAll(ctx context.Context) (installations []Installation, err error) {
+	installations = make([]Installation, 0)
+	err = p.db.SelectContext(ctx, &installations, `
+		SELECT *
+		FROM bee_schema.installations
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from installations: %v", err)
+	}
+
+	return installations, nil
+}
+
+func (p PostgresInstallationRepo) GetForUser(ctx context.Context, userID, id int64) (*Installation, error) {
+	installation := Installation{}
+	err := p.db.GetContext(ctx, &installation, `
+		SELECT *
+		FROM bee_schema.installations
+		WHERE user_id = $1 AND id = $2
+	`, userID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from installations: %v", err)
+	}
+
+	return &installation, nil
+}
+
+func (p PostgresInstallationRepo) UpdateLogRetention(ctx context.Context, id int64, days *int) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.installations
+		SET log_retention_days = $2
+		WHERE id = $1
+	`, id, days)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
+var _ InstallationRepo = &PostgresInstallationRepo{}
+
+func NewPostgresInstallationRepo(db *sqlx.DB) *PostgresInstallationRepo {
+	return &PostgresInstallationRepo{db: db}
+}
@@ -0,0 +1,642 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type NewJob struct {
+	Name       string
+	ParentName string
+	Matrix     StringMap // empty for jobs without a matrix
+	Image      string
+	Commands   []string
+	Timeout    int // in seconds
+	DependsOn  []string
+	Condition  string
+	RunsOn     []string // labels a runner must have to claim the job
+
+	MaxParallel int
+	FailFast    bool
+}
+
+// StringMap is a map of strings stored as a JSONB object, for example the
+// matrix values a job was expanded with.
+type StringMap map[string]string
+
+// Scan implements the [sql.Scanner] interface.
+func (m *StringMap) Scan(src any) error {
+	var b []byte
+	switch src := src.(type) {
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	case nil:
+		*m = StringMap{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into StringMap", src)
+	}
+
+	return json.Unmarshal(b, m)
+}
+
+// Value implements the [driver.Valuer] interface.
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(m)
+}
+
+// Job represents a row in the "jobs" table.
+//
+// The JSON struct tags are only to be used when receiving a row from LISTEN/NOTIFY.
+type Job struct {
+	ID             int64          `db:"id" json:"id"`
+	BuildID        int64          `db:"build_id" json:"build_id"`
+	Name           string         `db:"name" json:"name"`
+	ParentName     string         `db:"parent_name" json:"parent_name"`
+	Matrix         StringMap      `db:"matrix" json:"matrix"`
+	Image          string         `db:"image" json:"image"`
+	Commands       pq.StringArray `db:"commands" json:"commands"`
+	Timeout        int            `db:"timeout_seconds" json:"timeout_seconds"`
+	DependsOn      pq.StringArray `db:"depends_on" json:"depends_on"`
+	Condition      string         `db:"condition" json:"condition"`
+	RunsOn         pq.StringArray `db:"runs_on" json:"runs_on"`
+	MaxParallel    int            `db:"max_parallel" json:"max_parallel"`
+	FailFast       bool           `db:"fail_fast" json:"fail_fast"`
+	CheckRunID     *int64         `db:"check_run_id" json:"check_run_id"`
+	RunnerID       *int64         `db:"runner_id" json:"runner_id"`
+	LeaseExpiresAt *time.Time     `db:"lease_expires_at" json:"lease_expires_at"`
+	Attempts       int            `db:"attempts" json:"attempts"`
+	StartedAt      *time.Time     `db:"started_at" json:"started_at"`
+	LogLines       int64          `db:"log_lines" json:"log_lines"`
+	Status         string         `db:"status" json:"status"`
+	Conclusion     *string        `db:"conclusion" json:"conclusion"`
+	CreatedAt      time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+func (j Job) LogValue() slog.Value {
+	conclusionValue := slog.Any("conclusion", j.Conclusion)
+	if j.Conclusion != nil {
+		conclusionValue = slog.String("conclusion", *j.Conclusion)
+	}
+
+	return slog.GroupValue(
+		slog.Int64("id", j.ID),
+		slog.Int64("build_id", j.BuildID),
+		slog.String("name", j.Name),
+		slog.String("status", j.Status),
+		conclusionValue,
+	)
+}
+
+var _ slog.LogValuer = Job{}
+
+// JobUpdate describes a change of a single job's status (and optionally its
+// conclusion).
+type JobUpdate struct {
+	JobID      int64
+	Status     string
+	Conclusion *string
+}
+
+// ScheduleFunc computes the changes to make to the build and its jobs, given
+// their current state. If the build's status and conclusion are equal to the
+// current ones, the build is left untouched.
+type ScheduleFunc func(build Build, jobs []Job) (updates []JobUpdate, buildStatus string, buildConclusion *string)
+
+// QueueLimits limits how many builds may run at the same time. A build is
+// running once any of its jobs was claimed. Zero means no limit.
+type QueueLimits struct {
+	MaxBuildsPerInstallation int
+
+	// MaxBuildsPerRepo can be overridden per repository, see [RepoSettings].
+	MaxBuildsPerRepo int
+}
+
+type JobRepo interface {
+	// Get returns the job with jobID.
+	Get(ctx context.Context, jobID int64) (job *Job, err error)
+
+	// GetAllByBuildID returns all jobs of the build with buildID, ordered by ID.
+	GetAllByBuildID(ctx context.Context, buildID int64) (jobs []Job, err error)
+
+	// UpdateStatus sets the status of a job. Available values are: "pending", "queued", "in_progress", "completed".
+	// Returns a [buildstate.ConflictError] if the job can't change from its
+	// current status to status.
+	UpdateStatus(ctx context.Context, jobID int64, status string) (err error)
+
+	// SetConclusion sets the conclusion of a job and marks it as completed.
+	// Available values are: "canceled", "failure", "success", "timed_out", "skipped".
+	// Returns a [buildstate.ConflictError] if the job completed already.
+	SetConclusion(ctx context.Context, jobID int64, conclusion string) (err error)
+
+	// SetCheckRunID sets the check_run_id of a job.
+	SetCheckRunID(ctx context.Context, jobID, checkRunID int64) (err error)
+
+	// Schedule locks the build with buildID and all its jobs, and applies the
+	// changes computed by schedule within a single transaction. Returns a
+	// [buildstate.ConflictError] without applying any change if schedule
+	// computed a change that isn't legal.
+	//
+	// events, such as the request that caused the changes, are recorded in
+	// the same transaction, before the changes of status, unless schedule
+	// computed no change.
+	Schedule(ctx context.Context, buildID int64, schedule ScheduleFunc, events ...BuildEvent) (err error)
+
+	// Claim leases the next queued job whose runs_on labels are all among the
+	// runner's labels to the runner, and marks it as in progress. Jobs are
+	// ordered as described in package queue, and jobs of builds that haven't
+	// started yet are only claimed within limits. Returns ErrNotFound if no
+	// such job is queued, or if the runner already runs as many jobs as its
+	// max concurrency allows.
+	Claim(ctx context.Context, runner Runner, lease time.Duration, limits QueueLimits) (job *Job, err error)
+
+	// ExtendLease extends the lease the runner with runnerID holds on the job
+	// with jobID. Returns ErrLeaseLost if the runner doesn't hold the lease.
+	ExtendLease(ctx context.Context, jobID, runnerID int64, lease time.Duration) (leaseExpiresAt time.Time, err error)
+
+	// ReserveLogLines reserves n sequence numbers for log lines of the job with
+	// jobID and returns the first of them.
+	ReserveLogLines(ctx context.Context, jobID int64, n int) (first int64, err error)
+
+	// Complete sets the conclusion of a job leased by the runner with runnerID
+	// and releases the lease. Returns ErrLeaseLost if the runner doesn't hold
+	// the lease, and a [buildstate.ConflictError] if the job was completed
+	// while the runner held the lease, for example because it timed out.
+	Complete(ctx context.Context, jobID, runnerID int64, conclusion string) (err error)
+
+	// ExpireLeases returns jobs whose lease expired to the queue. Jobs that
+	// were already attempted as many times as their repository allows are
+	// completed as "timed_out" instead. Repositories without their own limit
+	// allow maxAttempts.
+	ExpireLeases(ctx context.Context, maxAttempts int) (expired []Job, err error)
+
+	// TimeOut completes the jobs that have been in progress for longer than
+	// their timeout plus grace as "timed_out".
+	TimeOut(ctx context.Context, grace time.Duration) (timedOut []Job, err error)
+}
+
+type PostgresJobRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresJobRepo) Get(ctx context.Context, jobID int64) (*Job, error) {
+	job := Job{}
+	err := p.db.GetContext(ctx, &job, `
+		SELECT *
+		FROM bee_schema.jobs
+		WHERE id = $1
+	`, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("executing SELECT query for jobID %d: %v", jobID, err)
+	}
+
+	return &job, nil
+}
+
+func (p PostgresJobRepo) GetAllByBuildID(ctx context.Context, buildID int64) (jobs []Job, err error) {
+	logger, _ := l.FromContext(ctx)
+	logger.Debug("JobRepo.GetAllByBuildID", slog.Any("buildID", buildID))
+
+	jobs = make([]Job, 0)
+	err = p.db.SelectContext(ctx, &jobs, `
+		SELECT *
+		FROM bee_schema.jobs
+		WHERE build_id = $1
+		ORDER BY id
+	`, buildID)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query for buildID %d: %v", buildID, err)
+	}
+
+	return jobs, nil
+}
+
+func (p PostgresJobRepo) UpdateStatus(ctx context.Context, jobID int64, status string) (err error) {
+	return p.update(ctx, jobID, status, nil)
+}
+
+func (p PostgresJobRepo) SetConclusion(ctx context.Context, jobID int64, conclusion string) (err error) {
+	return p.update(ctx, jobID, buildstate.Completed, &conclusion)
+}
+
+// update sets the status and conclusion of a job if it can change to status,
+// and records the event of the change.
+func (p PostgresJobRepo) update(ctx context.Context, jobID int64, status string, conclusion *string) (err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	job := Job{}
+	err = tx.GetContext(ctx, &job, `
+		UPDATE bee_schema.jobs
+		SET status = $2, conclusion = $3, updated_at = NOW()
+		WHERE id = $1 AND status::TEXT = ANY($4)
+		RETURNING *
+	`, jobID, status, conclusion, pq.StringArray(buildstate.JobStatusesBefore(status)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return statusConflict(ctx, tx, "job", jobID, status)
+		}
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	if event := jobStatusEvent(job, status, conclusion); event.Type != "" {
+		err = insertBuildEvents(ctx, tx, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresJobRepo) SetCheckRunID(ctx context.Context, jobID, checkRunID int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.jobs
+		SET check_run_id = $2
+		WHERE id = $1
+	`, jobID, checkRunID)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresJobRepo) Schedule(ctx context.Context, buildID int64, schedule ScheduleFunc, events ...BuildEvent) (err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	build := Build{}
+	err = tx.GetContext(ctx, &build, `
+		SELECT *
+		FROM bee_schema.builds
+		WHERE id = $1
+		FOR UPDATE
+	`, buildID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("selecting build %d: %v", buildID, err)
+	}
+
+	jobs := make([]Job, 0)
+	err = tx.SelectContext(ctx, &jobs, `
+		SELECT *
+		FROM bee_schema.jobs
+		WHERE build_id = $1
+		ORDER BY id
+		FOR UPDATE
+	`, buildID)
+	if err != nil {
+		return fmt.Errorf("selecting jobs of build %d: %v", buildID, err)
+	}
+
+	updates, buildStatus, buildConclusion := schedule(build, jobs)
+
+	byID := make(map[int64]Job, len(jobs))
+	for _, job := range jobs {
+		byID[job.ID] = job
+	}
+
+	requested := events
+	events = make([]BuildEvent, 0, len(requested)+len(updates)+1)
+	if len(updates) > 0 || buildStatus != build.Status || !equalPtr(buildConclusion, build.Conclusion) {
+		events = append(events, requested...)
+	}
+	for _, update := range updates {
+		job := byID[update.JobID]
+		if update.Status != job.Status && !buildstate.CanChangeJob(job.Status, update.Status) {
+			return &buildstate.ConflictError{Kind: "job", ID: job.ID, Status: job.Status, To: update.Status}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE bee_schema.jobs
+			SET status = $2, conclusion = $3, updated_at = NOW()
+			WHERE id = $1
+		`, update.JobID, update.Status, update.Conclusion)
+		if err != nil {
+			return fmt.Errorf("updating job %d: %v", update.JobID, err)
+		}
+
+		if event := jobStatusEvent(job, update.Status, update.Conclusion); event.Type != "" && update.Status != job.Status {
+			events = append(events, event)
+		}
+	}
+
+	if buildStatus != build.Status || !equalPtr(buildConclusion, build.Conclusion) {
+		if !buildstate.CanChangeBuild(build.Status, buildStatus) {
+			return &buildstate.ConflictError{Kind: "build", ID: buildID, Status: build.Status, To: buildStatus}
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE bee_schema.builds
+			SET status = $2, conclusion = $3, updated_at = NOW()
+			WHERE id = $1
+		`, buildID, buildStatus, buildConclusion)
+		if err != nil {
+			return fmt.Errorf("updating build %d: %v", buildID, err)
+		}
+
+		if event := buildStatusEvent(buildID, buildStatus, buildConclusion); event.Type != "" && buildStatus != build.Status {
+			events = append(events, event)
+		}
+	}
+
+	err = insertBuildEvents(ctx, tx, events...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresJobRepo) Claim(ctx context.Context, runner Runner, lease time.Duration, limits QueueLimits) (*Job, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Lock the runner so that concurrent claims of the same runner can't
+	// exceed its max concurrency.
+	var running int
+	err = tx.GetContext(ctx, &running, `
+		SELECT COUNT(jobs.id)
+		FROM (SELECT id FROM bee_schema.runners WHERE id = $1 FOR UPDATE) runners
+		LEFT JOIN bee_schema.jobs jobs ON jobs.runner_id = runners.id AND jobs.status = 'in_progress'
+	`, runner.ID)
+	if err != nil {
+		return nil, fmt.Errorf("counting running jobs of runnerID %d: %v", runner.ID, err)
+	}
+	if running >= runner.MaxConcurrency {
+		return nil, ErrNotFound
+	}
+
+	labels := pq.StringArray{}
+	labels = append(labels, runner.Labels...)
+
+	// The queue order and the limits are defined by the next_job database
+	// function, which executors that claim jobs directly from the database
+	// use too.
+	job := Job{}
+	err = tx.GetContext(ctx, &job, `
+		UPDATE bee_schema.jobs jobs
+		SET status           = 'in_progress',
+		    runner_id        = $1,
+		    lease_expires_at = NOW() + make_interval(secs => $2),
+		    attempts         = attempts + 1,
+		    updated_at       = NOW()
+		FROM (SELECT bee_schema.next_job($3, $4, $5) AS id) next
+		WHERE jobs.id = next.id
+		RETURNING jobs.*
+	`, runner.ID, lease.Seconds(), labels, limits.MaxBuildsPerInstallation, limits.MaxBuildsPerRepo)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("executing UPDATE query for runnerID %d: %v", runner.ID, err)
+	}
+
+	err = insertBuildEvents(ctx, tx, BuildEvent{BuildID: job.BuildID, JobID: &job.ID, RunnerID: &runner.ID, Type: JobClaimed})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return &job, nil
+}
+
+func (p PostgresJobRepo) ExtendLease(ctx context.Context, jobID, runnerID int64, lease time.Duration) (leaseExpiresAt time.Time, err error) {
+	err = p.db.GetContext(ctx, &leaseExpiresAt, `
+		UPDATE bee_schema.jobs
+		SET lease_expires_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1 AND runner_id = $2 AND status = 'in_progress'
+		RETURNING lease_expires_at
+	`, jobID, runnerID, lease.Seconds())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrLeaseLost
+		}
+		return time.Time{}, fmt.Errorf("executing UPDATE query for jobID %d: %v", jobID, err)
+	}
+
+	return leaseExpiresAt, nil
+}
+
+func (p PostgresJobRepo) ReserveLogLines(ctx context.Context, jobID int64, n int) (first int64, err error) {
+	err = p.db.GetContext(ctx, &first, `
+		UPDATE bee_schema.jobs
+		SET log_lines = log_lines + $2
+		WHERE id = $1
+		RETURNING log_lines - $2 + 1
+	`, jobID, n)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("executing UPDATE query for jobID %d: %v", jobID, err)
+	}
+
+	return first, nil
+}
+
+func (p PostgresJobRepo) Complete(ctx context.Context, jobID, runnerID int64, conclusion string) (err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var buildID int64
+	err = tx.GetContext(ctx, &buildID, `
+		UPDATE bee_schema.jobs
+		SET status = 'completed', conclusion = $3, lease_expires_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND runner_id = $2 AND status = 'in_progress'
+		RETURNING build_id
+	`, jobID, runnerID, conclusion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return completeConflict(ctx, tx, jobID, runnerID)
+		}
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	err = insertBuildEvents(ctx, tx, BuildEvent{BuildID: buildID, JobID: &jobID, RunnerID: &runnerID, Type: JobCompleted, Conclusion: &conclusion})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresJobRepo) ExpireLeases(ctx context.Context, maxAttempts int) (expired []Job, err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	expired = make([]Job, 0)
+	err = tx.SelectContext(ctx, &expired, `
+		WITH expired AS (
+			SELECT jobs.id, jobs.attempts < COALESCE(repos.max_attempts, $1) AS retry
+			FROM bee_schema.jobs jobs
+			JOIN bee_schema.builds builds ON builds.id = jobs.build_id
+			JOIN bee_schema.repos repos ON repos.id = builds.repo_id
+			WHERE jobs.status = 'in_progress' AND jobs.lease_expires_at < NOW()
+			FOR UPDATE OF jobs SKIP LOCKED
+		)
+		UPDATE bee_schema.jobs jobs
+		SET status           = CASE WHEN expired.retry THEN 'queued' ELSE 'completed' END::bee_schema.job_status,
+		    conclusion       = CASE WHEN expired.retry THEN NULL ELSE 'timed_out' END::bee_schema.job_conclusion,
+		    runner_id        = CASE WHEN expired.retry THEN NULL ELSE jobs.runner_id END,
+		    lease_expires_at = NULL,
+		    updated_at       = NOW()
+		FROM expired
+		WHERE jobs.id = expired.id
+		RETURNING jobs.*
+	`, maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	err = insertJobStatusEvents(ctx, tx, expired)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return expired, nil
+}
+
+func (p PostgresJobRepo) TimeOut(ctx context.Context, grace time.Duration) (timedOut []Job, err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	timedOut = make([]Job, 0)
+	err = tx.SelectContext(ctx, &timedOut, `
+		UPDATE bee_schema.jobs
+		SET status = 'completed', conclusion = 'timed_out', lease_expires_at = NULL, updated_at = NOW()
+		WHERE status = 'in_progress'
+		  AND started_at + make_interval(secs => timeout_seconds + $1) < NOW()
+		RETURNING *
+	`, grace.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	err = insertJobStatusEvents(ctx, tx, timedOut)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return timedOut, nil
+}
+
+// completeConflict returns why the runner with runnerID can't complete the job
+// with jobID: a ConflictError if the job was completed already while the
+// runner held its lease, for example because it timed out, and ErrLeaseLost
+// otherwise.
+func completeConflict(ctx context.Context, tx *sqlx.Tx, jobID, runnerID int64) error {
+	job := Job{}
+	err := tx.GetContext(ctx, &job, `
+		SELECT *
+		FROM bee_schema.jobs
+		WHERE id = $1
+	`, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("executing SELECT query for jobID %d: %v", jobID, err)
+	}
+
+	if job.Status == buildstate.Completed && job.RunnerID != nil && *job.RunnerID == runnerID {
+		return &buildstate.ConflictError{Kind: "job", ID: jobID, Status: job.Status, To: buildstate.Completed}
+	}
+	return ErrLeaseLost
+}
+
+// insertJobStatusEvents records the events of jobs that changed to their
+// current status.
+func insertJobStatusEvents(ctx context.Context, tx *sqlx.Tx, jobs []Job) error {
+	events := make([]BuildEvent, 0, len(jobs))
+	for _, job := range jobs {
+		if event := jobStatusEvent(job, job.Status, job.Conclusion); event.Type != "" {
+			events = append(events, event)
+		}
+	}
+
+	return insertBuildEvents(ctx, tx, events...)
+}
+
+var _ JobRepo = &PostgresJobRepo{}
+
+func NewPostgresJobRepo(db *sqlx.DB) *PostgresJobRepo {
+	return &PostgresJobRepo{db: db}
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
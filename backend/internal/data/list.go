@@ -0,0 +1,179 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is how many items a page holds if no limit is given.
+	DefaultLimit = 20
+
+	// MaxLimit is the most items a page can hold.
+	MaxLimit = 100
+)
+
+// ErrInvalidListOptions is returned when listing with an unknown sort field
+// or a malformed cursor.
+var ErrInvalidListOptions = errors.New("invalid list options")
+
+// ListOptions select a page of a list.
+//
+// Lists are paginated by keyset: a page holds the items following the last
+// item of the previous page in sort order, so pages stay consistent while
+// items are added, and deep pages are as fast as the first one.
+type ListOptions struct {
+	// Sort is the field the items are sorted by, prefixed with "-" for
+	// descending order. Each list has its own fields and default.
+	Sort string
+
+	// Limit is how many items the page holds at most. Zero means
+	// DefaultLimit. It's capped at MaxLimit.
+	Limit int
+
+	// Cursor is the next cursor returned with the previous page, or empty for
+	// the first page. It's only valid with the same sort.
+	Cursor string
+}
+
+func (o ListOptions) limit() int {
+	if o.Limit <= 0 {
+		return DefaultLimit
+	}
+	return min(o.Limit, MaxLimit)
+}
+
+// sortColumn is a column lists can be sorted by. Its values must not be null.
+type sortColumn struct {
+	column string
+
+	// parse parses a value of the column encoded in a cursor.
+	parse func(value string) (any, error)
+}
+
+func timeColumn(column string) sortColumn {
+	return sortColumn{column: column, parse: func(value string) (any, error) {
+		return time.Parse(time.RFC3339Nano, value)
+	}}
+}
+
+func stringColumn(column string) sortColumn {
+	return sortColumn{column: column, parse: func(value string) (any, error) {
+		return value, nil
+	}}
+}
+
+func intColumn(column string) sortColumn {
+	return sortColumn{column: column, parse: func(value string) (any, error) {
+		return strconv.ParseInt(value, 10, 64)
+	}}
+}
+
+// cursor is the position after the last item of a page. ID breaks ties
+// between items with the same value.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// keyset builds the clauses of a query selecting a page.
+type keyset struct {
+	sort     string
+	field    string
+	desc     bool
+	column   sortColumn
+	idColumn string
+	after    *cursor
+	limit    int
+}
+
+// newKeyset validates opts against the columns a list can be sorted by.
+// Items with the same value are ordered by idColumn.
+func newKeyset(opts ListOptions, columns map[string]sortColumn, defaultSort, idColumn string) (*keyset, error) {
+	k := &keyset{sort: opts.Sort, idColumn: idColumn, limit: opts.limit()}
+	if k.sort == "" {
+		k.sort = defaultSort
+	}
+	k.field, k.desc = strings.CutPrefix(k.sort, "-")
+
+	column, ok := columns[k.field]
+	if !ok {
+		fields := slices.Sorted(maps.Keys(columns))
+		return nil, fmt.Errorf("%w: unknown sort field %q, must be one of: %s", ErrInvalidListOptions, k.field, strings.Join(fields, ", "))
+	}
+	k.column = column
+
+	if opts.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+		}
+		k.after = &cursor{}
+		err = json.Unmarshal(raw, k.after)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+		}
+		if k.after.Sort != k.sort {
+			return nil, fmt.Errorf("%w: cursor was returned for sort %q", ErrInvalidListOptions, k.after.Sort)
+		}
+	}
+
+	return k, nil
+}
+
+// where returns the condition selecting the items after the cursor, with its
+// arguments appended to args. Returns "TRUE" for the first page.
+func (k *keyset) where(args []any) (string, []any, error) {
+	if k.after == nil {
+		return "TRUE", args, nil
+	}
+
+	value, err := k.column.parse(k.after.Value)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: malformed cursor", ErrInvalidListOptions)
+	}
+
+	op := ">"
+	if k.desc {
+		op = "<"
+	}
+	args = append(args, value, k.after.ID)
+	condition := fmt.Sprintf("(%s, %s) %s ($%d, $%d)", k.column.column, k.idColumn, op, len(args)-1, len(args))
+	return condition, args, nil
+}
+
+// orderBy returns the ORDER BY and LIMIT clauses. One more item than the
+// limit is selected, to tell whether there's a next page.
+func (k *keyset) orderBy() string {
+	direction := "ASC"
+	if k.desc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %d", k.column.column, direction, k.idColumn, direction, k.limit+1)
+}
+
+// page trims the extra item selected by orderBy. If there's a next page, it
+// returns the cursor after the last item kept, which is described by value
+// and id.
+func page[T any](k *keyset, items []T, value func(item T) (string, int64)) ([]T, string) {
+	if len(items) <= k.limit {
+		return items, ""
+	}
+	items = items[:k.limit]
+
+	v, id := value(items[len(items)-1])
+	raw, _ := json.Marshal(cursor{Sort: k.sort, Value: v, ID: id})
+	return items, base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
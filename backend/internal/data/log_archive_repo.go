@@ -0,0 +1,133 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LogArchive represents a row in the "log_archives" table.
+type LogArchive struct {
+	BuildID    int64     `db:"build_id"`
+	BlobKey    string    `db:"blob_key"`
+	Size       int64     `db:"size"`
+	Lines      int64     `db:"lines"`
+	ArchivedAt time.Time `db:"archived_at"`
+}
+
+type LogArchiveRepo interface {
+	// Get returns the archive of the logs of the build with buildID. Returns
+	// ErrNotFound if the logs weren't archived.
+	Get(ctx context.Context, buildID int64) (archive *LogArchive, err error)
+
+	// Archive calls archive and records the archive it returns. If the logs
+	// of the build with buildID are already archived, or are being archived
+	// concurrently, archive isn't called and archived is false.
+	Archive(ctx context.Context, buildID int64, archive func() (LogArchive, error)) (archived bool, err error)
+
+	// GetUnarchived returns up to limit builds that completed before
+	// completedBefore and whose logs weren't archived, oldest first.
+	GetUnarchived(ctx context.Context, completedBefore time.Time, limit int) (builds []Build, err error)
+}
+
+type PostgresLogArchiveRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresLogArchiveRepo) Get(ctx context.Context, buildID int64) (*LogArchive, error) {
+	archive := LogArchive{}
+	err := p.db.GetContext(ctx, &archive, `
+		SELECT *
+		FROM bee_schema.log_archives
+		WHERE build_id = $1
+	`, buildID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from log_archives: %v", err)
+	}
+
+	return &archive, nil
+}
+
+func (p PostgresLogArchiveRepo) Archive(ctx context.Context, buildID int64, archive func() (LogArchive, error)) (archived bool, err error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// The lock is released when the transaction ends.
+	var locked bool
+	err = tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock(hashtext('log_archives'), $1)`, buildID)
+	if err != nil {
+		return false, fmt.Errorf("acquiring advisory lock: %v", err)
+	}
+	if !locked {
+		_ = tx.Rollback()
+		return false, nil
+	}
+
+	var exists bool
+	err = tx.GetContext(ctx, &exists, `SELECT EXISTS (SELECT 1 FROM bee_schema.log_archives WHERE build_id = $1)`, buildID)
+	if err != nil {
+		return false, fmt.Errorf("selecting from log_archives: %v", err)
+	}
+	if exists {
+		_ = tx.Rollback()
+		return false, nil
+	}
+
+	result, err := archive()
+	if err != nil {
+		return false, err
+	}
+	result.BuildID = buildID
+
+	_, err = tx.NamedExecContext(ctx, `
+		INSERT INTO bee_schema.log_archives (build_id, blob_key, size, lines)
+		VALUES (:build_id, :blob_key, :size, :lines)
+	`, result)
+	if err != nil {
+		return false, fmt.Errorf("inserting into log_archives: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return true, nil
+}
+
+func (p PostgresLogArchiveRepo) GetUnarchived(ctx context.Context, completedBefore time.Time, limit int) (builds []Build, err error) {
+	builds = make([]Build, 0)
+	err = p.db.SelectContext(ctx, &builds, `
+		SELECT builds.*
+		FROM bee_schema.builds builds
+		LEFT JOIN bee_schema.log_archives archives ON archives.build_id = builds.id
+		WHERE builds.status = 'completed' AND builds.updated_at < $1 AND archives.build_id IS NULL
+		ORDER BY builds.updated_at
+		LIMIT $2
+	`, completedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query: %v", err)
+	}
+
+	return builds, nil
+}
+
+var _ LogArchiveRepo = &PostgresLogArchiveRepo{}
+
+func NewPostgresLogArchiveRepo(db *sqlx.DB) *PostgresLogArchiveRepo {
+	return &PostgresLogArchiveRepo{db: db}
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// logMaskTTL is how long masks are kept after they were last registered. It
+// outlasts any job, so that masks also apply to logs read back shortly after
+// the build.
+const logMaskTTL = 7 * 24 * time.Hour
+
+// LogMaskRepo holds the secret values that are masked in the logs of a job.
+type LogMaskRepo interface {
+	// Add registers values to be masked in the logs of the job with jobID.
+	Add(ctx context.Context, jobID int64, values []string) (err error)
+
+	// Get returns the values to be masked in the logs of the job with jobID.
+	Get(ctx context.Context, jobID int64) (values []string, err error)
+}
+
+type RedisLogMaskRepo struct {
+	redisDB *redis.Client
+}
+
+func (r RedisLogMaskRepo) Add(ctx context.Context, jobID int64, values []string) (err error) {
+	if len(values) == 0 {
+		return nil
+	}
+
+	members := make([]any, 0, len(values))
+	for _, value := range values {
+		members = append(members, value)
+	}
+
+	key := logMasksKey(jobID)
+	_, err = r.redisDB.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, key, members...)
+		pipe.Expire(ctx, key, logMaskTTL)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("add masks to redis: %w", err)
+	}
+
+	return nil
+}
+
+func (r RedisLogMaskRepo) Get(ctx context.Context, jobID int64) (values []string, err error) {
+	values, err = r.redisDB.SMembers(ctx, logMasksKey(jobID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get masks from redis: %w", err)
+	}
+
+	return values, nil
+}
+
+func logMasksKey(jobID int64) string {
+	return "logs:masks:" + strconv.FormatInt(jobID, 10)
+}
+
+var _ LogMaskRepo = RedisLogMaskRepo{}
+
+func NewRedisLogMaskRepo(redisDB *redis.Client) *RedisLogMaskRepo {
+	return &RedisLogMaskRepo{redisDB: redisDB}
+}
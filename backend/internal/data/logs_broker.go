@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LogsBroker fans out new log lines to everyone subscribed to the build, on
+// any server replica.
+type LogsBroker interface {
+	// Publish sends lines of output of the build with buildID to its
+	// subscribers. Lines published while nobody is subscribed are dropped.
+	Publish(ctx context.Context, buildID int64, lines []LogLine) (err error)
+
+	// Subscribe returns a channel that receives the lines published for the
+	// build with buildID from now on. The channel is closed once ctx is done.
+	Subscribe(ctx context.Context, buildID int64) (lines <-chan []LogLine, err error)
+}
+
+type RedisLogsBroker struct {
+	logger  *slog.Logger
+	redisDB *redis.Client
+}
+
+func (b RedisLogsBroker) Publish(ctx context.Context, buildID int64, lines []LogLine) (err error) {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(lines)
+	if err != nil {
+		return fmt.Errorf("marshal log lines: %w", err)
+	}
+
+	err = b.redisDB.Publish(ctx, logsChannel(buildID), payload).Err()
+	if err != nil {
+		return fmt.Errorf("publish to redis: %w", err)
+	}
+
+	return nil
+}
+
+func (b RedisLogsBroker) Subscribe(ctx context.Context, buildID int64) (<-chan []LogLine, error) {
+	pubsub := b.redisDB.Subscribe(ctx, logsChannel(buildID))
+
+	// Wait for the confirmation, so that no lines published after Subscribe
+	// returns are missed.
+	_, err := pubsub.Receive(ctx)
+	if err != nil {
+		_ = pubsub.Close()
+		return nil, fmt.Errorf("subscribe to redis: %w", err)
+	}
+
+	lines := make(chan []LogLine)
+	go func() {
+		defer close(lines)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				var batch []LogLine
+				err := json.Unmarshal([]byte(msg.Payload), &batch)
+				if err != nil {
+					b.logger.Error("failed to unmarshal log lines", slog.Int64("build_id", buildID), slog.Any("error", err))
+					continue
+				}
+
+				select {
+				case lines <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return lines, nil
+}
+
+func logsChannel(buildID int64) string {
+	return "logs:" + strconv.FormatInt(buildID, 10)
+}
+
+var _ LogsBroker = RedisLogsBroker{}
+
+func NewRedisLogsBroker(redisDB *redis.Client) *RedisLogsBroker {
+	return &RedisLogsBroker{
+		logger:  slog.Default().With(slog.String("subsystem", "logs_broker")),
+		redisDB: redisDB,
+	}
+}
@@ -1,47 +1,265 @@
 package data
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"slices"
+	"time"
+)
 
-	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
 )
 
-type LogsRepo interface {
-	// Get returns all logs for the build with buildID.
-	Get(ctx context.Context, buildID int64) (logs []string, err error)
+// LogLine is a line of output of a job.
+//
+// The JSON struct tags are only to be used when passing lines between server
+// replicas.
+type LogLine struct {
+	BuildID int64 `json:"build_id"`
+	JobID   int64 `json:"job_id"`
+
+	// Step is the index of the job's command that wrote the line. Nil if it's
+	// not known.
+	Step *int `json:"step"`
+
+	// Stream is LogStreamStdout or LogStreamStderr.
+	Stream string `json:"stream"`
+
+	// Seq numbers the lines of a job from 1, in the order they were received.
+	Seq int64 `json:"seq"`
+
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// LogsQuery selects log lines of a build.
+type LogsQuery struct {
+	BuildID int64
+
+	// JobID selects the lines of a single job. Nil selects all jobs.
+	JobID *int64
+
+	// Step selects the lines of a single step. Nil selects all steps.
+	Step *int
+
+	// Stream selects the lines of a single stream. Empty selects both.
+	Stream string
+
+	// From and To bound the time range that is searched for lines. To is
+	// exclusive.
+	From time.Time
+	To   time.Time
+
+	// After is a cursor: only lines after it in the order of [LogsReader.Get]
+	// are returned. Nil means from the start.
+	After *LogCursor
+
+	// AfterSeqs is a cursor per job: only lines whose sequence number is
+	// greater than AfterSeqs[line.JobID] are returned. Unlike After, it
+	// doesn't skip lines that are stored after newer lines of other jobs.
+	AfterSeqs map[int64]int64
+
+	// Limit is the maximum number of lines returned. Zero means no limit.
+	Limit int
 }
 
-type InfluxLogsRepo struct {
-	influxClient influxdb2.Client
-	org          string
-	bucket       string
+// matches reports whether line is selected by the query, ignoring the limit.
+func (q LogsQuery) matches(line LogLine) bool {
+	switch {
+	case line.BuildID != q.BuildID:
+		return false
+	case q.JobID != nil && line.JobID != *q.JobID:
+		return false
+	case q.Step != nil && (line.Step == nil || *line.Step != *q.Step):
+		return false
+	case q.Stream != "" && line.Stream != q.Stream:
+		return false
+	case line.Time.Before(q.From) || !line.Time.Before(q.To):
+		return false
+	case q.After != nil && compareLogLines(line, q.After.line()) <= 0:
+		return false
+	case line.Seq <= q.AfterSeqs[line.JobID]:
+		return false
+	}
+	return true
 }
 
-func (r InfluxLogsRepo) Get(ctx context.Context, buildID int64) (logs []string, err error) {
-	logs = make([]string, 0)
+// LogCursor is the position of a log line in the order of [LogsReader.Get]:
+// by time, then job and sequence number. Lines can share a time, so the time
+// alone isn't a position.
+type LogCursor struct {
+	Time  time.Time `json:"t"`
+	JobID int64     `json:"j"`
+	Seq   int64     `json:"s"`
+}
 
-	query := fmt.Sprintf("from(bucket: \"%s\") |> range(start: -1h) |> filter(fn: (r) => r[\"_measurement\"] == \"%d\")", r.bucket, buildID)
-	queryAPI := r.influxClient.QueryAPI(r.org)
-	queryResult, err := queryAPI.Query(ctx, query)
+// String encodes the cursor for clients, which treat it as opaque, like the
+// cursors of lists.
+func (c LogCursor) String() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// ParseLogCursor decodes a cursor encoded by [LogCursor.String].
+func ParseLogCursor(s string) (LogCursor, error) {
+	var c LogCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("decode cursor: %w", err)
+	}
+	err = json.Unmarshal(raw, &c)
 	if err != nil {
-		return nil, fmt.Errorf("query influxdb: %w", err)
+		return c, fmt.Errorf("decode cursor: %w", err)
 	}
+	return c, nil
+}
+
+// CursorOf returns the position of line.
+func CursorOf(line LogLine) LogCursor {
+	return LogCursor{Time: line.Time, JobID: line.JobID, Seq: line.Seq}
+}
+
+func (c LogCursor) line() LogLine {
+	return LogLine{Time: c.Time, JobID: c.JobID, Seq: c.Seq}
+}
+
+// LogsReader reads log lines.
+type LogsReader interface {
+	// Get returns the log lines selected by query, ordered by time, then job
+	// and sequence number.
+	Get(ctx context.Context, query LogsQuery) (lines []LogLine, err error)
+}
 
-	for queryResult.Next() {
-		record := queryResult.Record()
-		logs = append(logs, fmt.Sprintf("%s: %s", record.Time(), record.Value()))
+// LogsWriter stores log lines as they arrive.
+type LogsWriter interface {
+	// Append stores lines of output. Lines of the same job must have distinct
+	// sequence numbers and times.
+	Append(ctx context.Context, lines []LogLine) (err error)
+
+	// Finalize is called once the build with buildID completed, so that the
+	// backend can compact its logs. Lines appended afterward must still be
+	// stored. It may be called more than once for the same build.
+	Finalize(ctx context.Context, buildID int64) (err error)
+
+	// Delete deletes all lines of the build with buildID.
+	Delete(ctx context.Context, buildID int64) (err error)
+}
+
+// LogsRepo is a logs storage backend, selected through configuration.
+type LogsRepo interface {
+	LogsReader
+	LogsWriter
+}
+
+// logsTimeSlack widens the time range searched for the logs of a build, to
+// allow for clock skew between the server and runners.
+const logsTimeSlack = time.Minute
+
+// LogsQueryForBuild returns a query for all lines of build, bounded by the
+// time it was created and, if it completed, the time it was last updated.
+func LogsQueryForBuild(build Build) LogsQuery {
+	query := LogsQuery{
+		BuildID: build.ID,
+		From:    build.CreatedAt.Add(-logsTimeSlack),
+		To:      time.Now().Add(logsTimeSlack),
+	}
+	if build.Status == "completed" {
+		query.To = build.UpdatedAt.Add(logsTimeSlack)
+	}
+	return query
+}
+
+// NarrowLogsQuery narrows the time range of query, which reads lines of the
+// jobs of a build that follow the lines read already, to the times those
+// lines can have. Lines of a job are never older than the last line read of
+// it, whose time is in last, nor, if none was, than the time the job started.
+// If no line was read at all, query isn't narrowed, as jobs of builds from
+// before they were timed don't know when they started.
+func NarrowLogsQuery(query LogsQuery, jobs []Job, last map[int64]time.Time) LogsQuery {
+	if len(last) == 0 {
+		return query
+	}
+
+	var from time.Time
+	for _, job := range jobs {
+		since, ok := last[job.ID]
+		if !ok {
+			if job.StartedAt == nil {
+				// Jobs that didn't start have no lines.
+				continue
+			}
+			since = job.StartedAt.Add(-logsTimeSlack)
+		}
+		if from.IsZero() || since.Before(from) {
+			from = since
+		}
 	}
 
-	return logs, nil
+	if from.After(query.From) {
+		query.From = from
+	}
+	return query
 }
 
-var _ LogsRepo = InfluxLogsRepo{}
+// FilterLogLines returns the lines selected by query, ordered the same way as
+// [LogsReader.Get]. It's used by backends that can't filter on their own.
+func FilterLogLines(lines []LogLine, query LogsQuery) []LogLine {
+	filtered := make([]LogLine, 0)
+	for _, line := range lines {
+		if query.matches(line) {
+			filtered = append(filtered, line)
+		}
+	}
+
+	slices.SortFunc(filtered, compareLogLines)
+	if query.Limit > 0 && len(filtered) > query.Limit {
+		filtered = filtered[:query.Limit]
+	}
+	return filtered
+}
+
+// compareLogLines orders lines by time, then job and sequence number.
+func compareLogLines(a, b LogLine) int {
+	return cmp.Or(a.Time.Compare(b.Time), cmp.Compare(a.JobID, b.JobID), cmp.Compare(a.Seq, b.Seq))
+}
 
-func NewInfluxLogsRepo(influxClient influxdb2.Client, org, bucket string) *InfluxLogsRepo {
-	return &InfluxLogsRepo{
-		influxClient: influxClient,
-		org:          org,
-		bucket:       bucket,
+// EncodeLogLines writes lines to w as JSON lines.
+func EncodeLogLines(w io.Writer, lines []LogLine) error {
+	encoder := json.NewEncoder(w)
+	for _, line := range lines {
+		err := encoder.Encode(line)
+		if err != nil {
+			return fmt.Errorf("encode log line: %w", err)
+		}
 	}
+	return nil
+}
+
+// DecodeLogLines reads JSON lines written by [EncodeLogLines] from r. If
+// reading fails, the lines read so far are returned together with the error.
+func DecodeLogLines(r io.Reader) ([]LogLine, error) {
+	lines := make([]LogLine, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line LogLine
+		err := json.Unmarshal(scanner.Bytes(), &line)
+		if err != nil {
+			return lines, fmt.Errorf("decode log line: %w", err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return lines, fmt.Errorf("read log lines: %w", err)
+	}
+
+	return lines, nil
 }
@@ -0,0 +1,202 @@
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// FilesystemLogsRepo stores the log lines of every build as JSON lines in a
+// gzip-compressed file in a directory.
+//
+// Every appended batch is a separate gzip member, which readers decompress as
+// a single stream. Finalize recompresses the file as a single member, which
+// compresses better.
+//
+// Files are only locked within a process, so the directory must not be shared
+// by multiple server replicas.
+type FilesystemLogsRepo struct {
+	dir string
+
+	// locks serializes writes to the file of a build within this process.
+	locks sync.Map // build ID -> *sync.Mutex
+}
+
+func (r *FilesystemLogsRepo) Get(ctx context.Context, query LogsQuery) (lines []LogLine, err error) {
+	all, err := r.read(query.BuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterLogLines(all, query), nil
+}
+
+func (r *FilesystemLogsRepo) Append(ctx context.Context, lines []LogLine) (err error) {
+	byBuild := make(map[int64][]LogLine)
+	for _, line := range lines {
+		byBuild[line.BuildID] = append(byBuild[line.BuildID], line)
+	}
+
+	for buildID, buildLines := range byBuild {
+		member, err := compressLogLines(buildLines)
+		if err != nil {
+			return err
+		}
+
+		err = r.withLock(buildID, func() error {
+			f, err := os.OpenFile(r.path(buildID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return fmt.Errorf("open logs file: %w", err)
+			}
+			defer f.Close()
+
+			// A single write, so that concurrent readers see either none or
+			// all of the member.
+			_, err = f.Write(member)
+			if err != nil {
+				return fmt.Errorf("write logs file: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *FilesystemLogsRepo) Finalize(ctx context.Context, buildID int64) (err error) {
+	return r.withLock(buildID, func() error {
+		lines, err := r.read(buildID)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+
+		slices.SortFunc(lines, compareLogLines)
+		compressed, err := compressLogLines(lines)
+		if err != nil {
+			return err
+		}
+
+		// Replace the file atomically, so that readers never see it
+		// half-written.
+		tmp, err := os.CreateTemp(r.dir, filepath.Base(r.path(buildID))+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("create temporary logs file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+
+		_, err = tmp.Write(compressed)
+		if err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("write temporary logs file: %w", err)
+		}
+		err = tmp.Close()
+		if err != nil {
+			return fmt.Errorf("close temporary logs file: %w", err)
+		}
+
+		err = os.Rename(tmp.Name(), r.path(buildID))
+		if err != nil {
+			return fmt.Errorf("replace logs file: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *FilesystemLogsRepo) Delete(ctx context.Context, buildID int64) (err error) {
+	return r.withLock(buildID, func() error {
+		err := os.Remove(r.path(buildID))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove logs file: %w", err)
+		}
+		return nil
+	})
+}
+
+// read returns all lines of the build with buildID, in the order they were
+// appended.
+func (r *FilesystemLogsRepo) read(buildID int64) ([]LogLine, error) {
+	lines := make([]LogLine, 0)
+
+	f, err := os.Open(r.path(buildID))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return lines, nil
+		}
+		return nil, fmt.Errorf("open logs file: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			// The file was just created and is still empty.
+			return lines, nil
+		}
+		return nil, fmt.Errorf("read logs file: %w", err)
+	}
+	defer gz.Close()
+
+	lines, err = DecodeLogLines(gz)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		// A member that's being appended right now is incomplete.
+		return nil, fmt.Errorf("read logs file: %w", err)
+	}
+
+	return lines, nil
+}
+
+func (r *FilesystemLogsRepo) withLock(buildID int64, f func() error) error {
+	mu, _ := r.locks.LoadOrStore(buildID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+	return f()
+}
+
+func (r *FilesystemLogsRepo) path(buildID int64) string {
+	return filepath.Join(r.dir, strconv.FormatInt(buildID, 10)+".log.gz")
+}
+
+// compressLogLines returns lines as JSON lines in a single gzip member.
+func compressLogLines(lines []LogLine) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	err := EncodeLogLines(gz, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return nil, fmt.Errorf("compress log lines: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var _ LogsRepo = &FilesystemLogsRepo{}
+
+// NewFilesystemLogsRepo returns a repo that stores logs in dir, which is
+// created if it doesn't exist.
+func NewFilesystemLogsRepo(dir string) (*FilesystemLogsRepo, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("create logs directory: %w", err)
+	}
+
+	return &FilesystemLogsRepo{dir: dir}, nil
+}
@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// logsMeasurement is the measurement all log lines are stored in. The build,
+// job, step and stream are tags, the sequence number and text are fields.
+const logsMeasurement = "logs"
+
+// Lines written before logsMeasurement was introduced are stored in a
+// measurement per build, named after the build ID, with the text in the
+// legacyLogsField field and an optional job_id tag. They're still read, but
+// never written.
+const legacyLogsField = "Log"
+
+type InfluxLogsRepo struct {
+	influxClient influxdb2.Client
+	org          string
+	bucket       string
+}
+
+// Get implements [LogsReader]. The lines of builds that have none in
+// logsMeasurement are read from their legacy measurement.
+func (r InfluxLogsRepo) Get(ctx context.Context, query LogsQuery) (lines []LogLine, err error) {
+	lines, err = r.get(ctx, query)
+	if err != nil || len(lines) > 0 {
+		return lines, err
+	}
+
+	// The query may select no lines of a build that has some, for example
+	// because they're all before its cursor.
+	current, err := r.hasLines(ctx, query.BuildID)
+	if err != nil || current {
+		return lines, err
+	}
+
+	return r.getLegacy(ctx, query)
+}
+
+// hasLines reports whether the build with buildID has any lines in
+// logsMeasurement.
+func (r InfluxLogsRepo) hasLines(ctx context.Context, buildID int64) (bool, error) {
+	flux := fmt.Sprintf(
+		"from(bucket: \"%s\") |> range(start: 0) "+
+			"|> filter(fn: (r) => r[\"_measurement\"] == \"%s\" and r[\"build_id\"] == \"%d\") |> limit(n: 1)",
+		r.bucket, logsMeasurement, buildID,
+	)
+
+	queryAPI := r.influxClient.QueryAPI(r.org)
+	queryResult, err := queryAPI.Query(ctx, flux)
+	if err != nil {
+		return false, fmt.Errorf("query influxdb: %w", err)
+	}
+	defer func() { _ = queryResult.Close() }()
+
+	found := queryResult.Next()
+	if queryResult.Err() != nil {
+		return false, fmt.Errorf("read influxdb query result: %w", queryResult.Err())
+	}
+	return found, nil
+}
+
+func (r InfluxLogsRepo) get(ctx context.Context, query LogsQuery) (lines []LogLine, err error) {
+	lines = make([]LogLine, 0)
+
+	// Lines at the time of the cursor may still be after it.
+	from := query.From
+	if query.After != nil && query.After.Time.After(from) {
+		from = query.After.Time
+	}
+	if !from.Before(query.To) {
+		return lines, nil
+	}
+
+	filters := []string{
+		fmt.Sprintf("r[\"_measurement\"] == \"%s\"", logsMeasurement),
+		fmt.Sprintf("r[\"build_id\"] == \"%d\"", query.BuildID),
+	}
+	if query.JobID != nil {
+		filters = append(filters, fmt.Sprintf("r[\"job_id\"] == \"%d\"", *query.JobID))
+	}
+	if query.Step != nil {
+		filters = append(filters, fmt.Sprintf("r[\"step\"] == \"%d\"", *query.Step))
+	}
+	if query.Stream != "" {
+		filters = append(filters, fmt.Sprintf("r[\"stream\"] == %s", strconv.Quote(query.Stream)))
+	}
+
+	// Tags are strings, so lines are sorted by the job ID as a number in the
+	// job column, as compareLogLines does.
+	flux := fmt.Sprintf(
+		"from(bucket: \"%s\") |> range(start: %s, stop: %s) |> filter(fn: (r) => %s) "+
+			"|> pivot(rowKey: [\"_time\"], columnKey: [\"_field\"], valueColumn: \"_value\") "+
+			"|> map(fn: (r) => ({r with job: int(v: r.job_id)})) "+
+			"|> group() |> sort(columns: [\"_time\", \"job\", \"seq\"])",
+		r.bucket, from.UTC().Format(time.RFC3339Nano), query.To.UTC().Format(time.RFC3339Nano), strings.Join(filters, " and "),
+	)
+	// Flux can't compare lines with cursors, so lines before them are
+	// skipped, and the limit applied, while reading.
+	if query.Limit > 0 && query.After == nil && len(query.AfterSeqs) == 0 {
+		flux += fmt.Sprintf(" |> limit(n: %d)", query.Limit)
+	}
+
+	queryAPI := r.influxClient.QueryAPI(r.org)
+	queryResult, err := queryAPI.Query(ctx, flux)
+	if err != nil {
+		return nil, fmt.Errorf("query influxdb: %w", err)
+	}
+	defer func() { _ = queryResult.Close() }()
+
+	for queryResult.Next() {
+		record := queryResult.Record()
+
+		line := LogLine{
+			BuildID: query.BuildID,
+			Stream:  LogStreamStdout,
+			Time:    record.Time(),
+		}
+		line.JobID, _ = strconv.ParseInt(fmt.Sprint(record.ValueByKey("job_id")), 10, 64)
+		if step, ok := record.ValueByKey("step").(string); ok {
+			if i, err := strconv.Atoi(step); err == nil {
+				line.Step = &i
+			}
+		}
+		if stream, ok := record.ValueByKey("stream").(string); ok {
+			line.Stream = stream
+		}
+		if seq, ok := record.ValueByKey("seq").(int64); ok {
+			line.Seq = seq
+		}
+		if text, ok := record.ValueByKey("text").(string); ok {
+			line.Text = text
+		}
+
+		if line.Seq <= query.AfterSeqs[line.JobID] {
+			continue
+		}
+		if query.After != nil && compareLogLines(line, query.After.line()) <= 0 {
+			continue
+		}
+		lines = append(lines, line)
+		if query.Limit > 0 && len(lines) == query.Limit {
+			break
+		}
+	}
+	if queryResult.Err() != nil {
+		return nil, fmt.Errorf("read influxdb query result: %w", queryResult.Err())
+	}
+
+	return lines, nil
+}
+
+// getLegacy returns the lines selected by query from the legacy measurement of
+// the build. They have no sequence numbers, so the lines of each job are
+// numbered in the order of their times, which requires reading all of them
+// before the query is applied.
+func (r InfluxLogsRepo) getLegacy(ctx context.Context, query LogsQuery) (lines []LogLine, err error) {
+	flux := fmt.Sprintf(
+		"from(bucket: \"%s\") |> range(start: %s, stop: %s) "+
+			"|> filter(fn: (r) => r[\"_measurement\"] == \"%d\" and r[\"_field\"] == \"%s\") "+
+			"|> group() |> sort(columns: [\"_time\"])",
+		r.bucket, query.From.UTC().Format(time.RFC3339Nano), query.To.UTC().Format(time.RFC3339Nano), query.BuildID, legacyLogsField,
+	)
+
+	queryAPI := r.influxClient.QueryAPI(r.org)
+	queryResult, err := queryAPI.Query(ctx, flux)
+	if err != nil {
+		return nil, fmt.Errorf("query influxdb: %w", err)
+	}
+
+	all := make([]LogLine, 0)
+	seqs := make(map[int64]int64)
+	for queryResult.Next() {
+		record := queryResult.Record()
+
+		line := LogLine{
+			BuildID: query.BuildID,
+			Stream:  LogStreamStdout,
+			Time:    record.Time(),
+			Text:    fmt.Sprint(record.Value()),
+		}
+		line.JobID, _ = strconv.ParseInt(fmt.Sprint(record.ValueByKey("job_id")), 10, 64)
+		seqs[line.JobID]++
+		line.Seq = seqs[line.JobID]
+
+		all = append(all, line)
+	}
+	if queryResult.Err() != nil {
+		return nil, fmt.Errorf("read influxdb query result: %w", queryResult.Err())
+	}
+
+	return FilterLogLines(all, query), nil
+}
+
+// Finalize implements [LogsWriter]. Influx needs no compaction.
+func (r InfluxLogsRepo) Finalize(ctx context.Context, buildID int64) (err error) {
+	return nil
+}
+
+func (r InfluxLogsRepo) Append(ctx context.Context, lines []LogLine) (err error) {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	// Points with equal measurement, tags and time overwrite each other.
+	points := make([]*write.Point, 0, len(lines))
+	for _, line := range lines {
+		tags := map[string]string{
+			"build_id": strconv.FormatInt(line.BuildID, 10),
+			"job_id":   strconv.FormatInt(line.JobID, 10),
+			"stream":   line.Stream,
+		}
+		if line.Step != nil {
+			tags["step"] = strconv.Itoa(*line.Step)
+		}
+
+		point := influxdb2.NewPoint(
+			logsMeasurement,
+			tags,
+			map[string]interface{}{"seq": line.Seq, "text": line.Text},
+			line.Time,
+		)
+		points = append(points, point)
+	}
+
+	writeAPI := r.influxClient.WriteAPIBlocking(r.org, r.bucket)
+	err = writeAPI.WritePoint(ctx, points...)
+	if err != nil {
+		return fmt.Errorf("write to influxdb: %w", err)
+	}
+
+	return nil
+}
+
+func (r InfluxLogsRepo) Delete(ctx context.Context, buildID int64) (err error) {
+	predicate := fmt.Sprintf("_measurement=\"%s\" AND build_id=\"%d\"", logsMeasurement, buildID)
+	err = r.influxClient.DeleteAPI().DeleteWithName(ctx, r.org, r.bucket, time.Unix(0, 0), time.Now().Add(time.Hour), predicate)
+	if err != nil {
+		return fmt.Errorf("delete from influxdb: %w", err)
+	}
+
+	predicate = fmt.Sprintf("_measurement=\"%d\"", buildID)
+	err = r.influxClient.DeleteAPI().DeleteWithName(ctx, r.org, r.bucket, time.Unix(0, 0), time.Now().Add(time.Hour), predicate)
+	if err != nil {
+		return fmt.Errorf("delete legacy logs from influxdb: %w", err)
+	}
+
+	return nil
+}
+
+var _ LogsRepo = InfluxLogsRepo{}
+
+func NewInfluxLogsRepo(influxClient influxdb2.Client, org, bucket string) *InfluxLogsRepo {
+	return &InfluxLogsRepo{
+		influxClient: influxClient,
+		org:          org,
+		bucket:       bucket,
+	}
+}
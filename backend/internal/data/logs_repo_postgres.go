@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PostgresLogsRepo stores log lines in the "log_lines" table.
+type PostgresLogsRepo struct {
+	db *sqlx.DB
+}
+
+type logLineRow struct {
+	BuildID int64     `db:"build_id"`
+	JobID   int64     `db:"job_id"`
+	Step    *int      `db:"step"`
+	Stream  string    `db:"stream"`
+	Seq     int64     `db:"seq"`
+	Time    time.Time `db:"time"`
+	Text    string    `db:"text"`
+}
+
+func (p PostgresLogsRepo) Get(ctx context.Context, query LogsQuery) (lines []LogLine, err error) {
+	var limit *int
+	if query.Limit > 0 {
+		limit = &query.Limit
+	}
+	var stream *string
+	if query.Stream != "" {
+		stream = &query.Stream
+	}
+
+	var afterTime *time.Time
+	var afterJobID, afterSeq *int64
+	if query.After != nil {
+		afterTime, afterJobID, afterSeq = &query.After.Time, &query.After.JobID, &query.After.Seq
+	}
+
+	afterJobIDs := make(pq.Int64Array, 0, len(query.AfterSeqs))
+	afterSeqs := make(pq.Int64Array, 0, len(query.AfterSeqs))
+	for jobID, seq := range query.AfterSeqs {
+		afterJobIDs = append(afterJobIDs, jobID)
+		afterSeqs = append(afterSeqs, seq)
+	}
+
+	rows := make([]logLineRow, 0)
+	err = p.db.SelectContext(ctx, &rows, `
+		SELECT build_id, job_id, step, stream, seq, time, text
+		FROM bee_schema.log_lines
+		WHERE build_id = $1
+		  AND time >= $2 AND time < $3
+		  AND ($4::TIMESTAMPTZ IS NULL OR (time, job_id, seq) > ($4, $11, $12))
+		  AND ($5::BIGINT IS NULL OR job_id = $5)
+		  AND ($6::INTEGER IS NULL OR step = $6)
+		  AND ($7::VARCHAR IS NULL OR stream = $7)
+		  AND seq > COALESCE((
+		      SELECT positions.seq
+		      FROM unnest($9::BIGINT[], $10::BIGINT[]) AS positions(job_id, seq)
+		      WHERE positions.job_id = log_lines.job_id
+		  ), 0)
+		ORDER BY time, job_id, seq
+		LIMIT $8
+	`, query.BuildID, query.From, query.To, afterTime, query.JobID, query.Step, stream, limit, afterJobIDs, afterSeqs, afterJobID, afterSeq)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from log_lines: %v", err)
+	}
+
+	lines = make([]LogLine, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, LogLine(row))
+	}
+
+	return lines, nil
+}
+
+func (p PostgresLogsRepo) Append(ctx context.Context, lines []LogLine) (err error) {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	var (
+		buildIDs = make(pq.Int64Array, 0, len(lines))
+		jobIDs   = make(pq.Int64Array, 0, len(lines))
+		steps    = make([]sql.NullInt64, 0, len(lines))
+		streams  = make(pq.StringArray, 0, len(lines))
+		seqs     = make(pq.Int64Array, 0, len(lines))
+		times    = make(pq.StringArray, 0, len(lines))
+		texts    = make(pq.StringArray, 0, len(lines))
+	)
+	for _, line := range lines {
+		step := sql.NullInt64{}
+		if line.Step != nil {
+			step = sql.NullInt64{Int64: int64(*line.Step), Valid: true}
+		}
+
+		buildIDs = append(buildIDs, line.BuildID)
+		jobIDs = append(jobIDs, line.JobID)
+		steps = append(steps, step)
+		streams = append(streams, line.Stream)
+		seqs = append(seqs, line.Seq)
+		times = append(times, line.Time.UTC().Format(time.RFC3339Nano))
+		texts = append(texts, line.Text)
+	}
+
+	// Lines that are sent again, for example when a runner retries a request,
+	// are ignored.
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO bee_schema.log_lines (build_id, job_id, step, stream, seq, time, text)
+		SELECT *
+		FROM unnest($1::BIGINT[], $2::BIGINT[], $3::INTEGER[], $4::VARCHAR[], $5::BIGINT[], $6::TIMESTAMPTZ[], $7::TEXT[])
+		ON CONFLICT DO NOTHING
+	`, buildIDs, jobIDs, pq.Array(steps), streams, seqs, times, texts)
+	if err != nil {
+		return fmt.Errorf("inserting into log_lines: %v", err)
+	}
+
+	return nil
+}
+
+// Finalize implements [LogsWriter]. Postgres needs no compaction.
+func (p PostgresLogsRepo) Finalize(ctx context.Context, buildID int64) (err error) {
+	return nil
+}
+
+func (p PostgresLogsRepo) Delete(ctx context.Context, buildID int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		DELETE FROM bee_schema.log_lines
+		WHERE build_id = $1
+	`, buildID)
+	if err != nil {
+		return fmt.Errorf("deleting from log_lines: %v", err)
+	}
+
+	return nil
+}
+
+var _ LogsRepo = PostgresLogsRepo{}
+
+func NewPostgresLogsRepo(db *sqlx.DB) *PostgresLogsRepo {
+	return &PostgresLogsRepo{db: db}
+}
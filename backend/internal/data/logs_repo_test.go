@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+// The logs backends are tested against the same suite, so that they can be
+// swapped through configuration. Backends that need a server are skipped
+// unless it's configured:
+//   - TEST_POSTGRES_URL: connection string of a migrated database
+//   - TEST_INFLUXDB_URL, TEST_INFLUXDB_TOKEN, TEST_INFLUXDB_ORG and
+//     TEST_INFLUXDB_BUCKET: an InfluxDB server
+
+func TestFilesystemLogsRepo(t *testing.T) {
+	repo, err := NewFilesystemLogsRepo(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testLogsRepo(t, repo)
+}
+
+func TestPostgresLogsRepo(t *testing.T) {
+	url := os.Getenv("TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("TEST_POSTGRES_URL isn't set")
+	}
+
+	db, err := sqlx.Connect("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	testLogsRepo(t, NewPostgresLogsRepo(db))
+}
+
+func TestInfluxLogsRepo(t *testing.T) {
+	url := os.Getenv("TEST_INFLUXDB_URL")
+	if url == "" {
+		t.Skip("TEST_INFLUXDB_URL isn't set")
+	}
+
+	client := influxdb2.NewClient(url, os.Getenv("TEST_INFLUXDB_TOKEN"))
+	t.Cleanup(client.Close)
+
+	testLogsRepo(t, NewInfluxLogsRepo(client, os.Getenv("TEST_INFLUXDB_ORG"), os.Getenv("TEST_INFLUXDB_BUCKET")))
+}
+
+// testLogsRepo runs the conformance suite against repo. Every subtest uses
+// its own build, so that they don't see each other's lines.
+func testLogsRepo(t *testing.T, repo LogsRepo) {
+	ctx := context.Background()
+
+	// Build IDs that aren't used by real builds of a shared test database.
+	nextBuildID := time.Now().UnixNano()
+	newBuild := func(t *testing.T) int64 {
+		nextBuildID++
+		buildID := nextBuildID
+		t.Cleanup(func() { _ = repo.Delete(ctx, buildID) })
+		return buildID
+	}
+
+	// Microsecond precision, which every backend stores.
+	start := time.Now().Truncate(time.Microsecond)
+	step0, step1 := 0, 1
+
+	// lines returns lines of two jobs, which share some times, in the order
+	// Get returns them.
+	lines := func(buildID int64) []LogLine {
+		return []LogLine{
+			{BuildID: buildID, JobID: 1, Step: &step0, Stream: LogStreamStdout, Seq: 1, Time: start, Text: "a1"},
+			{BuildID: buildID, JobID: 2, Step: &step0, Stream: LogStreamStdout, Seq: 1, Time: start, Text: "b1"},
+			{BuildID: buildID, JobID: 1, Step: &step0, Stream: LogStreamStderr, Seq: 2, Time: start.Add(time.Microsecond), Text: "a2"},
+			{BuildID: buildID, JobID: 2, Step: &step1, Stream: LogStreamStdout, Seq: 2, Time: start.Add(time.Microsecond), Text: "b2"},
+			{BuildID: buildID, JobID: 1, Step: &step1, Stream: LogStreamStdout, Seq: 3, Time: start.Add(2 * time.Microsecond), Text: "a3"},
+			{BuildID: buildID, JobID: 2, Step: &step1, Stream: LogStreamStderr, Seq: 3, Time: start.Add(3 * time.Microsecond), Text: "b3"},
+		}
+	}
+	query := func(buildID int64) LogsQuery {
+		return LogsQuery{BuildID: buildID, From: start.Add(-time.Minute), To: start.Add(time.Minute)}
+	}
+
+	// appendLines appends lines in batches of the given size, in reverse, so
+	// that backends can't rely on lines arriving in order.
+	appendLines := func(t *testing.T, lines []LogLine, batchSize int) {
+		t.Helper()
+		reversed := slices.Clone(lines)
+		slices.Reverse(reversed)
+		for batch := range slices.Chunk(reversed, batchSize) {
+			err := repo.Append(ctx, batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	get := func(t *testing.T, query LogsQuery) []LogLine {
+		t.Helper()
+		got, err := repo.Get(ctx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	t.Run("Get returns lines ordered by time, job and sequence number", func(t *testing.T) {
+		buildID := newBuild(t)
+		want := lines(buildID)
+		appendLines(t, want, 2)
+
+		assertLines(t, get(t, query(buildID)), want)
+	})
+
+	t.Run("Get of a build without lines returns none", func(t *testing.T) {
+		assertLines(t, get(t, query(newBuild(t))), []LogLine{})
+	})
+
+	t.Run("Get filters by job, step and stream", func(t *testing.T) {
+		buildID := newBuild(t)
+		all := lines(buildID)
+		appendLines(t, all, len(all))
+
+		jobID := int64(2)
+		q := query(buildID)
+		q.JobID = &jobID
+		assertLines(t, get(t, q), []LogLine{all[1], all[3], all[5]})
+
+		q = query(buildID)
+		q.Step = &step1
+		assertLines(t, get(t, q), []LogLine{all[3], all[4], all[5]})
+
+		q = query(buildID)
+		q.Stream = LogStreamStderr
+		assertLines(t, get(t, q), []LogLine{all[2], all[5]})
+	})
+
+	t.Run("Get is bounded by From and an exclusive To", func(t *testing.T) {
+		buildID := newBuild(t)
+		all := lines(buildID)
+		appendLines(t, all, len(all))
+
+		q := query(buildID)
+		q.From = start.Add(time.Microsecond)
+		q.To = start.Add(3 * time.Microsecond)
+		assertLines(t, get(t, q), all[2:5])
+	})
+
+	t.Run("Get pages with After across lines that share a time", func(t *testing.T) {
+		buildID := newBuild(t)
+		all := lines(buildID)
+		appendLines(t, all, len(all))
+
+		got := make([]LogLine, 0)
+		q := query(buildID)
+		q.Limit = 1
+		for range len(all) + 1 {
+			page := get(t, q)
+			if len(page) == 0 {
+				break
+			}
+			got = append(got, page...)
+			cursor := CursorOf(page[len(page)-1])
+			q.After = &cursor
+		}
+		assertLines(t, got, all)
+	})
+
+	t.Run("Get orders and pages jobs by their number", func(t *testing.T) {
+		buildID := newBuild(t)
+		all := []LogLine{
+			{BuildID: buildID, JobID: 9, Step: &step0, Stream: LogStreamStdout, Seq: 1, Time: start, Text: "i1"},
+			{BuildID: buildID, JobID: 10, Step: &step0, Stream: LogStreamStdout, Seq: 1, Time: start, Text: "j1"},
+			{BuildID: buildID, JobID: 9, Step: &step0, Stream: LogStreamStdout, Seq: 2, Time: start.Add(time.Microsecond), Text: "i2"},
+			{BuildID: buildID, JobID: 10, Step: &step0, Stream: LogStreamStdout, Seq: 2, Time: start.Add(time.Microsecond), Text: "j2"},
+		}
+		appendLines(t, all, len(all))
+
+		assertLines(t, get(t, query(buildID)), all)
+
+		got := make([]LogLine, 0)
+		q := query(buildID)
+		q.Limit = 1
+		for range len(all) + 1 {
+			page := get(t, q)
+			if len(page) == 0 {
+				break
+			}
+			got = append(got, page...)
+			cursor := CursorOf(page[len(page)-1])
+			q.After = &cursor
+		}
+		assertLines(t, got, all)
+	})
+
+	t.Run("Get skips lines up to AfterSeqs of their job", func(t *testing.T) {
+		buildID := newBuild(t)
+		all := lines(buildID)
+		appendLines(t, all, len(all))
+
+		q := query(buildID)
+		q.AfterSeqs = map[int64]int64{1: 2, 2: 0}
+		assertLines(t, get(t, q), []LogLine{all[1], all[3], all[4], all[5]})
+
+		q.Limit = 2
+		assertLines(t, get(t, q), []LogLine{all[1], all[3]})
+	})
+
+	t.Run("Finalize keeps lines and accepts more", func(t *testing.T) {
+		buildID := newBuild(t)
+		all := lines(buildID)
+		appendLines(t, all[:4], 1)
+
+		err := repo.Finalize(ctx, buildID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertLines(t, get(t, query(buildID)), all[:4])
+
+		appendLines(t, all[4:], 1)
+		err = repo.Finalize(ctx, buildID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertLines(t, get(t, query(buildID)), all)
+	})
+
+	t.Run("Delete deletes the lines of the build only", func(t *testing.T) {
+		buildID, otherBuildID := newBuild(t), newBuild(t)
+		appendLines(t, lines(buildID), 3)
+		other := lines(otherBuildID)
+		appendLines(t, other, 3)
+
+		err := repo.Delete(ctx, buildID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertLines(t, get(t, query(buildID)), []LogLine{})
+		assertLines(t, get(t, query(otherBuildID)), other)
+
+		err = repo.Delete(ctx, buildID)
+		if err != nil {
+			t.Fatalf("deleting again: %v", err)
+		}
+	})
+}
+
+func assertLines(t *testing.T, got, want []LogLine) {
+	t.Helper()
+
+	equal := slices.EqualFunc(got, want, func(a, b LogLine) bool {
+		return a.BuildID == b.BuildID && a.JobID == b.JobID && a.Seq == b.Seq && a.Stream == b.Stream &&
+			a.Text == b.Text && a.Time.Equal(b.Time) &&
+			(a.Step == nil) == (b.Step == nil) && (a.Step == nil || *a.Step == *b.Step)
+	})
+	if !equal {
+		t.Errorf("got lines:\n%s\nwant:\n%s", formatLines(got), formatLines(want))
+	}
+}
+
+func formatLines(lines []LogLine) string {
+	var b strings.Builder
+	for _, line := range lines {
+		step := "-"
+		if line.Step != nil {
+			step = strconv.Itoa(*line.Step)
+		}
+		fmt.Fprintf(&b, "  %s build %d job %d seq %d step %s %s %q\n",
+			line.Time.Format(time.RFC3339Nano), line.BuildID, line.JobID, line.Seq, step, line.Stream, line.Text)
+	}
+	return b.String()
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// activeBuildsQuery selects the builds that haven't completed, whether they
+// are running, and their turn within their installation, from the
+// active_builds view. It defines the queue order described in package queue,
+// which the next_job database function that [JobRepo.Claim] uses follows too,
+// so that the positions reported by [QueueRepo.GetAll] match the claim order.
+const activeBuildsQuery = `
+	SELECT builds.*, active_builds.running, active_builds.turn
+	FROM bee_schema.builds builds
+	JOIN bee_schema.active_builds active_builds ON active_builds.id = builds.id
+`
+
+// QueuedBuild is a build none of whose jobs was claimed yet.
+type QueuedBuild struct {
+	FatBuild
+
+	// Position is the position of the build in the queue, starting at 1.
+	Position int `db:"position"`
+
+	// Running is the number of builds that are running.
+	Running int `db:"running_builds"`
+
+	// AverageDuration is the average duration (in seconds) of recent builds
+	// of the repository, or of all repositories if it has none. Nil if there
+	// are no recent builds.
+	AverageDuration *float64 `db:"average_duration_seconds"`
+}
+
+type QueueRepo interface {
+	// GetAll returns all queued builds, in the order they will be started.
+	GetAll(ctx context.Context) (builds []QueuedBuild, err error)
+
+	// GetCapacity returns the number of jobs that runners which sent a
+	// heartbeat within onlineWithin can run at the same time.
+	GetCapacity(ctx context.Context, onlineWithin time.Duration) (capacity int, err error)
+}
+
+type PostgresQueueRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresQueueRepo) GetAll(ctx context.Context) (builds []QueuedBuild, err error) {
+	builds = make([]QueuedBuild, 0)
+	err = p.db.SelectContext(ctx, &builds, `
+		WITH active AS (`+activeBuildsQuery+`),
+		queued AS (
+			SELECT active.*, ROW_NUMBER() OVER (ORDER BY active.priority DESC, active.turn, active.created_at, active.id) AS position
+			FROM active
+			WHERE NOT active.running
+		),
+		recent AS (
+			SELECT builds.repo_id,
+			       EXTRACT(EPOCH FROM builds.updated_at - MIN(jobs.started_at)) AS seconds,
+			       ROW_NUMBER() OVER (PARTITION BY builds.repo_id ORDER BY builds.id DESC) AS n
+			FROM bee_schema.builds builds
+			JOIN bee_schema.jobs jobs ON jobs.build_id = builds.id
+			WHERE builds.status = 'completed'
+			  AND builds.created_at > NOW() - INTERVAL '30 days'
+			  AND jobs.started_at IS NOT NULL
+			GROUP BY builds.id
+		),
+		durations AS (
+			SELECT repo_id, AVG(seconds) AS seconds
+			FROM recent
+			WHERE n <= 20
+			GROUP BY repo_id
+		)
+		SELECT queued.id, queued.number, queued.repo_id, queued.commit_sha, queued.commit_message, queued.installation_id,
+		       queued.check_run_id, queued.status, queued.conclusion, queued.created_at, queued.updated_at,
+		       queued.branch, queued.event, queued.labels, queued.inputs, queued.priority, queued.from_fork, queued.actor,
+		       repos.name AS repo_name, users.id AS user_id, users.username AS user_name,
+		       queued.position,
+		       (SELECT COUNT(*) FROM active WHERE active.running) AS running_builds,
+		       COALESCE(durations.seconds, (SELECT AVG(seconds) FROM durations)) AS average_duration_seconds
+		FROM queued
+		JOIN bee_schema.repos repos ON repos.id = queued.repo_id
+		JOIN bee_schema.users users ON users.id = repos.user_id
+		LEFT JOIN durations ON durations.repo_id = queued.repo_id
+		ORDER BY queued.position
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query: %v", err)
+	}
+
+	return builds, nil
+}
+
+func (p PostgresQueueRepo) GetCapacity(ctx context.Context, onlineWithin time.Duration) (capacity int, err error) {
+	err = p.db.GetContext(ctx, &capacity, `
+		SELECT COALESCE(SUM(max_concurrency), 0)
+		FROM bee_schema.runners
+		WHERE last_heartbeat_at > NOW() - make_interval(secs => $1)
+	`, onlineWithin.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("executing SELECT query: %v", err)
+	}
+
+	return capacity, nil
+}
+
+var _ QueueRepo = &PostgresQueueRepo{}
+
+func NewPostgresQueueRepo(db *sqlx.DB) *PostgresQueueRepo {
+	return &PostgresQueueRepo{db: db}
+}
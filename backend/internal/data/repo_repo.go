@@ -2,41 +2,166 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type Repo struct {
-	ID     int64  `db:"id"`
-	Name   string `db:"name"`
-	UserID int64  `db:"user_id"`
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+
+	// FullName is the name of the repository with its owner, for example
+	// "bee-ci/bee-ci-system".
+	FullName string `db:"full_name"`
+
+	// Private is true if the repository is private, or its visibility is
+	// unknown.
+	Private bool `db:"private"`
+
+	UserID int64 `db:"user_id"`
+
+	// InstallationID is the installation through which the app can access
+	// the repository. It's nil for repositories created before it was
+	// recorded, until they're reconciled with GitHub.
+	InstallationID *int64 `db:"installation_id"`
+
+	// RemovedAt is when the app was removed from the repository, or nil if
+	// it's installed on it.
+	RemovedAt *time.Time `db:"removed_at"`
 }
 
 func (r Repo) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.Int64("id", r.ID),
 		slog.String("name", r.Name),
+		slog.String("full_name", r.FullName),
+		slog.Bool("private", r.Private),
 		slog.Int64("user_id", r.UserID),
+		slog.Any("installation_id", r.InstallationID),
+		slog.Any("removed_at", r.RemovedAt),
 	)
 }
 
+// PurgedRepo is what's left of a purged repository outside the database.
+type PurgedRepo struct {
+	// BuildIDs are the IDs of the builds of the repository, whose logs may be
+	// in the logs backend.
+	BuildIDs []int64
+
+	// BlobKeys are the keys of the log archives, artifacts and caches of the
+	// repository in blob storage.
+	BlobKeys []string
+}
+
+// RepoSettings are per-repository overrides of server-wide defaults. Nil
+// fields use the default.
+type RepoSettings struct {
+	// BuildTimeout is the time (in seconds) after which a build that started
+	// but hasn't completed is timed out.
+	BuildTimeout *int `db:"build_timeout_seconds"`
+
+	// MaxAttempts is how many times a job is claimed before it's timed out
+	// instead of being returned to the queue when its runner stops sending
+	// heartbeats.
+	MaxAttempts *int `db:"max_attempts"`
+
+	// MaxConcurrentBuilds is how many builds of the repository may run at the
+	// same time. Further builds wait in the queue.
+	MaxConcurrentBuilds *int `db:"max_concurrent_builds"`
+
+	// SecretsForForks is whether builds of pull requests from forks get the
+	// secrets of the repository and its installation.
+	SecretsForForks *bool `db:"secrets_for_forks"`
+}
+
+var repoSortColumns = map[string]sortColumn{
+	"name": stringColumn("name"),
+	"id":   intColumn("id"),
+}
+
 type RepoRepo interface {
+	// Upsert creates the repositories, or updates them if they exist. Removed
+	// repositories are restored, with their builds.
 	Upsert(ctx context.Context, repo []Repo) (err error)
-	Delete(ctx context.Context, id []int64) (err error)
+
+	// Remove marks the repositories with ids as removed. Removed repositories
+	// and their builds are left out of listings until they're restored by
+	// Upsert or purged.
+	Remove(ctx context.Context, ids []int64) (err error)
+
+	// RemoveByInstallation marks the repositories accessed through the
+	// installation with installationID as removed, like Remove.
+	RemoveByInstallation(ctx context.Context, installationID int64) (err error)
+
+	// GetRemoved returns up to limit repositories that were removed before
+	// removedBefore, removed longest ago first.
+	GetRemoved(ctx context.Context, removedBefore time.Time, limit int) (repos []Repo, err error)
+
+	// Purge deletes the repository with id and everything that belongs to it
+	// from the database, if it was removed before removedBefore. Returns
+	// ErrNotFound otherwise, for example if it was restored in the meantime.
+	Purge(ctx context.Context, id int64, removedBefore time.Time) (purged *PurgedRepo, err error)
 
 	// Get returns a repository with given id. It does not take user ownership into account, so be careful using it
-	// as to not expose additional data.
+	// as to not expose additional data. Removed repositories are returned
+	// too.
 	Get(ctx context.Context, id int64) (repo *Repo, err error)
 
-	// GetForUser returns a repository belonging to a given user.
+	// GetAllForInstallation returns the repositories accessed through the
+	// installation with installationID, including removed ones.
+	GetAllForInstallation(ctx context.Context, installationID int64) (repos []Repo, err error)
+
+	// GetForUser returns a repository belonging to a given user, unless it was
+	// removed.
 	GetForUser(ctx context.Context, userID, repoID int64) (repo *Repo, err error)
 
+	// GetByFullName returns the repository whose full name is fullName,
+	// ignoring case, unless it was removed.
+	GetByFullName(ctx context.Context, fullName string) (repo *Repo, err error)
+
 	// GetAllForUser retrieves all repositories for a given user and whose names are substrings of searchRepo.
 	//
 	// If searchRepo is empty, all repositories are considered.
 	GetAllForUser(ctx context.Context, searchRepo string, userID int64) (repos []Repo, err error)
+
+	// List returns a page of the repositories of userID whose names contain
+	// search, and the cursor of the next page, which is empty if it's the last
+	// page. If search is empty, all repositories are considered.
+	//
+	// Repositories can be sorted by "name" (the default) and "id".
+	List(ctx context.Context, userID int64, search string, opts ListOptions) (repos []Repo, nextCursor string, err error)
+
+	// Count returns how many repositories of userID have names that contain
+	// search.
+	Count(ctx context.Context, userID int64, search string) (count int, err error)
+
+	// GetSettings returns the settings of the repository with repoID.
+	GetSettings(ctx context.Context, repoID int64) (settings *RepoSettings, err error)
+
+	// UpdateSettings replaces the settings of the repository with repoID.
+	UpdateSettings(ctx context.Context, repoID int64, settings RepoSettings) (err error)
+
+	// GetDefaultBranch returns the default branch of the repository with
+	// repoID, or an empty string if it's unknown.
+	GetDefaultBranch(ctx context.Context, repoID int64) (branch string, err error)
+
+	// SetDefaultBranch records the default branch of the repository with
+	// repoID.
+	SetDefaultBranch(ctx context.Context, repoID int64, branch string) (err error)
+
+	// GetBadgeToken returns the token that makes the badges of the
+	// repository with repoID public, or an empty string if they aren't.
+	GetBadgeToken(ctx context.Context, repoID int64) (token string, err error)
+
+	// SetBadgeToken sets the token that makes the badges of the repository
+	// with repoID public. An empty token makes them private again.
+	SetBadgeToken(ctx context.Context, repoID int64, token string) (err error)
 }
 
 type PostgresRepoRepo struct {
@@ -46,11 +171,15 @@ type PostgresRepoRepo struct {
 func (p PostgresRepoRepo) Upsert(ctx context.Context, repos []Repo) (err error) {
 	_, err = p.db.NamedExecContext(
 		ctx,
-		`INSERT INTO bee_schema.repos (id, name, user_id)
-		VALUES (:id, :name, :user_id)
+		`INSERT INTO bee_schema.repos (id, name, full_name, private, user_id, installation_id)
+		VALUES (:id, :name, :full_name, :private, :user_id, :installation_id)
 		ON CONFLICT (id) DO UPDATE SET
 		name = EXCLUDED.name,
-		user_id = EXCLUDED.user_id
+		full_name = EXCLUDED.full_name,
+		private = EXCLUDED.private,
+		user_id = EXCLUDED.user_id,
+		installation_id = COALESCE(EXCLUDED.installation_id, repos.installation_id),
+		removed_at = NULL
 		`,
 		repos,
 	)
@@ -61,10 +190,15 @@ func (p PostgresRepoRepo) Upsert(ctx context.Context, repos []Repo) (err error)
 	return nil
 }
 
-func (p PostgresRepoRepo) Delete(ctx context.Context, ids []int64) (err error) {
+func (p PostgresRepoRepo) Remove(ctx context.Context, ids []int64) (err error) {
+	if len(ids) == 0 {
+		return nil
+	}
+
 	query, args, err := sqlx.In(`
-		DELETE FROM bee_schema.repos
-       	WHERE id IN (?)
+		UPDATE bee_schema.repos
+		SET removed_at = NOW()
+		WHERE id IN (?) AND removed_at IS NULL
 	`, ids)
 	if err != nil {
 		return fmt.Errorf("preparing query with IN clause: %v", err)
@@ -74,15 +208,114 @@ func (p PostgresRepoRepo) Delete(ctx context.Context, ids []int64) (err error) {
 
 	_, err = p.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("executing DELETE query: %v", err)
+		return fmt.Errorf("executing UPDATE query: %v", err)
 	}
 	return nil
 }
 
+func (p PostgresRepoRepo) RemoveByInstallation(ctx context.Context, installationID int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.repos
+		SET removed_at = NOW()
+		WHERE installation_id = $1 AND removed_at IS NULL
+	`, installationID)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+	return nil
+}
+
+func (p PostgresRepoRepo) GetRemoved(ctx context.Context, removedBefore time.Time, limit int) (repos []Repo, err error) {
+	repos = make([]Repo, 0)
+	err = p.db.SelectContext(ctx, &repos, `
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
+		FROM bee_schema.repos
+		WHERE removed_at < $1
+		ORDER BY removed_at, id
+		LIMIT $2
+	`, removedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return repos, nil
+}
+
+func (p PostgresRepoRepo) Purge(ctx context.Context, id int64, removedBefore time.Time) (*PurgedRepo, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// The lock makes Upsert wait, so that a repository that is restored
+	// concurrently is either purged first and then created again, or not
+	// purged at all.
+	var removed bool
+	err = tx.GetContext(ctx, &removed, `
+		SELECT COALESCE(removed_at < $2, FALSE)
+		FROM bee_schema.repos
+		WHERE id = $1
+		FOR UPDATE
+	`, id, removedBefore)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from repos: %v", err)
+	}
+	if !removed {
+		return nil, ErrNotFound
+	}
+
+	purged := PurgedRepo{BuildIDs: make([]int64, 0), BlobKeys: make([]string, 0)}
+	err = tx.SelectContext(ctx, &purged.BuildIDs, `
+		SELECT id
+		FROM bee_schema.builds
+		WHERE repo_id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from builds: %v", err)
+	}
+
+	err = tx.SelectContext(ctx, &purged.BlobKeys, `
+		SELECT log_archives.blob_key
+		FROM bee_schema.log_archives log_archives
+		JOIN bee_schema.builds builds ON builds.id = log_archives.build_id
+		WHERE builds.repo_id = $1
+		UNION ALL
+		SELECT artifacts.blob_key
+		FROM bee_schema.artifacts artifacts
+		JOIN bee_schema.builds builds ON builds.id = artifacts.build_id
+		WHERE builds.repo_id = $1
+		UNION ALL
+		SELECT blob_key
+		FROM bee_schema.caches
+		WHERE repo_id = $1
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("selecting blob keys: %v", err)
+	}
+
+	// Builds, and the rows that belong to them, are deleted by ON DELETE
+	// CASCADE.
+	_, err = tx.ExecContext(ctx, `DELETE FROM bee_schema.repos WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("executing DELETE query: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("committing transaction: %v", err)
+	}
+
+	return &purged, nil
+}
+
 func (p PostgresRepoRepo) Get(ctx context.Context, id int64) (repo *Repo, err error) {
 	repo = &Repo{}
 	err = p.db.GetContext(ctx, repo, `
-		SELECT id, name, user_id
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
 		FROM bee_schema.repos
 		WHERE id = $1
 	`, id)
@@ -93,14 +326,49 @@ func (p PostgresRepoRepo) Get(ctx context.Context, id int64) (repo *Repo, err er
 	return repo, nil
 }
 
+func (p PostgresRepoRepo) GetAllForInstallation(ctx context.Context, installationID int64) (repos []Repo, err error) {
+	repos = make([]Repo, 0)
+	err = p.db.SelectContext(ctx, &repos, `
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
+		FROM bee_schema.repos
+		WHERE installation_id = $1
+		ORDER BY id
+	`, installationID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return repos, nil
+}
+
 func (p PostgresRepoRepo) GetForUser(ctx context.Context, userID, repoID int64) (repo *Repo, err error) {
 	repo = &Repo{}
 	err = p.db.GetContext(ctx, repo, `
-		SELECT id, name, user_id
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
 		FROM bee_schema.repos
-		WHERE user_id = $1 AND id = $2
+		WHERE user_id = $1 AND id = $2 AND removed_at IS NULL
 	`, userID, repoID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return repo, nil
+}
+
+func (p PostgresRepoRepo) GetByFullName(ctx context.Context, fullName string) (repo *Repo, err error) {
+	repo = &Repo{}
+	err = p.db.GetContext(ctx, repo, `
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
+		FROM bee_schema.repos
+		WHERE LOWER(full_name) = LOWER($1) AND removed_at IS NULL
+	`, fullName)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
 		return nil, fmt.Errorf("selecting from repos: %v", err)
 	}
 
@@ -111,9 +379,9 @@ func (p PostgresRepoRepo) GetAllForUser(ctx context.Context, searchRepo string,
 	repos = make([]Repo, 0)
 
 	query := `
-		SELECT id, name, user_id
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
 		FROM bee_schema.repos
-		WHERE user_id = $1`
+		WHERE user_id = $1 AND removed_at IS NULL`
 	args := []interface{}{userID}
 	if searchRepo != "" {
 		query += " AND name ILIKE $2"
@@ -126,6 +394,137 @@ func (p PostgresRepoRepo) GetAllForUser(ctx context.Context, searchRepo string,
 	return repos, nil
 }
 
+func (p PostgresRepoRepo) List(ctx context.Context, userID int64, search string, opts ListOptions) (repos []Repo, nextCursor string, err error) {
+	k, err := newKeyset(opts, repoSortColumns, "name", "id")
+	if err != nil {
+		return nil, "", err
+	}
+
+	after, args, err := k.where([]any{userID, "%" + escapeLike(search) + "%"})
+	if err != nil {
+		return nil, "", err
+	}
+
+	repos = make([]Repo, 0)
+	err = p.db.SelectContext(ctx, &repos, `
+		SELECT id, name, full_name, private, user_id, installation_id, removed_at
+		FROM bee_schema.repos
+		WHERE user_id = $1 AND removed_at IS NULL AND name ILIKE $2 AND `+after+`
+		`+k.orderBy(), args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	repos, nextCursor = page(k, repos, func(repo Repo) (string, int64) {
+		if k.field == "id" {
+			return strconv.FormatInt(repo.ID, 10), repo.ID
+		}
+		return repo.Name, repo.ID
+	})
+	return repos, nextCursor, nil
+}
+
+func (p PostgresRepoRepo) Count(ctx context.Context, userID int64, search string) (count int, err error) {
+	err = p.db.GetContext(ctx, &count, `
+		SELECT COUNT(*)
+		FROM bee_schema.repos
+		WHERE user_id = $1 AND removed_at IS NULL AND name ILIKE $2
+	`, userID, "%"+escapeLike(search)+"%")
+	if err != nil {
+		return 0, fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return count, nil
+}
+
+func (p PostgresRepoRepo) GetSettings(ctx context.Context, repoID int64) (settings *RepoSettings, err error) {
+	settings = &RepoSettings{}
+	err = p.db.GetContext(ctx, settings, `
+		SELECT build_timeout_seconds, max_attempts, max_concurrent_builds, secrets_for_forks
+		FROM bee_schema.repos
+		WHERE id = $1
+	`, repoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return settings, nil
+}
+
+func (p PostgresRepoRepo) UpdateSettings(ctx context.Context, repoID int64, settings RepoSettings) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.repos
+		SET build_timeout_seconds = $2, max_attempts = $3, max_concurrent_builds = $4, secrets_for_forks = $5
+		WHERE id = $1
+	`, repoID, settings.BuildTimeout, settings.MaxAttempts, settings.MaxConcurrentBuilds, settings.SecretsForForks)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresRepoRepo) GetDefaultBranch(ctx context.Context, repoID int64) (branch string, err error) {
+	err = p.db.GetContext(ctx, &branch, `
+		SELECT COALESCE(default_branch, '')
+		FROM bee_schema.repos
+		WHERE id = $1
+	`, repoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return branch, nil
+}
+
+func (p PostgresRepoRepo) SetDefaultBranch(ctx context.Context, repoID int64, branch string) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.repos
+		SET default_branch = $2
+		WHERE id = $1 AND default_branch IS DISTINCT FROM $2
+	`, repoID, branch)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresRepoRepo) GetBadgeToken(ctx context.Context, repoID int64) (token string, err error) {
+	err = p.db.GetContext(ctx, &token, `
+		SELECT COALESCE(badge_token, '')
+		FROM bee_schema.repos
+		WHERE id = $1
+	`, repoID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("selecting from repos: %v", err)
+	}
+
+	return token, nil
+}
+
+func (p PostgresRepoRepo) SetBadgeToken(ctx context.Context, repoID int64, token string) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.repos
+		SET badge_token = NULLIF($2, '')
+		WHERE id = $1
+	`, repoID, token)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
 var _ RepoRepo = &PostgresRepoRepo{}
 
 func NewPostgresRepoRepo(db *sqlx.DB) *PostgresRepoRepo {
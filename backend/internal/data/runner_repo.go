@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type NewRunner struct {
+	Name           string
+	TokenHash      string // hex-encoded SHA-256 of the runner's token
+	Labels         []string
+	MaxConcurrency int
+	Version        string
+}
+
+// Runner represents a row in the "runners" table.
+type Runner struct {
+	ID              int64          `db:"id"`
+	Name            string         `db:"name"`
+	TokenHash       string         `db:"token_hash"`
+	CreatedAt       time.Time      `db:"created_at"`
+	Labels          pq.StringArray `db:"labels"`
+	MaxConcurrency  int            `db:"max_concurrency"`
+	Version         string         `db:"version"`
+	LastHeartbeatAt *time.Time     `db:"last_heartbeat_at"`
+}
+
+func (r Runner) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("id", r.ID),
+		slog.String("name", r.Name),
+		slog.Any("labels", []string(r.Labels)),
+		slog.Int("max_concurrency", r.MaxConcurrency),
+		slog.String("version", r.Version),
+	)
+}
+
+var _ slog.LogValuer = Runner{}
+
+// FatRunner represents a row in the "runners" table, merged with the number of
+// jobs the runner is running.
+type FatRunner struct {
+	Runner
+	RunningJobs int `db:"running_jobs"`
+}
+
+type RunnerRepo interface {
+	// Create registers a new runner and returns it.
+	Create(ctx context.Context, runner NewRunner) (created *Runner, err error)
+
+	// GetByTokenHash returns the runner whose token has tokenHash.
+	GetByTokenHash(ctx context.Context, tokenHash string) (runner *Runner, err error)
+
+	// GetAll returns all runners, ordered by ID.
+	GetAll(ctx context.Context) (runners []FatRunner, err error)
+
+	// Heartbeat records that the runner with runnerID is alive.
+	Heartbeat(ctx context.Context, runnerID int64) (err error)
+}
+
+type PostgresRunnerRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresRunnerRepo) Create(ctx context.Context, runner NewRunner) (*Runner, error) {
+	labels := pq.StringArray{}
+	labels = append(labels, runner.Labels...)
+
+	created := Runner{}
+	err := p.db.GetContext(ctx, &created, `
+		INSERT INTO bee_schema.runners (name, token_hash, labels, max_concurrency, version, last_heartbeat_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING *
+	`, runner.Name, runner.TokenHash, labels, runner.MaxConcurrency, runner.Version)
+	if err != nil {
+		return nil, fmt.Errorf("executing INSERT query: %v", err)
+	}
+
+	return &created, nil
+}
+
+func (p PostgresRunnerRepo) GetByTokenHash(ctx context.Context, tokenHash string) (*Runner, error) {
+	runner := Runner{}
+	err := p.db.GetContext(ctx, &runner, `
+		SELECT *
+		FROM bee_schema.runners
+		WHERE token_hash = $1
+	`, tokenHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("executing SELECT query: %v", err)
+	}
+
+	return &runner, nil
+}
+
+func (p PostgresRunnerRepo) GetAll(ctx context.Context) (runners []FatRunner, err error) {
+	runners = make([]FatRunner, 0)
+	err = p.db.SelectContext(ctx, &runners, `
+		SELECT runners.*, COUNT(jobs.id) AS running_jobs
+		FROM bee_schema.runners runners
+		LEFT JOIN bee_schema.jobs jobs ON jobs.runner_id = runners.id AND jobs.status = 'in_progress'
+		GROUP BY runners.id
+		ORDER BY runners.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("executing SELECT query: %v", err)
+	}
+
+	return runners, nil
+}
+
+func (p PostgresRunnerRepo) Heartbeat(ctx context.Context, runnerID int64) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		UPDATE bee_schema.runners
+		SET last_heartbeat_at = NOW()
+		WHERE id = $1
+	`, runnerID)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	return nil
+}
+
+var _ RunnerRepo = &PostgresRunnerRepo{}
+
+func NewPostgresRunnerRepo(db *sqlx.DB) *PostgresRunnerRepo {
+	return &PostgresRunnerRepo{db: db}
+}
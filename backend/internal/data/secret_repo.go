@@ -0,0 +1,206 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Scope is what secrets and variables belong to: either a repository or an
+// installation. Exactly one of the IDs is set.
+type Scope struct {
+	InstallationID *int64
+	RepoID         *int64
+}
+
+func RepoScope(repoID int64) Scope {
+	return Scope{RepoID: &repoID}
+}
+
+func InstallationScope(installationID int64) Scope {
+	return Scope{InstallationID: &installationID}
+}
+
+func (s Scope) String() string {
+	if s.RepoID != nil {
+		return "repo:" + strconv.FormatInt(*s.RepoID, 10)
+	}
+	return "installation:" + strconv.FormatInt(*s.InstallationID, 10)
+}
+
+// conflictTarget returns the ON CONFLICT target matching the unique index of
+// names within the scope.
+func (s Scope) conflictTarget() string {
+	if s.RepoID != nil {
+		return "(repo_id, name) WHERE repo_id IS NOT NULL"
+	}
+	return "(installation_id, name) WHERE installation_id IS NOT NULL"
+}
+
+// Secret represents a row in the "secrets" table. The value is encrypted, see
+// package envelope.
+type Secret struct {
+	ID             int64  `db:"id"`
+	InstallationID *int64 `db:"installation_id"`
+	RepoID         *int64 `db:"repo_id"`
+	Name           string `db:"name"`
+
+	Ciphertext   []byte `db:"ciphertext"`
+	EncryptedKey []byte `db:"encrypted_key"`
+
+	// KeyID identifies the master key that encrypted the data key.
+	KeyID string `db:"key_id"`
+
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+// AAD returns the additional data the value is encrypted with, so that the
+// ciphertext can't be moved to another secret.
+func (s Secret) AAD() []byte {
+	return []byte(Scope{InstallationID: s.InstallationID, RepoID: s.RepoID}.String() + "/" + s.Name)
+}
+
+type SecretRepo interface {
+	// GetAll returns the secrets of scope, ordered by name.
+	GetAll(ctx context.Context, scope Scope) (secrets []Secret, err error)
+
+	// GetForBuild returns the secrets passed to the jobs of a build: those of
+	// the installation, overridden by those of the repository with the same
+	// name.
+	GetForBuild(ctx context.Context, installationID, repoID int64) (secrets []Secret, err error)
+
+	// Put creates the secret, or replaces the value of the secret with the
+	// same name in its scope.
+	Put(ctx context.Context, secret Secret) (err error)
+
+	// Delete deletes the secret with name in scope.
+	Delete(ctx context.Context, scope Scope, name string) (err error)
+
+	// GetNotWrappedWith returns up to limit secrets whose data key was
+	// encrypted with a master key other than the one with keyID.
+	GetNotWrappedWith(ctx context.Context, keyID string, limit int) (secrets []Secret, err error)
+
+	// Rewrap replaces the encrypted data key of the secret with id, if it's
+	// still encrypted with the master key with oldKeyID. Returns ErrNotFound
+	// otherwise.
+	Rewrap(ctx context.Context, id int64, oldKeyID string, encryptedKey []byte, keyID string) (err error)
+}
+
+type PostgresSecretRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresSecretRepo) GetAll(ctx context.Context, scope Scope) (secrets []Secret, err error) {
+	secrets = make([]Secret, 0)
+	err = p.db.SelectContext(ctx, &secrets, `
+		SELECT *
+		FROM bee_schema.secrets
+		WHERE installation_id = $1 OR repo_id = $2
+		ORDER BY name
+	`, scope.InstallationID, scope.RepoID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from secrets: %v", err)
+	}
+
+	return secrets, nil
+}
+
+func (p PostgresSecretRepo) GetForBuild(ctx context.Context, installationID, repoID int64) (secrets []Secret, err error) {
+	secrets = make([]Secret, 0)
+	err = p.db.SelectContext(ctx, &secrets, `
+		SELECT DISTINCT ON (name) *
+		FROM bee_schema.secrets
+		WHERE installation_id = $1 OR repo_id = $2
+		ORDER BY name, repo_id IS NULL
+	`, installationID, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from secrets: %v", err)
+	}
+
+	return secrets, nil
+}
+
+func (p PostgresSecretRepo) Put(ctx context.Context, secret Secret) (err error) {
+	scope := Scope{InstallationID: secret.InstallationID, RepoID: secret.RepoID}
+	_, err = p.db.NamedExecContext(ctx, `
+		INSERT INTO bee_schema.secrets (installation_id, repo_id, name, ciphertext, encrypted_key, key_id)
+		VALUES (:installation_id, :repo_id, :name, :ciphertext, :encrypted_key, :key_id)
+		ON CONFLICT `+scope.conflictTarget()+` DO UPDATE
+		SET ciphertext = excluded.ciphertext,
+		    encrypted_key = excluded.encrypted_key,
+		    key_id = excluded.key_id,
+		    updated_at = CURRENT_TIMESTAMP
+	`, secret)
+	if err != nil {
+		return fmt.Errorf("executing INSERT query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresSecretRepo) Delete(ctx context.Context, scope Scope, name string) (err error) {
+	result, err := p.db.ExecContext(ctx, `
+		DELETE FROM bee_schema.secrets
+		WHERE (installation_id = $1 OR repo_id = $2) AND name = $3
+	`, scope.InstallationID, scope.RepoID, name)
+	if err != nil {
+		return fmt.Errorf("executing DELETE query: %v", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %v", err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p PostgresSecretRepo) GetNotWrappedWith(ctx context.Context, keyID string, limit int) (secrets []Secret, err error) {
+	secrets = make([]Secret, 0)
+	err = p.db.SelectContext(ctx, &secrets, `
+		SELECT *
+		FROM bee_schema.secrets
+		WHERE key_id <> $1
+		ORDER BY id
+		LIMIT $2
+	`, keyID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from secrets: %v", err)
+	}
+
+	return secrets, nil
+}
+
+func (p PostgresSecretRepo) Rewrap(ctx context.Context, id int64, oldKeyID string, encryptedKey []byte, keyID string) (err error) {
+	result, err := p.db.ExecContext(ctx, `
+		UPDATE bee_schema.secrets
+		SET encrypted_key = $3, key_id = $4
+		WHERE id = $1 AND key_id = $2
+	`, id, oldKeyID, encryptedKey, keyID)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE query: %v", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %v", err)
+	}
+	if updated == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+var _ SecretRepo = &PostgresSecretRepo{}
+
+func NewPostgresSecretRepo(db *sqlx.DB) *PostgresSecretRepo {
+	return &PostgresSecretRepo{db: db}
+}
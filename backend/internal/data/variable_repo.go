@@ -0,0 +1,111 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Variable represents a row in the "variables" table: a plain environment
+// variable that is not secret.
+type Variable struct {
+	ID             int64     `db:"id"`
+	InstallationID *int64    `db:"installation_id"`
+	RepoID         *int64    `db:"repo_id"`
+	Name           string    `db:"name"`
+	Value          string    `db:"value"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+type VariableRepo interface {
+	// GetAll returns the variables of scope, ordered by name.
+	GetAll(ctx context.Context, scope Scope) (variables []Variable, err error)
+
+	// GetForBuild returns the variables passed to the jobs of a build: those
+	// of the installation, overridden by those of the repository with the
+	// same name.
+	GetForBuild(ctx context.Context, installationID, repoID int64) (variables []Variable, err error)
+
+	// Put creates the variable with name in scope, or replaces its value.
+	Put(ctx context.Context, scope Scope, name, value string) (err error)
+
+	// Delete deletes the variable with name in scope.
+	Delete(ctx context.Context, scope Scope, name string) (err error)
+}
+
+type PostgresVariableRepo struct {
+	db *sqlx.DB
+}
+
+func (p PostgresVariableRepo) GetAll(ctx context.Context, scope Scope) (variables []Variable, err error) {
+	variables = make([]Variable, 0)
+	err = p.db.SelectContext(ctx, &variables, `
+		SELECT *
+		FROM bee_schema.variables
+		WHERE installation_id = $1 OR repo_id = $2
+		ORDER BY name
+	`, scope.InstallationID, scope.RepoID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from variables: %v", err)
+	}
+
+	return variables, nil
+}
+
+func (p PostgresVariableRepo) GetForBuild(ctx context.Context, installationID, repoID int64) (variables []Variable, err error) {
+	variables = make([]Variable, 0)
+	err = p.db.SelectContext(ctx, &variables, `
+		SELECT DISTINCT ON (name) *
+		FROM bee_schema.variables
+		WHERE installation_id = $1 OR repo_id = $2
+		ORDER BY name, repo_id IS NULL
+	`, installationID, repoID)
+	if err != nil {
+		return nil, fmt.Errorf("selecting from variables: %v", err)
+	}
+
+	return variables, nil
+}
+
+func (p PostgresVariableRepo) Put(ctx context.Context, scope Scope, name, value string) (err error) {
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO bee_schema.variables (installation_id, repo_id, name, value)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT `+scope.conflictTarget()+` DO UPDATE
+		SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, scope.InstallationID, scope.RepoID, name, value)
+	if err != nil {
+		return fmt.Errorf("executing INSERT query: %v", err)
+	}
+
+	return nil
+}
+
+func (p PostgresVariableRepo) Delete(ctx context.Context, scope Scope, name string) (err error) {
+	result, err := p.db.ExecContext(ctx, `
+		DELETE FROM bee_schema.variables
+		WHERE (installation_id = $1 OR repo_id = $2) AND name = $3
+	`, scope.InstallationID, scope.RepoID, name)
+	if err != nil {
+		return fmt.Errorf("executing DELETE query: %v", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %v", err)
+	}
+	if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+var _ VariableRepo = &PostgresVariableRepo{}
+
+func NewPostgresVariableRepo(db *sqlx.DB) *PostgresVariableRepo {
+	return &PostgresVariableRepo{db: db}
+}
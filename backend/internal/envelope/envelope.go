@@ -0,0 +1,214 @@
+// Package envelope implements envelope encryption: every value is encrypted
+// with its own random data key, and the data key is encrypted ("wrapped") with
+// a master key. Rotating the master key only requires wrapping the data keys
+// again, not encrypting the values again.
+//
+// All encryption uses AES-256-GCM with random nonces.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the size of master keys and data keys in bytes.
+const KeySize = 32
+
+// ErrUnknownKey is returned when a value was sealed with a master key that
+// isn't in the keyring.
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Sealed is an encrypted value together with its wrapped data key.
+type Sealed struct {
+	Ciphertext   []byte
+	EncryptedKey []byte
+
+	// KeyID identifies the master key that wrapped the data key.
+	KeyID string
+}
+
+// Keyring holds the current master key, which seals new values, and previous
+// master keys, which can still open values sealed before a rotation.
+type Keyring struct {
+	currentID string
+	keys      map[string][]byte
+}
+
+// NewKeyring returns a keyring from base64-encoded master keys.
+func NewKeyring(current string, previous ...string) (*Keyring, error) {
+	currentKey, err := ParseKey(current)
+	if err != nil {
+		return nil, fmt.Errorf("current master key: %w", err)
+	}
+
+	keyring := &Keyring{
+		currentID: KeyID(currentKey),
+		keys:      map[string][]byte{KeyID(currentKey): currentKey},
+	}
+	for i, encoded := range previous {
+		key, err := ParseKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("previous master key %d: %w", i+1, err)
+		}
+		keyring.keys[KeyID(key)] = key
+	}
+
+	return keyring, nil
+}
+
+// ParseKey decodes a base64-encoded master key.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("decode base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// GenerateKey returns a new random base64-encoded master key.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// KeyID returns the ID of a master key, derived from its hash, so that it can
+// be stored next to the values it sealed without revealing the key.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// CurrentKeyID returns the ID of the master key that seals new values.
+func (k *Keyring) CurrentKeyID() string {
+	return k.currentID
+}
+
+// Seal encrypts plaintext with a new data key and wraps the data key with the
+// current master key. The sealed value only opens with the same aad, which
+// binds it to where it is stored.
+func (k *Keyring) Seal(plaintext, aad []byte) (Sealed, error) {
+	dataKey := make([]byte, KeySize)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("generate data key: %w", err)
+	}
+
+	ciphertext, err := encrypt(dataKey, plaintext, aad)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("encrypt value: %w", err)
+	}
+
+	encryptedKey, err := encrypt(k.keys[k.currentID], dataKey, nil)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("wrap data key: %w", err)
+	}
+
+	return Sealed{
+		Ciphertext:   ciphertext,
+		EncryptedKey: encryptedKey,
+		KeyID:        k.currentID,
+	}, nil
+}
+
+// Open decrypts a sealed value.
+func (k *Keyring) Open(sealed Sealed, aad []byte) ([]byte, error) {
+	dataKey, err := k.unwrap(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(dataKey, sealed.Ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// Rewrap wraps the data key of a sealed value with the current master key.
+// The ciphertext stays the same.
+func (k *Keyring) Rewrap(sealed Sealed) (Sealed, error) {
+	if sealed.KeyID == k.currentID {
+		return sealed, nil
+	}
+
+	dataKey, err := k.unwrap(sealed)
+	if err != nil {
+		return Sealed{}, err
+	}
+
+	encryptedKey, err := encrypt(k.keys[k.currentID], dataKey, nil)
+	if err != nil {
+		return Sealed{}, fmt.Errorf("wrap data key: %w", err)
+	}
+
+	return Sealed{
+		Ciphertext:   sealed.Ciphertext,
+		EncryptedKey: encryptedKey,
+		KeyID:        k.currentID,
+	}, nil
+}
+
+func (k *Keyring) unwrap(sealed Sealed) ([]byte, error) {
+	masterKey, ok := k.keys[sealed.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, sealed.KeyID)
+	}
+
+	dataKey, err := decrypt(masterKey, sealed.EncryptedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// encrypt returns the nonce followed by the ciphertext of plaintext.
+func encrypt(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func decrypt(key, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
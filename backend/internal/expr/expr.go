@@ -0,0 +1,569 @@
+// Package expr implements a small, safe expression language used in "if"
+// conditions of jobs and steps in the .bee-ci.json file.
+//
+// Expressions may optionally be wrapped in ${{ }}. They support string
+// ('main' or "main"), number, boolean and null literals, references to
+// context values (branch, event, labels, inputs.<name>, matrix.<key>), the
+// operators ! == != < <= > >= && || and parentheses, and the following
+// functions:
+//
+//   - success() – all jobs the job depends on succeeded
+//   - failure() – any job the job depends on failed or timed out
+//   - cancelled() – any job the job depends on was canceled
+//   - always() – always true
+//   - contains(haystack, needle) – substring or list membership
+//   - startsWith(s, prefix), endsWith(s, suffix)
+//
+// Evaluation never has side effects and always terminates.
+package expr
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError is returned by [Parse] when the expression is malformed.
+type SyntaxError struct {
+	Pos int // byte offset in the expression, starting at 1
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// StatusFunctions are the functions whose result depends on the results of
+// the jobs the job depends on.
+var StatusFunctions = []string{"success", "failure", "cancelled", "always"}
+
+var functionArity = map[string]int{
+	"success":    0,
+	"failure":    0,
+	"cancelled":  0,
+	"always":     0,
+	"contains":   2,
+	"startsWith": 2,
+	"endsWith":   2,
+}
+
+// Expr is a parsed expression.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parses the expression src. The expression may be wrapped in ${{ }}.
+func Parse(src string) (*Expr, error) {
+	trimmed := strings.TrimSpace(src)
+	if strings.HasPrefix(trimmed, "${{") && strings.HasSuffix(trimmed, "}}") {
+		trimmed = strings.TrimSpace(trimmed[3 : len(trimmed)-2])
+	}
+	if trimmed == "" {
+		return nil, &SyntaxError{Pos: 1, Msg: "expression is empty"}
+	}
+
+	tokens, err := tokenize(trimmed)
+	if err != nil {
+		return nil, err
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// References returns the context references used in the expression, for
+// example [["inputs", "environment"], ["branch"]].
+func (e *Expr) References() [][]string {
+	refs := make([][]string, 0)
+	walk(e.root, func(n node) {
+		if ref, ok := n.(refNode); ok {
+			refs = append(refs, ref.path)
+		}
+	})
+	return refs
+}
+
+// UsesStatusFunction reports whether the expression calls any of
+// [StatusFunctions].
+func (e *Expr) UsesStatusFunction() bool {
+	uses := false
+	walk(e.root, func(n node) {
+		if call, ok := n.(callNode); ok && slices.Contains(StatusFunctions, call.name) {
+			uses = true
+		}
+	})
+	return uses
+}
+
+// Status describes the results of the jobs a job depends on.
+type Status struct {
+	Success   bool
+	Failure   bool
+	Cancelled bool
+}
+
+// Context holds the values an expression is evaluated against.
+type Context struct {
+	// Variables maps root names to values. Values may be strings, numbers,
+	// booleans, nil, []string, map[string]string or map[string]any.
+	Variables map[string]any
+
+	Status Status
+}
+
+// Eval evaluates the expression and returns its result.
+func (e *Expr) Eval(ctx Context) (any, error) {
+	return e.root.eval(ctx)
+}
+
+// EvalBool evaluates the expression and returns whether its result is truthy.
+// false, null, 0 and the empty string are falsy, everything else is truthy.
+func (e *Expr) EvalBool(ctx Context) (bool, error) {
+	value, err := e.Eval(ctx)
+	if err != nil {
+		return false, fmt.Errorf("evaluating %q: %w", e.src, err)
+	}
+	return truthy(value), nil
+}
+
+type node interface {
+	eval(ctx Context) (any, error)
+}
+
+type literalNode struct {
+	value any
+}
+
+type refNode struct {
+	path []string
+}
+
+type callNode struct {
+	name string
+	args []node
+}
+
+type unaryNode struct {
+	operand node
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func walk(n node, fn func(node)) {
+	fn(n)
+	switch n := n.(type) {
+	case callNode:
+		for _, arg := range n.args {
+			walk(arg, fn)
+		}
+	case unaryNode:
+		walk(n.operand, fn)
+	case binaryNode:
+		walk(n.left, fn)
+		walk(n.right, fn)
+	}
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) acceptOperator(ops ...string) (token, bool) {
+	t := p.peek()
+	if t.kind == tokenOperator && slices.Contains(ops, t.value) {
+		p.pos++
+		return t, true
+	}
+	return t, false
+}
+
+func (p *parser) expectOperator(op string) error {
+	t := p.peek()
+	if _, ok := p.acceptOperator(op); !ok {
+		return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected %q, got %s", op, t)}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOperator("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOperator("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.acceptOperator("==", "!=", "<", "<=", ">", ">=")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode{op: op.value, left: left, right: right}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if _, ok := p.acceptOperator("!"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString:
+		return literalNode{value: t.value}, nil
+	case tokenNumber:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("invalid number %q", t.value)}
+		}
+		return literalNode{value: f}, nil
+	case tokenOperator:
+		if t.value == "(" {
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expectOperator(")")
+			if err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+
+		if _, ok := p.acceptOperator("("); ok {
+			return p.parseCall(t)
+		}
+
+		path := []string{t.value}
+		for {
+			if _, ok := p.acceptOperator("."); !ok {
+				break
+			}
+			key := p.next()
+			if key.kind != tokenIdent {
+				return nil, &SyntaxError{Pos: key.pos, Msg: fmt.Sprintf("expected property name after %q, got %s", strings.Join(path, "."), key)}
+			}
+			path = append(path, key.value)
+		}
+		return refNode{path: path}, nil
+	}
+
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s, expected a value", t)}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	arity, ok := functionArity[name.value]
+	if !ok {
+		return nil, &SyntaxError{Pos: name.pos, Msg: fmt.Sprintf("unknown function %q", name.value)}
+	}
+
+	args := make([]node, 0)
+	if _, ok := p.acceptOperator(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.acceptOperator(","); !ok {
+				break
+			}
+		}
+		err := p.expectOperator(")")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(args) != arity {
+		return nil, &SyntaxError{Pos: name.pos, Msg: fmt.Sprintf("function %q takes %d argument(s), got %d", name.value, arity, len(args))}
+	}
+
+	return callNode{name: name.value, args: args}, nil
+}
+
+func (n literalNode) eval(Context) (any, error) {
+	return n.value, nil
+}
+
+func (n refNode) eval(ctx Context) (any, error) {
+	var value any = ctx.Variables
+	for _, key := range n.path {
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[key]
+		case map[string]string:
+			s, ok := v[key]
+			if !ok {
+				return nil, nil
+			}
+			value = s
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("cannot access property %q of %s", key, typeName(value))
+		}
+	}
+	return value, nil
+}
+
+func (n callNode) eval(ctx Context) (any, error) {
+	switch n.name {
+	case "success":
+		return ctx.Status.Success, nil
+	case "failure":
+		return ctx.Status.Failure, nil
+	case "cancelled":
+		return ctx.Status.Cancelled, nil
+	case "always":
+		return true, nil
+	}
+
+	args := make([]any, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	switch n.name {
+	case "contains":
+		needle := toString(args[1])
+		switch haystack := args[0].(type) {
+		case []string:
+			return slices.Contains(haystack, needle), nil
+		case string:
+			return strings.Contains(haystack, needle), nil
+		case nil:
+			return false, nil
+		default:
+			return nil, fmt.Errorf("contains: first argument must be a string or a list, got %s", typeName(haystack))
+		}
+	case "startsWith":
+		return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+	case "endsWith":
+		return strings.HasSuffix(toString(args[0]), toString(args[1])), nil
+	}
+
+	return nil, fmt.Errorf("unknown function %q", n.name)
+}
+
+func (n unaryNode) eval(ctx Context) (any, error) {
+	value, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+func (n binaryNode) eval(ctx Context) (any, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// && and || short-circuit and return one of their operands.
+	switch n.op {
+	case "&&":
+		if !truthy(left) {
+			return left, nil
+		}
+		return n.right.eval(ctx)
+	case "||":
+		if truthy(left) {
+			return left, nil
+		}
+		return n.right.eval(ctx)
+	}
+
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	}
+
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if lok && rok {
+		switch n.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+	}
+
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		switch n.op {
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("operator %q cannot compare %s and %s", n.op, typeName(left), typeName(right))
+}
+
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	default:
+		return false
+	}
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	default:
+		return true
+	}
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []string:
+		return "list"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,132 @@
+package expr
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantPos int
+		wantMsg string
+	}{
+		{src: "", wantPos: 1, wantMsg: "expression is empty"},
+		{src: "${{ }}", wantPos: 1, wantMsg: "expression is empty"},
+		{src: "branch = 'main'", wantPos: 8, wantMsg: `unexpected character '=' (did you mean "=="?)`},
+		{src: "branch == 'main", wantPos: 11, wantMsg: "unterminated string"},
+		{src: "branch ==", wantPos: 10, wantMsg: "unexpected end of expression, expected a value"},
+		{src: "(branch == 'main'", wantPos: 18, wantMsg: `expected ")", got end of expression`},
+		{src: "branch 'main'", wantPos: 8, wantMsg: `unexpected "main"`},
+		{src: "inputs.", wantPos: 8, wantMsg: `expected property name after "inputs", got end of expression`},
+		{src: "run('x')", wantPos: 1, wantMsg: `unknown function "run"`},
+		{src: "success() && contains('a')", wantPos: 14, wantMsg: `function "contains" takes 2 argument(s), got 1`},
+		{src: "branch == 'a' == 'b'", wantPos: 15, wantMsg: `unexpected "=="`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			_, err := Parse(test.src)
+
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("got error %v, want a syntax error", err)
+			}
+			if syntaxErr.Pos != test.wantPos || syntaxErr.Msg != test.wantMsg {
+				t.Errorf("got position %d: %s, want position %d: %s", syntaxErr.Pos, syntaxErr.Msg, test.wantPos, test.wantMsg)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	ctx := Context{
+		Variables: map[string]any{
+			"branch": "feature/login",
+			"event":  "push",
+			"labels": []string{"deploy", "urgent"},
+			"inputs": map[string]string{"environment": "prod"},
+			"matrix": map[string]string{"node": "18"},
+		},
+		Status: Status{Success: true},
+	}
+
+	tests := []struct {
+		src     string
+		want    bool
+		wantErr string
+	}{
+		{src: "branch == 'feature/login'", want: true},
+		{src: "${{ event != 'push' }}", want: false},
+		{src: `'it''s' == "it's"`, want: true},
+		{src: "inputs.environment == 'prod' && matrix.node == '18'", want: true},
+		{src: "inputs.missing == null", want: true},
+		{src: "contains(labels, 'deploy')", want: true},
+		{src: "contains(labels, 'deplo')", want: false},
+		{src: "contains(branch, 'login')", want: true},
+		{src: "contains(inputs.missing, 'x')", want: false},
+		{src: "startsWith(branch, 'feature/') && endsWith(branch, 'login')", want: true},
+		{src: "1 < 2 && 2 <= 2 && 'a' < 'b' && 3 > 2.5", want: true},
+		{src: "!(branch == 'main') || doesnt.matter", want: true},
+		{src: "0 || ''", want: false},
+		{src: "success() && !failure() && !cancelled()", want: true},
+		{src: "always()", want: true},
+		{src: "branch > 1", wantErr: `operator ">" cannot compare string and number`},
+		{src: "matrix.node >= 18", wantErr: `operator ">=" cannot compare string and number`},
+		{src: "true < false", wantErr: `operator "<" cannot compare boolean and boolean`},
+		{src: "contains(1, 'a')", wantErr: "contains: first argument must be a string or a list, got number"},
+		{src: "branch.name", wantErr: `cannot access property "name" of string`},
+		{src: "event == 'push' && labels.first", wantErr: `cannot access property "first" of list`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := Parse(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := e.EvalBool(ctx)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAnalysis(t *testing.T) {
+	tests := []struct {
+		src            string
+		wantStatus     bool
+		wantReferences [][]string
+	}{
+		{src: "branch == 'main'", wantStatus: false, wantReferences: [][]string{{"branch"}}},
+		{src: "always()", wantStatus: true, wantReferences: [][]string{}},
+		{src: "!(failure()) && inputs.environment == 'prod'", wantStatus: true, wantReferences: [][]string{{"inputs", "environment"}}},
+		{src: "contains(labels, matrix.os)", wantStatus: false, wantReferences: [][]string{{"labels"}, {"matrix", "os"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			e, err := Parse(test.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := e.UsesStatusFunction(); got != test.wantStatus {
+				t.Errorf("got UsesStatusFunction %t, want %t", got, test.wantStatus)
+			}
+			if got := e.References(); !reflect.DeepEqual(got, test.wantReferences) {
+				t.Errorf("got References %v, want %v", got, test.wantReferences)
+			}
+		})
+	}
+}
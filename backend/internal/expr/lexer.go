@@ -0,0 +1,132 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of expression"
+	case tokenIdent:
+		return "identifier"
+	case tokenNumber:
+		return "number"
+	case tokenString:
+		return "string"
+	default:
+		return "operator"
+	}
+}
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int // byte offset in the source, starting at 1
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return t.kind.String()
+	}
+	return fmt.Sprintf("%q", t.value)
+}
+
+// operators are sorted so that longer operators are matched first.
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", ",", "."}
+
+func tokenize(src string) ([]token, error) {
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			value, n, err := readString(src[i:])
+			if err != nil {
+				return nil, &SyntaxError{Pos: i + 1, Msg: err.Error()}
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value, pos: i + 1})
+			i += n
+		case isDigit(c):
+			start := i
+			for i < len(src) && (isDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, value: src[start:i], pos: start + 1})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentPart(rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: src[start:i], pos: start + 1})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tokens = append(tokens, token{kind: tokenOperator, value: op, pos: i + 1})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				msg := fmt.Sprintf("unexpected character %q", c)
+				switch c {
+				case '=', '&', '|':
+					msg += fmt.Sprintf(" (did you mean %q?)", string(c)+string(c))
+				}
+				return nil, &SyntaxError{Pos: i + 1, Msg: msg}
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(src) + 1})
+	return tokens, nil
+}
+
+// readString reads a quoted string at the start of s. The quote character is
+// escaped by doubling it, for example 'it”s'.
+func readString(s string) (value string, n int, err error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			b.WriteByte(quote)
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || isDigit(c) || c == '-'
+}
@@ -0,0 +1,216 @@
+// Package logarchive moves the logs of completed builds from the logs backend
+// to blob storage, as a single gzip-compressed object of JSON lines per build,
+// and reads archived logs back transparently.
+package logarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+type Config struct {
+	// After is how long after a build completed its logs are archived, so
+	// that lines that are still in flight reach the logs backend first.
+	After time.Duration
+
+	// Interval is how often the archiver looks for builds to archive.
+	Interval time.Duration
+
+	// BatchSize is how many builds are archived per interval at most.
+	BatchSize int
+}
+
+// DefaultConfig returns the configuration used when none is configured.
+func DefaultConfig() Config {
+	return Config{
+		After:     10 * time.Minute,
+		Interval:  time.Minute,
+		BatchSize: 20,
+	}
+}
+
+// Key returns the key of the blob the logs of the build with buildID are
+// archived to.
+func Key(buildID int64) string {
+	return "logs/" + strconv.FormatInt(buildID, 10) + ".jsonl.gz"
+}
+
+type Archiver struct {
+	logger         *slog.Logger
+	logArchiveRepo data.LogArchiveRepo
+	logsReader     data.LogsReader
+	logsWriter     data.LogsWriter
+	blobs          blob.Store
+	config         Config
+}
+
+// New returns an archiver that archives the lines read by logsReader, and
+// deletes them from the logs backend with logsWriter once they're archived.
+func New(logArchiveRepo data.LogArchiveRepo, logsReader data.LogsReader, logsWriter data.LogsWriter, blobs blob.Store, config Config) *Archiver {
+	return &Archiver{
+		logger:         slog.Default().With(slog.String("subsystem", "logarchive")),
+		logArchiveRepo: logArchiveRepo,
+		logsReader:     logsReader,
+		logsWriter:     logsWriter,
+		blobs:          blobs,
+		config:         config,
+	}
+}
+
+// Start starts the archiver. It is safe to run multiple archivers against the
+// same database.
+//
+// To shut down the archiver, cancel the context.
+func (a Archiver) Start(ctx context.Context) error {
+	a.logger.Info("archiver started",
+		slog.Duration("interval", a.config.Interval),
+		slog.Duration("after", a.config.After),
+	)
+
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			a.logger.Debug("context cancelled, archiver will stop")
+			return nil
+		case <-ticker.C:
+			a.ArchiveCompleted(ctx)
+		}
+	}
+}
+
+// ArchiveCompleted archives the logs of builds that completed long enough
+// ago. Errors are logged, and don't stop archiving the remaining builds.
+func (a Archiver) ArchiveCompleted(ctx context.Context) {
+	builds, err := a.logArchiveRepo.GetUnarchived(ctx, time.Now().Add(-a.config.After), a.config.BatchSize)
+	if err != nil {
+		a.logger.Error("failed to get builds to archive", slog.Any("error", err))
+		return
+	}
+
+	for _, build := range builds {
+		err = a.Archive(ctx, build)
+		if err != nil {
+			a.logger.Error("failed to archive logs", slog.Int64("build_id", build.ID), slog.Any("error", err))
+		}
+	}
+}
+
+// Archive uploads the logs of build to blob storage and deletes them from the
+// logs backend.
+func (a Archiver) Archive(ctx context.Context, build data.Build) error {
+	archived, err := a.logArchiveRepo.Archive(ctx, build.ID, func() (data.LogArchive, error) {
+		lines, err := a.logsReader.Get(ctx, data.LogsQueryForBuild(build))
+		if err != nil {
+			return data.LogArchive{}, fmt.Errorf("get logs: %w", err)
+		}
+
+		compressed, err := Compress(lines)
+		if err != nil {
+			return data.LogArchive{}, err
+		}
+
+		key := Key(build.ID)
+		err = a.blobs.Put(ctx, key, bytes.NewReader(compressed), int64(len(compressed)))
+		if err != nil {
+			return data.LogArchive{}, fmt.Errorf("upload logs: %w", err)
+		}
+
+		return data.LogArchive{
+			BlobKey: key,
+			Size:    int64(len(compressed)),
+			Lines:   int64(len(lines)),
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !archived {
+		return nil
+	}
+
+	// From now on the logs are read from the archive.
+	err = a.logsWriter.Delete(ctx, build.ID)
+	if err != nil {
+		return fmt.Errorf("prune logs backend: %w", err)
+	}
+
+	a.logger.Debug("logs archived", slog.Int64("build_id", build.ID))
+	return nil
+}
+
+// Compress returns lines as gzip-compressed JSON lines, the format of the
+// archive.
+func Compress(lines []data.LogLine) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	err := data.EncodeLogLines(gz, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	err = gz.Close()
+	if err != nil {
+		return nil, fmt.Errorf("compress logs: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Reader reads the logs of builds whose logs were archived from the archive,
+// and the logs of other builds from the logs backend.
+type Reader struct {
+	logArchiveRepo data.LogArchiveRepo
+	logsRepo       data.LogsReader
+	blobs          blob.Store
+}
+
+func (r Reader) Get(ctx context.Context, query data.LogsQuery) (lines []data.LogLine, err error) {
+	archive, err := r.logArchiveRepo.Get(ctx, query.BuildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			return r.logsRepo.Get(ctx, query)
+		}
+		return nil, fmt.Errorf("get log archive: %w", err)
+	}
+
+	object, err := r.blobs.Open(ctx, archive.BlobKey)
+	if err != nil {
+		return nil, fmt.Errorf("open log archive: %w", err)
+	}
+	defer object.Close()
+
+	gz, err := gzip.NewReader(object)
+	if err != nil {
+		return nil, fmt.Errorf("read log archive: %w", err)
+	}
+	defer gz.Close()
+
+	lines, err = data.DecodeLogLines(gz)
+	if err != nil {
+		return nil, fmt.Errorf("read log archive: %w", err)
+	}
+
+	return data.FilterLogLines(lines, query), nil
+}
+
+var _ data.LogsReader = Reader{}
+
+func NewReader(logArchiveRepo data.LogArchiveRepo, logsRepo data.LogsReader, blobs blob.Store) *Reader {
+	return &Reader{
+		logArchiveRepo: logArchiveRepo,
+		logsRepo:       logsRepo,
+		blobs:          blobs,
+	}
+}
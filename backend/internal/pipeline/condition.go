@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/bee-ci/bee-ci-system/internal/expr"
+)
+
+// InputConfig declares an input that can be referenced in conditions as
+// inputs.<name>.
+type InputConfig struct {
+	Description string `json:"description"`
+	Default     string `json:"default"`
+}
+
+// Command is a single command of a job. In the .bee-ci.json file, it's either
+// a string or an object with "run" and an optional "if" condition:
+//
+//	"commands": ["npm install", {"run": "npm run deploy", "if": "branch == 'main'"}]
+type Command struct {
+	Run string `json:"run"`
+	If  string `json:"if"`
+}
+
+func (c *Command) UnmarshalJSON(b []byte) error {
+	var run string
+	if err := json.Unmarshal(b, &run); err == nil {
+		*c = Command{Run: run}
+		return nil
+	}
+
+	type command Command // prevent recursion
+	var cmd command
+	decoder := json.NewDecoder(strings.NewReader(string(b)))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&cmd)
+	if err != nil {
+		return fmt.Errorf("command must be a string or an object with \"run\" and \"if\": %w", err)
+	}
+	*c = Command(cmd)
+	return nil
+}
+
+// BuildContext holds information about the build that conditions are
+// evaluated against.
+type BuildContext struct {
+	Branch string
+	Event  string // for example "push" or "pull_request"
+	Labels []string
+	Inputs map[string]string
+}
+
+// Variables returns the values available in conditions of a job expanded with
+// matrix.
+func (b BuildContext) Variables(matrix map[string]string) map[string]any {
+	labels := b.Labels
+	if labels == nil {
+		labels = make([]string, 0)
+	}
+	inputs := b.Inputs
+	if inputs == nil {
+		inputs = make(map[string]string)
+	}
+	if matrix == nil {
+		matrix = make(map[string]string)
+	}
+
+	return map[string]any{
+		"branch": b.Branch,
+		"event":  b.Event,
+		"labels": labels,
+		"inputs": inputs,
+		"matrix": matrix,
+	}
+}
+
+// ResolveCommands returns the commands of the job whose conditions evaluate to
+// true.
+func (j Job) ResolveCommands(ctx BuildContext) ([]string, error) {
+	commands := make([]string, 0, len(j.Commands))
+	for i, command := range j.Commands {
+		if command.If != "" {
+			condition, err := expr.Parse(command.If)
+			if err != nil {
+				return nil, fmt.Errorf("command #%d: if: %w", i+1, err)
+			}
+			ok, err := condition.EvalBool(expr.Context{Variables: ctx.Variables(j.Matrix)})
+			if err != nil {
+				return nil, fmt.Errorf("command #%d: if: %w", i+1, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		commands = append(commands, command.Run)
+	}
+	return commands, nil
+}
+
+// validateCondition checks that the condition is syntactically valid and only
+// references known values. Status functions such as success() are only allowed
+// if allowStatus is true.
+func validateCondition(src string, inputs map[string]InputConfig, matrixKeys []string, allowStatus bool) error {
+	condition, err := expr.Parse(src)
+	if err != nil {
+		return err
+	}
+
+	if !allowStatus && condition.UsesStatusFunction() {
+		return fmt.Errorf("status functions (%s) are only allowed in job conditions", strings.Join(expr.StatusFunctions, "(), ")+"()")
+	}
+
+	errs := make([]error, 0)
+	for _, ref := range condition.References() {
+		name := strings.Join(ref, ".")
+		switch ref[0] {
+		case "branch", "event", "labels":
+			if len(ref) > 1 {
+				errs = append(errs, fmt.Errorf("%q has no properties", ref[0]))
+			}
+		case "inputs":
+			if len(ref) != 2 {
+				errs = append(errs, fmt.Errorf("%q must be of the form inputs.<name>", name))
+			} else if _, ok := inputs[ref[1]]; !ok {
+				errs = append(errs, fmt.Errorf("unknown input %q, declared inputs are: %s", ref[1], strings.Join(slices.Sorted(maps.Keys(inputs)), ", ")))
+			}
+		case "matrix":
+			if len(ref) != 2 {
+				errs = append(errs, fmt.Errorf("%q must be of the form matrix.<key>", name))
+			} else if !slices.Contains(matrixKeys, ref[1]) {
+				errs = append(errs, fmt.Errorf("unknown matrix key %q", ref[1]))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown name %q, available names are: branch, event, labels, inputs, matrix", ref[0]))
+		}
+	}
+
+	return errors.Join(errs...)
+}
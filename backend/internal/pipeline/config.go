@@ -0,0 +1,190 @@
+// Package pipeline implements parsing and validation of the .bee-ci.json
+// config file, and the job dependency graph built from it.
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// FileName is the name of the config file that must exist in the root of the
+// repository for a build to be created.
+const FileName = ".bee-ci.json"
+
+// DefaultTimeout is the timeout (in seconds) of a job that doesn't specify one.
+const DefaultTimeout = 600
+
+// Config represents the contents of the .bee-ci.json file.
+type Config struct {
+	Inputs map[string]InputConfig `json:"inputs"`
+	Jobs   []JobConfig            `json:"jobs"`
+}
+
+// JobConfig represents a single job in the .bee-ci.json file.
+type JobConfig struct {
+	Name     string    `json:"job_name"`
+	Timeout  int       `json:"timeout"` // in seconds
+	Image    string    `json:"image"`
+	Commands []Command `json:"commands"`
+
+	// OnlyRunsAfter is a list of names of jobs that must succeed before this
+	// job is released to the queue.
+	OnlyRunsAfter []string `json:"only_runs_after"`
+
+	// RunsOn is a list of labels a runner must have to claim the job, for
+	// example ["linux", "arm64"]. Jobs without labels can run on any runner.
+	RunsOn []string `json:"runs_on"`
+
+	// Matrix, if set, expands the job into multiple concrete jobs. See
+	// [MatrixConfig].
+	Matrix *MatrixConfig `json:"matrix"`
+
+	// If is a condition that must be true for the job to run. It's evaluated
+	// once all jobs the job depends on have completed. If it doesn't call any
+	// status function, it's implicitly combined with success(). See package
+	// [expr] for the syntax.
+	If string `json:"if"`
+}
+
+// Parse decodes and validates the .bee-ci.json config file.
+func Parse(content []byte) (*Config, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	config := Config{}
+	err := decoder.Decode(&config)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", FileName, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("validating %s: %w", FileName, err)
+	}
+
+	return &config, nil
+}
+
+// Validate checks that the config is well-formed: every job has a unique
+// name, an image and at least one command, all conditions are valid, all
+// dependencies refer to existing jobs, there are no dependency cycles, and all
+// matrices expand.
+//
+// Jobs without a timeout get [DefaultTimeout].
+func (c *Config) Validate() error {
+	if len(c.Jobs) == 0 {
+		return errors.New("at least one job must be defined")
+	}
+
+	errs := make([]error, 0)
+	names := make(map[string]bool, len(c.Jobs))
+	for i := range c.Jobs {
+		job := &c.Jobs[i]
+		if job.Name == "" {
+			errs = append(errs, fmt.Errorf("job #%d: job_name must not be empty", i+1))
+			continue
+		}
+		if names[job.Name] {
+			errs = append(errs, fmt.Errorf("job %q: job_name must be unique", job.Name))
+		}
+		names[job.Name] = true
+
+		if job.Image == "" {
+			errs = append(errs, fmt.Errorf("job %q: image must not be empty", job.Name))
+		}
+		if len(job.Commands) == 0 {
+			errs = append(errs, fmt.Errorf("job %q: at least one command must be defined", job.Name))
+		}
+		for j, command := range job.Commands {
+			if command.Run == "" {
+				errs = append(errs, fmt.Errorf("job %q: command #%d: run must not be empty", job.Name, j+1))
+			}
+			if command.If != "" {
+				err := validateCondition(command.If, c.Inputs, job.matrixKeys(), false)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("job %q: command #%d: if: %w", job.Name, j+1, err))
+				}
+			}
+		}
+		if job.If != "" {
+			err := validateCondition(job.If, c.Inputs, job.matrixKeys(), true)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("job %q: if: %w", job.Name, err))
+			}
+		}
+		for j, label := range job.RunsOn {
+			if label == "" {
+				errs = append(errs, fmt.Errorf("job %q: runs_on label #%d must not be empty", job.Name, j+1))
+			}
+		}
+		if job.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("job %q: timeout must not be negative", job.Name))
+		}
+		if job.Timeout == 0 {
+			job.Timeout = DefaultTimeout
+		}
+	}
+
+	for _, job := range c.Jobs {
+		for _, dep := range job.OnlyRunsAfter {
+			if dep == job.Name {
+				errs = append(errs, fmt.Errorf("job %q: job cannot depend on itself", job.Name))
+			} else if !names[dep] {
+				errs = append(errs, fmt.Errorf("job %q: only_runs_after refers to unknown job %q", job.Name, dep))
+			}
+		}
+	}
+
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	_, err := NewGraph(c.Edges())
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Expand()
+	return err
+}
+
+// Edges returns the dependencies of every job, keyed by job name.
+func (c *Config) Edges() map[string][]string {
+	edges := make(map[string][]string, len(c.Jobs))
+	for _, job := range c.Jobs {
+		edges[job.Name] = job.OnlyRunsAfter
+	}
+	return edges
+}
+
+// matrixKeys returns the keys that the job's matrix combinations may have.
+func (j JobConfig) matrixKeys() []string {
+	keys := make([]string, 0)
+	if j.Matrix == nil {
+		return keys
+	}
+
+	for key := range j.Matrix.Axes {
+		keys = append(keys, key)
+	}
+	for _, include := range j.Matrix.Include {
+		for key := range include {
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// DefaultInputs returns the default values of all declared inputs.
+func (c *Config) DefaultInputs() map[string]string {
+	inputs := make(map[string]string, len(c.Inputs))
+	for name, input := range c.Inputs {
+		inputs[name] = input.Default
+	}
+	return inputs
+}
@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Graph is a directed acyclic graph of jobs. An edge from A to B means that B
+// only runs after A.
+type Graph struct {
+	dependencies map[string][]string
+	dependents   map[string][]string
+	stages       [][]string
+}
+
+// NewGraph creates a graph from the dependencies of every job, keyed by job
+// name. It returns an error if a dependency refers to an unknown job or if
+// the dependencies form a cycle.
+func NewGraph(dependencies map[string][]string) (*Graph, error) {
+	g := &Graph{
+		dependencies: make(map[string][]string, len(dependencies)),
+		dependents:   make(map[string][]string, len(dependencies)),
+	}
+
+	for name, deps := range dependencies {
+		for _, dep := range deps {
+			if _, ok := dependencies[dep]; !ok {
+				return nil, fmt.Errorf("job %q depends on unknown job %q", name, dep)
+			}
+			g.dependents[dep] = append(g.dependents[dep], name)
+		}
+		g.dependencies[name] = slices.Clone(deps)
+	}
+	for name := range g.dependents {
+		slices.Sort(g.dependents[name])
+	}
+
+	if cycle := g.findCycle(); cycle != nil {
+		return nil, fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+	}
+
+	g.stages = g.computeStages()
+	return g, nil
+}
+
+// Dependencies returns the names of jobs that must succeed before the job.
+func (g *Graph) Dependencies(name string) []string {
+	return g.dependencies[name]
+}
+
+// Dependents returns the names of jobs that only run after the job.
+func (g *Graph) Dependents(name string) []string {
+	return g.dependents[name]
+}
+
+// Stages returns job names grouped by their depth in the graph. Jobs in the
+// first stage have no dependencies, and jobs in stage N only depend on jobs in
+// stages before N.
+func (g *Graph) Stages() [][]string {
+	return g.stages
+}
+
+// Stage returns the index of the stage the job belongs to, or -1 if the job
+// is not in the graph.
+func (g *Graph) Stage(name string) int {
+	for i, stage := range g.stages {
+		if slices.Contains(stage, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Graph) sortedNames() []string {
+	names := make([]string, 0, len(g.dependencies))
+	for name := range g.dependencies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// findCycle returns the jobs forming a cycle, with the first job repeated at
+// the end, or nil if there are no cycles.
+func (g *Graph) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(g.dependencies))
+	path := make([]string, 0)
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+
+		for _, dependent := range g.dependents[name] {
+			switch state[dependent] {
+			case visiting:
+				start := slices.Index(path, dependent)
+				return append(slices.Clone(path[start:]), dependent)
+			case unvisited:
+				if cycle := visit(dependent); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range g.sortedNames() {
+		if state[name] == unvisited {
+			if cycle := visit(name); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *Graph) computeStages() [][]string {
+	depth := make(map[string]int, len(g.dependencies))
+
+	var depthOf func(name string) int
+	depthOf = func(name string) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		d := 0
+		for _, dep := range g.dependencies[name] {
+			d = max(d, depthOf(dep)+1)
+		}
+		depth[name] = d
+		return d
+	}
+
+	stages := make([][]string, 0)
+	for _, name := range g.sortedNames() {
+		d := depthOf(name)
+		for len(stages) <= d {
+			stages = append(stages, make([]string, 0))
+		}
+		stages[d] = append(stages[d], name)
+	}
+
+	return stages
+}
@@ -0,0 +1,329 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MaxMatrixJobs is the maximum number of jobs a single matrix can expand to.
+const MaxMatrixJobs = 256
+
+// MatrixConfig represents the "matrix" block of a job in the .bee-ci.json
+// file. The job is expanded into one concrete job for every combination of
+// axis values.
+type MatrixConfig struct {
+	// Axes maps axis names to the values the axis takes, for example
+	// {"node": ["18", "20"]}.
+	Axes map[string][]MatrixValue `json:"axes"`
+
+	// Include extends the combinations that match the axis values of an entry
+	// with its other keys, or adds the entry as a new combination if none
+	// match.
+	Include []map[string]MatrixValue `json:"include"`
+
+	// Exclude removes combinations that match all keys of any entry.
+	Exclude []map[string]MatrixValue `json:"exclude"`
+
+	// MaxParallel is the maximum number of expanded jobs that may be queued or
+	// running at the same time. Zero means no limit.
+	MaxParallel int `json:"max_parallel"`
+
+	// FailFast cancels the expanded jobs that haven't started yet as soon as
+	// one of them fails. Defaults to true.
+	FailFast *bool `json:"fail_fast"`
+}
+
+// MatrixValue is a single value of a matrix axis. Strings, numbers and
+// booleans are accepted and stored as strings.
+type MatrixValue string
+
+func (v *MatrixValue) UnmarshalJSON(b []byte) error {
+	var value any
+	err := json.Unmarshal(b, &value)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case string:
+		*v = MatrixValue(value)
+	case float64:
+		*v = MatrixValue(strconv.FormatFloat(value, 'f', -1, 64))
+	case bool:
+		*v = MatrixValue(strconv.FormatBool(value))
+	default:
+		return fmt.Errorf("matrix value must be a string, number or boolean, got %s", string(b))
+	}
+	return nil
+}
+
+// Job is a concrete job, created from a [JobConfig] by expanding its matrix.
+// Jobs without a matrix are expanded into a single Job.
+type Job struct {
+	Name       string
+	ParentName string
+	Matrix     map[string]string
+
+	Image     string
+	Commands  []Command
+	Timeout   int
+	DependsOn []string
+	Condition string
+	RunsOn    []string
+
+	MaxParallel int
+	FailFast    bool
+}
+
+var matrixRefRegexp = regexp.MustCompile(`\$\{\{\s*matrix\.([A-Za-z0-9_-]+)\s*\}\}`)
+
+// Expand expands the matrices of all jobs into concrete jobs. Dependencies on
+// a matrix job are replaced with dependencies on all jobs it expanded into.
+func (c *Config) Expand() ([]Job, error) {
+	jobs := make([]Job, 0, len(c.Jobs))
+	expandedNames := make(map[string][]string, len(c.Jobs))
+	errs := make([]error, 0)
+
+	for _, jobConfig := range c.Jobs {
+		expanded, err := jobConfig.expand()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %q: %w", jobConfig.Name, err))
+			continue
+		}
+		for _, job := range expanded {
+			expandedNames[jobConfig.Name] = append(expandedNames[jobConfig.Name], job.Name)
+		}
+		jobs = append(jobs, expanded...)
+	}
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	seen := make(map[string]string, len(jobs))
+	for i := range jobs {
+		job := &jobs[i]
+		if parent, ok := seen[job.Name]; ok {
+			errs = append(errs, fmt.Errorf("job %q: expanded job name %q is also used by job %q", job.ParentName, job.Name, parent))
+		}
+		seen[job.Name] = job.ParentName
+
+		dependsOn := make([]string, 0, len(job.DependsOn))
+		for _, dep := range job.DependsOn {
+			dependsOn = append(dependsOn, expandedNames[dep]...)
+		}
+		job.DependsOn = dependsOn
+	}
+
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return jobs, nil
+}
+
+func (j JobConfig) expand() ([]Job, error) {
+	if j.Matrix == nil {
+		return []Job{{
+			Name:       j.Name,
+			ParentName: j.Name,
+			Matrix:     map[string]string{},
+			Image:      j.Image,
+			Commands:   j.Commands,
+			Timeout:    j.Timeout,
+			DependsOn:  j.OnlyRunsAfter,
+			Condition:  j.If,
+			RunsOn:     j.RunsOn,
+			FailFast:   true,
+		}}, nil
+	}
+
+	combinations, err := j.Matrix.combinations()
+	if err != nil {
+		return nil, err
+	}
+
+	failFast := true
+	if j.Matrix.FailFast != nil {
+		failFast = *j.Matrix.FailFast
+	}
+
+	jobs := make([]Job, 0, len(combinations))
+	for _, combination := range combinations {
+		name, err := interpolate(j.Name, combination)
+		if err != nil {
+			return nil, fmt.Errorf("job_name: %w", err)
+		}
+		if name == j.Name {
+			name = fmt.Sprintf("%s (%s)", j.Name, strings.Join(sortedValues(combination), ", "))
+		}
+
+		image, err := interpolate(j.Image, combination)
+		if err != nil {
+			return nil, fmt.Errorf("image: %w", err)
+		}
+
+		commands := make([]Command, 0, len(j.Commands))
+		for i, command := range j.Commands {
+			command.Run, err = interpolate(command.Run, combination)
+			if err != nil {
+				return nil, fmt.Errorf("command #%d: %w", i+1, err)
+			}
+			commands = append(commands, command)
+		}
+
+		runsOn := make([]string, 0, len(j.RunsOn))
+		for _, label := range j.RunsOn {
+			label, err = interpolate(label, combination)
+			if err != nil {
+				return nil, fmt.Errorf("runs_on: %w", err)
+			}
+			runsOn = append(runsOn, label)
+		}
+
+		jobs = append(jobs, Job{
+			Name:        name,
+			ParentName:  j.Name,
+			Matrix:      combination,
+			Image:       image,
+			Commands:    commands,
+			Timeout:     j.Timeout,
+			DependsOn:   j.OnlyRunsAfter,
+			Condition:   j.If,
+			RunsOn:      runsOn,
+			MaxParallel: j.Matrix.MaxParallel,
+			FailFast:    failFast,
+		})
+	}
+
+	return jobs, nil
+}
+
+// combinations returns all combinations of axis values, with excluded
+// combinations removed and included combinations added.
+func (m MatrixConfig) combinations() ([]map[string]string, error) {
+	if m.MaxParallel < 0 {
+		return nil, errors.New("matrix: max_parallel must not be negative")
+	}
+	if len(m.Axes) == 0 && len(m.Include) == 0 {
+		return nil, errors.New("matrix: at least one axis or include entry must be defined")
+	}
+
+	keys := slices.Sorted(maps.Keys(m.Axes))
+
+	combinations := []map[string]string{{}}
+	for _, key := range keys {
+		values := m.Axes[key]
+		if len(values) == 0 {
+			return nil, fmt.Errorf("matrix: axis %q must have at least one value", key)
+		}
+
+		next := make([]map[string]string, 0, len(combinations)*len(values))
+		for _, combination := range combinations {
+			for _, value := range values {
+				extended := maps.Clone(combination)
+				extended[key] = string(value)
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+
+		if len(combinations) > MaxMatrixJobs {
+			return nil, fmt.Errorf("matrix: expands to more than %d jobs", MaxMatrixJobs)
+		}
+	}
+	if len(keys) == 0 {
+		combinations = make([]map[string]string, 0)
+	}
+
+	for i, exclude := range m.Exclude {
+		for key := range exclude {
+			if _, ok := m.Axes[key]; !ok {
+				return nil, fmt.Errorf("matrix: exclude #%d refers to unknown axis %q", i+1, key)
+			}
+		}
+		combinations = slices.DeleteFunc(combinations, func(combination map[string]string) bool {
+			return matches(combination, exclude)
+		})
+	}
+
+	// Include entries extend every combination of the axes that has the values
+	// of the axes they name, without changing the values of axes. An entry
+	// that extends no combination is added as a new combination, which later
+	// entries don't extend.
+	original := len(combinations)
+	for _, include := range m.Include {
+		axisValues := make(map[string]MatrixValue)
+		extraValues := make(map[string]string)
+		for key, value := range include {
+			if _, ok := m.Axes[key]; ok {
+				axisValues[key] = value
+			} else {
+				extraValues[key] = string(value)
+			}
+		}
+
+		extended := false
+		for _, combination := range combinations[:original] {
+			if matches(combination, axisValues) {
+				maps.Copy(combination, extraValues)
+				extended = true
+			}
+		}
+
+		if !extended {
+			combination := make(map[string]string, len(include))
+			for key, value := range include {
+				combination[key] = string(value)
+			}
+			combinations = append(combinations, combination)
+		}
+	}
+
+	if len(combinations) == 0 {
+		return nil, errors.New("matrix: all combinations were excluded")
+	}
+	if len(combinations) > MaxMatrixJobs {
+		return nil, fmt.Errorf("matrix: expands to more than %d jobs", MaxMatrixJobs)
+	}
+
+	return combinations, nil
+}
+
+func matches(combination map[string]string, filter map[string]MatrixValue) bool {
+	for key, value := range filter {
+		if combination[key] != string(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// interpolate replaces ${{ matrix.<key> }} references in s with values from
+// the combination.
+func interpolate(s string, combination map[string]string) (string, error) {
+	var err error
+	result := matrixRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		key := matrixRefRegexp.FindStringSubmatch(ref)[1]
+		value, ok := combination[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown matrix key %q in %q", key, s)
+		}
+		return value
+	})
+	return result, err
+}
+
+func sortedValues(combination map[string]string) []string {
+	values := make([]string, 0, len(combination))
+	for _, key := range slices.Sorted(maps.Keys(combination)) {
+		values = append(values, combination[key])
+	}
+	return values
+}
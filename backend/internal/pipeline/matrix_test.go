@@ -0,0 +1,210 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCombinations(t *testing.T) {
+	tests := []struct {
+		name    string
+		matrix  string
+		want    []map[string]string
+		wantErr string
+	}{
+		{
+			name:   "every combination of the axes, by sorted axis names",
+			matrix: `{"axes": {"os": ["linux", "windows"], "node": [18, 20]}}`,
+			want: []map[string]string{
+				{"node": "18", "os": "linux"},
+				{"node": "18", "os": "windows"},
+				{"node": "20", "os": "linux"},
+				{"node": "20", "os": "windows"},
+			},
+		},
+		{
+			name:   "numbers and booleans are strings",
+			matrix: `{"axes": {"version": [1.5, 2], "race": [true]}}`,
+			want: []map[string]string{
+				{"race": "true", "version": "1.5"},
+				{"race": "true", "version": "2"},
+			},
+		},
+		{
+			name:   "exclude removes combinations that match all its keys",
+			matrix: `{"axes": {"os": ["linux", "windows"], "node": [18, 20]}, "exclude": [{"os": "windows", "node": 18}]}`,
+			want: []map[string]string{
+				{"node": "18", "os": "linux"},
+				{"node": "20", "os": "linux"},
+				{"node": "20", "os": "windows"},
+			},
+		},
+		{
+			name:   "exclude of some axes removes every combination with their values",
+			matrix: `{"axes": {"os": ["linux", "windows"], "node": [18, 20]}, "exclude": [{"os": "windows"}]}`,
+			want: []map[string]string{
+				{"node": "18", "os": "linux"},
+				{"node": "20", "os": "linux"},
+			},
+		},
+		{
+			name:   "include extends every combination with its axis values",
+			matrix: `{"axes": {"os": ["linux", "windows"], "node": [18, 20]}, "include": [{"os": "linux", "experimental": true}]}`,
+			want: []map[string]string{
+				{"experimental": "true", "node": "18", "os": "linux"},
+				{"node": "18", "os": "windows"},
+				{"experimental": "true", "node": "20", "os": "linux"},
+				{"node": "20", "os": "windows"},
+			},
+		},
+		{
+			name:   "include without axis values extends every combination",
+			matrix: `{"axes": {"os": ["linux", "windows"]}, "include": [{"color": "red"}]}`,
+			want: []map[string]string{
+				{"color": "red", "os": "linux"},
+				{"color": "red", "os": "windows"},
+			},
+		},
+		{
+			name:   "include that extends no combination is added",
+			matrix: `{"axes": {"os": ["linux", "windows"], "node": [18, 20]}, "include": [{"os": "linux", "node": 22}]}`,
+			want: []map[string]string{
+				{"node": "18", "os": "linux"},
+				{"node": "18", "os": "windows"},
+				{"node": "20", "os": "linux"},
+				{"node": "20", "os": "windows"},
+				{"node": "22", "os": "linux"},
+			},
+		},
+		{
+			name:   "include doesn't extend excluded combinations",
+			matrix: `{"axes": {"os": ["linux", "windows"]}, "exclude": [{"os": "windows"}], "include": [{"os": "windows", "shell": "pwsh"}]}`,
+			want: []map[string]string{
+				{"os": "linux"},
+				{"os": "windows", "shell": "pwsh"},
+			},
+		},
+		{
+			name:   "include doesn't extend combinations added by other entries",
+			matrix: `{"axes": {"os": ["linux"]}, "include": [{"os": "mac"}, {"os": "mac", "arch": "arm64"}]}`,
+			want: []map[string]string{
+				{"os": "linux"},
+				{"os": "mac"},
+				{"arch": "arm64", "os": "mac"},
+			},
+		},
+		{
+			name:   "include without axes",
+			matrix: `{"include": [{"os": "linux"}, {"os": "mac"}]}`,
+			want: []map[string]string{
+				{"os": "linux"},
+				{"os": "mac"},
+			},
+		},
+		{
+			name:    "negative max_parallel",
+			matrix:  `{"axes": {"os": ["linux"]}, "max_parallel": -1}`,
+			wantErr: "max_parallel must not be negative",
+		},
+		{
+			name:    "neither axes nor include",
+			matrix:  `{}`,
+			wantErr: "at least one axis or include entry",
+		},
+		{
+			name:    "axis without values",
+			matrix:  `{"axes": {"os": []}}`,
+			wantErr: `axis "os" must have at least one value`,
+		},
+		{
+			name:    "exclude of an unknown axis",
+			matrix:  `{"axes": {"os": ["linux"]}, "exclude": [{"arch": "arm64"}]}`,
+			wantErr: `exclude #1 refers to unknown axis "arch"`,
+		},
+		{
+			name:    "every combination excluded",
+			matrix:  `{"axes": {"os": ["linux"]}, "exclude": [{"os": "linux"}]}`,
+			wantErr: "all combinations were excluded",
+		},
+		{
+			name:    "too many combinations",
+			matrix:  fmt.Sprintf(`{"axes": {"a": %s, "b": %s}}`, values(17), values(16)),
+			wantErr: "expands to more than 256 jobs",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var matrix MatrixConfig
+			err := json.Unmarshal([]byte(test.matrix), &matrix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := matrix.combinations()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, test.want, maps.Equal) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	config := Config{Jobs: []JobConfig{
+		{
+			Name:     "test",
+			Image:    "node:${{ matrix.node }}",
+			Commands: []Command{{Run: "npm test -- --os ${{ matrix.os }}"}},
+			Matrix: &MatrixConfig{
+				Axes:        map[string][]MatrixValue{"node": {"18", "20"}, "os": {"linux"}},
+				MaxParallel: 1,
+			},
+		},
+		{
+			Name:          "deploy",
+			Image:         "alpine",
+			Commands:      []Command{{Run: "./deploy.sh"}},
+			OnlyRunsAfter: []string{"test"},
+		},
+	}}
+
+	jobs, err := config.Expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		got = append(got, fmt.Sprintf("%s: %s %q after %v, max %d, fail-fast %t",
+			job.Name, job.Image, job.Commands[0].Run, job.DependsOn, job.MaxParallel, job.FailFast))
+	}
+	want := []string{
+		`test (18, linux): node:18 "npm test -- --os linux" after [], max 1, fail-fast true`,
+		`test (20, linux): node:20 "npm test -- --os linux" after [], max 1, fail-fast true`,
+		`deploy: alpine "./deploy.sh" after [test (18, linux) test (20, linux)], max 0, fail-fast true`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got jobs:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// values returns a JSON array of n distinct matrix values.
+func values(n int) string {
+	numbers := make([]string, 0, n)
+	for i := range n {
+		numbers = append(numbers, fmt.Sprint(i))
+	}
+	return "[" + strings.Join(numbers, ", ") + "]"
+}
@@ -0,0 +1,58 @@
+// Package queue defines how queued builds are prioritized and estimates how
+// long they wait.
+//
+// Jobs are claimed by priority first. Within a priority, builds take turns
+// across installations: the n-th unfinished build of every installation goes
+// before the (n+1)-th build of any installation, so that one account pushing
+// many commits doesn't starve the others. Builds that already started count
+// as taking a turn, so their remaining jobs are claimed before new builds of
+// the same installation start.
+package queue
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	PrioritySchedule    = 0
+	PriorityPush        = 1
+	PriorityPullRequest = 2
+	PriorityManual      = 3
+)
+
+// Priority returns the priority of a build created for event, for example
+// "push" or "pull_request". Builds requested manually, for example by
+// re-running a check suite, get [PriorityManual] regardless of the event.
+func Priority(event string, manual bool) int {
+	if manual {
+		return PriorityManual
+	}
+
+	switch event {
+	case "manual":
+		return PriorityManual
+	case "pull_request":
+		return PriorityPullRequest
+	case "push":
+		return PriorityPush
+	default:
+		return PrioritySchedule
+	}
+}
+
+// ETA estimates how long a build waits before it starts, given the number of
+// builds ahead of it (running or queued), how many builds can run at the same
+// time and how long builds take on average. Returns nil if there's no data to
+// estimate from.
+func ETA(ahead, capacity int, averageDuration time.Duration) *time.Duration {
+	if averageDuration <= 0 {
+		return nil
+	}
+	capacity = max(capacity, 1)
+
+	// The builds ahead run in waves of capacity builds.
+	waves := math.Floor(float64(ahead) / float64(capacity))
+	eta := time.Duration(waves) * averageDuration
+	return &eta
+}
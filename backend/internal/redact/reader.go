@@ -0,0 +1,61 @@
+package redact
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// Reader masks secrets in the lines it reads. Lines pushed by runners are
+// redacted before they are stored already, but lines written to the logs
+// backend directly, and lines stored before a secret was registered, aren't.
+type Reader struct {
+	logsRepo    data.LogsReader
+	logMaskRepo data.LogMaskRepo
+	patterns    []*regexp.Regexp
+}
+
+func (r Reader) Get(ctx context.Context, query data.LogsQuery) (lines []data.LogLine, err error) {
+	lines, err = r.logsRepo.Get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines are redacted per job, as secrets are registered per job and may
+	// be split across consecutive lines of the same job only.
+	jobs := make(map[int64][]int)
+	for i, line := range lines {
+		jobs[line.JobID] = append(jobs[line.JobID], i)
+	}
+
+	for jobID, indexes := range jobs {
+		masks, err := r.logMaskRepo.Get(ctx, jobID)
+		if err != nil {
+			return nil, fmt.Errorf("get masks of job with id %d: %w", jobID, err)
+		}
+
+		texts := make([]string, 0, len(indexes))
+		for _, i := range indexes {
+			texts = append(texts, lines[i].Text)
+		}
+
+		redacted := New(masks, r.patterns).RedactLines(texts)
+		for j, i := range indexes {
+			lines[i].Text = redacted[j]
+		}
+	}
+
+	return lines, nil
+}
+
+var _ data.LogsReader = Reader{}
+
+func NewReader(logsRepo data.LogsReader, logMaskRepo data.LogMaskRepo, patterns []*regexp.Regexp) *Reader {
+	return &Reader{
+		logsRepo:    logsRepo,
+		logMaskRepo: logMaskRepo,
+		patterns:    patterns,
+	}
+}
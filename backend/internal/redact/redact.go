@@ -0,0 +1,349 @@
+// Package redact masks secrets in build logs: values registered as secrets,
+// together with their base64- and URL-encoded forms, and anything matching
+// patterns of common credential formats.
+//
+// Output reaches the server in chunks, so a secret may be split across lines.
+// Lines are therefore redacted together, as if they were a single text, and
+// lines at the end of a chunk that may hold the beginning of a secret are held
+// back until the next chunk arrives, see [Redactor.Incomplete].
+package redact
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mask replaces every secret.
+const Mask = "***"
+
+// MinLength is the length secrets (and every encoded form of them) must have
+// to be masked. Shorter values would mask large parts of unrelated output.
+const MinLength = 4
+
+// maxPatternLength is how far back from the end of a chunk an incomplete
+// match of a pattern is looked for.
+const maxPatternLength = 256
+
+// DefaultPatterns match common credential formats.
+var DefaultPatterns = []string{
+	// GitHub tokens.
+	`gh[pousr]_[A-Za-z0-9]{36,255}`,
+	`github_pat_[A-Za-z0-9_]{22,255}`,
+	// AWS access key IDs.
+	`(?:AKIA|ASIA)[0-9A-Z]{16}`,
+	// Google API keys.
+	`AIza[0-9A-Za-z_-]{35}`,
+	// Slack tokens.
+	`xox[abprs]-[0-9A-Za-z-]{10,}`,
+	// JSON Web Tokens.
+	`eyJ[0-9A-Za-z_-]{8,}\.eyJ[0-9A-Za-z_-]{8,}\.[0-9A-Za-z_-]{8,}`,
+	// PEM private keys.
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----`,
+}
+
+// CompilePatterns compiles regular expressions for [New].
+func CompilePatterns(exprs []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compile pattern %q: %w", expr, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+type Redactor struct {
+	// values are the forms of all secrets that are masked, longest first.
+	values   []string
+	patterns []*regexp.Regexp
+	anchored []*regexp.Regexp
+	// progs are the compiled patterns, to tell if text is the beginning of a
+	// match, see [partial].
+	progs []*syntax.Prog
+}
+
+// New returns a redactor that masks secrets and anything matching patterns.
+func New(secrets []string, patterns []*regexp.Regexp) *Redactor {
+	values := make([]string, 0)
+	for _, secret := range secrets {
+		values = append(values, Variants(secret)...)
+	}
+	slices.SortFunc(values, func(a, b string) int { return len(b) - len(a) })
+	values = slices.Compact(values)
+
+	anchored := make([]*regexp.Regexp, 0, len(patterns))
+	progs := make([]*syntax.Prog, 0, len(patterns))
+	for _, pattern := range patterns {
+		anchored = append(anchored, regexp.MustCompile(`^(?:`+pattern.String()+`)`))
+
+		// The pattern was compiled by regexp already, so it's valid.
+		re, _ := syntax.Parse(pattern.String(), syntax.Perl)
+		prog, _ := syntax.Compile(re.Simplify())
+		progs = append(progs, prog)
+	}
+
+	return &Redactor{
+		values:   values,
+		patterns: patterns,
+		anchored: anchored,
+		progs:    progs,
+	}
+}
+
+// Variants returns the forms of secret that are masked: the secret itself,
+// URL-encoded, and base64-encoded. Every line of a multi-line secret is masked
+// on its own, because log lines never span several lines of output.
+//
+// Base64 encodes 3 bytes at a time, so the encoding of a secret that is part
+// of a longer encoded text depends on its offset. The variants therefore hold
+// the part of the encoding that is the same at every offset modulo 3.
+func Variants(secret string) []string {
+	variants := make([]string, 0)
+	add := func(variant string) {
+		if len(variant) >= MinLength && !slices.Contains(variants, variant) {
+			variants = append(variants, variant)
+		}
+	}
+
+	for line := range strings.SplitSeq(secret, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if len(line) < MinLength {
+			continue
+		}
+
+		add(line)
+		add(url.QueryEscape(line))
+		add(url.PathEscape(line))
+
+		for offset := range 3 {
+			padded := make([]byte, offset, offset+len(line))
+			padded = append(padded, line...)
+			encoded := base64.RawStdEncoding.EncodeToString(padded)
+
+			// Characters encoding bits of the padding or of whatever follows
+			// the secret differ from text to text.
+			start := (8*offset + 5) / 6
+			end := 8 * len(padded) / 6
+			add(encoded[start:end])
+			add(base64.RawURLEncoding.EncodeToString(padded)[start:end])
+		}
+	}
+
+	return variants
+}
+
+// Redact masks every secret in text.
+func (r *Redactor) Redact(text string) string {
+	return mask(text, r.find(text), 0)
+}
+
+// RedactLines masks every secret in texts, including secrets split across
+// consecutive texts. Every part of a split secret is masked.
+func (r *Redactor) RedactLines(texts []string) []string {
+	joined := strings.Join(texts, "")
+	found := r.find(joined)
+
+	redacted := make([]string, 0, len(texts))
+	offset := 0
+	for _, text := range texts {
+		redacted = append(redacted, mask(text, found, offset))
+		offset += len(text)
+	}
+	return redacted
+}
+
+// Incomplete returns the index of the first of texts that may hold the
+// beginning of a secret whose end hasn't been seen yet, or len(texts) if
+// there is none. Those texts should be redacted again once the texts that
+// follow them are known.
+func (r *Redactor) Incomplete(texts []string) int {
+	joined := strings.Join(texts, "")
+	start := len(joined)
+
+	for _, value := range r.values {
+		if k := suffixPrefix(joined, value); k > 0 {
+			start = min(start, len(joined)-k)
+		}
+	}
+
+	for i, pattern := range r.patterns {
+		prefix, _ := pattern.LiteralPrefix()
+		if k := suffixPrefix(joined, prefix); k > 0 {
+			start = min(start, len(joined)-k)
+		}
+
+		// A match that ends with the text could go on, and text that
+		// doesn't match yet could match once more of it is known. Text
+		// that can't become a match, however it goes on, isn't held back.
+		// Matches start with the literal prefix of the pattern, or at any
+		// character if it has none.
+		from := max(0, len(joined)-maxPatternLength)
+		for from < len(joined) {
+			j := from
+			if prefix != "" {
+				k := strings.Index(joined[from:], prefix)
+				if k < 0 {
+					break
+				}
+				j += k
+			} else if !utf8.RuneStart(joined[j]) {
+				from++
+				continue
+			}
+
+			loc := r.anchored[i].FindStringIndex(joined[j:])
+			if loc != nil && j+loc[1] == len(joined) || loc == nil && partial(r.progs[i], joined[j:]) {
+				start = min(start, j)
+				break
+			}
+			from = j + max(len(prefix), 1)
+		}
+	}
+
+	offset := 0
+	for i, text := range texts {
+		offset += len(text)
+		if offset > start {
+			return i
+		}
+	}
+	return len(texts)
+}
+
+// find returns the sorted, non-overlapping byte ranges of text to mask.
+func (r *Redactor) find(text string) [][2]int {
+	found := make([][2]int, 0)
+
+	for _, value := range r.values {
+		from := 0
+		for {
+			i := strings.Index(text[from:], value)
+			if i < 0 {
+				break
+			}
+			found = append(found, [2]int{from + i, from + i + len(value)})
+			from += i + len(value)
+		}
+	}
+
+	for _, pattern := range r.patterns {
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			if loc[0] < loc[1] {
+				found = append(found, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return found
+	}
+
+	slices.SortFunc(found, func(a, b [2]int) int { return a[0] - b[0] })
+	merged := found[:1]
+	for _, loc := range found[1:] {
+		last := &merged[len(merged)-1]
+		if loc[0] <= last[1] {
+			last[1] = max(last[1], loc[1])
+			continue
+		}
+		merged = append(merged, loc)
+	}
+	return merged
+}
+
+// mask replaces the parts of text covered by found with Mask. The ranges in
+// found are relative to a text that text starts at offset of.
+func mask(text string, found [][2]int, offset int) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range found {
+		start, end := loc[0]-offset, loc[1]-offset
+		if end <= 0 {
+			continue
+		}
+		if start >= len(text) {
+			break
+		}
+
+		start, end = max(start, 0), min(end, len(text))
+		b.WriteString(text[last:start])
+		b.WriteString(Mask)
+		last = end
+	}
+	if last == 0 && b.Len() == 0 {
+		return text
+	}
+
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// partial reports whether text is the beginning of a match of prog, that is
+// whether text followed by more text could match. It runs prog as an NFA over
+// text and checks that some thread is still alive at the end. Empty-width
+// assertions are assumed to hold, as they may depend on the text that follows.
+func partial(prog *syntax.Prog, text string) bool {
+	threads := follow(prog, nil, uint32(prog.Start))
+	for _, c := range text {
+		next := make([]uint32, 0, len(threads))
+		for _, pc := range threads {
+			inst := &prog.Inst[pc]
+			switch inst.Op {
+			case syntax.InstRune, syntax.InstRune1:
+				if inst.MatchRune(c) {
+					next = follow(prog, next, inst.Out)
+				}
+			case syntax.InstRuneAny:
+				next = follow(prog, next, inst.Out)
+			case syntax.InstRuneAnyNotNL:
+				if c != '\n' {
+					next = follow(prog, next, inst.Out)
+				}
+			}
+		}
+
+		threads = next
+		if len(threads) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// follow adds pc to threads, following the instructions that don't consume
+// text.
+func follow(prog *syntax.Prog, threads []uint32, pc uint32) []uint32 {
+	if slices.Contains(threads, pc) {
+		return threads
+	}
+	threads = append(threads, pc)
+
+	inst := &prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch:
+		threads = follow(prog, threads, inst.Out)
+		threads = follow(prog, threads, inst.Arg)
+	case syntax.InstCapture, syntax.InstNop, syntax.InstEmptyWidth:
+		threads = follow(prog, threads, inst.Out)
+	}
+	return threads
+}
+
+// suffixPrefix returns the length of the longest proper prefix of value that
+// text ends with.
+func suffixPrefix(text, value string) int {
+	for k := min(len(value)-1, len(text)); k > 0; k-- {
+		if strings.HasSuffix(text, value[:k]) {
+			return k
+		}
+	}
+	return 0
+}
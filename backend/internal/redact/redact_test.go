@@ -0,0 +1,173 @@
+package redact
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newDefault(t *testing.T, secrets ...string) *Redactor {
+	t.Helper()
+	patterns, err := CompilePatterns(DefaultPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(secrets, patterns)
+}
+
+func TestRedactLinesMasksSplitSecrets(t *testing.T) {
+	token := "ghp_" + strings.Repeat("a", 36)
+
+	tests := []struct {
+		name    string
+		secrets []string
+		texts   []string
+		want    []string
+	}{
+		{
+			name:    "secret split across lines",
+			secrets: []string{"hunter22"},
+			texts:   []string{"password: hun", "ter22\n"},
+			want:    []string{"password: ***", "***\n"},
+		},
+		{
+			name:  "pattern split across lines",
+			texts: []string{"token " + token[:10], token[10:] + "\n"},
+			want:  []string{"token ***", "***\n"},
+		},
+		{
+			name:    "nothing to mask",
+			secrets: []string{"hunter22"},
+			texts:   []string{"All tests passed\n", "Done\n"},
+			want:    []string{"All tests passed\n", "Done\n"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newDefault(t, test.secrets...).RedactLines(test.texts)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	token := "ghp_" + strings.Repeat("a", 36)
+
+	tests := []struct {
+		name    string
+		secrets []string
+		texts   []string
+		want    int
+	}{
+		{
+			name:    "beginning of a secret",
+			secrets: []string{"hunter22"},
+			texts:   []string{"log in\n", "password: hun"},
+			want:    1,
+		},
+		{
+			name:  "literal prefix of a pattern",
+			texts: []string{"log in\n", "token gh"},
+			want:  1,
+		},
+		{
+			name:  "beginning of a match of a pattern",
+			texts: []string{"log in\n", "token ", token[:20]},
+			want:  2,
+		},
+		{
+			name:  "match of a pattern that could go on",
+			texts: []string{"log in\n", "token " + token},
+			want:  1,
+		},
+		{
+			name:  "complete match of a pattern",
+			texts: []string{"log in\n", "token " + token + "\n"},
+			want:  2,
+		},
+		{
+			name:  "literal prefix that can't become a match",
+			texts: []string{"All tests passed\n", "Done\n"},
+			want:  2,
+		},
+		{
+			name:  "text after the literal prefix that can't become a match",
+			texts: []string{"see ghp_ docs\n", "ASIA is a continent\n"},
+			want:  2,
+		},
+		{
+			name:  "matches that end before the text",
+			texts: []string{"key AKIA" + strings.Repeat("A", 16) + " used\n"},
+			want:  1,
+		},
+		{
+			name:  "no texts",
+			texts: []string{},
+			want:  0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := newDefault(t, test.secrets...).Incomplete(test.texts)
+			if got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIncompleteHoldsSplitMatchesOfPatternsWithoutPrefix(t *testing.T) {
+	patterns, err := CompilePatterns([]string{`(?i)password=\S+`, `[0-9a-f]{40}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(nil, patterns)
+	sha := strings.Repeat("0123456789abcdef", 3)[:40]
+
+	tests := []struct {
+		name          string
+		first, second []string
+		wantHeld      int
+		want          []string
+	}{
+		{
+			name:     "case-insensitive pattern",
+			first:    []string{"log in\n", "PassWord=hun"},
+			second:   []string{"ter22\n"},
+			wantHeld: 1,
+			want:     []string{"log in\n", "***", "***\n"},
+		},
+		{
+			name:     "pattern of a character class",
+			first:    []string{"commit\n", "sha " + sha[:15]},
+			second:   []string{sha[15:] + "\n"},
+			wantHeld: 1,
+			want:     []string{"commit\n", "sha ***", "***\n"},
+		},
+		{
+			name:     "text that can't become a match",
+			first:    []string{"password: none\n", "deadbeef done\n"},
+			second:   []string{"ok\n"},
+			wantHeld: 2,
+			want:     []string{"password: none\n", "deadbeef done\n", "ok\n"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			held := r.Incomplete(test.first)
+			if held != test.wantHeld {
+				t.Fatalf("got %d, want %d", held, test.wantHeld)
+			}
+
+			// The lines that were ready are redacted on their own, and the held
+			// lines once the next ones arrive, as storeLogs does.
+			got := r.RedactLines(test.first[:held])
+			got = append(got, r.RedactLines(slices.Concat(test.first[held:], test.second))...)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
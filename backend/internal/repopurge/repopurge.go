@@ -0,0 +1,139 @@
+// Package repopurge deletes repositories that the app was removed from long
+// enough ago, with their builds, logs, artifacts and caches. Until then,
+// removed repositories are only hidden, so that they're restored with their
+// history if the app is installed on them again.
+package repopurge
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+type Config struct {
+	// After is how long after it was removed a repository is purged. It has
+	// no default: repositories are only purged if it's configured.
+	After time.Duration
+
+	// Interval is how often the purger looks for repositories to purge.
+	Interval time.Duration
+
+	// BatchSize is how many repositories are purged per interval at most.
+	BatchSize int
+}
+
+// DefaultConfig returns the configuration used when none is configured.
+func DefaultConfig() Config {
+	return Config{
+		Interval:  time.Hour,
+		BatchSize: 10,
+	}
+}
+
+type Purger struct {
+	logger     *slog.Logger
+	repoRepo   data.RepoRepo
+	logsWriter data.LogsWriter
+	blobs      blob.Store
+	config     Config
+}
+
+// New returns a purger that deletes the logs of purged builds with logsWriter,
+// and their blobs from blobs, which may be nil if blob storage isn't
+// configured.
+func New(repoRepo data.RepoRepo, logsWriter data.LogsWriter, blobs blob.Store, config Config) *Purger {
+	return &Purger{
+		logger:     slog.Default().With(slog.String("subsystem", "repopurge")),
+		repoRepo:   repoRepo,
+		logsWriter: logsWriter,
+		blobs:      blobs,
+		config:     config,
+	}
+}
+
+// Start starts the purger. It is safe to run multiple purgers against the
+// same database.
+//
+// To shut down the purger, cancel the context.
+func (p Purger) Start(ctx context.Context) error {
+	p.logger.Info("purger started",
+		slog.Duration("interval", p.config.Interval),
+		slog.Duration("after", p.config.After),
+	)
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Debug("context cancelled, purger will stop")
+			return nil
+		case <-ticker.C:
+			err := p.PurgeRemoved(ctx)
+			if err != nil {
+				p.logger.Error("failed to purge removed repositories", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// PurgeRemoved purges up to BatchSize repositories that were removed more than
+// After ago.
+//
+// Repositories are deleted from the database before their logs and blobs, so
+// that a repository restored in the meantime never refers to deleted blobs.
+// Logs and blobs that can't be deleted are logged and left behind.
+func (p Purger) PurgeRemoved(ctx context.Context) error {
+	removedBefore := time.Now().Add(-p.config.After)
+	repos, err := p.repoRepo.GetRemoved(ctx, removedBefore, p.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range repos {
+		purged, err := p.repoRepo.Purge(ctx, repo.ID, removedBefore)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+
+		for _, buildID := range purged.BuildIDs {
+			err = p.logsWriter.Delete(ctx, buildID)
+			if err != nil {
+				p.logger.Error("failed to delete logs of purged build",
+					slog.Int64("repo_id", repo.ID),
+					slog.Int64("build_id", buildID),
+					slog.Any("error", err),
+				)
+			}
+		}
+
+		if p.blobs != nil {
+			for _, key := range purged.BlobKeys {
+				err = p.blobs.Delete(ctx, key)
+				if err != nil {
+					p.logger.Error("failed to delete blob of purged repository",
+						slog.Int64("repo_id", repo.ID),
+						slog.String("blob_key", key),
+						slog.Any("error", err),
+					)
+				}
+			}
+		}
+
+		p.logger.Info("purged removed repository",
+			slog.Any("repo", repo),
+			slog.Int("builds", len(purged.BuildIDs)),
+			slog.Int("blobs", len(purged.BlobKeys)),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Package reposync reconciles the repositories of installations with the
+// repositories the app can access on GitHub, so that the repositories table
+// recovers from missed installation_repositories webhooks.
+package reposync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/go-github/v64/github"
+
+	"github.com/bee-ci/bee-ci-system/internal/common/ghservice"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// Report lists what changed when the repositories of an installation were
+// reconciled.
+type Report struct {
+	InstallationID int64
+
+	// Added are the repositories that weren't known to belong to the
+	// installation.
+	Added []data.Repo
+
+	// Restored are the repositories that were removed, but can be accessed
+	// again.
+	Restored []data.Repo
+
+	// Updated are the repositories whose name or visibility changed, as they
+	// are now.
+	Updated []data.Repo
+
+	// Removed are the repositories that can't be accessed anymore.
+	Removed []data.Repo
+
+	// Unchanged is how many repositories were up-to-date.
+	Unchanged int
+}
+
+type Syncer struct {
+	logger           *slog.Logger
+	installationRepo data.InstallationRepo
+	repoRepo         data.RepoRepo
+	githubService    *ghservice.GithubService
+	interval         time.Duration
+}
+
+func New(installationRepo data.InstallationRepo, repoRepo data.RepoRepo, githubService *ghservice.GithubService, interval time.Duration) *Syncer {
+	return &Syncer{
+		logger:           slog.Default().With(slog.String("subsystem", "reposync")),
+		installationRepo: installationRepo,
+		repoRepo:         repoRepo,
+		githubService:    githubService,
+		interval:         interval,
+	}
+}
+
+// Start starts the syncer, which syncs all installations every interval. It
+// is safe to run multiple syncers against the same database.
+//
+// To shut down the syncer, cancel the context.
+func (s Syncer) Start(ctx context.Context) error {
+	s.logger.Info("syncer started", slog.Duration("interval", s.interval))
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("context cancelled, syncer will stop")
+			return nil
+		case <-ticker.C:
+			err := s.SyncAll(ctx)
+			if err != nil {
+				s.logger.Error("failed to sync installations", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// SyncAll syncs the repositories of all installations. An installation that
+// fails to sync is logged and doesn't stop the others from syncing.
+func (s Syncer) SyncAll(ctx context.Context) error {
+	installations, err := s.installationRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, installation := range installations {
+		report, err := s.Sync(ctx, installation.ID)
+		if err != nil {
+			s.logger.Error("failed to sync installation", slog.Int64("installation_id", installation.ID), slog.Any("error", err))
+			continue
+		}
+
+		if len(report.Added)+len(report.Restored)+len(report.Updated)+len(report.Removed) > 0 {
+			s.logger.Info("synced installation",
+				slog.Int64("installation_id", installation.ID),
+				slog.Int("added", len(report.Added)),
+				slog.Int("restored", len(report.Restored)),
+				slog.Int("updated", len(report.Updated)),
+				slog.Int("removed", len(report.Removed)),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Sync makes the repositories of the installation with installationID match
+// the repositories it can access on GitHub. Repositories that it can't access
+// anymore are removed, not deleted. Returns data.ErrNotFound if the
+// installation doesn't exist.
+//
+// Nothing is changed if the repositories can't be listed completely.
+func (s Syncer) Sync(ctx context.Context, installationID int64) (*Report, error) {
+	installation, err := s.installationRepo.Get(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessible, err := s.listAccessible(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+
+	known, err := s.repoRepo.GetAllForInstallation(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	knownByID := make(map[int64]data.Repo, len(known))
+	for _, repo := range known {
+		knownByID[repo.ID] = repo
+	}
+
+	report := Report{
+		InstallationID: installationID,
+		Added:          make([]data.Repo, 0),
+		Restored:       make([]data.Repo, 0),
+		Updated:        make([]data.Repo, 0),
+		Removed:        make([]data.Repo, 0),
+	}
+
+	upserts := make([]data.Repo, 0)
+	accessibleIDs := make(map[int64]bool, len(accessible))
+	for _, ghRepo := range accessible {
+		accessibleIDs[ghRepo.GetID()] = true
+
+		repo := data.Repo{
+			ID:             ghRepo.GetID(),
+			Name:           ghRepo.GetName(),
+			FullName:       ghRepo.GetFullName(),
+			Private:        ghRepo.GetPrivate(),
+			UserID:         installation.UserID,
+			InstallationID: &installationID,
+		}
+
+		knownRepo, ok := knownByID[repo.ID]
+		switch {
+		case !ok:
+			report.Added = append(report.Added, repo)
+		case knownRepo.RemovedAt != nil:
+			report.Restored = append(report.Restored, repo)
+		case knownRepo.FullName != repo.FullName || knownRepo.Private != repo.Private:
+			report.Updated = append(report.Updated, repo)
+		default:
+			report.Unchanged++
+			continue
+		}
+		upserts = append(upserts, repo)
+	}
+
+	removedIDs := make([]int64, 0)
+	for _, repo := range known {
+		if repo.RemovedAt == nil && !accessibleIDs[repo.ID] {
+			report.Removed = append(report.Removed, repo)
+			removedIDs = append(removedIDs, repo.ID)
+		}
+	}
+
+	if len(upserts) > 0 {
+		err = s.repoRepo.Upsert(ctx, upserts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(removedIDs) > 0 {
+		err = s.repoRepo.Remove(ctx, removedIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &report, nil
+}
+
+// listAccessible returns all repositories the installation with
+// installationID can access.
+func (s Syncer) listAccessible(ctx context.Context, installationID int64) ([]*github.Repository, error) {
+	ghClient, err := s.githubService.GetClientForInstallation(ctx, installationID)
+	if err != nil {
+		return nil, fmt.Errorf("get github client: %w", err)
+	}
+
+	repos := make([]*github.Repository, 0)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := ghClient.Apps.ListRepos(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("list repositories of installation: %w", err)
+		}
+		repos = append(repos, page.Repositories...)
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	return repos, nil
+}
@@ -0,0 +1,371 @@
+// Package scheduler implements a listener that listens the database for job
+// updates, releases jobs whose dependencies succeeded to the queue, skips jobs
+// whose dependencies didn't succeed, and derives the status of the build from
+// its jobs. Once a build completes, its logs are finalized.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/expr"
+	"github.com/bee-ci/bee-ci-system/internal/pipeline"
+	"github.com/lib/pq"
+)
+
+const channelName = "jobs_channel"
+
+type Scheduler struct {
+	logger     *slog.Logger
+	dbListener *pq.Listener
+	jobRepo    data.JobRepo
+	buildRepo  data.BuildRepo
+	logsWriter data.LogsWriter
+}
+
+func New(dbListener *pq.Listener, jobRepo data.JobRepo, buildRepo data.BuildRepo, logsWriter data.LogsWriter) *Scheduler {
+	return &Scheduler{
+		logger:     slog.Default().With(slog.String("subsystem", "scheduler")),
+		dbListener: dbListener,
+		jobRepo:    jobRepo,
+		buildRepo:  buildRepo,
+		logsWriter: logsWriter,
+	}
+}
+
+// Start starts the scheduler. It will listen for job updates from the
+// database and advance the build the job belongs to.
+//
+// To shut down the scheduler, cancel the context.
+func (s Scheduler) Start(ctx context.Context) error {
+	err := s.dbListener.Listen(channelName)
+	if err != nil {
+		return fmt.Errorf("listen on channel %s: %w", channelName, err)
+	}
+
+	s.logger.Info("scheduler started, listens to db changes", slog.String("channel", channelName))
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("context cancelled, db listener will be closed")
+			err = s.dbListener.Close()
+			if err != nil {
+				s.logger.Error("failed to close db listener", slog.Any("error", err))
+				return err
+			}
+			return nil
+		case msg := <-s.dbListener.Notify:
+			if msg == nil {
+				// The connection was re-established. Notifications sent in the
+				// meantime are lost.
+				continue
+			}
+
+			updatedJob := data.Job{}
+			err := json.Unmarshal([]byte(msg.Extra), &updatedJob)
+			if err != nil {
+				s.logger.Error("db listener got notification but it failed to unmarshal job", slog.Any("error", err))
+				break
+			}
+
+			s.logger.Debug("db listener got notification",
+				slog.Any("channel", msg.Channel),
+				slog.Any("job", updatedJob),
+			)
+
+			err = s.Advance(ctx, updatedJob.BuildID)
+			var conflict *buildstate.ConflictError
+			if errors.As(err, &conflict) {
+				// Nothing was changed. The build is advanced again on the
+				// next update of one of its jobs.
+				s.logger.Warn("build changed concurrently, not advanced", slog.Int64("build_id", updatedJob.BuildID), slog.Any("error", err))
+				break
+			}
+			if err != nil {
+				s.logger.Error("failed to advance build", slog.Int64("build_id", updatedJob.BuildID), slog.Any("error", err))
+				break
+			}
+
+			if updatedJob.Status == "completed" {
+				err = s.finalizeLogs(ctx, updatedJob.BuildID)
+				if err != nil {
+					s.logger.Error("failed to finalize logs", slog.Int64("build_id", updatedJob.BuildID), slog.Any("error", err))
+				}
+			}
+		}
+	}
+}
+
+// Advance releases or skips the pending jobs of the build with buildID, and
+// updates the build's status and conclusion. It is safe to call Advance
+// concurrently and multiple times for the same build.
+func (s Scheduler) Advance(ctx context.Context, buildID int64) error {
+	return s.jobRepo.Schedule(ctx, buildID, Plan)
+}
+
+// finalizeLogs finalizes the logs of the build with buildID if it completed.
+// Jobs completing at the same time may finalize the logs more than once.
+func (s Scheduler) finalizeLogs(ctx context.Context, buildID int64) error {
+	build, err := s.buildRepo.GetByID(ctx, buildID)
+	if err != nil {
+		return fmt.Errorf("get build: %w", err)
+	}
+	if build.Status != "completed" {
+		return nil
+	}
+
+	return s.logsWriter.Finalize(ctx, buildID)
+}
+
+// Plan implements [data.ScheduleFunc].
+//
+// A pending job is evaluated once all jobs it depends on completed: it's
+// queued if its condition is true, and skipped otherwise. A job without a
+// condition, or whose condition doesn't call any status function, implicitly
+// requires success() – such jobs are skipped as soon as any job they depend on
+// completed with a conclusion other than "success". Skipping propagates to the
+// job's dependents. A job whose condition fails to evaluate is completed with
+// "failure".
+//
+// Jobs expanded from the same matrix are additionally limited by the matrix's
+// max_parallel, and if the matrix is fail_fast, the ones that haven't started
+// yet are canceled as soon as one of them fails.
+func Plan(build data.Build, jobs []data.Job) (updates []data.JobUpdate, buildStatus string, buildConclusion *string) {
+	updates = make([]data.JobUpdate, 0)
+
+	if build.Status == "completed" || len(jobs) == 0 {
+		return updates, build.Status, build.Conclusion
+	}
+
+	byName := make(map[string]*data.Job, len(jobs))
+	siblings := make(map[string][]*data.Job, len(jobs))
+	for i := range jobs {
+		byName[jobs[i].Name] = &jobs[i]
+		siblings[jobs[i].ParentName] = append(siblings[jobs[i].ParentName], &jobs[i])
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i := range jobs {
+			job := &jobs[i]
+			if job.Status != "pending" && job.Status != "queued" {
+				continue
+			}
+
+			switch {
+			case job.FailFast && siblingFailed(siblings[job.ParentName]):
+				job.Status = "completed"
+				job.Conclusion = ptr("canceled")
+			case job.Status == "queued":
+				continue
+			case !usesStatusFunction(job) && dependencyFailed(job, byName):
+				job.Status = "completed"
+				job.Conclusion = ptr("skipped")
+			case !dependenciesCompleted(job, byName):
+				continue
+			default:
+				run, err := evaluateCondition(build, job, byName)
+				switch {
+				case err != nil:
+					job.Status = "completed"
+					job.Conclusion = ptr("failure")
+				case !run:
+					job.Status = "completed"
+					job.Conclusion = ptr("skipped")
+				case belowMaxParallel(job, siblings[job.ParentName]):
+					job.Status = "queued"
+				default:
+					continue
+				}
+			}
+
+			changed = true
+			updates = append(updates, data.JobUpdate{
+				JobID:      job.ID,
+				Status:     job.Status,
+				Conclusion: job.Conclusion,
+			})
+		}
+	}
+
+	buildStatus, buildConclusion = Derive(jobs)
+	if !buildstate.CanChangeBuild(build.Status, buildStatus) {
+		// A build that started stays in progress while its jobs are returned
+		// to the queue.
+		buildStatus = build.Status
+	}
+	return updates, buildStatus, buildConclusion
+}
+
+func dependencyFailed(job *data.Job, byName map[string]*data.Job) bool {
+	for _, depName := range job.DependsOn {
+		dep, ok := byName[depName]
+		if !ok || (dep.Status == "completed" && conclusionOf(*dep) != "success") {
+			return true
+		}
+	}
+	return false
+}
+
+func dependenciesCompleted(job *data.Job, byName map[string]*data.Job) bool {
+	for _, depName := range job.DependsOn {
+		if dep, ok := byName[depName]; ok && dep.Status != "completed" {
+			return false
+		}
+	}
+	return true
+}
+
+func usesStatusFunction(job *data.Job) bool {
+	if job.Condition == "" {
+		return false
+	}
+	condition, err := expr.Parse(job.Condition)
+	return err == nil && condition.UsesStatusFunction()
+}
+
+// evaluateCondition evaluates the condition of a job whose dependencies have
+// all completed.
+func evaluateCondition(build data.Build, job *data.Job, byName map[string]*data.Job) (bool, error) {
+	status := expr.Status{Success: true}
+	for _, depName := range job.DependsOn {
+		dep, ok := byName[depName]
+		if !ok {
+			status.Success = false
+			status.Failure = true
+			continue
+		}
+
+		switch conclusionOf(*dep) {
+		case "success":
+		case "failure", "timed_out":
+			status.Success = false
+			status.Failure = true
+		case "canceled":
+			status.Success = false
+			status.Cancelled = true
+		default:
+			status.Success = false
+		}
+	}
+
+	if job.Condition == "" {
+		return status.Success, nil
+	}
+
+	condition, err := expr.Parse(job.Condition)
+	if err != nil {
+		return false, err
+	}
+
+	buildCtx := pipeline.BuildContext{
+		Branch: build.Branch,
+		Event:  build.Event,
+		Labels: build.Labels,
+		Inputs: build.Inputs,
+	}
+	run, err := condition.EvalBool(expr.Context{
+		Variables: buildCtx.Variables(job.Matrix),
+		Status:    status,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if !condition.UsesStatusFunction() {
+		run = run && status.Success
+	}
+	return run, nil
+}
+
+func belowMaxParallel(job *data.Job, siblings []*data.Job) bool {
+	if job.MaxParallel == 0 {
+		return true
+	}
+
+	active := 0
+	for _, sibling := range siblings {
+		if sibling.Status == "queued" || sibling.Status == "in_progress" {
+			active++
+		}
+	}
+	return active < job.MaxParallel
+}
+
+func siblingFailed(siblings []*data.Job) bool {
+	if len(siblings) < 2 {
+		return false
+	}
+
+	for _, sibling := range siblings {
+		if sibling.Status == "completed" {
+			c := conclusionOf(*sibling)
+			if c == "failure" || c == "timed_out" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Derive returns the status and conclusion of a build from the state of its
+// jobs.
+//
+// The build is in progress once any of its jobs started. Jobs that were
+// requeued after their runner lost the lease started already, so the build
+// doesn't move back to "queued" while they wait for another runner.
+//
+// The build is completed once all of its jobs are completed. Its conclusion is
+// the most severe of its jobs' conclusions: "failure", then "timed_out", then
+// "canceled", otherwise "success".
+func Derive(jobs []data.Job) (status string, conclusion *string) {
+	completed, started := 0, false
+	conclusions := make(map[string]bool)
+	for _, job := range jobs {
+		switch job.Status {
+		case "completed":
+			completed++
+			started = true
+			conclusions[conclusionOf(job)] = true
+		case "in_progress":
+			started = true
+		default:
+			if job.Attempts > 0 || job.StartedAt != nil {
+				started = true
+			}
+		}
+	}
+
+	if completed < len(jobs) {
+		if started {
+			return "in_progress", nil
+		}
+		return "queued", nil
+	}
+
+	for _, c := range []string{"failure", "timed_out", "canceled"} {
+		if conclusions[c] {
+			return "completed", ptr(c)
+		}
+	}
+	return "completed", ptr("success")
+}
+
+// conclusionOf returns the conclusion of a completed job. A job that was
+// completed without a conclusion is treated as failed.
+func conclusionOf(job data.Job) string {
+	if job.Conclusion == nil {
+		return "failure"
+	}
+	return *job.Conclusion
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
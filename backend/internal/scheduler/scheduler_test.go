@@ -0,0 +1,242 @@
+package scheduler
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name  string
+		build data.Build
+		jobs  []data.Job
+
+		// want maps the names of the jobs that are updated to their new
+		// status, followed by their conclusion if they completed.
+		want      map[string]string
+		wantBuild string
+	}{
+		{
+			name:      "queues jobs without dependencies",
+			build:     data.Build{Status: "queued"},
+			jobs:      []data.Job{{ID: 1, Name: "a", Status: "pending"}, {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}}},
+			want:      map[string]string{"a": "queued"},
+			wantBuild: "queued",
+		},
+		{
+			name:      "queues jobs whose dependencies succeeded",
+			build:     data.Build{Status: "in_progress"},
+			jobs:      []data.Job{completed(1, "a", "success"), {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}}},
+			want:      map[string]string{"b": "queued"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:  "skips dependents of failed jobs transitively",
+			build: data.Build{Status: "in_progress"},
+			jobs: []data.Job{
+				completed(1, "a", "failure"),
+				{ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}},
+				{ID: 3, Name: "c", Status: "pending", DependsOn: []string{"b"}},
+			},
+			want:      map[string]string{"b": "completed skipped", "c": "completed skipped"},
+			wantBuild: "completed failure",
+		},
+		{
+			name:      "skips dependents of missing jobs",
+			build:     data.Build{Status: "queued"},
+			jobs:      []data.Job{{ID: 1, Name: "b", Status: "pending", DependsOn: []string{"a"}}},
+			want:      map[string]string{"b": "completed skipped"},
+			wantBuild: "completed success",
+		},
+		{
+			name:      "queues always() after a failure",
+			build:     data.Build{Status: "in_progress"},
+			jobs:      []data.Job{completed(1, "a", "failure"), {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}, Condition: "always()"}},
+			want:      map[string]string{"b": "queued"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:      "queues failure() after a failure",
+			build:     data.Build{Status: "in_progress"},
+			jobs:      []data.Job{completed(1, "a", "timed_out"), {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}, Condition: "failure()"}},
+			want:      map[string]string{"b": "queued"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:      "skips failure() after a success",
+			build:     data.Build{Status: "in_progress"},
+			jobs:      []data.Job{completed(1, "a", "success"), {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}, Condition: "failure()"}},
+			want:      map[string]string{"b": "completed skipped"},
+			wantBuild: "completed success",
+		},
+		{
+			name:      "waits for dependencies of status functions to complete",
+			build:     data.Build{Status: "in_progress"},
+			jobs:      []data.Job{{ID: 1, Name: "a", Status: "in_progress"}, {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}, Condition: "always()"}},
+			want:      map[string]string{},
+			wantBuild: "in_progress",
+		},
+		{
+			name:      "conditions without status functions require success",
+			build:     data.Build{Status: "in_progress", Branch: "main"},
+			jobs:      []data.Job{completed(1, "a", "failure"), {ID: 2, Name: "b", Status: "pending", DependsOn: []string{"a"}, Condition: "branch == 'main'"}},
+			want:      map[string]string{"b": "completed skipped"},
+			wantBuild: "completed failure",
+		},
+		{
+			name:  "evaluates conditions against the build and matrix",
+			build: data.Build{Status: "queued", Branch: "main"},
+			jobs: []data.Job{
+				{ID: 1, Name: "a", Status: "pending", Condition: "branch == 'main' && matrix.os == 'linux'", Matrix: data.StringMap{"os": "linux"}},
+				{ID: 2, Name: "b", Status: "pending", Condition: "branch == 'main' && matrix.os == 'linux'", Matrix: data.StringMap{"os": "windows"}},
+			},
+			want:      map[string]string{"a": "queued", "b": "completed skipped"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:  "fails jobs whose condition fails to evaluate",
+			build: data.Build{Status: "queued", Branch: "main"},
+			jobs: []data.Job{
+				{ID: 1, Name: "a", Status: "pending", Condition: "branch > 1"},
+				{ID: 2, Name: "b", Status: "pending", Condition: "branch =="},
+			},
+			want:      map[string]string{"a": "completed failure", "b": "completed failure"},
+			wantBuild: "completed failure",
+		},
+		{
+			name:  "limits jobs of a matrix to max_parallel",
+			build: data.Build{Status: "in_progress"},
+			jobs: []data.Job{
+				{ID: 1, Name: "test (1)", ParentName: "test", MaxParallel: 2, Status: "in_progress"},
+				{ID: 2, Name: "test (2)", ParentName: "test", MaxParallel: 2, Status: "pending"},
+				{ID: 3, Name: "test (3)", ParentName: "test", MaxParallel: 2, Status: "pending"},
+			},
+			want:      map[string]string{"test (2)": "queued"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:  "cancels jobs of a fail-fast matrix that didn't start once one fails",
+			build: data.Build{Status: "in_progress"},
+			jobs: []data.Job{
+				{ID: 1, Name: "test (1)", ParentName: "test", FailFast: true, Status: "completed", Conclusion: ptr("failure")},
+				{ID: 2, Name: "test (2)", ParentName: "test", FailFast: true, Status: "queued"},
+				{ID: 3, Name: "test (3)", ParentName: "test", FailFast: true, Status: "pending"},
+				{ID: 4, Name: "test (4)", ParentName: "test", FailFast: true, Status: "in_progress"},
+			},
+			want:      map[string]string{"test (2)": "completed canceled", "test (3)": "completed canceled"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:  "doesn't cancel jobs of a matrix that isn't fail-fast",
+			build: data.Build{Status: "in_progress"},
+			jobs: []data.Job{
+				{ID: 1, Name: "test (1)", ParentName: "test", Status: "completed", Conclusion: ptr("failure")},
+				{ID: 2, Name: "test (2)", ParentName: "test", Status: "pending"},
+			},
+			want:      map[string]string{"test (2)": "queued"},
+			wantBuild: "in_progress",
+		},
+		{
+			name:      "leaves completed builds untouched",
+			build:     data.Build{Status: "completed", Conclusion: ptr("canceled")},
+			jobs:      []data.Job{{ID: 1, Name: "a", Status: "pending"}},
+			want:      map[string]string{},
+			wantBuild: "completed canceled",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := make(map[int64]string, len(test.jobs))
+			for _, job := range test.jobs {
+				names[job.ID] = job.Name
+			}
+
+			updates, status, conclusion := Plan(test.build, test.jobs)
+
+			got := make(map[string]string, len(updates))
+			for _, update := range updates {
+				got[names[update.JobID]] = outcome(update.Status, update.Conclusion)
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("got updates %v, want %v", got, test.want)
+			}
+			if gotBuild := outcome(status, conclusion); gotBuild != test.wantBuild {
+				t.Errorf("got build %q, want %q", gotBuild, test.wantBuild)
+			}
+		})
+	}
+}
+
+func TestDerive(t *testing.T) {
+	startedAt := time.Now()
+
+	tests := []struct {
+		name string
+		jobs []data.Job
+		want string
+	}{
+		{
+			name: "no job started",
+			jobs: []data.Job{{Status: "pending"}, {Status: "queued"}},
+			want: "queued",
+		},
+		{
+			name: "a job is in progress",
+			jobs: []data.Job{{Status: "in_progress"}, {Status: "pending"}},
+			want: "in_progress",
+		},
+		{
+			name: "a job completed",
+			jobs: []data.Job{completed(1, "a", "success"), {Status: "pending"}},
+			want: "in_progress",
+		},
+		{
+			name: "a requeued job",
+			jobs: []data.Job{{Status: "queued", Attempts: 1, StartedAt: &startedAt}, {Status: "pending"}},
+			want: "in_progress",
+		},
+		{
+			name: "all jobs succeeded or were skipped",
+			jobs: []data.Job{completed(1, "a", "success"), completed(2, "b", "skipped")},
+			want: "completed success",
+		},
+		{
+			name: "failure is the most severe conclusion",
+			jobs: []data.Job{completed(1, "a", "canceled"), completed(2, "b", "failure"), completed(3, "c", "timed_out")},
+			want: "completed failure",
+		},
+		{
+			name: "timed_out is more severe than canceled",
+			jobs: []data.Job{completed(1, "a", "canceled"), completed(2, "b", "timed_out"), completed(3, "c", "success")},
+			want: "completed timed_out",
+		},
+		{
+			name: "a job completed without a conclusion failed",
+			jobs: []data.Job{{Status: "completed"}, completed(2, "b", "success")},
+			want: "completed failure",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := outcome(Derive(test.jobs))
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func completed(id int64, name, conclusion string) data.Job {
+	return data.Job{ID: id, Name: name, Status: "completed", Conclusion: &conclusion}
+}
+
+// outcome formats a status, followed by the conclusion if there is one.
+func outcome(status string, conclusion *string) string {
+	if conclusion == nil {
+		return status
+	}
+	return status + " " + *conclusion
+}
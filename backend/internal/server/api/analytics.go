@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/common/userid"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// defaultAnalyticsRange is how far back analytics go if "from" isn't set.
+const defaultAnalyticsRange = 30 * 24 * time.Hour
+
+// maxAnalyticsBuckets is how many buckets analytics grouped by time may have,
+// so that a fine granularity over a long range doesn't return huge responses.
+const maxAnalyticsBuckets = 1000
+
+// bucketSizes are the shortest durations of the buckets of each granularity.
+var bucketSizes = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 28 * 24 * time.Hour,
+}
+
+// parseAnalyticsQuery parses the query parameters of analytics: "from" and
+// "to" (RFC 3339 timestamps, the last 30 days by default), "granularity" (one
+// of data.Granularities, "day" by default), "repoId" and "branch".
+func parseAnalyticsQuery(r *http.Request) (data.AnalyticsQuery, error) {
+	query := r.URL.Query()
+	q := data.AnalyticsQuery{
+		Branch:      query.Get("branch"),
+		To:          time.Now(),
+		Granularity: "day",
+	}
+
+	if query.Has("to") {
+		to, err := time.Parse(time.RFC3339, query.Get("to"))
+		if err != nil {
+			return q, fmt.Errorf("invalid to: %s", query.Get("to"))
+		}
+		q.To = to
+	}
+
+	q.From = q.To.Add(-defaultAnalyticsRange)
+	if query.Has("from") {
+		from, err := time.Parse(time.RFC3339, query.Get("from"))
+		if err != nil {
+			return q, fmt.Errorf("invalid from: %s", query.Get("from"))
+		}
+		q.From = from
+	}
+
+	if !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+
+	if query.Has("granularity") {
+		q.Granularity = query.Get("granularity")
+		if !slices.Contains(data.Granularities, q.Granularity) {
+			return q, fmt.Errorf("invalid granularity: %s", q.Granularity)
+		}
+	}
+
+	if query.Get("repoId") != "" {
+		repoID, err := strconv.ParseInt(query.Get("repoId"), 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid repoId: %s", query.Get("repoId"))
+		}
+		q.RepoID = repoID
+	}
+
+	return q, nil
+}
+
+// analyticsQuery returns the user and the query of an analytics request. If
+// it returns false, the error was already written to w. If bucketed is true,
+// the query is rejected if it has too many buckets.
+func analyticsQuery(w http.ResponseWriter, r *http.Request, bucketed bool) (userID int64, q data.AnalyticsQuery, ok bool) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok = userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return 0, q, false
+	}
+
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, q, false
+	}
+
+	if bucketed && q.To.Sub(q.From)/bucketSizes[q.Granularity] >= maxAnalyticsBuckets {
+		msg := fmt.Sprintf("too many buckets: at most %d %ss can be requested", maxAnalyticsBuckets, q.Granularity)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return 0, q, false
+	}
+
+	return userID, q, true
+}
+
+// getSuccessRates returns how many builds succeeded and failed per bucket.
+func (a *App) getSuccessRates(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, q, ok := analyticsQuery(w, r, true)
+	if !ok {
+		return
+	}
+
+	buckets, err := a.AnalyticsRepo.SuccessRates(r.Context(), userID, q)
+	if err != nil {
+		msg := "failed to get success rates"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := successRatesDTO{
+		From:        q.From,
+		To:          q.To,
+		Granularity: q.Granularity,
+		Buckets:     make([]successRateBucketDTO, 0, len(buckets)),
+	}
+	for _, bucket := range buckets {
+		response.Buckets = append(response.Buckets, successRateBucketDTO{
+			Start:       bucket.Start,
+			Total:       bucket.Total,
+			Successful:  bucket.Successful,
+			Failed:      bucket.Failed,
+			SuccessRate: ratio(bucket.Successful, bucket.Successful+bucket.Failed),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode success rates into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getDurations returns the percentiles of how long builds waited in the queue
+// and ran per bucket.
+func (a *App) getDurations(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, q, ok := analyticsQuery(w, r, true)
+	if !ok {
+		return
+	}
+
+	buckets, err := a.AnalyticsRepo.Durations(r.Context(), userID, q)
+	if err != nil {
+		msg := "failed to get durations"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := durationsDTO{
+		From:        q.From,
+		To:          q.To,
+		Granularity: q.Granularity,
+		Buckets:     make([]durationBucketDTO, 0, len(buckets)),
+	}
+	for _, bucket := range buckets {
+		response.Buckets = append(response.Buckets, durationBucketDTO{
+			Start:        bucket.Start,
+			Builds:       bucket.Builds,
+			QueueSeconds: percentilesDTO{P50: bucket.QueueP50, P90: bucket.QueueP90, P99: bucket.QueueP99},
+			RunSeconds:   percentilesDTO{P50: bucket.RunP50, P90: bucket.RunP90, P99: bucket.RunP99},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode durations into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getJobFailures returns the jobs that failed in the range, most failures
+// first.
+func (a *App) getJobFailures(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, q, ok := analyticsQuery(w, r, false)
+	if !ok {
+		return
+	}
+
+	failures, err := a.AnalyticsRepo.JobFailures(r.Context(), userID, q)
+	if err != nil {
+		msg := "failed to get job failures"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := jobFailuresDTO{
+		From: q.From,
+		To:   q.To,
+		Jobs: make([]jobFailureDTO, 0, len(failures)),
+	}
+	for _, job := range failures {
+		response.Jobs = append(response.Jobs, jobFailureDTO{
+			RepoID:       strconv.FormatInt(job.RepoID, 10),
+			RepoName:     job.RepoName,
+			JobName:      job.JobName,
+			Runs:         job.Runs,
+			Failures:     job.Failures,
+			FailureRate:  *ratio(job.Failures, job.Runs),
+			Share:        job.Share,
+			LastFailedAt: job.LastFailedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode job failures into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getRecovery returns the mean time to recovery of every branch that failed
+// in the range, slowest first.
+func (a *App) getRecovery(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, q, ok := analyticsQuery(w, r, false)
+	if !ok {
+		return
+	}
+
+	recoveries, err := a.AnalyticsRepo.Recovery(r.Context(), userID, q)
+	if err != nil {
+		msg := "failed to get recovery"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := recoveryDTO{
+		From:     q.From,
+		To:       q.To,
+		Branches: make([]branchRecoveryDTO, 0, len(recoveries)),
+	}
+	for _, recovery := range recoveries {
+		response.Branches = append(response.Branches, branchRecoveryDTO{
+			RepoID:                    strconv.FormatInt(recovery.RepoID, 10),
+			RepoName:                  recovery.RepoName,
+			Branch:                    recovery.Branch,
+			Failures:                  recovery.Failures,
+			Recoveries:                recovery.Recoveries,
+			MeanTimeToRecoverySeconds: recovery.MeanSeconds,
+			FailingSince:              recovery.FailingSince,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode recovery into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// ratio returns n/total, or nil if total is 0.
+func ratio(n, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	r := float64(n) / float64(total)
+	return &r
+}
@@ -2,36 +2,89 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"math"
 	"net/http"
-	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bee-ci/bee-ci-system/internal/blob"
 	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
 	"github.com/bee-ci/bee-ci-system/internal/common/middleware"
 	"github.com/bee-ci/bee-ci-system/internal/common/userid"
 	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/envelope"
+	pl "github.com/bee-ci/bee-ci-system/internal/pipeline"
+	"github.com/bee-ci/bee-ci-system/internal/queue"
+	"github.com/bee-ci/bee-ci-system/internal/reposync"
 )
 
 type App struct {
-	BuildRepo data.BuildRepo
-	LogsRepo  data.LogsRepo
-	RepoRepo  data.RepoRepo
-	UserRepo  data.UserRepo
+	BuildRepo  data.BuildRepo
+	JobRepo    data.JobRepo
+	LogsRepo   data.LogsReader
+	LogsBroker data.LogsBroker
+	RepoRepo   data.RepoRepo
+	UserRepo   data.UserRepo
+	RunnerRepo data.RunnerRepo
+	QueueRepo  data.QueueRepo
+
+	DashboardRepo  data.DashboardRepo
+	BuildEventRepo data.BuildEventRepo
+	AnalyticsRepo  data.AnalyticsRepo
+
+	InstallationRepo data.InstallationRepo
+
+	// RepoSyncer reconciles the repositories of installations with GitHub.
+	RepoSyncer *reposync.Syncer
+
+	// LogArchiveRepo and Blobs are nil if logs aren't archived. Artifacts
+	// can't be downloaded either if Blobs is nil.
+	LogArchiveRepo data.LogArchiveRepo
+	Blobs          blob.Store
+	ArtifactRepo   data.ArtifactRepo
+
+	SecretRepo   data.SecretRepo
+	VariableRepo data.VariableRepo
+
+	// Keyring encrypts secrets. Secrets can't be created if it's nil.
+	Keyring *envelope.Keyring
+
+	// logRetentionDaysDefault is how many days logs are kept after the build
+	// completes, unless the installation overrides it.
+	logRetentionDaysDefault int
+
 	jwtSecret []byte
 }
 
-func NewApp(buildRepo data.BuildRepo, logsRepo data.LogsRepo, repoRepo data.RepoRepo, userRepo data.UserRepo, jwtSecret []byte) *App {
+func NewApp(buildRepo data.BuildRepo, jobRepo data.JobRepo, logsRepo data.LogsReader, logsBroker data.LogsBroker, repoRepo data.RepoRepo, userRepo data.UserRepo, runnerRepo data.RunnerRepo, queueRepo data.QueueRepo, dashboardRepo data.DashboardRepo, buildEventRepo data.BuildEventRepo, analyticsRepo data.AnalyticsRepo, installationRepo data.InstallationRepo, repoSyncer *reposync.Syncer, logArchiveRepo data.LogArchiveRepo, blobs blob.Store, artifactRepo data.ArtifactRepo, secretRepo data.SecretRepo, variableRepo data.VariableRepo, keyring *envelope.Keyring, logRetentionDaysDefault int, jwtSecret []byte) *App {
 	return &App{
-		BuildRepo: buildRepo,
-		LogsRepo:  logsRepo,
-		RepoRepo:  repoRepo,
-		UserRepo:  userRepo,
+		BuildRepo:  buildRepo,
+		JobRepo:    jobRepo,
+		LogsRepo:   logsRepo,
+		LogsBroker: logsBroker,
+		RepoRepo:   repoRepo,
+		UserRepo:   userRepo,
+		RunnerRepo: runnerRepo,
+		QueueRepo:  queueRepo,
+
+		DashboardRepo:           dashboardRepo,
+		BuildEventRepo:          buildEventRepo,
+		AnalyticsRepo:           analyticsRepo,
+		InstallationRepo:        installationRepo,
+		RepoSyncer:              repoSyncer,
+		LogArchiveRepo:          logArchiveRepo,
+		Blobs:                   blobs,
+		ArtifactRepo:            artifactRepo,
+		SecretRepo:              secretRepo,
+		VariableRepo:            variableRepo,
+		Keyring:                 keyring,
+		logRetentionDaysDefault: logRetentionDaysDefault,
+
 		jwtSecret: jwtSecret,
 	}
 }
@@ -49,8 +102,43 @@ func (a *App) Mux() http.Handler {
 	mux.HandleFunc("GET /dashboard/", a.getDashboard)
 	mux.HandleFunc("GET /my-repositories/", a.getMyRepositories)
 	mux.HandleFunc("GET /repositories/{id}/", a.getRepository)
+	mux.HandleFunc("GET /repositories/{id}/builds/{number}/", a.getRepositoryBuild)
+	mux.HandleFunc("GET /repositories/{id}/settings/", a.getRepositorySettings)
+	mux.HandleFunc("PUT /repositories/{id}/settings/", a.updateRepositorySettings)
+	mux.HandleFunc("GET /repositories/{id}/badge/", a.getBadgeSettings)
+	mux.HandleFunc("POST /repositories/{id}/badge/token/", a.createBadgeToken)
+	mux.HandleFunc("DELETE /repositories/{id}/badge/token/", a.deleteBadgeToken)
 	mux.HandleFunc("GET /pipeline/{id}/", a.getPipeline)
 	mux.HandleFunc("GET /pipeline/{id}/logs/", a.getBuildLogs)
+	mux.HandleFunc("GET /pipeline/{id}/logs/stream/", a.streamBuildLogs)
+	mux.HandleFunc("GET /pipeline/{id}/logs.gz/", a.downloadBuildLogs)
+	mux.HandleFunc("GET /pipeline/{id}/graph/", a.getPipelineGraph)
+	mux.HandleFunc("GET /pipeline/{id}/timeline/", a.getPipelineTimeline)
+	mux.HandleFunc("GET /pipeline/{id}/jobs/", a.getPipelineJobs)
+	mux.HandleFunc("GET /pipeline/{id}/jobs/{job_id}/logs/", a.getJobLogs)
+	mux.HandleFunc("GET /pipeline/{id}/artifacts/", a.getArtifacts)
+	mux.HandleFunc("GET /pipeline/{id}/artifacts/{artifact_id}/", a.downloadArtifact)
+	mux.HandleFunc("GET /installations/{id}/settings/", a.getInstallationSettings)
+	mux.HandleFunc("PUT /installations/{id}/settings/", a.updateInstallationSettings)
+	mux.HandleFunc("POST /installations/{id}/sync/", a.syncInstallation)
+	mux.HandleFunc("GET /repositories/{id}/secrets/", a.getSecrets(a.repoScope))
+	mux.HandleFunc("PUT /repositories/{id}/secrets/{name}/", a.putSecret(a.repoScope))
+	mux.HandleFunc("DELETE /repositories/{id}/secrets/{name}/", a.deleteSecret(a.repoScope))
+	mux.HandleFunc("GET /repositories/{id}/variables/", a.getVariables(a.repoScope))
+	mux.HandleFunc("PUT /repositories/{id}/variables/{name}/", a.putVariable(a.repoScope))
+	mux.HandleFunc("DELETE /repositories/{id}/variables/{name}/", a.deleteVariable(a.repoScope))
+	mux.HandleFunc("GET /installations/{id}/secrets/", a.getSecrets(a.installationScope))
+	mux.HandleFunc("PUT /installations/{id}/secrets/{name}/", a.putSecret(a.installationScope))
+	mux.HandleFunc("DELETE /installations/{id}/secrets/{name}/", a.deleteSecret(a.installationScope))
+	mux.HandleFunc("GET /installations/{id}/variables/", a.getVariables(a.installationScope))
+	mux.HandleFunc("PUT /installations/{id}/variables/{name}/", a.putVariable(a.installationScope))
+	mux.HandleFunc("DELETE /installations/{id}/variables/{name}/", a.deleteVariable(a.installationScope))
+	mux.HandleFunc("GET /runners/", a.getRunners)
+	mux.HandleFunc("GET /queue/", a.getQueue)
+	mux.HandleFunc("GET /analytics/success-rates/", a.getSuccessRates)
+	mux.HandleFunc("GET /analytics/durations/", a.getDurations)
+	mux.HandleFunc("GET /analytics/job-failures/", a.getJobFailures)
+	mux.HandleFunc("GET /analytics/recovery/", a.getRecovery)
 
 	authMux := middleware.WithJWT(mux, a.jwtSecret)
 	return authMux
@@ -93,21 +181,6 @@ func (a *App) getUser(w http.ResponseWriter, r *http.Request) {
 func (a *App) getMyRepositories(w http.ResponseWriter, r *http.Request) {
 	logger, _ := l.FromContext(r.Context())
 
-	currentPage, err := strconv.Atoi(r.URL.Query().Get("currentPage"))
-	if err != nil {
-		currentPage = 0
-	}
-	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
-	if err != nil {
-		pageSize = 10
-	}
-
-	params := getMyRepositoriesParams{
-		CurrentPage: currentPage,
-		PageSize:    pageSize,
-		Search:      r.URL.Query().Get("search"),
-	}
-
 	userID, ok := userid.FromContext(r.Context())
 	if !ok {
 		msg := "invalid user ID"
@@ -116,42 +189,52 @@ func (a *App) getMyRepositories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	allRepos, err := a.RepoRepo.GetAllForUser(r.Context(), params.Search, userID)
+	opts, err := parseListOptions(r)
 	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	search := r.URL.Query().Get("search")
+
+	repos, nextCursor, err := a.RepoRepo.List(r.Context(), userID, search, opts)
+	if err != nil {
+		if errors.Is(err, data.ErrInvalidListOptions) {
+			logger.Debug(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		msg := "failed to get my repositories"
 		logger.Debug(msg, slog.Any("error", err))
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
 
-	totalPages := math.Ceil(float64(len(allRepos)) / float64(params.PageSize))
+	totalRepos, err := a.RepoRepo.Count(r.Context(), userID, search)
+	if err != nil {
+		msg := "failed to count my repositories"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
 
-	// Perform paging
-	// TODO: Paging should be done at database-level
-	startIndex := (params.CurrentPage) * params.PageSize
-	endIndex := startIndex + params.PageSize
-	repos := make([]data.Repo, 0)
-	for i := startIndex; i < len(allRepos) && i < endIndex; i++ {
-		repos = append(repos, allRepos[i])
+	repoIDs := make([]int64, 0, len(repos))
+	for _, repo := range repos {
+		repoIDs = append(repoIDs, repo.ID)
+	}
+	latestBuilds, err := a.BuildRepo.GetLatestByRepoIDs(r.Context(), userID, repoIDs)
+	if err != nil {
+		msg := "failed to get latest builds for repos"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
 	}
 
 	repositories := make([]repository, 0)
 	for _, repo := range repos {
-		wasFound := true
-		latestBuild, err := a.BuildRepo.GetLatestByRepoID(r.Context(), userID, repo.ID)
-		if err != nil {
-			if errors.Is(err, data.ErrNotFound) {
-				wasFound = false
-			} else {
-				msg := "failed to get latest build for repo"
-				logger.Error(msg, slog.Any("error", err))
-				http.Error(w, msg, http.StatusInternalServerError)
-				return
-			}
-		}
-
 		var dateOfLastUpdate *time.Time = nil
-		if wasFound {
+		if latestBuild, ok := latestBuilds[repo.ID]; ok {
 			dateOfLastUpdate = &latestBuild.UpdatedAt
 		}
 
@@ -164,9 +247,8 @@ func (a *App) getMyRepositories(w http.ResponseWriter, r *http.Request) {
 
 	response := getMyRepositoriesDTO{
 		Repositories:      repositories,
-		TotalRepositories: len(allRepos),
-		TotalPages:        int(totalPages),
-		CurrentPage:       params.CurrentPage,
+		TotalRepositories: totalRepos,
+		NextCursor:        nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -206,9 +288,29 @@ func (a *App) getRepository(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	builds, err := a.BuildRepo.GetAllByRepoID(r.Context(), userID, repoID)
+	opts, err := parseListOptions(r)
+	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseBuildFilter(r)
+	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.RepoID = repoID
+
+	builds, nextCursor, err := a.BuildRepo.List(r.Context(), userID, filter, opts)
 	if err != nil {
-		msg := fmt.Sprintf("failed to get all builds for repository id=%d for user id=%d", repoID, userID)
+		if errors.Is(err, data.ErrInvalidListOptions) {
+			logger.Debug(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get builds for repository id=%d for user id=%d", repoID, userID)
 		logger.Debug(msg, slog.Any("error", err))
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
@@ -216,18 +318,7 @@ func (a *App) getRepository(w http.ResponseWriter, r *http.Request) {
 
 	pipelines := make([]pipeline, 0)
 	for _, build := range builds {
-		pipeline := pipeline{
-			ID:             strconv.FormatInt(build.ID, 10),
-			RepositoryName: build.RepoName,
-			RepositoryID:   strconv.FormatInt(build.RepoID, 10),
-			CommitName:     build.CommitMsg,
-			Status:         build.Status,
-			Conclusion:     build.Conclusion,
-			StartDate:      build.CreatedAt,
-			EndDate:        &build.UpdatedAt,
-		}
-
-		pipelines = append(pipelines, pipeline)
+		pipelines = append(pipelines, newPipeline(build))
 	}
 
 	var dateOfLastUpdate *time.Time = nil
@@ -242,6 +333,7 @@ func (a *App) getRepository(w http.ResponseWriter, r *http.Request) {
 		URL:              "URL not available",
 		DateOfLastUpdate: dateOfLastUpdate,
 		Pipelines:        pipelines,
+		NextCursor:       nextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -265,91 +357,41 @@ func (a *App) getDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	builds, err := a.BuildRepo.GetAllByUserID(r.Context(), userID)
+	dashboard, err := a.DashboardRepo.Get(r.Context(), userID)
 	if err != nil {
-		msg := "failed to get all builds"
-		logger.Debug(msg, slog.Any("error", err))
+		msg := "failed to get dashboard"
+		logger.Error(msg, slog.Any("error", err))
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
-	successfulBuilds := 0
-	for _, build := range builds {
-		if build.Conclusion != nil && *build.Conclusion == "success" {
-			successfulBuilds++
-		}
-	}
 
 	stats := statsDTO{
-		TotalPipelines:        len(builds),
-		SuccessfulPipelines:   successfulBuilds,
-		UnsuccessfulPipelines: len(builds) - successfulBuilds,
-	}
-
-	repos, err := a.RepoRepo.GetAllForUser(r.Context(), "", userID)
-	if err != nil {
-		msg := "failed to get my repositories"
-		logger.Debug(msg, slog.Any("error", err))
-		http.Error(w, msg, http.StatusInternalServerError)
-		return
+		TotalPipelines:        dashboard.Stats.TotalBuilds,
+		SuccessfulPipelines:   dashboard.Stats.SuccessfulBuilds,
+		UnsuccessfulPipelines: dashboard.Stats.TotalBuilds - dashboard.Stats.SuccessfulBuilds,
 	}
 
 	pipelines := make([]pipelineDashboardData, 0)
-	// Get the latest build for every repo
-	for _, repo := range repos {
-		build, err := a.BuildRepo.GetLatestByRepoID(r.Context(), userID, repo.ID)
-		if err != nil {
-			if errors.Is(err, data.ErrNotFound) {
-				continue
-			}
-			msg := "failed to get latest build for repo"
-			logger.Error(msg, slog.Any("error", err))
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
-		}
-
-		pipeline := pipelineDashboardData{
-			ID:             strconv.FormatInt(build.ID, 10),
-			RepositoryName: repo.Name,
-			CommitName:     build.CommitMsg,
-			Status:         build.Status,
-			Conclusion:     build.Conclusion,
-		}
-		pipelines = append(pipelines, pipeline)
-	}
-
 	repositories := make([]repository, 0)
-	for _, repo := range repos {
-		wasFound := true
-		latestBuild, err := a.BuildRepo.GetLatestByRepoID(r.Context(), userID, repo.ID)
-		if err != nil {
-			if errors.Is(err, data.ErrNotFound) {
-				wasFound = false
-			} else {
-				msg := "failed to get latest build for repo"
-				logger.Error(msg, slog.Any("error", err))
-				http.Error(w, msg, http.StatusInternalServerError)
-				return
-			}
-		}
-
-		var dateOfLastUpdate *time.Time
-		if wasFound {
-			dateOfLastUpdate = &latestBuild.UpdatedAt
-		}
-
+	for _, repo := range dashboard.Repos {
 		repositories = append(repositories, repository{
-			ID:               strconv.FormatInt(repo.ID, 10),
-			Name:             repo.Name,
-			DateOfLastUpdate: dateOfLastUpdate,
+			ID:               strconv.FormatInt(repo.RepoID, 10),
+			Name:             repo.RepoName,
+			DateOfLastUpdate: repo.BuildUpdatedAt,
 		})
-	}
 
-	sort.Slice(repositories, func(i, j int) bool {
-		if repositories[i].DateOfLastUpdate == nil || repositories[j].DateOfLastUpdate == nil {
-			return true
+		if repo.BuildID == nil {
+			continue
 		}
-		return repositories[i].DateOfLastUpdate.After(*repositories[j].DateOfLastUpdate)
-	})
+		pipelines = append(pipelines, pipelineDashboardData{
+			ID:             strconv.FormatInt(*repo.BuildID, 10),
+			Number:         *repo.BuildNumber,
+			RepositoryName: repo.RepoName,
+			CommitName:     *repo.BuildCommitMsg,
+			Status:         *repo.BuildStatus,
+			Conclusion:     repo.BuildConclusion,
+		})
+	}
 
 	response := getDashboardDataDTO{
 		Stats:        stats,
@@ -378,8 +420,21 @@ func (a *App) getRepositories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repos, err := a.RepoRepo.GetAllForUser(r.Context(), "", userID)
+	opts, err := parseListOptions(r)
+	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repos, nextCursor, err := a.RepoRepo.List(r.Context(), userID, r.URL.Query().Get("search"), opts)
 	if err != nil {
+		if errors.Is(err, data.ErrInvalidListOptions) {
+			logger.Debug(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		msg := "failed to get repositories"
 		logger.Debug(msg, slog.Any("error", err))
 		http.Error(w, msg, http.StatusInternalServerError)
@@ -387,7 +442,7 @@ func (a *App) getRepositories(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(repos)
+	err = json.NewEncoder(w).Encode(getRepositoriesDTO{Repositories: repos, NextCursor: nextCursor})
 	if err != nil {
 		msg := "failed to encode repositories into json"
 		logger.Debug(msg, slog.Any("error", err))
@@ -407,37 +462,45 @@ func (a *App) getBuilds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var result []data.FatBuild
+	opts, err := parseListOptions(r)
+	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseBuildFilter(r)
+	if err != nil {
+		logger.Debug(err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if r.URL.Query().Get("repo_id") == "" {
-		var err error
-		result, err = a.BuildRepo.GetAllByUserID(r.Context(), userID)
-		if err != nil {
-			msg := "failed to get all builds"
-			logger.Debug(msg, slog.Any("error", err))
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
-		}
-	} else {
-		repoID, err := strconv.ParseInt(r.URL.Query().Get("repo_id"), 10, 64)
+	if r.URL.Query().Get("repo_id") != "" {
+		filter.RepoID, err = strconv.ParseInt(r.URL.Query().Get("repo_id"), 10, 64)
 		if err != nil {
 			msg := "invalid repo ID"
 			logger.Debug(msg, slog.Any("error", err))
 			http.Error(w, msg, http.StatusBadRequest)
 			return
 		}
+	}
 
-		result, err = a.BuildRepo.GetAllByRepoID(r.Context(), userID, repoID)
-		if err != nil {
-			msg := "failed to get builds by repo id"
-			logger.Debug(msg, slog.Any("error", err))
-			http.Error(w, msg, http.StatusInternalServerError)
+	builds, nextCursor, err := a.BuildRepo.List(r.Context(), userID, filter, opts)
+	if err != nil {
+		if errors.Is(err, data.ErrInvalidListOptions) {
+			logger.Debug(err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+
+		msg := "failed to get builds"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err := json.NewEncoder(w).Encode(result)
+	err = json.NewEncoder(w).Encode(getBuildsDTO{Builds: builds, NextCursor: nextCursor})
 	if err != nil {
 		msg := "failed to encode builds into json"
 		logger.Error(msg, slog.Any("error", err))
@@ -486,7 +549,7 @@ func (a *App) getBuild(w http.ResponseWriter, r *http.Request) {
 func (a *App) getBuildLogs(w http.ResponseWriter, r *http.Request) {
 	logger, _ := l.FromContext(r.Context())
 
-	_, ok := userid.FromContext(r.Context())
+	userID, ok := userid.FromContext(r.Context())
 	if !ok {
 		msg := "invalid user ID"
 		logger.Debug(msg)
@@ -502,21 +565,21 @@ func (a *App) getBuildLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Authorization (check if buildID belongs to userID)
-
-	logs, err := a.LogsRepo.Get(r.Context(), buildID)
+	build, err := a.BuildRepo.Get(r.Context(), userID, buildID)
 	if err != nil {
-		msg := fmt.Sprintf("failed to get logs for build with id %d", buildID)
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d from repo", buildID)
 		logger.Debug(msg, slog.Any("error", err))
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
-	for _, logLine := range logs {
-		logLine += "\n"
-		_, _ = w.Write([]byte(logLine))
-	}
+	a.writeLogs(w, r, build.Build, nil)
 }
 
 func (a *App) getPipeline(w http.ResponseWriter, r *http.Request) {
@@ -552,19 +615,61 @@ func (a *App) getPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ppln := pipeline{
-		ID:             strconv.FormatInt(fatBuild.ID, 10),
-		RepositoryName: fatBuild.RepoName,
-		RepositoryID:   strconv.FormatInt(fatBuild.RepoID, 10),
-		CommitName:     fatBuild.CommitMsg,
-		Status:         fatBuild.Status,
-		Conclusion:     fatBuild.Conclusion,
-		StartDate:      fatBuild.CreatedAt,
-		EndDate:        &fatBuild.UpdatedAt,
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newPipeline(*fatBuild))
+	if err != nil {
+		msg := "failed to encode build into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getRepositoryBuild returns the build of the repository by its number, like
+// getPipeline does by its ID.
+func (a *App) getRepositoryBuild(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	repoID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid repository ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	number, err := strconv.ParseInt(r.PathValue("number"), 10, 64)
+	if err != nil || number < 1 {
+		msg := fmt.Sprintf("invalid build number: %s", r.PathValue("number"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	fatBuild, err := a.BuildRepo.GetByNumber(r.Context(), userID, repoID, number)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build #%d of repository with id %d not found", number, repoID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build #%d of repository with id %d from repo", number, repoID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(ppln)
+	err = json.NewEncoder(w).Encode(newPipeline(*fatBuild))
 	if err != nil {
 		msg := "failed to encode build into json"
 		logger.Error(msg, slog.Any("error", err))
@@ -572,3 +677,723 @@ func (a *App) getPipeline(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+func newPipeline(build data.FatBuild) pipeline {
+	return pipeline{
+		ID:             strconv.FormatInt(build.ID, 10),
+		Number:         build.Number,
+		RepositoryName: build.RepoName,
+		RepositoryID:   strconv.FormatInt(build.RepoID, 10),
+		CommitName:     build.CommitMsg,
+		Status:         build.Status,
+		Conclusion:     build.Conclusion,
+		StartDate:      build.CreatedAt,
+		EndDate:        endDate(build.Status, build.UpdatedAt),
+	}
+}
+
+func (a *App) getPipelineGraph(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d from repo", buildID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	jobs, err := a.JobRepo.GetAllByBuildID(r.Context(), buildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get jobs for build with id %d", buildID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	dependencies := make(map[string][]string, len(jobs))
+	for _, job := range jobs {
+		dependencies[job.Name] = job.DependsOn
+	}
+	graph, err := pl.NewGraph(dependencies)
+	if err != nil {
+		msg := fmt.Sprintf("failed to create job graph for build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := pipelineGraphDTO{
+		Nodes: make([]pipelineGraphNode, 0, len(jobs)),
+		Edges: make([]pipelineGraphEdge, 0),
+	}
+	for _, job := range jobs {
+		response.Nodes = append(response.Nodes, pipelineGraphNode{
+			ID:         strconv.FormatInt(job.ID, 10),
+			Name:       job.Name,
+			ParentName: job.ParentName,
+			Status:     job.Status,
+			Conclusion: job.Conclusion,
+			Stage:      graph.Stage(job.Name),
+		})
+		for _, dep := range graph.Dependencies(job.Name) {
+			response.Edges = append(response.Edges, pipelineGraphEdge{From: dep, To: job.Name})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode pipeline graph into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) getPipelineJobs(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d from repo", buildID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	jobs, err := a.JobRepo.GetAllByBuildID(r.Context(), buildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get jobs for build with id %d", buildID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	// Group jobs expanded from the same matrix under their parent job,
+	// preserving the order in which they were defined.
+	groups := make([]jobGroupDTO, 0)
+	groupIndex := make(map[string]int)
+	for _, job := range jobs {
+		i, ok := groupIndex[job.ParentName]
+		if !ok {
+			i = len(groups)
+			groupIndex[job.ParentName] = i
+			groups = append(groups, jobGroupDTO{Name: job.ParentName, Jobs: make([]jobDTO, 0)})
+		}
+
+		groups[i].Jobs = append(groups[i].Jobs, jobDTO{
+			ID:         strconv.FormatInt(job.ID, 10),
+			Name:       job.Name,
+			Matrix:     job.Matrix,
+			Status:     job.Status,
+			Conclusion: job.Conclusion,
+			StartDate:  job.CreatedAt,
+			EndDate:    endDate(job.Status, job.UpdatedAt),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(getPipelineJobsDTO{Groups: groups})
+	if err != nil {
+		msg := "failed to encode pipeline jobs into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (a *App) getJobLogs(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := "invalid build ID"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	jobID, err := strconv.ParseInt(r.PathValue("job_id"), 10, 64)
+	if err != nil {
+		msg := "invalid job ID"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	build, err := a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d from repo", buildID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	a.writeLogs(w, r, build.Build, &jobID)
+}
+
+// writeLogs writes the logs of build, or of the job with jobID if it's not
+// nil. The logs are written as JSON if the request accepts
+// "application/json", and as plain text otherwise.
+//
+// The "job", "step" and "stream" query parameters filter the lines. The logs
+// are paginated if the "limit" query parameter is set. If there are more
+// lines, the X-Next-Cursor header (and the nextCursor field of JSON) holds
+// the value of the "cursor" query parameter to get the next page with.
+//
+// If the logs are older than the retention period of the build's
+// installation, 410 Gone is returned.
+func (a *App) writeLogs(w http.ResponseWriter, r *http.Request, build data.Build, jobID *int64) {
+	logger, _ := l.FromContext(r.Context())
+
+	retentionDays, err := a.logRetentionDays(r.Context(), build.InstallationID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get log retention of build with id %d", build.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if logsExpired(build, retentionDays) {
+		msg := fmt.Sprintf("logs expired: logs are kept for %d days after the build completes", retentionDays)
+		logger.Debug(msg, slog.Int64("build_id", build.ID))
+		http.Error(w, msg, http.StatusGone)
+		return
+	}
+
+	query := data.LogsQueryForBuild(build)
+	query.JobID = jobID
+
+	if rawJobID := r.URL.Query().Get("job"); rawJobID != "" && jobID == nil {
+		id, err := strconv.ParseInt(rawJobID, 10, 64)
+		if err != nil {
+			msg := fmt.Sprintf("invalid job ID: %s", rawJobID)
+			logger.Debug(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		query.JobID = &id
+	}
+
+	if rawStep := r.URL.Query().Get("step"); rawStep != "" {
+		step, err := strconv.Atoi(rawStep)
+		if err != nil || step < 0 {
+			msg := fmt.Sprintf("invalid step: %s", rawStep)
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		query.Step = &step
+	}
+
+	query.Stream = r.URL.Query().Get("stream")
+	if query.Stream != "" && query.Stream != data.LogStreamStdout && query.Stream != data.LogStreamStderr {
+		msg := fmt.Sprintf("invalid stream: %s", query.Stream)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if rawCursor := r.URL.Query().Get("cursor"); rawCursor != "" {
+		cursor, err := data.ParseLogCursor(rawCursor)
+		if err != nil {
+			msg := fmt.Sprintf("invalid cursor: %s", rawCursor)
+			logger.Debug(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		query.After = &cursor
+	}
+
+	limit := 0
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 {
+			msg := fmt.Sprintf("invalid limit: %s", rawLimit)
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		// One more line tells whether there is a next page.
+		query.Limit = limit + 1
+	}
+
+	lines, err := a.LogsRepo.Get(r.Context(), query)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get logs for build with id %d", build.ID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	nextCursor := ""
+	if limit > 0 && len(lines) > limit {
+		lines = lines[:limit]
+		nextCursor = data.CursorOf(lines[limit-1]).String()
+		w.Header().Set("X-Next-Cursor", nextCursor)
+	}
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "text/plain")
+		for _, line := range lines {
+			_, _ = fmt.Fprintf(w, "%s: %s\n", line.Time, line.Text)
+		}
+		return
+	}
+
+	response := getLogsDTO{
+		Lines:      make([]logLineDTO, 0, len(lines)),
+		NextCursor: nextCursor,
+	}
+	for _, line := range lines {
+		response.Lines = append(response.Lines, mapLogLine(line))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode logs into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+func mapLogLine(line data.LogLine) logLineDTO {
+	return logLineDTO{
+		BuildID: strconv.FormatInt(line.BuildID, 10),
+		JobID:   strconv.FormatInt(line.JobID, 10),
+		Step:    line.Step,
+		Stream:  line.Stream,
+		Seq:     line.Seq,
+		Time:    line.Time,
+		Text:    line.Text,
+	}
+}
+
+// logRetentionDays returns how many days logs of builds of the installation
+// with installationID are kept after the build completes.
+func (a *App) logRetentionDays(ctx context.Context, installationID int64) (int, error) {
+	installation, err := a.InstallationRepo.Get(ctx, installationID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			return a.logRetentionDaysDefault, nil
+		}
+		return 0, err
+	}
+
+	if installation.LogRetentionDays == nil {
+		return a.logRetentionDaysDefault, nil
+	}
+	return *installation.LogRetentionDays, nil
+}
+
+func logsExpired(build data.Build, retentionDays int) bool {
+	if build.Status != "completed" {
+		return false
+	}
+	return time.Since(build.UpdatedAt) > time.Duration(retentionDays)*24*time.Hour
+}
+
+func (a *App) getRepositorySettings(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	repoID, ok := a.authorizeRepo(w, r)
+	if !ok {
+		return
+	}
+
+	settings, err := a.RepoRepo.GetSettings(r.Context(), repoID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get settings of repository id=%d", repoID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(repositorySettingsDTO{
+		BuildTimeoutSeconds: settings.BuildTimeout,
+		MaxAttempts:         settings.MaxAttempts,
+		MaxConcurrentBuilds: settings.MaxConcurrentBuilds,
+		SecretsForForks:     settings.SecretsForForks,
+	})
+	if err != nil {
+		msg := "failed to encode repository settings into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// updateRepositorySettings replaces the settings of a repository. Settings
+// that are null use the server-wide default.
+func (a *App) updateRepositorySettings(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	repoID, ok := a.authorizeRepo(w, r)
+	if !ok {
+		return
+	}
+
+	var params repositorySettingsDTO
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if params.BuildTimeoutSeconds != nil && *params.BuildTimeoutSeconds <= 0 {
+		msg := "buildTimeoutSeconds must be positive or null"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if params.MaxAttempts != nil && *params.MaxAttempts <= 0 {
+		msg := "maxAttempts must be positive or null"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if params.MaxConcurrentBuilds != nil && *params.MaxConcurrentBuilds <= 0 {
+		msg := "maxConcurrentBuilds must be positive or null"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	err = a.RepoRepo.UpdateSettings(r.Context(), repoID, data.RepoSettings{
+		BuildTimeout:        params.BuildTimeoutSeconds,
+		MaxAttempts:         params.MaxAttempts,
+		MaxConcurrentBuilds: params.MaxConcurrentBuilds,
+		SecretsForForks:     params.SecretsForForks,
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to update settings of repository id=%d", repoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeRepo returns the ID of the repository in the path, if it belongs to
+// the user. Otherwise, it writes an error response and returns false.
+func (a *App) authorizeRepo(w http.ResponseWriter, r *http.Request) (repoID int64, ok bool) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return 0, false
+	}
+
+	repoID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid repository ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return 0, false
+	}
+
+	_, err = a.RepoRepo.GetForUser(r.Context(), userID, repoID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("repository with id %d not found", repoID)
+			http.Error(w, msg, http.StatusNotFound)
+			return 0, false
+		}
+
+		msg := fmt.Sprintf("failed to get repository id=%d for user id=%d", repoID, userID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return 0, false
+	}
+
+	return repoID, true
+}
+
+// authorizeInstallation returns the installation whose ID is in the path, or
+// writes an error response if it doesn't belong to the user.
+func (a *App) authorizeInstallation(w http.ResponseWriter, r *http.Request) (installation *data.Installation, ok bool) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return nil, false
+	}
+
+	installationID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid installation ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return nil, false
+	}
+
+	installation, err = a.InstallationRepo.GetForUser(r.Context(), userID, installationID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("installation with id %d not found", installationID)
+			http.Error(w, msg, http.StatusNotFound)
+			return nil, false
+		}
+
+		msg := fmt.Sprintf("failed to get installation id=%d for user id=%d", installationID, userID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return installation, true
+}
+
+func (a *App) getInstallationSettings(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	installation, ok := a.authorizeInstallation(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(installationSettingsDTO{
+		LogRetentionDays: installation.LogRetentionDays,
+	})
+	if err != nil {
+		msg := "failed to encode installation settings into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// updateInstallationSettings replaces the settings of an installation.
+// Settings that are null use the server-wide default.
+func (a *App) updateInstallationSettings(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	installation, ok := a.authorizeInstallation(w, r)
+	if !ok {
+		return
+	}
+
+	var params installationSettingsDTO
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if params.LogRetentionDays != nil && *params.LogRetentionDays <= 0 {
+		msg := "logRetentionDays must be positive or null"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	err = a.InstallationRepo.UpdateLogRetention(r.Context(), installation.ID, params.LogRetentionDays)
+	if err != nil {
+		msg := fmt.Sprintf("failed to update settings of installation id=%d", installation.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runnerOfflineAfter is how long a runner may go without a heartbeat before
+// it's considered offline.
+const runnerOfflineAfter = 2 * time.Minute
+
+func (a *App) getRunners(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	runners, err := a.RunnerRepo.GetAll(r.Context())
+	if err != nil {
+		msg := "failed to get runners"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := getRunnersDTO{Runners: make([]runnerDTO, 0, len(runners))}
+	for _, runner := range runners {
+		state := "online"
+		if runner.LastHeartbeatAt == nil || time.Since(*runner.LastHeartbeatAt) > runnerOfflineAfter {
+			state = "offline"
+		} else if runner.RunningJobs > 0 {
+			state = "busy"
+		}
+
+		response.Runners = append(response.Runners, runnerDTO{
+			ID:              strconv.FormatInt(runner.ID, 10),
+			Name:            runner.Name,
+			Labels:          runner.Labels,
+			MaxConcurrency:  runner.MaxConcurrency,
+			Version:         runner.Version,
+			State:           state,
+			RunningJobs:     runner.RunningJobs,
+			LastHeartbeatAt: runner.LastHeartbeatAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode runners into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getQueue returns the queued builds of the user's repositories, with their
+// position in the queue shared by all users.
+func (a *App) getQueue(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	builds, err := a.QueueRepo.GetAll(r.Context())
+	if err != nil {
+		msg := "failed to get queued builds"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	capacity, err := a.QueueRepo.GetCapacity(r.Context(), runnerOfflineAfter)
+	if err != nil {
+		msg := "failed to get runner capacity"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := getQueueDTO{
+		Total:    len(builds),
+		Capacity: capacity,
+		Builds:   make([]queuedBuildDTO, 0),
+	}
+	for _, build := range builds {
+		response.Running = build.Running
+		if build.UserID != userID {
+			continue
+		}
+
+		var averageDuration time.Duration
+		if build.AverageDuration != nil {
+			averageDuration = time.Duration(*build.AverageDuration * float64(time.Second))
+		}
+
+		queued := queuedBuildDTO{
+			ID:             strconv.FormatInt(build.ID, 10),
+			Number:         build.Number,
+			RepositoryName: build.RepoName,
+			RepositoryID:   strconv.FormatInt(build.RepoID, 10),
+			CommitName:     build.CommitMsg,
+			Event:          build.Event,
+			Priority:       build.Priority,
+			Position:       build.Position,
+			CreatedAt:      build.CreatedAt,
+		}
+		if eta := queue.ETA(build.Running+build.Position-1, capacity, averageDuration); eta != nil {
+			etaSeconds, durationSeconds := int(eta.Seconds()), int(averageDuration.Seconds())
+			queued.ETASeconds = &etaSeconds
+			queued.EstimatedDurationSeconds = &durationSeconds
+		}
+		response.Builds = append(response.Builds, queued)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode queue into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// endDate returns when a build or job with status completed, which is when it
+// was last updated, or nil if it hasn't completed yet.
+func endDate(status string, updatedAt time.Time) *time.Time {
+	if status != "completed" {
+		return nil
+	}
+	return &updatedAt
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/common/userid"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// getArtifacts returns the artifacts of a build that haven't expired.
+func (a *App) getArtifacts(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	artifacts, err := a.ArtifactRepo.GetAll(r.Context(), buildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get artifacts of build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := getArtifactsDTO{Artifacts: make([]artifactDTO, 0, len(artifacts))}
+	for _, artifact := range artifacts {
+		response.Artifacts = append(response.Artifacts, artifactDTO{
+			ID:        strconv.FormatInt(artifact.ID, 10),
+			JobID:     strconv.FormatInt(artifact.JobID, 10),
+			Name:      artifact.Name,
+			Size:      artifact.Size,
+			SHA256:    artifact.SHA256,
+			CreatedAt: artifact.CreatedAt,
+			ExpiresAt: artifact.ExpiresAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode artifacts into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// downloadArtifact serves the content of an artifact. Its checksum is used as
+// the ETag, and Range requests can resume interrupted downloads.
+func (a *App) downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	if a.Blobs == nil {
+		msg := "artifacts are not enabled on this server"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	artifactID, err := strconv.ParseInt(r.PathValue("artifact_id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid artifact ID: %s", r.PathValue("artifact_id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	artifact, err := a.ArtifactRepo.Get(r.Context(), buildID, artifactID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("artifact with id %d not found", artifactID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get artifact with id %d", artifactID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	object, err := a.Blobs.Open(r.Context(), artifact.BlobKey)
+	if err != nil {
+		msg := fmt.Sprintf("failed to open artifact with id %d", artifactID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+	w.Header().Set("ETag", `"`+artifact.SHA256+`"`)
+
+	// The content type is derived from the extension of the name.
+	http.ServeContent(w, r, artifact.Name, artifact.CreatedAt, object)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+)
+
+// getBadgeSettings returns what's needed to embed the badge of a repository.
+func (a *App) getBadgeSettings(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	repoID, ok := a.authorizeRepo(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := a.RepoRepo.GetBadgeToken(r.Context(), repoID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get badge token of repository id=%d", repoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	a.writeBadgeSettings(w, r, repoID, token)
+}
+
+// createBadgeToken makes the badges of a private repository public to
+// everyone who has the new token. A previous token stops working.
+func (a *App) createBadgeToken(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	repoID, ok := a.authorizeRepo(w, r)
+	if !ok {
+		return
+	}
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		msg := "failed to generate badge token"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(b)
+
+	err = a.RepoRepo.SetBadgeToken(r.Context(), repoID, token)
+	if err != nil {
+		msg := fmt.Sprintf("failed to set badge token of repository id=%d", repoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	a.writeBadgeSettings(w, r, repoID, token)
+}
+
+// deleteBadgeToken makes the badges of a private repository private again.
+func (a *App) deleteBadgeToken(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	repoID, ok := a.authorizeRepo(w, r)
+	if !ok {
+		return
+	}
+
+	err := a.RepoRepo.SetBadgeToken(r.Context(), repoID, "")
+	if err != nil {
+		msg := fmt.Sprintf("failed to delete badge token of repository id=%d", repoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *App) writeBadgeSettings(w http.ResponseWriter, r *http.Request, repoID int64, token string) {
+	logger, _ := l.FromContext(r.Context())
+
+	repo, err := a.RepoRepo.Get(r.Context(), repoID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get repository id=%d", repoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	settings := badgeSettingsDTO{
+		Path:    "/badge/" + repo.FullName + ".svg",
+		Private: repo.Private,
+	}
+	if token != "" {
+		settings.Token = &token
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(settings)
+	if err != nil {
+		msg := "failed to encode badge settings into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// commitSHAPrefixPattern matches abbreviated commit SHAs.
+var commitSHAPrefixPattern = regexp.MustCompile(`^[0-9a-fA-F]{1,40}$`)
+
+// parseListOptions parses the query parameters shared by all list endpoints:
+// "limit", "cursor" and "sort".
+func parseListOptions(r *http.Request) (data.ListOptions, error) {
+	opts := data.ListOptions{
+		Sort:   r.URL.Query().Get("sort"),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+
+	if r.URL.Query().Has("limit") {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			return opts, fmt.Errorf("invalid limit: %s", r.URL.Query().Get("limit"))
+		}
+		opts.Limit = limit
+	}
+
+	return opts, nil
+}
+
+// parseBuildFilter parses the query parameters that filter lists of builds:
+// "status", "conclusion", "branch", "event", "actor", "createdAfter" and
+// "createdBefore" (RFC 3339 timestamps) and "commit" (a commit SHA prefix).
+func parseBuildFilter(r *http.Request) (data.BuildFilter, error) {
+	query := r.URL.Query()
+	filter := data.BuildFilter{
+		Status:          query.Get("status"),
+		Conclusion:      query.Get("conclusion"),
+		Branch:          query.Get("branch"),
+		Event:           query.Get("event"),
+		Actor:           query.Get("actor"),
+		CommitSHAPrefix: query.Get("commit"),
+	}
+
+	if filter.CommitSHAPrefix != "" && !commitSHAPrefixPattern.MatchString(filter.CommitSHAPrefix) {
+		return filter, fmt.Errorf("invalid commit: %s", filter.CommitSHAPrefix)
+	}
+
+	for name, t := range map[string]*time.Time{"createdAfter": &filter.CreatedAfter, "createdBefore": &filter.CreatedBefore} {
+		if !query.Has(name) {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, query.Get(name))
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %s", name, query.Get(name))
+		}
+		*t = parsed
+	}
+
+	return filter, nil
+}
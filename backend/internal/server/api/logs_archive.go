@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/common/userid"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/logarchive"
+)
+
+// downloadBuildLogs serves all logs of a build as a gzip-compressed file of
+// JSON lines. Logs that were archived are served from blob storage as they
+// are, so Range requests can resume interrupted downloads. Logs that weren't
+// archived yet are compressed on the fly.
+func (a *App) downloadBuildLogs(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	build, err := a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	retentionDays, err := a.logRetentionDays(r.Context(), build.InstallationID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get log retention of build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if logsExpired(build.Build, retentionDays) {
+		msg := fmt.Sprintf("logs expired: logs are kept for %d days after the build completes", retentionDays)
+		logger.Debug(msg, slog.Int64("build_id", buildID))
+		http.Error(w, msg, http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="build-%d.jsonl.gz"`, buildID))
+
+	content, modTime, err := a.openLogArchive(r, build.Build)
+	if err != nil {
+		w.Header().Del("Content-Type")
+		w.Header().Del("Content-Disposition")
+		msg := fmt.Sprintf("failed to get logs for build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	http.ServeContent(w, r, "", modTime, content)
+}
+
+// openLogArchive returns the archived logs of build, or the logs compressed
+// into the same format if they weren't archived yet.
+func (a *App) openLogArchive(r *http.Request, build data.Build) (io.ReadSeekCloser, time.Time, error) {
+	if a.LogArchiveRepo != nil && a.Blobs != nil {
+		archive, err := a.LogArchiveRepo.Get(r.Context(), build.ID)
+		if err == nil {
+			object, err := a.Blobs.Open(r.Context(), archive.BlobKey)
+			if err != nil {
+				return nil, time.Time{}, fmt.Errorf("open log archive: %w", err)
+			}
+			return object, archive.ArchivedAt, nil
+		}
+		if !errors.Is(err, data.ErrNotFound) {
+			return nil, time.Time{}, fmt.Errorf("get log archive: %w", err)
+		}
+	}
+
+	lines, err := a.LogsRepo.Get(r.Context(), data.LogsQueryForBuild(build))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("get logs: %w", err)
+	}
+
+	compressed, err := logarchive.Compress(lines)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	// The logs of a build that is running change, so they're never cached.
+	modTime := time.Time{}
+	if build.Status == "completed" {
+		modTime = build.UpdatedAt
+	}
+	return nopSeekCloser{bytes.NewReader(compressed)}, modTime, nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/common/userid"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// logsStreamPollInterval is how often a log stream checks whether the build
+// completed, and catches up with lines that weren't published, for example
+// because they were written to the store by a runner directly.
+const logsStreamPollInterval = 5 * time.Second
+
+// streamBuildLogs streams the logs of a build as Server-Sent Events. Every
+// line is a "log" event whose ID is the sequence number of the last line sent
+// of every job, as comma-separated "<job ID>:<seq>" pairs, so a client that
+// reconnects with the Last-Event-ID header continues after the last line it
+// received of each job. Lines of concurrent jobs aren't stored in the order of
+// their times, so a single time can't be used. Once the build completes, an
+// "end" event is sent and the stream is closed.
+func (a *App) streamBuildLogs(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	build, err := a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	retentionDays, err := a.logRetentionDays(r.Context(), build.InstallationID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get log retention of build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if logsExpired(build.Build, retentionDays) {
+		msg := fmt.Sprintf("logs expired: logs are kept for %d days after the build completes", retentionDays)
+		logger.Debug(msg, slog.Int64("build_id", buildID))
+		http.Error(w, msg, http.StatusGone)
+		return
+	}
+
+	seqs, err := parseLogsStreamID(r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		msg := fmt.Sprintf("invalid Last-Event-ID: %s", r.Header.Get("Last-Event-ID"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Subscribe before reading the stored lines, so that no line falls in
+	// between. Lines that arrive both ways are deduplicated by their job and
+	// sequence number.
+	published, err := a.LogsBroker.Subscribe(r.Context(), buildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to subscribe to logs of build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+
+	stream := logsStream{w: w, rc: http.NewResponseController(w), seqs: seqs, times: make(map[int64]time.Time)}
+
+	// Every viewer catches up on every tick, so only the lines that may
+	// follow those sent are read, rather than the whole log of the build.
+	catchUp := func() error {
+		jobs, err := a.JobRepo.GetAllByBuildID(r.Context(), buildID)
+		if err != nil {
+			return fmt.Errorf("get jobs: %w", err)
+		}
+
+		query := data.NarrowLogsQuery(data.LogsQueryForBuild(build.Build), jobs, stream.times)
+		query.AfterSeqs = stream.seqs
+		lines, err := a.LogsRepo.Get(r.Context(), query)
+		if err != nil {
+			return fmt.Errorf("get logs: %w", err)
+		}
+		return stream.send(lines)
+	}
+
+	err = catchUp()
+	if err != nil {
+		logger.Error("failed to stream logs", slog.Int64("build_id", buildID), slog.Any("error", err))
+		return
+	}
+
+	ticker := time.NewTicker(logsStreamPollInterval)
+	defer ticker.Stop()
+
+	for build.Status != "completed" {
+		select {
+		case <-r.Context().Done():
+			return
+		case lines, ok := <-published:
+			if !ok {
+				return
+			}
+			err = stream.send(lines)
+		case <-ticker.C:
+			build, err = a.BuildRepo.Get(r.Context(), userID, buildID)
+			if err != nil {
+				err = fmt.Errorf("get build: %w", err)
+				break
+			}
+			err = catchUp()
+		}
+		if err != nil {
+			logger.Error("failed to stream logs", slog.Int64("build_id", buildID), slog.Any("error", err))
+			return
+		}
+	}
+
+	// Lines written just before the build completed may not have been
+	// published yet.
+	err = catchUp()
+	if err != nil {
+		logger.Error("failed to stream logs", slog.Int64("build_id", buildID), slog.Any("error", err))
+		return
+	}
+
+	err = stream.end(build.Build)
+	if err != nil {
+		logger.Debug("failed to end logs stream", slog.Int64("build_id", buildID), slog.Any("error", err))
+	}
+}
+
+// logsStream writes log lines as Server-Sent Events.
+type logsStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+
+	// seqs maps job IDs to the sequence number of the last line sent of the
+	// job. Lines that aren't newer are dropped.
+	seqs map[int64]int64
+
+	// times maps job IDs to the time of the last line sent of the job.
+	times map[int64]time.Time
+}
+
+func (s *logsStream) send(lines []data.LogLine) error {
+	sent := false
+	for _, line := range lines {
+		if line.Seq <= s.seqs[line.JobID] {
+			continue
+		}
+
+		payload, err := json.Marshal(mapLogLine(line))
+		if err != nil {
+			return fmt.Errorf("marshal log line: %w", err)
+		}
+
+		s.seqs[line.JobID] = line.Seq
+		s.times[line.JobID] = line.Time
+		_, err = fmt.Fprintf(s.w, "id: %s\nevent: log\ndata: %s\n\n", formatLogsStreamID(s.seqs), payload)
+		if err != nil {
+			return fmt.Errorf("write event: %w", err)
+		}
+		sent = true
+	}
+
+	if !sent {
+		// Keeps the connection from being closed by proxies as idle.
+		_, err := fmt.Fprint(s.w, ": keep-alive\n\n")
+		if err != nil {
+			return fmt.Errorf("write comment: %w", err)
+		}
+	}
+
+	return s.rc.Flush()
+}
+
+func (s *logsStream) end(build data.Build) error {
+	payload, err := json.Marshal(logsStreamEndDTO{Status: build.Status, Conclusion: build.Conclusion})
+	if err != nil {
+		return fmt.Errorf("marshal end event: %w", err)
+	}
+
+	_, err = fmt.Fprintf(s.w, "event: end\ndata: %s\n\n", payload)
+	if err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+
+	return s.rc.Flush()
+}
+
+// formatLogsStreamID returns the event ID of a log stream that sent the lines
+// up to seqs.
+func formatLogsStreamID(seqs map[int64]int64) string {
+	pairs := make([]string, 0, len(seqs))
+	for _, jobID := range slices.Sorted(maps.Keys(seqs)) {
+		pairs = append(pairs, fmt.Sprintf("%d:%d", jobID, seqs[jobID]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// parseLogsStreamID parses an event ID returned by formatLogsStreamID. An
+// empty ID starts from the first line of every job.
+func parseLogsStreamID(id string) (map[int64]int64, error) {
+	seqs := make(map[int64]int64)
+	if id == "" {
+		return seqs, nil
+	}
+
+	for _, pair := range strings.Split(id, ",") {
+		jobID, seq, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("missing sequence number in %q", pair)
+		}
+		parsedJobID, err := strconv.ParseInt(jobID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse job ID: %w", err)
+		}
+		parsedSeq, err := strconv.ParseInt(seq, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse sequence number: %w", err)
+		}
+		seqs[parsedJobID] = parsedSeq
+	}
+
+	return seqs, nil
+}
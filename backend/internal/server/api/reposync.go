@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// syncInstallation reconciles the repositories of an installation with the
+// repositories it can access on GitHub right away, instead of waiting for the
+// periodic sync, and returns what changed.
+func (a *App) syncInstallation(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	installation, ok := a.authorizeInstallation(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := a.RepoSyncer.Sync(r.Context(), installation.ID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to sync repositories of installation id=%d", installation.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(syncReportDTO{
+		InstallationID: strconv.FormatInt(report.InstallationID, 10),
+		Added:          newSyncedRepositoryDTOs(report.Added),
+		Restored:       newSyncedRepositoryDTOs(report.Restored),
+		Updated:        newSyncedRepositoryDTOs(report.Updated),
+		Removed:        newSyncedRepositoryDTOs(report.Removed),
+		Unchanged:      report.Unchanged,
+	})
+	if err != nil {
+		msg := "failed to encode sync report into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+func newSyncedRepositoryDTOs(repos []data.Repo) []syncedRepositoryDTO {
+	dtos := make([]syncedRepositoryDTO, 0, len(repos))
+	for _, repo := range repos {
+		dtos = append(dtos, syncedRepositoryDTO{
+			ID:   strconv.FormatInt(repo.ID, 10),
+			Name: repo.Name,
+		})
+	}
+	return dtos
+}
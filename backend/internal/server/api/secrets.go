@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// maxSecretSize is the largest value of a secret or variable, in bytes.
+const maxSecretSize = 48 * 1024
+
+// namePattern matches valid names of secrets and variables, which are passed
+// to jobs as environment variables.
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,254}$`)
+
+// scopeFunc returns the scope in the path of the request, if it belongs to the
+// user. Otherwise, it writes an error response and returns false.
+type scopeFunc func(w http.ResponseWriter, r *http.Request) (scope data.Scope, ok bool)
+
+func (a *App) repoScope(w http.ResponseWriter, r *http.Request) (data.Scope, bool) {
+	repoID, ok := a.authorizeRepo(w, r)
+	if !ok {
+		return data.Scope{}, false
+	}
+	return data.RepoScope(repoID), true
+}
+
+func (a *App) installationScope(w http.ResponseWriter, r *http.Request) (data.Scope, bool) {
+	installation, ok := a.authorizeInstallation(w, r)
+	if !ok {
+		return data.Scope{}, false
+	}
+	return data.InstallationScope(installation.ID), true
+}
+
+// getSecrets returns the names of the secrets of a scope. Values of secrets
+// are never returned.
+func (a *App) getSecrets(scopeOf scopeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		scope, ok := scopeOf(w, r)
+		if !ok {
+			return
+		}
+
+		secrets, err := a.SecretRepo.GetAll(r.Context(), scope)
+		if err != nil {
+			msg := fmt.Sprintf("failed to get secrets of %s", scope)
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		response := getSecretsDTO{Secrets: make([]secretDTO, 0, len(secrets))}
+		for _, secret := range secrets {
+			response.Secrets = append(response.Secrets, secretDTO{
+				Name:      secret.Name,
+				CreatedAt: secret.CreatedAt,
+				UpdatedAt: secret.UpdatedAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			msg := "failed to encode secrets into json"
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// putSecret creates or replaces a secret. The value is encrypted before it's
+// stored.
+func (a *App) putSecret(scopeOf scopeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		if a.Keyring == nil {
+			msg := "secrets are not enabled on this server"
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusServiceUnavailable)
+			return
+		}
+
+		scope, ok := scopeOf(w, r)
+		if !ok {
+			return
+		}
+
+		name, params, ok := decodeValueParams(w, r)
+		if !ok {
+			return
+		}
+
+		secret := data.Secret{
+			InstallationID: scope.InstallationID,
+			RepoID:         scope.RepoID,
+			Name:           name,
+		}
+		sealed, err := a.Keyring.Seal([]byte(params.Value), secret.AAD())
+		if err != nil {
+			msg := "failed to encrypt secret"
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		secret.Ciphertext = sealed.Ciphertext
+		secret.EncryptedKey = sealed.EncryptedKey
+		secret.KeyID = sealed.KeyID
+
+		err = a.SecretRepo.Put(r.Context(), secret)
+		if err != nil {
+			msg := fmt.Sprintf("failed to store secret %s of %s", name, scope)
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *App) deleteSecret(scopeOf scopeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		scope, ok := scopeOf(w, r)
+		if !ok {
+			return
+		}
+
+		name := r.PathValue("name")
+		err := a.SecretRepo.Delete(r.Context(), scope, name)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				msg := fmt.Sprintf("secret %s not found", name)
+				http.Error(w, msg, http.StatusNotFound)
+				return
+			}
+
+			msg := fmt.Sprintf("failed to delete secret %s of %s", name, scope)
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getVariables returns the variables of a scope, including their values.
+func (a *App) getVariables(scopeOf scopeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		scope, ok := scopeOf(w, r)
+		if !ok {
+			return
+		}
+
+		variables, err := a.VariableRepo.GetAll(r.Context(), scope)
+		if err != nil {
+			msg := fmt.Sprintf("failed to get variables of %s", scope)
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		response := getVariablesDTO{Variables: make([]variableDTO, 0, len(variables))}
+		for _, variable := range variables {
+			response.Variables = append(response.Variables, variableDTO{
+				Name:      variable.Name,
+				Value:     variable.Value,
+				CreatedAt: variable.CreatedAt,
+				UpdatedAt: variable.UpdatedAt,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			msg := "failed to encode variables into json"
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func (a *App) putVariable(scopeOf scopeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		scope, ok := scopeOf(w, r)
+		if !ok {
+			return
+		}
+
+		name, params, ok := decodeValueParams(w, r)
+		if !ok {
+			return
+		}
+
+		err := a.VariableRepo.Put(r.Context(), scope, name, params.Value)
+		if err != nil {
+			msg := fmt.Sprintf("failed to store variable %s of %s", name, scope)
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *App) deleteVariable(scopeOf scopeFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		scope, ok := scopeOf(w, r)
+		if !ok {
+			return
+		}
+
+		name := r.PathValue("name")
+		err := a.VariableRepo.Delete(r.Context(), scope, name)
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				msg := fmt.Sprintf("variable %s not found", name)
+				http.Error(w, msg, http.StatusNotFound)
+				return
+			}
+
+			msg := fmt.Sprintf("failed to delete variable %s of %s", name, scope)
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeValueParams validates the name in the path and decodes the value in
+// the body of a request to create or replace a secret or variable.
+func decodeValueParams(w http.ResponseWriter, r *http.Request) (name string, params putValueParams, ok bool) {
+	logger, _ := l.FromContext(r.Context())
+
+	name = r.PathValue("name")
+	if !namePattern.MatchString(name) {
+		msg := fmt.Sprintf("invalid name %q: names must consist of letters, digits and underscores, and not start with a digit", name)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return "", params, false
+	}
+
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 2*maxSecretSize)).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return "", params, false
+	}
+	if len(params.Value) > maxSecretSize {
+		msg := fmt.Sprintf("value must be at most %d bytes", maxSecretSize)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return "", params, false
+	}
+
+	return name, params, true
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/common/userid"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// getPipelineTimeline returns the events of the build in the order they
+// happened, and how long the build and each of its jobs waited in the queue
+// and ran.
+func (a *App) getPipelineTimeline(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	userID, ok := userid.FromContext(r.Context())
+	if !ok {
+		msg := "invalid user ID"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	buildID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid build ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	_, err = a.BuildRepo.Get(r.Context(), userID, buildID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("build with id %d not found", buildID)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to get build with id %d from repo", buildID)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	events, err := a.BuildEventRepo.GetAll(r.Context(), buildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get events of build with id %d", buildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(newTimelineDTO(buildID, events))
+	if err != nil {
+		msg := "failed to encode timeline into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// newTimelineDTO derives the durations of the build and its jobs from its
+// events. A build or job that was retried is started when its last attempt was
+// claimed, so its queue time includes the earlier attempts.
+func newTimelineDTO(buildID int64, events []data.FatBuildEvent) timelineDTO {
+	timeline := timelineDTO{
+		BuildID: strconv.FormatInt(buildID, 10),
+		Events:  make([]timelineEventDTO, 0, len(events)),
+		Jobs:    make([]timelineJobDTO, 0),
+	}
+
+	jobs := make(map[int64]*timelineJobDTO)
+	jobOrder := make([]int64, 0)
+	for _, event := range events {
+		createdAt := event.CreatedAt
+		timeline.Events = append(timeline.Events, newTimelineEventDTO(event))
+
+		switch event.Type {
+		case data.BuildQueued:
+			timeline.QueuedAt = first(timeline.QueuedAt, &createdAt)
+		case data.BuildStarted:
+			timeline.StartedAt = first(timeline.StartedAt, &createdAt)
+		case data.BuildCompleted:
+			timeline.CompletedAt = &createdAt
+		}
+
+		if event.JobID == nil {
+			continue
+		}
+		job, ok := jobs[*event.JobID]
+		if !ok {
+			job = &timelineJobDTO{ID: strconv.FormatInt(*event.JobID, 10)}
+			if event.JobName != nil {
+				job.Name = *event.JobName
+			}
+			jobs[*event.JobID] = job
+			jobOrder = append(jobOrder, *event.JobID)
+		}
+
+		switch event.Type {
+		case data.JobQueued:
+			job.QueuedAt = first(job.QueuedAt, &createdAt)
+		case data.JobClaimed, data.JobStarted:
+			job.StartedAt = &createdAt
+			job.CompletedAt = nil
+		case data.JobCompleted:
+			job.CompletedAt = &createdAt
+		}
+	}
+
+	timeline.QueueSeconds = seconds(timeline.QueuedAt, timeline.StartedAt)
+	timeline.RunSeconds = seconds(timeline.StartedAt, timeline.CompletedAt)
+	timeline.TotalSeconds = seconds(timeline.QueuedAt, timeline.CompletedAt)
+
+	for _, id := range jobOrder {
+		job := jobs[id]
+		job.QueueSeconds = seconds(job.QueuedAt, job.StartedAt)
+		job.RunSeconds = seconds(job.StartedAt, job.CompletedAt)
+		timeline.Jobs = append(timeline.Jobs, *job)
+	}
+
+	return timeline
+}
+
+func newTimelineEventDTO(event data.FatBuildEvent) timelineEventDTO {
+	dto := timelineEventDTO{
+		ID:         strconv.FormatInt(event.ID, 10),
+		Type:       event.Type,
+		JobName:    event.JobName,
+		RunnerName: event.RunnerName,
+		Actor:      event.Actor,
+		Conclusion: event.Conclusion,
+		CreatedAt:  event.CreatedAt,
+	}
+	if event.JobID != nil {
+		jobID := strconv.FormatInt(*event.JobID, 10)
+		dto.JobID = &jobID
+	}
+	if event.RunnerID != nil {
+		runnerID := strconv.FormatInt(*event.RunnerID, 10)
+		dto.RunnerID = &runnerID
+	}
+	return dto
+}
+
+// first returns current if it's set, and t otherwise.
+func first(current, t *time.Time) *time.Time {
+	if current != nil {
+		return current
+	}
+	return t
+}
+
+// seconds returns the seconds between from and to, or nil if either of them
+// didn't happen yet.
+func seconds(from, to *time.Time) *float64 {
+	if from == nil || to == nil {
+		return nil
+	}
+	s := to.Sub(*from).Seconds()
+	return &s
+}
@@ -2,24 +2,32 @@ package api
 
 import (
 	"time"
-)
 
-type getMyRepositoriesParams struct {
-	CurrentPage int    `json:"currentPage"`
-	PageSize    int    `json:"pageSize"`
-	Search      string `json:"search"`
-}
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
 
 type getUserDTO struct {
 	ID   int64  `json:"id"`
 	Name string `json:"name"`
 }
 
+// getMyRepositoriesDTO is a page of repositories. Like every list, it's
+// returned in pages: NextCursor is passed as the "cursor" query parameter to
+// get the next page, and is empty on the last page.
 type getMyRepositoriesDTO struct {
 	Repositories      []repository `json:"repositories"`
 	TotalRepositories int          `json:"totalRepositories"`
-	TotalPages        int          `json:"totalPages"`
-	CurrentPage       int          `json:"currentPage"`
+	NextCursor        string       `json:"nextCursor"`
+}
+
+type getRepositoriesDTO struct {
+	Repositories []data.Repo `json:"repositories"`
+	NextCursor   string      `json:"nextCursor"`
+}
+
+type getBuildsDTO struct {
+	Builds     []data.FatBuild `json:"builds"`
+	NextCursor string          `json:"nextCursor"`
 }
 
 type repository struct {
@@ -42,6 +50,7 @@ type statsDTO struct {
 
 type pipelineDashboardData struct {
 	ID             string  `json:"id"`
+	Number         int64   `json:"number"`
 	RepositoryName string  `json:"repositoryName"`
 	CommitName     string  `json:"commitName"`
 	Status         string  `json:"status"`
@@ -55,10 +64,12 @@ type getRepositoryDTO struct {
 	URL              string     `json:"url"`
 	DateOfLastUpdate *time.Time `json:"dateOfLastUpdate"`
 	Pipelines        []pipeline `json:"pipelines"`
+	NextCursor       string     `json:"nextCursor"`
 }
 
 type pipeline struct {
 	ID             string     `json:"id"`
+	Number         int64      `json:"number"`
 	RepositoryName string     `json:"repositoryName"`
 	RepositoryID   string     `json:"repositoryId"`
 	CommitName     string     `json:"commitName"`
@@ -67,3 +78,314 @@ type pipeline struct {
 	StartDate      time.Time  `json:"startDate"`
 	EndDate        *time.Time `json:"endDate"`
 }
+
+// timelineDTO holds the events of a build. Times and durations are null until
+// the build or job reaches the state they depend on.
+type timelineDTO struct {
+	BuildID      string             `json:"buildId"`
+	Events       []timelineEventDTO `json:"events"`
+	Jobs         []timelineJobDTO   `json:"jobs"`
+	QueuedAt     *time.Time         `json:"queuedAt"`
+	StartedAt    *time.Time         `json:"startedAt"`
+	CompletedAt  *time.Time         `json:"completedAt"`
+	QueueSeconds *float64           `json:"queueSeconds"`
+	RunSeconds   *float64           `json:"runSeconds"`
+	TotalSeconds *float64           `json:"totalSeconds"`
+}
+
+type timelineEventDTO struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	JobID      *string   `json:"jobId"`
+	JobName    *string   `json:"jobName"`
+	RunnerID   *string   `json:"runnerId"`
+	RunnerName *string   `json:"runnerName"`
+	Actor      string    `json:"actor"`
+	Conclusion *string   `json:"conclusion"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type timelineJobDTO struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	QueuedAt     *time.Time `json:"queuedAt"`
+	StartedAt    *time.Time `json:"startedAt"`
+	CompletedAt  *time.Time `json:"completedAt"`
+	QueueSeconds *float64   `json:"queueSeconds"`
+	RunSeconds   *float64   `json:"runSeconds"`
+}
+
+type pipelineGraphDTO struct {
+	Nodes []pipelineGraphNode `json:"nodes"`
+	Edges []pipelineGraphEdge `json:"edges"`
+}
+
+type pipelineGraphNode struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	ParentName string  `json:"parentName"`
+	Status     string  `json:"status"`
+	Conclusion *string `json:"conclusion"`
+	Stage      int     `json:"stage"`
+}
+
+// pipelineGraphEdge means that the job named To only runs after the job named From.
+type pipelineGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type getPipelineJobsDTO struct {
+	Groups []jobGroupDTO `json:"groups"`
+}
+
+// jobGroupDTO groups the jobs expanded from a single job of the config file.
+type jobGroupDTO struct {
+	Name string   `json:"name"`
+	Jobs []jobDTO `json:"jobs"`
+}
+
+type jobDTO struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Matrix     map[string]string `json:"matrix"`
+	Status     string            `json:"status"`
+	Conclusion *string           `json:"conclusion"`
+	StartDate  time.Time         `json:"startDate"`
+	EndDate    *time.Time        `json:"endDate"`
+}
+
+// repositorySettingsDTO holds per-repository overrides of server-wide
+// defaults. Null values use the default.
+type repositorySettingsDTO struct {
+	BuildTimeoutSeconds *int  `json:"buildTimeoutSeconds"`
+	MaxAttempts         *int  `json:"maxAttempts"`
+	MaxConcurrentBuilds *int  `json:"maxConcurrentBuilds"`
+	SecretsForForks     *bool `json:"secretsForForks"`
+}
+
+// badgeSettingsDTO tells how to embed the badge of a repository. Badges of
+// private repositories need the token query parameter, and can't be embedded
+// if Token is null.
+type badgeSettingsDTO struct {
+	// Path is the path of the badge on the server, to which the branch, job
+	// and token query parameters can be added.
+	Path    string  `json:"path"`
+	Private bool    `json:"private"`
+	Token   *string `json:"token"`
+}
+
+// installationSettingsDTO holds per-installation overrides of server-wide
+// defaults. Null values use the default.
+type installationSettingsDTO struct {
+	LogRetentionDays *int `json:"logRetentionDays"`
+}
+
+// syncReportDTO lists the repositories of an installation that changed when
+// they were reconciled with GitHub.
+type syncReportDTO struct {
+	InstallationID string                `json:"installationId"`
+	Added          []syncedRepositoryDTO `json:"added"`
+	Restored       []syncedRepositoryDTO `json:"restored"`
+	Updated        []syncedRepositoryDTO `json:"updated"`
+	Removed        []syncedRepositoryDTO `json:"removed"`
+	Unchanged      int                   `json:"unchanged"`
+}
+
+type syncedRepositoryDTO struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type getRunnersDTO struct {
+	Runners []runnerDTO `json:"runners"`
+}
+
+type runnerDTO struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	Labels         []string `json:"labels"`
+	MaxConcurrency int      `json:"maxConcurrency"`
+	Version        string   `json:"version"`
+
+	// State is "online", "busy" (running at least one job) or "offline" (no
+	// heartbeat recently).
+	State           string     `json:"state"`
+	RunningJobs     int        `json:"runningJobs"`
+	LastHeartbeatAt *time.Time `json:"lastHeartbeatAt"`
+}
+
+type getQueueDTO struct {
+	// Total is the number of queued builds of all users.
+	Total int `json:"total"`
+
+	// Running is the number of running builds of all users.
+	Running int `json:"running"`
+
+	// Capacity is the number of jobs online runners can run at the same time.
+	Capacity int `json:"capacity"`
+
+	Builds []queuedBuildDTO `json:"builds"`
+}
+
+type queuedBuildDTO struct {
+	ID             string    `json:"id"`
+	Number         int64     `json:"number"`
+	RepositoryName string    `json:"repositoryName"`
+	RepositoryID   string    `json:"repositoryId"`
+	CommitName     string    `json:"commitName"`
+	Event          string    `json:"event"`
+	Priority       int       `json:"priority"`
+	Position       int       `json:"position"`
+	CreatedAt      time.Time `json:"createdAt"`
+
+	// ETASeconds is the estimated time until the build starts. Null if there
+	// are no recent builds to estimate from.
+	ETASeconds               *int `json:"etaSeconds"`
+	EstimatedDurationSeconds *int `json:"estimatedDurationSeconds"`
+}
+
+type getLogsDTO struct {
+	Lines []logLineDTO `json:"lines"`
+
+	// NextCursor is the "cursor" query parameter of the next page, empty on
+	// the last page.
+	NextCursor string `json:"nextCursor"`
+}
+
+type logLineDTO struct {
+	BuildID string    `json:"buildId"`
+	JobID   string    `json:"jobId"`
+	Step    *int      `json:"step"`
+	Stream  string    `json:"stream"`
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Text    string    `json:"text"`
+}
+
+type logsStreamEndDTO struct {
+	Status     string  `json:"status"`
+	Conclusion *string `json:"conclusion"`
+}
+
+// getSecretsDTO lists secrets without their values, which are never returned.
+type getSecretsDTO struct {
+	Secrets []secretDTO `json:"secrets"`
+}
+
+type secretDTO struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type getVariablesDTO struct {
+	Variables []variableDTO `json:"variables"`
+}
+
+type variableDTO struct {
+	Name      string    `json:"name"`
+	Value     string    `json:"value"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// putValueParams is the body of requests creating or replacing a secret or
+// variable.
+type putValueParams struct {
+	Value string `json:"value"`
+}
+
+type getArtifactsDTO struct {
+	Artifacts []artifactDTO `json:"artifacts"`
+}
+
+type artifactDTO struct {
+	ID        string    `json:"id"`
+	JobID     string    `json:"jobId"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// successRatesDTO holds the builds completed per bucket of the granularity.
+// Buckets start at the start of the hour, day, week or month that contains
+// "from".
+type successRatesDTO struct {
+	From        time.Time              `json:"from"`
+	To          time.Time              `json:"to"`
+	Granularity string                 `json:"granularity"`
+	Buckets     []successRateBucketDTO `json:"buckets"`
+}
+
+type successRateBucketDTO struct {
+	Start      time.Time `json:"start"`
+	Total      int       `json:"total"`
+	Successful int       `json:"successful"`
+	Failed     int       `json:"failed"`
+
+	// SuccessRate is the fraction of successful builds among the builds that
+	// succeeded or failed. Null if there are none.
+	SuccessRate *float64 `json:"successRate"`
+}
+
+type durationsDTO struct {
+	From        time.Time           `json:"from"`
+	To          time.Time           `json:"to"`
+	Granularity string              `json:"granularity"`
+	Buckets     []durationBucketDTO `json:"buckets"`
+}
+
+type durationBucketDTO struct {
+	Start        time.Time      `json:"start"`
+	Builds       int            `json:"builds"`
+	QueueSeconds percentilesDTO `json:"queueSeconds"`
+	RunSeconds   percentilesDTO `json:"runSeconds"`
+}
+
+// percentilesDTO holds percentiles of durations. They are null if there are
+// no durations.
+type percentilesDTO struct {
+	P50 *float64 `json:"p50"`
+	P90 *float64 `json:"p90"`
+	P99 *float64 `json:"p99"`
+}
+
+type jobFailuresDTO struct {
+	From time.Time       `json:"from"`
+	To   time.Time       `json:"to"`
+	Jobs []jobFailureDTO `json:"jobs"`
+}
+
+type jobFailureDTO struct {
+	RepoID       string    `json:"repoId"`
+	RepoName     string    `json:"repoName"`
+	JobName      string    `json:"jobName"`
+	Runs         int       `json:"runs"`
+	Failures     int       `json:"failures"`
+	FailureRate  float64   `json:"failureRate"`
+	Share        float64   `json:"share"`
+	LastFailedAt time.Time `json:"lastFailedAt"`
+}
+
+type recoveryDTO struct {
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"`
+	Branches []branchRecoveryDTO `json:"branches"`
+}
+
+type branchRecoveryDTO struct {
+	RepoID     string `json:"repoId"`
+	RepoName   string `json:"repoName"`
+	Branch     string `json:"branch"`
+	Failures   int    `json:"failures"`
+	Recoveries int    `json:"recoveries"`
+
+	// MeanTimeToRecoverySeconds is null if the branch never recovered.
+	MeanTimeToRecoverySeconds *float64 `json:"meanTimeToRecoverySeconds"`
+
+	// FailingSince is null unless the branch is still failing.
+	FailingSince *time.Time `json:"failingSince"`
+}
@@ -0,0 +1,168 @@
+// Package badge serves SVG badges with the status of the latest completed
+// build of a repository, to be embedded in README files. Badges of public repositories
+// are public. Badges of private repositories are only served with the badge
+// token of the repository, if it has one.
+package badge
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// Statuses shown on badges.
+const (
+	Passing = "passing"
+	Failing = "failing"
+	Unknown = "unknown"
+)
+
+type Handler struct {
+	repoRepo  data.RepoRepo
+	buildRepo data.BuildRepo
+}
+
+func NewHandler(repoRepo data.RepoRepo, buildRepo data.BuildRepo) *Handler {
+	return &Handler{
+		repoRepo:  repoRepo,
+		buildRepo: buildRepo,
+	}
+}
+
+func (h *Handler) Mux() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /{owner}/{repo}/{$}", h.getBadge)
+
+	return mux
+}
+
+// getBadge serves the badge of the repository in the path, which ends with
+// ".svg". The optional query parameters are:
+//   - branch: the branch of the builds, the default branch of the
+//     repository if it's empty
+//   - job: the name of a job, to show the status of that job rather than of
+//     the whole build
+//   - token: the badge token of the repository, required if it's private
+//
+// Badges of repositories that don't exist, or that can't be accessed, show
+// an unknown status and are served with 404 Not Found, so that they can't be
+// told apart.
+func (h *Handler) getBadge(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	repoName, ok := strings.CutSuffix(r.PathValue("repo"), ".svg")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	job := query.Get("job")
+	label := "build"
+	if job != "" {
+		label = job
+	}
+
+	status, err := h.status(r.Context(), r.PathValue("owner")+"/"+repoName, query.Get("branch"), job, query.Get("token"))
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write(render(label, Unknown))
+			return
+		}
+
+		msg := "failed to get status of badge"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	svg := render(label, status)
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	// Badges are cached, but revalidated on every use, so that they change
+	// as soon as a build completes.
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	_, _ = w.Write(svg)
+}
+
+// status returns the status of the badge of the repository with fullName.
+// Returns data.ErrNotFound if the repository doesn't exist, or if it's private
+// and token isn't its badge token.
+func (h *Handler) status(ctx context.Context, fullName, branch, job, token string) (string, error) {
+	repo, err := h.repoRepo.GetByFullName(ctx, fullName)
+	if err != nil {
+		return "", err
+	}
+
+	if repo.Private {
+		badgeToken, err := h.repoRepo.GetBadgeToken(ctx, repo.ID)
+		if err != nil {
+			return "", err
+		}
+		if badgeToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(badgeToken)) != 1 {
+			return "", data.ErrNotFound
+		}
+	}
+
+	if branch == "" {
+		branch, err = h.repoRepo.GetDefaultBranch(ctx, repo.ID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	outcomes, err := h.buildRepo.GetLatestOutcomes(ctx, repo.ID, branch, job)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			return Unknown, nil
+		}
+		return "", fmt.Errorf("get latest outcomes of repository with id %d: %w", repo.ID, err)
+	}
+
+	return statusOf(outcomes), nil
+}
+
+// statusOf returns the status of a completed build, or of the jobs of a
+// completed build, from their outcomes. Jobs that were canceled or skipped
+// don't count, unless all of them were.
+func statusOf(outcomes []data.Outcome) string {
+	passed := false
+	for _, outcome := range outcomes {
+		if outcome.Conclusion == nil {
+			continue
+		}
+
+		switch *outcome.Conclusion {
+		case "failure", "timed_out":
+			return Failing
+		case "success":
+			passed = true
+		}
+	}
+
+	if passed {
+		return Passing
+	}
+	return Unknown
+}
@@ -0,0 +1,85 @@
+package badge
+
+import (
+	"bytes"
+	"text/template"
+	"unicode/utf8"
+)
+
+// colors maps statuses to the color of the right half of the badge.
+var colors = map[string]string{
+	Passing: "#4c1",
+	Failing: "#e05d44",
+	Unknown: "#9f9f9f",
+}
+
+// badgeTemplate draws a badge in the style of shields.io: label on the left,
+// status on the right. Text is stretched to the estimated widths, so that it
+// fits whatever font the viewer substitutes for Verdana.
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{html .Label}}: {{.Status}}">
+  <title>{{html .Label}}: {{.Status}}</title>
+  <linearGradient id="s" x2="0" y2="100%">
+    <stop offset="0" stop-color="#bbb" stop-opacity=".1"/>
+    <stop offset="1" stop-opacity=".1"/>
+  </linearGradient>
+  <clipPath id="r">
+    <rect width="{{.Width}}" height="20" rx="3" fill="#fff"/>
+  </clipPath>
+  <g clip-path="url(#r)">
+    <rect width="{{.LabelWidth}}" height="20" fill="#555"/>
+    <rect x="{{.LabelWidth}}" width="{{.StatusWidth}}" height="20" fill="{{.Color}}"/>
+    <rect width="{{.Width}}" height="20" fill="url(#s)"/>
+  </g>
+  <g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+    <text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3" textLength="{{.LabelTextWidth}}" lengthAdjust="spacingAndGlyphs">{{html .Label}}</text>
+    <text x="{{.LabelX}}" y="14" textLength="{{.LabelTextWidth}}" lengthAdjust="spacingAndGlyphs">{{html .Label}}</text>
+    <text x="{{.StatusX}}" y="15" fill="#010101" fill-opacity=".3" textLength="{{.StatusTextWidth}}" lengthAdjust="spacingAndGlyphs">{{.Status}}</text>
+    <text x="{{.StatusX}}" y="14" textLength="{{.StatusTextWidth}}" lengthAdjust="spacingAndGlyphs">{{.Status}}</text>
+  </g>
+</svg>
+`))
+
+// padding is the horizontal space around the text of each half of a badge.
+const padding = 10
+
+type badgeData struct {
+	Label, Status, Color            string
+	Width, LabelWidth, StatusWidth  int
+	LabelTextWidth, StatusTextWidth int
+	LabelX, StatusX                 int
+}
+
+// render returns the SVG of a badge with label and status.
+func render(label, status string) []byte {
+	labelTextWidth := textWidth(label)
+	statusTextWidth := textWidth(status)
+	labelWidth := labelTextWidth + padding
+	statusWidth := statusTextWidth + padding
+
+	var buf bytes.Buffer
+	err := badgeTemplate.Execute(&buf, badgeData{
+		Label:           label,
+		Status:          status,
+		Color:           colors[status],
+		Width:           labelWidth + statusWidth,
+		LabelWidth:      labelWidth,
+		StatusWidth:     statusWidth,
+		LabelTextWidth:  labelTextWidth,
+		StatusTextWidth: statusTextWidth,
+		LabelX:          labelWidth / 2,
+		StatusX:         labelWidth + statusWidth/2,
+	})
+	if err != nil {
+		// The template only fails on write errors, which bytes.Buffer
+		// doesn't return.
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+// textWidth estimates the width in pixels of s in 11px Verdana, whose
+// characters are 7 pixels wide on average.
+func textWidth(s string) int {
+	return 7 * utf8.RuneCountInString(s)
+}
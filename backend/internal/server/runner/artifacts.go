@@ -0,0 +1,152 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/artifact"
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+// checksumHeader holds the hex-encoded SHA-256 checksum of an uploaded
+// artifact. Optional: if it's set, uploads that don't match it are rejected.
+const checksumHeader = "X-Checksum-SHA256"
+
+var checksumPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// uploadArtifact stores the request body as an artifact of the job. The body
+// is streamed to blob storage, so its length must be known up front. An
+// artifact with the same name uploaded by the job before is replaced.
+//
+// The "retentionDays" query parameter shortens how long the artifact is kept.
+func (h *Handler) uploadArtifact(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	if h.blobs == nil {
+		msg := "artifacts are not enabled on this server"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !artifact.ValidName(name) {
+		msg := fmt.Sprintf("invalid artifact name %q: names must consist of letters, digits, dots, dashes and underscores, and not start with a dot", name)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if r.ContentLength < 0 {
+		msg := "artifacts must be uploaded with a Content-Length"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusLengthRequired)
+		return
+	}
+	if r.ContentLength > h.artifactConfig.MaxSize {
+		msg := fmt.Sprintf("artifact must be at most %d bytes", h.artifactConfig.MaxSize)
+		logger.Debug(msg, slog.Int64("size", r.ContentLength))
+		http.Error(w, msg, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	checksum, ok := parseChecksum(w, r)
+	if !ok {
+		return
+	}
+
+	retention := h.artifactConfig.Retention
+	if r.URL.Query().Has("retentionDays") {
+		days, err := strconv.Atoi(r.URL.Query().Get("retentionDays"))
+		if err != nil || days <= 0 {
+			msg := fmt.Sprintf("invalid retentionDays: %s", r.URL.Query().Get("retentionDays"))
+			logger.Debug(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		retention = min(time.Duration(days)*24*time.Hour, retention)
+	}
+
+	job, ok := h.getLeasedJob(w, r)
+	if !ok {
+		return
+	}
+
+	key := artifact.Key(job.BuildID, job.ID, name)
+	body := blob.NewVerifyingReader(r.Body, checksum)
+	err := h.blobs.Put(r.Context(), key, body, r.ContentLength)
+	if err != nil {
+		if errors.Is(err, blob.ErrChecksumMismatch) {
+			msg := "artifact doesn't match its checksum"
+			logger.Debug(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to store artifact %s of job with id %d", name, job.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	uploaded := data.Artifact{
+		BuildID:   job.BuildID,
+		JobID:     job.ID,
+		Name:      name,
+		BlobKey:   key,
+		Size:      r.ContentLength,
+		SHA256:    body.Sum(),
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(retention),
+	}
+	uploaded.ID, err = h.artifactRepo.Put(r.Context(), uploaded)
+	if err != nil {
+		msg := fmt.Sprintf("failed to record artifact %s of job with id %d", name, job.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("artifact uploaded", slog.Int64("job_id", job.ID), slog.String("name", name), slog.Int64("size", uploaded.Size))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(artifactDTO{
+		ID:        uploaded.ID,
+		Name:      uploaded.Name,
+		Size:      uploaded.Size,
+		SHA256:    uploaded.SHA256,
+		ExpiresAt: uploaded.ExpiresAt,
+	})
+	if err != nil {
+		msg := "failed to encode artifact into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseChecksum returns the checksum in the checksumHeader of the request, or
+// an empty string if it's not set. If it's invalid, it writes an error
+// response and returns false.
+func parseChecksum(w http.ResponseWriter, r *http.Request) (checksum string, ok bool) {
+	logger, _ := l.FromContext(r.Context())
+
+	checksum = strings.ToLower(r.Header.Get(checksumHeader))
+	if checksum != "" && !checksumPattern.MatchString(checksum) {
+		msg := fmt.Sprintf("invalid %s header: must be a hex-encoded SHA-256 checksum", checksumHeader)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return "", false
+	}
+
+	return checksum, true
+}
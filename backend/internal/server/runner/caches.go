@@ -0,0 +1,206 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/cache"
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+)
+
+const (
+	// cacheKeyHeader holds the key of the restored cache entry, which differs
+	// from the requested key if the entry matched a restore key.
+	cacheKeyHeader = "X-Cache-Key"
+
+	// cacheHitHeader is "true" if the restored cache entry matched the
+	// requested key exactly.
+	cacheHitHeader = "X-Cache-Hit"
+)
+
+// restoreCache serves the content of the cache entry matching the "key"
+// query parameter, falling back to the newest entry whose key starts with one
+// of the "restoreKey" query parameters, in order. Entries of the build's
+// branch are preferred over those of the default branch. Responds with 204 No
+// Content if no entry matches.
+func (h *Handler) restoreCache(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	if h.caches == nil {
+		msg := "caches are not enabled on this server"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	restoreKeys := r.URL.Query()["restoreKey"]
+	for _, k := range append([]string{key}, restoreKeys...) {
+		if !cache.ValidKey(k) {
+			msg := fmt.Sprintf("invalid cache key %q: keys must consist of up to 512 printable ASCII characters other than spaces", k)
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, ok := h.getLeasedJob(w, r)
+	if !ok {
+		return
+	}
+
+	build, err := h.buildRepo.GetByID(r.Context(), job.BuildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get build with id %d", job.BuildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	branches := []string{build.Branch}
+	defaultBranch, err := h.repoRepo.GetDefaultBranch(r.Context(), build.RepoID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get default branch of repo with id %d", build.RepoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if defaultBranch != "" && defaultBranch != build.Branch {
+		branches = append(branches, defaultBranch)
+	}
+
+	entry, exact, err := h.caches.Find(r.Context(), build.RepoID, branches, key, restoreKeys)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to find cache entry %s", key)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	object, err := h.caches.Open(r.Context(), *entry)
+	if err != nil {
+		msg := fmt.Sprintf("failed to open cache entry %s", entry.Key)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	defer object.Close()
+	logger.Debug("cache entry restored", slog.Int64("job_id", job.ID), slog.String("key", entry.Key), slog.String("branch", entry.Branch), slog.Bool("exact", exact))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(cacheKeyHeader, entry.Key)
+	w.Header().Set(cacheHitHeader, fmt.Sprint(exact))
+	w.Header().Set(checksumHeader, entry.SHA256)
+	w.Header().Set("ETag", `"`+entry.SHA256+`"`)
+	http.ServeContent(w, r, "", entry.CreatedAt, object)
+}
+
+// saveCache saves the request body as the cache entry with the "key" query
+// parameter in the build's branch. Entries are never replaced, so saving a
+// key that exists already responds with 409 Conflict.
+//
+// Builds of pull requests from forks can restore caches, but not save them,
+// as they could plant content restored by builds of the repository itself.
+func (h *Handler) saveCache(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	if h.caches == nil {
+		msg := "caches are not enabled on this server"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusServiceUnavailable)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if !cache.ValidKey(key) {
+		msg := fmt.Sprintf("invalid cache key %q: keys must consist of up to 512 printable ASCII characters other than spaces", key)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if r.ContentLength < 0 {
+		msg := "caches must be saved with a Content-Length"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusLengthRequired)
+		return
+	}
+
+	checksum, ok := parseChecksum(w, r)
+	if !ok {
+		return
+	}
+
+	job, ok := h.getLeasedJob(w, r)
+	if !ok {
+		return
+	}
+
+	build, err := h.buildRepo.GetByID(r.Context(), job.BuildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get build with id %d", job.BuildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if build.FromFork {
+		msg := "builds of pull requests from forks can't save caches"
+		logger.Debug(msg, slog.Int64("build_id", build.ID))
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	entry, err := h.caches.Save(r.Context(), build.RepoID, build.Branch, key, r.Body, r.ContentLength, checksum)
+	if err != nil {
+		if errors.Is(err, data.ErrAlreadyExists) {
+			msg := fmt.Sprintf("cache entry %s exists already", key)
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, cache.ErrTooLarge) {
+			msg := "cache entry exceeds the size limit of the repository"
+			logger.Debug(msg, slog.Int64("size", r.ContentLength))
+			http.Error(w, msg, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, blob.ErrChecksumMismatch) {
+			msg := "cache entry doesn't match its checksum"
+			logger.Debug(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		msg := fmt.Sprintf("failed to save cache entry %s", key)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("cache entry saved", slog.Int64("job_id", job.ID), slog.String("key", key), slog.String("branch", entry.Branch), slog.Int64("size", entry.Size))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(cacheEntryDTO{
+		ID:     entry.ID,
+		Key:    entry.Key,
+		Branch: entry.Branch,
+		Size:   entry.Size,
+		SHA256: entry.SHA256,
+	})
+	if err != nil {
+		msg := "failed to encode cache entry into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
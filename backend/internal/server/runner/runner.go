@@ -0,0 +1,807 @@
+// Package runner implements the API used by runners to claim and execute jobs.
+//
+// A runner registers once with the registration token configured on the
+// server and receives its own token, which authenticates all further
+// requests. Every authenticated request counts as a heartbeat of the runner.
+//
+// A runner only claims jobs whose runs_on labels it has all of, and no more
+// jobs at a time than its max concurrency. Claimed jobs are leased to the
+// runner: it must send heartbeats to extend the lease, otherwise the job is
+// returned to the queue by the watchdog.
+//
+// Secrets are masked in the logs pushed by runners. Besides values matching
+// the configured patterns, runners can register values to mask for each job.
+//
+// Jobs can upload files they produce as artifacts, which are kept in blob
+// storage until they expire, and save and restore dependency caches.
+package runner
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/artifact"
+	"github.com/bee-ci/bee-ci-system/internal/blob"
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
+	"github.com/bee-ci/bee-ci-system/internal/cache"
+	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/envelope"
+	"github.com/bee-ci/bee-ci-system/internal/redact"
+)
+
+const (
+	// LeaseDuration is how long a claimed job stays leased to a runner without
+	// a heartbeat.
+	LeaseDuration = 2 * time.Minute
+
+	// HeartbeatInterval is how often runners are asked to send heartbeats.
+	HeartbeatInterval = 30 * time.Second
+
+	// maxClaimWait is the longest a claim request waits for a job to be queued.
+	maxClaimWait = 60 * time.Second
+
+	// claimPollInterval is how often a waiting claim request checks the queue.
+	claimPollInterval = time.Second
+)
+
+// conclusions are the conclusions a runner may report for a job.
+var conclusions = []string{"success", "failure", "timed_out", "canceled"}
+
+type Handler struct {
+	runnerRepo data.RunnerRepo
+	jobRepo    data.JobRepo
+	buildRepo  data.BuildRepo
+	repoRepo   data.RepoRepo
+	userRepo   data.UserRepo
+	logsWriter data.LogsWriter
+	logsBroker data.LogsBroker
+
+	logMaskRepo  data.LogMaskRepo
+	heldLogsRepo data.HeldLogsRepo
+
+	secretRepo   data.SecretRepo
+	variableRepo data.VariableRepo
+
+	// keyring decrypts secrets. No secrets are passed to jobs if it's nil.
+	keyring *envelope.Keyring
+
+	// artifactRepo and blobs store artifacts. Artifacts can't be uploaded if
+	// blobs is nil.
+	artifactRepo   data.ArtifactRepo
+	blobs          blob.Store
+	artifactConfig artifact.Config
+
+	// caches stores dependency caches. Caches are disabled if it's nil.
+	caches *cache.Store
+
+	// redactPatterns match credentials that are masked in logs in addition to
+	// the values registered as masks.
+	redactPatterns []*regexp.Regexp
+
+	// The token runners must present to register. Registration is disabled
+	// if it's empty.
+	registrationToken string
+
+	queueLimits data.QueueLimits
+}
+
+func NewHandler(
+	runnerRepo data.RunnerRepo,
+	jobRepo data.JobRepo,
+	buildRepo data.BuildRepo,
+	repoRepo data.RepoRepo,
+	userRepo data.UserRepo,
+	logsWriter data.LogsWriter,
+	logsBroker data.LogsBroker,
+	logMaskRepo data.LogMaskRepo,
+	heldLogsRepo data.HeldLogsRepo,
+	redactPatterns []*regexp.Regexp,
+	secretRepo data.SecretRepo,
+	variableRepo data.VariableRepo,
+	keyring *envelope.Keyring,
+	artifactRepo data.ArtifactRepo,
+	blobs blob.Store,
+	artifactConfig artifact.Config,
+	caches *cache.Store,
+	registrationToken string,
+	queueLimits data.QueueLimits,
+) *Handler {
+	return &Handler{
+		runnerRepo:        runnerRepo,
+		jobRepo:           jobRepo,
+		buildRepo:         buildRepo,
+		repoRepo:          repoRepo,
+		userRepo:          userRepo,
+		logsWriter:        logsWriter,
+		logsBroker:        logsBroker,
+		logMaskRepo:       logMaskRepo,
+		heldLogsRepo:      heldLogsRepo,
+		redactPatterns:    redactPatterns,
+		secretRepo:        secretRepo,
+		variableRepo:      variableRepo,
+		keyring:           keyring,
+		artifactRepo:      artifactRepo,
+		blobs:             blobs,
+		artifactConfig:    artifactConfig,
+		caches:            caches,
+		registrationToken: registrationToken,
+		queueLimits:       queueLimits,
+	}
+}
+
+func (h *Handler) Mux() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /register/", h.register)
+	mux.Handle("POST /jobs/claim/", h.withRunner(http.HandlerFunc(h.claimJob)))
+	mux.Handle("POST /jobs/{id}/heartbeat/", h.withRunner(http.HandlerFunc(h.heartbeat)))
+	mux.Handle("POST /jobs/{id}/logs/", h.withRunner(http.HandlerFunc(h.pushLogs)))
+	mux.Handle("POST /jobs/{id}/masks/", h.withRunner(http.HandlerFunc(h.addMasks)))
+	mux.Handle("PUT /jobs/{id}/artifacts/{name}/", h.withRunner(http.HandlerFunc(h.uploadArtifact)))
+	mux.Handle("GET /jobs/{id}/caches/", h.withRunner(http.HandlerFunc(h.restoreCache)))
+	mux.Handle("PUT /jobs/{id}/caches/", h.withRunner(http.HandlerFunc(h.saveCache)))
+	mux.Handle("POST /jobs/{id}/conclusion/", h.withRunner(http.HandlerFunc(h.completeJob)))
+
+	return mux
+}
+
+func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	token, ok := bearerToken(r)
+	if h.registrationToken == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.registrationToken)) != 1 {
+		msg := "invalid registration token"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	var params registerParams
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		msg := "runner name must not be empty"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if slices.Contains(params.Labels, "") {
+		msg := "runner labels must not be empty"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if params.MaxConcurrency == 0 {
+		params.MaxConcurrency = 1
+	}
+	if params.MaxConcurrency < 0 {
+		msg := "max concurrency must be positive"
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	runnerToken, err := generateToken()
+	if err != nil {
+		msg := "failed to generate runner token"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	runner, err := h.runnerRepo.Create(r.Context(), data.NewRunner{
+		Name:           params.Name,
+		TokenHash:      hashToken(runnerToken),
+		Labels:         params.Labels,
+		MaxConcurrency: params.MaxConcurrency,
+		Version:        params.Version,
+	})
+	if err != nil {
+		msg := "failed to register runner"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("runner registered", slog.Any("runner", runner))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(registerDTO{
+		ID:             runner.ID,
+		Name:           runner.Name,
+		Labels:         runner.Labels,
+		MaxConcurrency: runner.MaxConcurrency,
+		Token:          runnerToken,
+	})
+	if err != nil {
+		msg := "failed to encode runner into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// claimJob leases a queued job to the runner. If no job can be claimed, the
+// request waits for up to the number of seconds given in the "wait" query
+// parameter, and responds with 204 No Content if none could be claimed in the
+// meantime.
+func (h *Handler) claimJob(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+	runner := runnerFromContext(r.Context())
+
+	wait := time.Duration(0)
+	if r.URL.Query().Has("wait") {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("wait"))
+		if err != nil || seconds < 0 {
+			msg := fmt.Sprintf("invalid wait: %s", r.URL.Query().Get("wait"))
+			logger.Debug(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		wait = min(time.Duration(seconds)*time.Second, maxClaimWait)
+	}
+
+	job, err := h.waitForJob(r.Context(), *runner, wait)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		msg := "failed to claim job"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	logger.Info("job claimed", slog.Any("job", job), slog.Any("runner", runner))
+
+	// If anything below fails, the lease expires and the job is claimed again.
+	build, err := h.buildRepo.GetByID(r.Context(), job.BuildID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get build with id %d", job.BuildID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	repo, err := h.repoRepo.Get(r.Context(), build.RepoID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get repo with id %d", build.RepoID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	owner, err := h.userRepo.Get(r.Context(), repo.UserID)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get owner of repo with id %d", repo.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	env, secrets, err := h.getEnv(r.Context(), *build)
+	if err != nil {
+		msg := fmt.Sprintf("failed to get variables and secrets of build with id %d", build.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	// Secrets are masked in the logs before the runner gets to print them.
+	secretValues := make([]string, 0, len(secrets))
+	for _, value := range secrets {
+		secretValues = append(secretValues, value)
+	}
+	err = h.logMaskRepo.Add(r.Context(), job.ID, secretValues)
+	if err != nil {
+		msg := fmt.Sprintf("failed to add masks to job with id %d", job.ID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	response := claimedJobDTO{
+		Job: jobDTO{
+			ID:       job.ID,
+			Name:     job.Name,
+			Image:    job.Image,
+			Commands: job.Commands,
+			Timeout:  job.Timeout,
+			Attempt:  job.Attempts,
+		},
+		Build: buildDTO{
+			ID:        build.ID,
+			Number:    build.Number,
+			CommitSHA: build.CommitSHA,
+			CommitMsg: build.CommitMsg,
+			Branch:    build.Branch,
+			Event:     build.Event,
+		},
+		Repo: repoDTO{
+			ID:    repo.ID,
+			Owner: owner.Username,
+			Name:  repo.Name,
+		},
+		Lease: leaseDTO{
+			ExpiresAt:                *job.LeaseExpiresAt,
+			HeartbeatIntervalSeconds: int(HeartbeatInterval.Seconds()),
+		},
+		Env:     env,
+		Secrets: secrets,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		msg := "failed to encode job into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+// getEnv returns the variables and decrypted secrets passed to the jobs of
+// build. Builds of pull requests from forks get no secrets, unless their
+// repository allows it.
+func (h *Handler) getEnv(ctx context.Context, build data.Build) (env, secrets map[string]string, err error) {
+	env = make(map[string]string)
+	secrets = make(map[string]string)
+
+	variables, err := h.variableRepo.GetForBuild(ctx, build.InstallationID, build.RepoID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, variable := range variables {
+		env[variable.Name] = variable.Value
+	}
+
+	if h.keyring == nil {
+		return env, secrets, nil
+	}
+
+	if build.FromFork {
+		settings, err := h.repoRepo.GetSettings(ctx, build.RepoID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if settings.SecretsForForks == nil || !*settings.SecretsForForks {
+			return env, secrets, nil
+		}
+	}
+
+	sealedSecrets, err := h.secretRepo.GetForBuild(ctx, build.InstallationID, build.RepoID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, secret := range sealedSecrets {
+		value, err := h.keyring.Open(envelope.Sealed{
+			Ciphertext:   secret.Ciphertext,
+			EncryptedKey: secret.EncryptedKey,
+			KeyID:        secret.KeyID,
+		}, secret.AAD())
+		if err != nil {
+			return nil, nil, fmt.Errorf("decrypt secret %s: %w", secret.Name, err)
+		}
+		secrets[secret.Name] = string(value)
+	}
+
+	return env, secrets, nil
+}
+
+// waitForJob claims a job, polling the queue until one is available or wait
+// elapses. Returns data.ErrNotFound if no job could be claimed.
+func (h *Handler) waitForJob(ctx context.Context, runner data.Runner, wait time.Duration) (*data.Job, error) {
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(claimPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := h.jobRepo.Claim(ctx, runner, LeaseDuration, h.queueLimits)
+		if !errors.Is(err, data.ErrNotFound) {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, data.ErrNotFound
+		case <-deadline.C:
+			return nil, data.ErrNotFound
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Handler) heartbeat(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+	runner := runnerFromContext(r.Context())
+
+	jobID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid job ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	leaseExpiresAt, err := h.jobRepo.ExtendLease(r.Context(), jobID, runner.ID, LeaseDuration)
+	if err != nil {
+		h.handleLeaseError(w, r, jobID, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(leaseDTO{
+		ExpiresAt:                leaseExpiresAt,
+		HeartbeatIntervalSeconds: int(HeartbeatInterval.Seconds()),
+	})
+	if err != nil {
+		msg := "failed to encode lease into json"
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+}
+
+func (h *Handler) pushLogs(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	job, ok := h.getLeasedJob(w, r)
+	if !ok {
+		return
+	}
+	jobID := job.ID
+
+	var params pushLogsParams
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	for _, line := range params.Lines {
+		if line.Stream != "" && line.Stream != data.LogStreamStdout && line.Stream != data.LogStreamStderr {
+			msg := fmt.Sprintf("invalid stream: %s", line.Stream)
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if line.Step != nil && (*line.Step < 0 || *line.Step >= len(job.Commands)) {
+			msg := fmt.Sprintf("invalid step: %d", *line.Step)
+			logger.Debug(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	if len(params.Lines) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	seq, err := h.jobRepo.ReserveLogLines(r.Context(), job.ID, len(params.Lines))
+	if err != nil {
+		msg := fmt.Sprintf("failed to number logs of job with id %d", jobID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	// Every line gets its own timestamp, so that lines of the batch don't
+	// overwrite each other and keep their order.
+	now := time.Now()
+	lines := make([]data.LogLine, 0, len(params.Lines))
+	for i, line := range params.Lines {
+		stream := line.Stream
+		if stream == "" {
+			stream = data.LogStreamStdout
+		}
+
+		lines = append(lines, data.LogLine{
+			BuildID: job.BuildID,
+			JobID:   job.ID,
+			Step:    line.Step,
+			Stream:  stream,
+			Seq:     seq + int64(i),
+			Time:    now.Add(time.Duration(i)),
+			Text:    line.Text,
+		})
+	}
+
+	err = h.storeLogs(r.Context(), job.ID, lines, false)
+	if err != nil {
+		msg := fmt.Sprintf("failed to store logs of job with id %d", jobID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeLogs masks secrets in lines, stores them and publishes them to live
+// viewers. Lines that may end with the beginning of a secret are held back
+// until the next lines of the job arrive, unless final is true.
+//
+// Requests of the same job are serialized, so that concurrent ones neither
+// store the held lines twice nor overwrite each other's held lines.
+func (h *Handler) storeLogs(ctx context.Context, jobID int64, lines []data.LogLine, final bool) error {
+	unlock, err := h.heldLogsRepo.Lock(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	held, err := h.heldLogsRepo.Get(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	lines = append(held, lines...)
+	if len(lines) == 0 {
+		return nil
+	}
+
+	masks, err := h.logMaskRepo.Get(ctx, jobID)
+	if err != nil {
+		return err
+	}
+	redactor := redact.New(masks, h.redactPatterns)
+
+	texts := make([]string, 0, len(lines))
+	for _, line := range lines {
+		texts = append(texts, line.Text)
+	}
+
+	ready := len(lines)
+	if !final {
+		ready = redactor.Incomplete(texts)
+	}
+
+	// Held lines are redacted too, as they may hold complete secrets as well.
+	for i, text := range redactor.RedactLines(texts) {
+		lines[i].Text = text
+	}
+
+	if ready > 0 {
+		err = h.logsWriter.Append(ctx, lines[:ready])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = h.heldLogsRepo.Hold(ctx, jobID, lines[ready:])
+	if err != nil {
+		return err
+	}
+
+	// The lines are stored already, so live viewers that miss them catch up
+	// from the store.
+	err = h.logsBroker.Publish(ctx, lines[0].BuildID, lines[:ready])
+	if err != nil {
+		logger, _ := l.FromContext(ctx)
+		logger.Error("failed to publish logs", slog.Int64("job_id", jobID), slog.Any("error", err))
+	}
+
+	return nil
+}
+
+// addMasks registers values that are masked in the logs of the job, for
+// example secrets that the job obtained while running.
+func (h *Handler) addMasks(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+
+	job, ok := h.getLeasedJob(w, r)
+	if !ok {
+		return
+	}
+	jobID := job.ID
+
+	var params addMasksParams
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	err = h.logMaskRepo.Add(r.Context(), job.ID, params.Values)
+	if err != nil {
+		msg := fmt.Sprintf("failed to add masks to job with id %d", jobID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) completeJob(w http.ResponseWriter, r *http.Request) {
+	logger, _ := l.FromContext(r.Context())
+	runner := runnerFromContext(r.Context())
+
+	// Only the runner holding the lease may flush the held logs of the job.
+	job, ok := h.getLeasedJob(w, r)
+	if !ok {
+		return
+	}
+	jobID := job.ID
+
+	var params completeParams
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		msg := "failed to decode request body"
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(conclusions, params.Conclusion) {
+		msg := fmt.Sprintf("invalid conclusion %q, must be one of: %s", params.Conclusion, strings.Join(conclusions, ", "))
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Once the job completes, no more lines that could complete a secret
+	// arrive.
+	err = h.storeLogs(r.Context(), jobID, nil, true)
+	if err != nil {
+		msg := fmt.Sprintf("failed to store held logs of job with id %d", jobID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	err = h.jobRepo.Complete(r.Context(), jobID, runner.ID, params.Conclusion)
+	if err != nil {
+		h.handleLeaseError(w, r, jobID, err)
+		return
+	}
+	logger.Info("job completed", slog.Int64("job_id", jobID), slog.String("conclusion", params.Conclusion), slog.Any("runner", runner))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getLeasedJob returns the job in the path of the request, if it's leased to
+// the runner. Otherwise, it writes an error response and returns false.
+func (h *Handler) getLeasedJob(w http.ResponseWriter, r *http.Request) (job *data.Job, ok bool) {
+	logger, _ := l.FromContext(r.Context())
+	runner := runnerFromContext(r.Context())
+
+	jobID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		msg := fmt.Sprintf("invalid job ID: %s", r.PathValue("id"))
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err = h.jobRepo.Get(r.Context(), jobID)
+	if err != nil {
+		if errors.Is(err, data.ErrNotFound) {
+			msg := fmt.Sprintf("job with id %d not found", jobID)
+			http.Error(w, msg, http.StatusNotFound)
+			return nil, false
+		}
+
+		msg := fmt.Sprintf("failed to get job with id %d", jobID)
+		logger.Error(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return nil, false
+	}
+	if job.Status != "in_progress" || job.RunnerID == nil || *job.RunnerID != runner.ID {
+		h.handleLeaseError(w, r, jobID, data.ErrLeaseLost)
+		return nil, false
+	}
+
+	return job, true
+}
+
+// handleLeaseError responds with 409 Conflict if the runner lost the lease on
+// the job, or the job completed already, so that it stops working on it.
+func (h *Handler) handleLeaseError(w http.ResponseWriter, r *http.Request, jobID int64, err error) {
+	logger, _ := l.FromContext(r.Context())
+
+	if errors.Is(err, data.ErrLeaseLost) {
+		msg := fmt.Sprintf("runner doesn't hold the lease on job with id %d", jobID)
+		logger.Debug(msg)
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+
+	var conflict *buildstate.ConflictError
+	if errors.As(err, &conflict) {
+		msg := fmt.Sprintf("job with id %d is %s already", jobID, conflict.Status)
+		logger.Debug(msg, slog.Any("error", err))
+		http.Error(w, msg, http.StatusConflict)
+		return
+	}
+
+	msg := fmt.Sprintf("failed to update job with id %d", jobID)
+	logger.Error(msg, slog.Any("error", err))
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+type contextKey struct{}
+
+// withRunner authenticates the runner by the token in the Authorization header.
+func (h *Handler) withRunner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger, _ := l.FromContext(r.Context())
+
+		token, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, "missing runner token", http.StatusUnauthorized)
+			return
+		}
+
+		runner, err := h.runnerRepo.GetByTokenHash(r.Context(), hashToken(token))
+		if err != nil {
+			if errors.Is(err, data.ErrNotFound) {
+				http.Error(w, "invalid runner token", http.StatusUnauthorized)
+				return
+			}
+
+			msg := "failed to authenticate runner"
+			logger.Error(msg, slog.Any("error", err))
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+
+		err = h.runnerRepo.Heartbeat(r.Context(), runner.ID)
+		if err != nil {
+			logger.Error("failed to record runner heartbeat", slog.Any("error", err), slog.Any("runner", runner))
+		}
+
+		ctx := context.WithValue(r.Context(), contextKey{}, runner)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func runnerFromContext(ctx context.Context) *data.Runner {
+	return ctx.Value(contextKey{}).(*data.Runner)
+}
+
+func bearerToken(r *http.Request) (token string, ok bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"time"
+)
+
+type registerParams struct {
+	Name           string   `json:"name"`
+	Labels         []string `json:"labels"`
+	MaxConcurrency int      `json:"maxConcurrency"`
+	Version        string   `json:"version"`
+}
+
+type registerDTO struct {
+	ID             int64    `json:"id"`
+	Name           string   `json:"name"`
+	Labels         []string `json:"labels"`
+	MaxConcurrency int      `json:"maxConcurrency"`
+	Token          string   `json:"token"`
+}
+
+type claimedJobDTO struct {
+	Job   jobDTO   `json:"job"`
+	Build buildDTO `json:"build"`
+	Repo  repoDTO  `json:"repo"`
+	Lease leaseDTO `json:"lease"`
+
+	// Env holds the plain environment variables of the job.
+	Env map[string]string `json:"env"`
+
+	// Secrets holds the secret environment variables of the job. They are
+	// only ever sent to the runner that claimed the job.
+	Secrets map[string]string `json:"secrets"`
+}
+
+type jobDTO struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Image    string   `json:"image"`
+	Commands []string `json:"commands"`
+	Timeout  int      `json:"timeoutSeconds"`
+	Attempt  int      `json:"attempt"`
+}
+
+type buildDTO struct {
+	ID        int64  `json:"id"`
+	Number    int64  `json:"number"`
+	CommitSHA string `json:"commitSha"`
+	CommitMsg string `json:"commitMessage"`
+	Branch    string `json:"branch"`
+	Event     string `json:"event"`
+}
+
+type repoDTO struct {
+	ID    int64  `json:"id"`
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+}
+
+type leaseDTO struct {
+	ExpiresAt                time.Time `json:"expiresAt"`
+	HeartbeatIntervalSeconds int       `json:"heartbeatIntervalSeconds"`
+}
+
+type pushLogsParams struct {
+	Lines []logLineParams `json:"lines"`
+}
+
+type logLineParams struct {
+	Text string `json:"text"`
+
+	// Step is the index of the job's command that wrote the line. Optional.
+	Step *int `json:"step"`
+
+	// Stream is "stdout" (the default) or "stderr".
+	Stream string `json:"stream"`
+}
+
+type addMasksParams struct {
+	Values []string `json:"values"`
+}
+
+type completeParams struct {
+	Conclusion string `json:"conclusion"`
+}
+
+type artifactDTO struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type cacheEntryDTO struct {
+	ID     int64  `json:"id"`
+	Key    string `json:"key"`
+	Branch string `json:"branch"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -22,20 +23,26 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/go-github/v64/github"
 
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
 	l "github.com/bee-ci/bee-ci-system/internal/common/logger"
 	"github.com/bee-ci/bee-ci-system/internal/common/middleware"
 	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/pipeline"
+	"github.com/bee-ci/bee-ci-system/internal/queue"
+	"github.com/bee-ci/bee-ci-system/internal/scheduler"
 )
 
 //go:embed redirect.html
 var redirectHTMLPage embed.FS
 
 type Handler struct {
-	httpClient    *http.Client
-	userRepo      data.UserRepo
-	repoRepo      data.RepoRepo
-	buildRepo     data.BuildRepo
-	githubService *ghservice.GithubService
+	httpClient       *http.Client
+	userRepo         data.UserRepo
+	repoRepo         data.RepoRepo
+	buildRepo        data.BuildRepo
+	jobRepo          data.JobRepo
+	installationRepo data.InstallationRepo
+	githubService    *ghservice.GithubService
 
 	// The domain where the auth cookie will be placed, for example ".pacia.tech" or .karolak.cc".
 	//
@@ -59,6 +66,8 @@ func NewHandler(
 	userRepo data.UserRepo,
 	repoRepo data.RepoRepo,
 	buildRepo data.BuildRepo,
+	jobRepo data.JobRepo,
+	installationRepo data.InstallationRepo,
 	githubService *ghservice.GithubService,
 	mainDomain string,
 	frontendURL string,
@@ -77,6 +86,8 @@ func NewHandler(
 		userRepo:               userRepo,
 		repoRepo:               repoRepo,
 		buildRepo:              buildRepo,
+		jobRepo:                jobRepo,
+		installationRepo:       installationRepo,
 		githubService:          githubService,
 		mainDomain:             mainDomain,
 		redirectURL:            redirectURL,
@@ -294,14 +305,25 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		)
 
 		if *event.Action == "created" {
-			repos := mapRepos(userID, event.Repositories)
+			repos := mapRepos(userID, *installation.ID, event.Repositories)
 			err = h.repoRepo.Upsert(r.Context(), repos)
 			if err != nil {
 				logger.Error("error creating repositories", slog.Any("error", err))
 				http.Error(w, "error creating repositories", http.StatusInternalServerError)
 				break
 			}
+
+			err = h.installationRepo.Upsert(r.Context(), *installation.ID, userID)
+			if err != nil {
+				logger.Error("error creating installation", slog.Any("error", err))
+				http.Error(w, "error creating installation", http.StatusInternalServerError)
+				break
+			}
 		} else if *event.Action == "deleted" {
+			// GitHub leaves out the repositories of installations on all
+			// repositories of an account, so they're removed by installation.
+			// The ones in the payload are removed too, as repositories from
+			// before installations were recorded don't know theirs.
 			removedRepositories := event.Repositories
 
 			repoIDs := make([]int64, 0, len(removedRepositories))
@@ -309,13 +331,20 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 				repoIDs = append(repoIDs, *removedRepository.ID)
 			}
 
-			err = h.repoRepo.Delete(r.Context(), repoIDs)
+			err = h.repoRepo.Remove(r.Context(), repoIDs)
 			if err != nil {
-				logger.Error("error deleting repositories", slog.Any("error", err))
-				http.Error(w, "error deleting repositories", http.StatusInternalServerError)
+				logger.Error("error removing repositories", slog.Any("error", err))
+				http.Error(w, "error removing repositories", http.StatusInternalServerError)
 				break
 			}
-			_, _ = w.Write([]byte(fmt.Sprintf("removed %d repositories\n", len(removedRepositories))))
+
+			err = h.repoRepo.RemoveByInstallation(r.Context(), *installation.ID)
+			if err != nil {
+				logger.Error("error removing repositories of installation", slog.Any("error", err))
+				http.Error(w, "error removing repositories of installation", http.StatusInternalServerError)
+				break
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf("removed repositories of installation %d\n", *installation.ID)))
 		}
 	case *github.InstallationRepositoriesEvent:
 		// Payload: https://github.com/octokit/webhooks/blob/main/payload-examples/api.github.com/installation_repositories/added.payload.json
@@ -334,7 +363,7 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		switch *event.Action {
 		case "added":
 			addedRepositories := event.RepositoriesAdded
-			repos := mapRepos(userID, addedRepositories)
+			repos := mapRepos(userID, *installation.ID, addedRepositories)
 			err = h.repoRepo.Upsert(r.Context(), repos)
 			if err != nil {
 				logger.Error("error creating repositories", slog.Any("error", err))
@@ -350,10 +379,10 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 				repoIDs = append(repoIDs, *removedRepository.ID)
 			}
 
-			err = h.repoRepo.Delete(r.Context(), repoIDs)
+			err = h.repoRepo.Remove(r.Context(), repoIDs)
 			if err != nil {
-				logger.Error("error deleting repositories", slog.Any("error", err))
-				http.Error(w, "error deleting repositories", http.StatusInternalServerError)
+				logger.Error("error removing repositories", slog.Any("error", err))
+				http.Error(w, "error removing repositories", http.StatusInternalServerError)
 				break
 			}
 			_, _ = w.Write([]byte(fmt.Sprintf("removed %d repositories\n", len(removedRepositories))))
@@ -390,7 +419,7 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		hasConfigFile := slices.ContainsFunc(files, func(file *github.RepositoryContent) bool {
-			return *file.Name == ".bee-ci.json"
+			return *file.Name == pipeline.FileName
 		})
 
 		if !hasConfigFile {
@@ -405,6 +434,20 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 			headSHA := *event.CheckSuite.HeadSHA
 			message := *event.CheckSuite.HeadCommit.Message
 
+			config, err := h.getConfig(r.Context(), ghClient, repoOwner, repoName, headSHA)
+			if err != nil {
+				logger.Warn("invalid .bee-ci.json config file", slog.Any("error", err))
+				http.Error(w, fmt.Sprintf("invalid .bee-ci.json config file: %v", err), http.StatusUnprocessableEntity)
+				return
+			}
+
+			jobs, err := config.Expand()
+			if err != nil {
+				logger.Warn("failed to expand jobs from .bee-ci.json config file", slog.Any("error", err))
+				http.Error(w, fmt.Sprintf("invalid .bee-ci.json config file: %v", err), http.StatusUnprocessableEntity)
+				return
+			}
+
 			logger.Debug(fmt.Sprintf("check suite %s", *event.Action),
 				slog.String("owner", *event.Repo.Owner.Login),
 				slog.String("removedRepository", *event.Repo.Name),
@@ -412,12 +455,42 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 				slog.String("head_sha", headSHA),
 			)
 
+			buildCtx, err := h.getBuildContext(r.Context(), ghClient, event)
+			if err != nil {
+				logger.Error("failed to get build context", slog.Any("error", err))
+				http.Error(w, "failed to get build context", http.StatusInternalServerError)
+				return
+			}
+			buildCtx.Inputs = config.DefaultInputs()
+
+			fromFork, err := h.isFromFork(r.Context(), ghClient, event)
+			if err != nil {
+				logger.Error("failed to check whether the build is from a fork", slog.Any("error", err))
+				http.Error(w, "failed to check whether the build is from a fork", http.StatusInternalServerError)
+				return
+			}
+
+			newJobs, err := mapJobs(jobs, buildCtx)
+			if err != nil {
+				logger.Warn("failed to evaluate command conditions", slog.Any("error", err))
+				http.Error(w, fmt.Sprintf("invalid .bee-ci.json config file: %v", err), http.StatusUnprocessableEntity)
+				return
+			}
+
 			// TODO: Parse information from the BeeCI config file here (such as name)
 			buildID, err := h.buildRepo.Create(r.Context(), data.NewBuild{
 				RepoID:         *event.Repo.ID,
 				CommitSHA:      headSHA,
 				CommitMsg:      message,
 				InstallationID: *installation.ID,
+				Branch:         buildCtx.Branch,
+				Event:          buildCtx.Event,
+				Labels:         buildCtx.Labels,
+				Inputs:         buildCtx.Inputs,
+				Priority:       queue.Priority(buildCtx.Event, *event.Action == "rerequested"),
+				FromFork:       fromFork,
+				Actor:          event.Sender.GetLogin(),
+				Jobs:           newJobs,
 			})
 			if err != nil {
 				logger.Error("failed to create build", slog.Any("error", err))
@@ -426,6 +499,30 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			logger.Debug("build created", slog.Int64("build_id", buildID))
+
+			// Installations created before they were tracked are only known
+			// from their builds.
+			err = h.installationRepo.Upsert(r.Context(), *installation.ID, *event.Repo.Owner.ID)
+			if err != nil {
+				logger.Error("failed to create installation", slog.Int64("installation_id", *installation.ID), slog.Any("error", err))
+			}
+
+			// Caches of other branches fall back to those of the default
+			// branch.
+			err = h.repoRepo.SetDefaultBranch(r.Context(), *event.Repo.ID, event.Repo.GetDefaultBranch())
+			if err != nil {
+				logger.Error("failed to record default branch", slog.Int64("repo_id", *event.Repo.ID), slog.Any("error", err))
+			}
+
+			// Release the jobs without dependencies to the queue.
+			err = h.jobRepo.Schedule(r.Context(), buildID, scheduler.Plan)
+			var conflict *buildstate.ConflictError
+			if errors.As(err, &conflict) {
+				// The scheduler advances the build once its jobs change.
+				logger.Warn("build changed concurrently, jobs not scheduled", slog.Int64("build_id", buildID), slog.Any("error", err))
+			} else if err != nil {
+				logger.Error("failed to schedule jobs", slog.Int64("build_id", buildID), slog.Any("error", err))
+			}
 			_, _ = w.Write([]byte("build created, ID: " + strconv.FormatInt(buildID, 10)))
 		}
 
@@ -434,6 +531,85 @@ func (h Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getConfig downloads the .bee-ci.json config file at commit ref, and parses it.
+func (h Handler) getConfig(ctx context.Context, ghClient *github.Client, owner, repo, ref string) (*pipeline.Config, error) {
+	opts := &github.RepositoryContentGetOptions{Ref: ref}
+	file, _, _, err := ghClient.Repositories.GetContents(ctx, owner, repo, pipeline.FileName, opts)
+	if err != nil {
+		return nil, fmt.Errorf("get config file content: %w", err)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, fmt.Errorf("decode config file content: %w", err)
+	}
+
+	return pipeline.Parse([]byte(content))
+}
+
+// getBuildContext returns the information about the check suite that job and
+// command conditions are evaluated against. For check suites of pull
+// requests, the labels of the pull requests are fetched.
+func (h Handler) getBuildContext(ctx context.Context, ghClient *github.Client, event *github.CheckSuiteEvent) (pipeline.BuildContext, error) {
+	buildCtx := pipeline.BuildContext{
+		Branch: event.CheckSuite.GetHeadBranch(),
+		Event:  "push",
+		Labels: make([]string, 0),
+	}
+
+	pullRequests := event.CheckSuite.PullRequests
+	if len(pullRequests) == 0 {
+		return buildCtx, nil
+	}
+
+	buildCtx.Event = "pull_request"
+	for _, pr := range pullRequests {
+		pullRequest, _, err := ghClient.PullRequests.Get(ctx, *event.Repo.Owner.Login, *event.Repo.Name, pr.GetNumber())
+		if err != nil {
+			return pipeline.BuildContext{}, fmt.Errorf("get pull request #%d: %w", pr.GetNumber(), err)
+		}
+		for _, label := range pullRequest.Labels {
+			if !slices.Contains(buildCtx.Labels, label.GetName()) {
+				buildCtx.Labels = append(buildCtx.Labels, label.GetName())
+			}
+		}
+	}
+
+	return buildCtx, nil
+}
+
+// isFromFork reports whether the check suite is of a pull request from a
+// fork. GitHub leaves pull requests from forks out of check suites, so a
+// commit that isn't on the head branch in the repository is considered to
+// come from a fork as well.
+func (h Handler) isFromFork(ctx context.Context, ghClient *github.Client, event *github.CheckSuiteEvent) (bool, error) {
+	for _, pr := range event.CheckSuite.PullRequests {
+		if pr.GetHead().GetRepo().GetID() != event.Repo.GetID() {
+			return true, nil
+		}
+	}
+	if len(event.CheckSuite.PullRequests) > 0 {
+		return false, nil
+	}
+
+	branch := event.CheckSuite.GetHeadBranch()
+	if branch == "" {
+		return false, nil
+	}
+
+	comparison, resp, err := ghClient.Repositories.CompareCommits(ctx, event.Repo.Owner.GetLogin(), event.Repo.GetName(), branch, event.CheckSuite.GetHeadSHA(), &github.ListOptions{PerPage: 1})
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return true, nil
+		}
+		return false, fmt.Errorf("compare branch %s with commit: %w", branch, err)
+	}
+
+	// The commit is on the branch if the branch is at it or ahead of it.
+	status := comparison.GetStatus()
+	return status != "identical" && status != "behind", nil
+}
+
 // Function to create JWT tokens with claims
 func (h Handler) createToken(userID int64) (string, error) {
 	// Create a new JWT token with claims
@@ -452,14 +628,44 @@ func (h Handler) createToken(userID int64) (string, error) {
 	return tokenString, nil
 }
 
-func mapRepos(userID int64, repositories []*github.Repository) []data.Repo {
+func mapRepos(userID, installationID int64, repositories []*github.Repository) []data.Repo {
 	repos := make([]data.Repo, 0, len(repositories))
 	for _, repo := range repositories {
 		repos = append(repos, data.Repo{
-			ID:     *repo.ID,
-			Name:   *repo.Name,
-			UserID: userID,
+			ID:             *repo.ID,
+			Name:           *repo.Name,
+			FullName:       repo.GetFullName(),
+			Private:        repo.GetPrivate(),
+			UserID:         userID,
+			InstallationID: &installationID,
 		})
 	}
 	return repos
 }
+
+// mapJobs maps expanded jobs to jobs to be created. Commands whose conditions
+// evaluate to false in buildCtx are left out.
+func mapJobs(jobs []pipeline.Job, buildCtx pipeline.BuildContext) ([]data.NewJob, error) {
+	newJobs := make([]data.NewJob, 0, len(jobs))
+	for _, job := range jobs {
+		commands, err := job.ResolveCommands(buildCtx)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", job.Name, err)
+		}
+
+		newJobs = append(newJobs, data.NewJob{
+			Name:        job.Name,
+			ParentName:  job.ParentName,
+			Matrix:      job.Matrix,
+			Image:       job.Image,
+			Commands:    commands,
+			Timeout:     job.Timeout,
+			DependsOn:   job.DependsOn,
+			Condition:   job.Condition,
+			RunsOn:      job.RunsOn,
+			MaxParallel: job.MaxParallel,
+			FailFast:    job.FailFast,
+		})
+	}
+	return newJobs, nil
+}
@@ -20,16 +20,19 @@ import (
 	"github.com/lib/pq"
 )
 
-const channelName = "builds_channel"
+const (
+	buildsChannelName = "builds_channel"
+	jobsChannelName   = "jobs_channel"
+)
 
 type Updater struct {
 	logger        *slog.Logger
 	httpClient    *http.Client
 	dbListener    *pq.Listener
-	channelName   string
 	repoRepo      data.RepoRepo
 	userRepo      data.UserRepo
 	buildRepo     data.BuildRepo
+	jobRepo       data.JobRepo
 	githubService *ghs.GithubService
 	frontendURL   string
 }
@@ -39,88 +42,150 @@ func New(
 	repoRepo data.RepoRepo,
 	userRepo data.UserRepo,
 	buildRepo data.BuildRepo,
+	jobRepo data.JobRepo,
 	githubService *ghs.GithubService,
 	frontendURL string,
 ) *Updater {
 	return &Updater{
 		logger:        slog.Default(), // TODO: add some "subsystem name" to this logger
 		httpClient:    &http.Client{Timeout: 10 * time.Second},
-		channelName:   channelName,
 		dbListener:    dbListener,
 		repoRepo:      repoRepo,
 		userRepo:      userRepo,
 		buildRepo:     buildRepo,
+		jobRepo:       jobRepo,
 		githubService: githubService,
 		frontendURL:   frontendURL,
 	}
 }
 
 // Start starts the updater. It will listen for updates from the database and
-// create check runs on GitHub when the updates happen.
+// create check runs on GitHub when the updates happen. Every build and every
+// job of a build gets its own check run.
 //
 // To shut down the updater, cancel the context.
 func (u Updater) Start(ctx context.Context) error {
-	err := u.dbListener.Listen(channelName)
-	if err != nil {
-		return fmt.Errorf("listen on channel %s: %w", channelName, err)
+	for _, channelName := range []string{buildsChannelName, jobsChannelName} {
+		err := u.dbListener.Listen(channelName)
+		if err != nil {
+			return fmt.Errorf("listen on channel %s: %w", channelName, err)
+		}
 	}
 
-	u.logger.Info("updater started, listens to db changes", slog.String("channel", channelName))
+	u.logger.Info("updater started, listens to db changes",
+		slog.String("channel", buildsChannelName),
+		slog.String("channel", jobsChannelName),
+	)
 
 	for {
 		select {
 		case <-ctx.Done():
 			u.logger.Debug("context cancelled, db listener will be closed")
-			err = u.dbListener.Close()
+			err := u.dbListener.Close()
 			if err != nil {
 				u.logger.Error("failed to close db listener", slog.Any("error", err))
 				return err
 			}
 			return nil
 		case msg := <-u.dbListener.Notify:
-			updatedBuild := data.Build{}
-			err := json.Unmarshal([]byte(msg.Extra), &updatedBuild)
-			if err != nil {
-				u.logger.Error("db listener got notification but it failed to unmarshal build", slog.Any("error", err))
-				break
+			if msg == nil {
+				// The connection was re-established. Notifications sent in the
+				// meantime are lost.
+				continue
 			}
 
-			u.logger.Debug("db listener got notification",
-				slog.Any("channel", msg.Channel),
-				slog.Any("build", updatedBuild),
-			)
-
-			if updatedBuild.Status == "queued" && updatedBuild.CheckRunID == nil {
-				// The build is new and hasn't been sent to GitHub yet. Create a new check run.
-				checkRunID, err := u.createCheckRun(ctx, updatedBuild)
-				if err != nil {
-					u.logger.Error("failed to create check run", slog.Any("error", err))
-					break
-				}
-
-				err = u.buildRepo.SetCheckRunID(ctx, updatedBuild.ID, checkRunID)
-				if err != nil {
-					u.logger.Error("failed to update check run ID in the database", slog.Any("error", err))
-					break
-				}
-			} else if updatedBuild.Status == "queued" && updatedBuild.CheckRunID != nil {
-				// Nothing to be done. The check run on GitHub has already been created.
-			} else {
-				if updatedBuild.CheckRunID == nil {
-					// This should never happen, but let's be extra safe.
-					u.logger.Error("check run ID is nil", slog.Any("build", updatedBuild))
-					break
-				}
-				// The build isn't new and has been sent to GitHub before. Update the check run.
-				err = u.updateCheckRun(ctx, *updatedBuild.CheckRunID, updatedBuild)
-				if err != nil {
-					u.logger.Error("failed to update check run", slog.Any("error", err))
-				}
+			switch msg.Channel {
+			case buildsChannelName:
+				u.handleBuildNotification(ctx, msg)
+			case jobsChannelName:
+				u.handleJobNotification(ctx, msg)
 			}
 		}
 	}
 }
 
+func (u Updater) handleBuildNotification(ctx context.Context, msg *pq.Notification) {
+	updatedBuild := data.Build{}
+	err := json.Unmarshal([]byte(msg.Extra), &updatedBuild)
+	if err != nil {
+		u.logger.Error("db listener got notification but it failed to unmarshal build", slog.Any("error", err))
+		return
+	}
+
+	u.logger.Debug("db listener got notification",
+		slog.Any("channel", msg.Channel),
+		slog.Any("build", updatedBuild),
+	)
+
+	if updatedBuild.Status == "queued" && updatedBuild.CheckRunID == nil {
+		// The build is new and hasn't been sent to GitHub yet. Create a new check run.
+		checkRunID, err := u.createCheckRun(ctx, updatedBuild)
+		if err != nil {
+			u.logger.Error("failed to create check run", slog.Any("error", err))
+			return
+		}
+
+		err = u.buildRepo.SetCheckRunID(ctx, updatedBuild.ID, checkRunID)
+		if err != nil {
+			u.logger.Error("failed to update check run ID in the database", slog.Any("error", err))
+			return
+		}
+	} else if updatedBuild.Status == "queued" && updatedBuild.CheckRunID != nil {
+		// Nothing to be done. The check run on GitHub has already been created.
+	} else {
+		if updatedBuild.CheckRunID == nil {
+			// This should never happen, but let's be extra safe.
+			u.logger.Error("check run ID is nil", slog.Any("build", updatedBuild))
+			return
+		}
+		// The build isn't new and has been sent to GitHub before. Update the check run.
+		err = u.updateCheckRun(ctx, *updatedBuild.CheckRunID, updatedBuild)
+		if err != nil {
+			u.logger.Error("failed to update check run", slog.Any("error", err))
+		}
+	}
+}
+
+func (u Updater) handleJobNotification(ctx context.Context, msg *pq.Notification) {
+	updatedJob := data.Job{}
+	err := json.Unmarshal([]byte(msg.Extra), &updatedJob)
+	if err != nil {
+		u.logger.Error("db listener got notification but it failed to unmarshal job", slog.Any("error", err))
+		return
+	}
+
+	u.logger.Debug("db listener got notification",
+		slog.Any("channel", msg.Channel),
+		slog.Any("job", updatedJob),
+	)
+
+	if updatedJob.CheckRunID == nil {
+		if updatedJob.Status != "pending" {
+			// The check run is being created in response to the notification
+			// sent when the job was inserted. The notification sent after its
+			// ID is saved will carry the latest status.
+			return
+		}
+
+		checkRunID, err := u.createJobCheckRun(ctx, updatedJob)
+		if err != nil {
+			u.logger.Error("failed to create check run for job", slog.Any("error", err))
+			return
+		}
+
+		err = u.jobRepo.SetCheckRunID(ctx, updatedJob.ID, checkRunID)
+		if err != nil {
+			u.logger.Error("failed to update job check run ID in the database", slog.Any("error", err))
+		}
+		return
+	}
+
+	err = u.updateJobCheckRun(ctx, *updatedJob.CheckRunID, updatedJob)
+	if err != nil {
+		u.logger.Error("failed to update check run for job", slog.Any("error", err))
+	}
+}
+
 func (u Updater) createCheckRun(ctx context.Context, build data.Build) (checkRunID int64, err error) {
 	repo, err := u.repoRepo.Get(ctx, build.RepoID)
 	if err != nil {
@@ -146,7 +211,7 @@ func (u Updater) createCheckRun(ctx context.Context, build data.Build) (checkRun
 
 	createCheckRunOptions := github.CreateCheckRunOptions{
 		// TODO: Get name from the BeeCI config file?
-		Name:        build.CommitMsg + ", started at: " + fmt.Sprint(time.Now().Format(time.RFC822Z)),
+		Name:        checkRunName(build),
 		HeadSHA:     build.CommitSHA,
 		DetailsURL:  &detailsURL,
 		ExternalID:  &buildID,
@@ -197,7 +262,7 @@ func (u Updater) updateCheckRun(ctx context.Context, checkRunID int64, build dat
 
 	// TODO: Do I need to set these options again, or if I set them to null they will be removed?
 	checkRunUpdateOptions := github.UpdateCheckRunOptions{
-		Name:        build.CommitMsg + ", started at: " + fmt.Sprint(time.Now().Format(time.RFC822Z)),
+		Name:        checkRunName(build),
 		DetailsURL:  nil,
 		ExternalID:  nil,
 		Status:      nil,
@@ -223,3 +288,111 @@ func (u Updater) updateCheckRun(ctx context.Context, checkRunID int64, build dat
 
 	return nil
 }
+
+func (u Updater) createJobCheckRun(ctx context.Context, job data.Job) (checkRunID int64, err error) {
+	build, err := u.buildRepo.GetByID(ctx, job.BuildID)
+	if err != nil {
+		return 0, fmt.Errorf("get build: %w", err)
+	}
+
+	repo, err := u.repoRepo.Get(ctx, build.RepoID)
+	if err != nil {
+		return 0, fmt.Errorf("get repo: %w", err)
+	}
+
+	user, err := u.userRepo.Get(ctx, repo.UserID)
+	if err != nil {
+		return 0, fmt.Errorf("get user: %w", err)
+	}
+
+	ghClient, err := u.githubService.GetClientForInstallation(ctx, build.InstallationID)
+	if err != nil {
+		return 0, fmt.Errorf("get client for installation: %w", err)
+	}
+
+	detailsURL, err := url.JoinPath(u.frontendURL, "pipeline", strconv.FormatInt(build.ID, 10))
+	if err != nil {
+		return 0, fmt.Errorf("join paths to create details URL: %w", err)
+	}
+
+	externalID := fmt.Sprintf("%d/%d", build.ID, job.ID)
+	createCheckRunOptions := github.CreateCheckRunOptions{
+		Name:       job.Name,
+		HeadSHA:    build.CommitSHA,
+		DetailsURL: &detailsURL,
+		ExternalID: &externalID,
+		Status:     github.String(checkRunStatus(job.Status)),
+		StartedAt:  &github.Timestamp{Time: job.CreatedAt},
+	}
+
+	checkRun, _, err := ghClient.Checks.CreateCheckRun(ctx, user.Username, repo.Name, createCheckRunOptions)
+	if err != nil {
+		return 0, fmt.Errorf("create check run for repo %s/%s: %w", user.Username, repo.Name, err)
+	}
+
+	u.logger.Info("check run for job created",
+		slog.String("html_url", *checkRun.HTMLURL),
+		slog.Any("job", job),
+	)
+
+	return *checkRun.ID, nil
+}
+
+func (u Updater) updateJobCheckRun(ctx context.Context, checkRunID int64, job data.Job) error {
+	build, err := u.buildRepo.GetByID(ctx, job.BuildID)
+	if err != nil {
+		return fmt.Errorf("get build: %w", err)
+	}
+
+	repo, err := u.repoRepo.Get(ctx, build.RepoID)
+	if err != nil {
+		return fmt.Errorf("get repo: %w", err)
+	}
+
+	user, err := u.userRepo.Get(ctx, repo.UserID)
+	if err != nil {
+		return fmt.Errorf("get user: %w", err)
+	}
+
+	ghClient, err := u.githubService.GetClientForInstallation(ctx, build.InstallationID)
+	if err != nil {
+		return fmt.Errorf("get client for installation: %w", err)
+	}
+
+	checkRunUpdateOptions := github.UpdateCheckRunOptions{
+		Name:   job.Name,
+		Status: github.String(checkRunStatus(job.Status)),
+	}
+	if job.Conclusion != nil {
+		checkRunUpdateOptions.Conclusion = job.Conclusion
+		checkRunUpdateOptions.CompletedAt = &github.Timestamp{Time: job.UpdatedAt}
+	}
+
+	checkRun, _, err := ghClient.Checks.UpdateCheckRun(ctx, user.Username, repo.Name, checkRunID, checkRunUpdateOptions)
+	if err != nil {
+		return fmt.Errorf("update check run for repo %s/%s: %w", user.Username, repo.Name, err)
+	}
+
+	u.logger.Info("check run for job updated",
+		slog.String("html_url", *checkRun.HTMLURL),
+		slog.Any("job", job),
+	)
+
+	return nil
+}
+
+// checkRunStatus maps the status of a job to the status of a GitHub check run.
+// GitHub has no notion of jobs waiting for their dependencies, so these are
+// reported as queued.
+func checkRunStatus(jobStatus string) string {
+	if jobStatus == "pending" {
+		return "queued"
+	}
+	return jobStatus
+}
+
+// checkRunName names the check run of build after its number, so it can be
+// told apart from the check runs of other builds of the same commit.
+func checkRunName(build data.Build) string {
+	return fmt.Sprintf("#%d %s, started at: %s", build.Number, build.CommitMsg, time.Now().Format(time.RFC822Z))
+}
@@ -0,0 +1,192 @@
+// Package watchdog implements a loop that completes builds and jobs that got
+// stuck: jobs whose runner stopped sending heartbeats are returned to the
+// queue (or timed out after too many attempts), jobs running for longer than
+// their timeout are timed out, and builds that didn't complete within the
+// build timeout since they started, or didn't start within the queue timeout,
+// are timed out together with their unfinished jobs.
+//
+// All changes are made in the database, so they reach GitHub through the
+// updater like any other change.
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bee-ci/bee-ci-system/internal/buildstate"
+	"github.com/bee-ci/bee-ci-system/internal/data"
+	"github.com/bee-ci/bee-ci-system/internal/scheduler"
+)
+
+// Config holds the server-wide thresholds. BuildTimeout and MaxAttempts can be
+// overridden per repository, see [data.RepoSettings].
+type Config struct {
+	// BuildTimeout is the time after which a build that started but hasn't
+	// completed is timed out.
+	BuildTimeout time.Duration
+
+	// QueueTimeout is the time after which a build none of whose jobs started
+	// is timed out. It covers builds that wait for a runner or for other
+	// builds to complete.
+	QueueTimeout time.Duration
+
+	// JobTimeoutGrace is added to a job's own timeout before it's timed out,
+	// so that runners enforcing the timeout themselves report first.
+	JobTimeoutGrace time.Duration
+
+	// MaxAttempts is how many times a job is claimed before it's timed out
+	// instead of being returned to the queue when its lease expires.
+	MaxAttempts int
+
+	// Interval is how often the watchdog checks for stuck builds and jobs.
+	Interval time.Duration
+}
+
+// DefaultConfig returns the thresholds used when none are configured.
+func DefaultConfig() Config {
+	return Config{
+		BuildTimeout:    6 * time.Hour,
+		QueueTimeout:    24 * time.Hour,
+		JobTimeoutGrace: time.Minute,
+		MaxAttempts:     3,
+		Interval:        15 * time.Second,
+	}
+}
+
+// actor is the actor of the build events recorded by the watchdog.
+const actor = "watchdog"
+
+type Watchdog struct {
+	logger    *slog.Logger
+	buildRepo data.BuildRepo
+	jobRepo   data.JobRepo
+	config    Config
+}
+
+func New(buildRepo data.BuildRepo, jobRepo data.JobRepo, config Config) *Watchdog {
+	return &Watchdog{
+		logger:    slog.Default().With(slog.String("subsystem", "watchdog")),
+		buildRepo: buildRepo,
+		jobRepo:   jobRepo,
+		config:    config,
+	}
+}
+
+// Start starts the watchdog. It is safe to run multiple watchdogs against the
+// same database.
+//
+// To shut down the watchdog, cancel the context.
+func (w Watchdog) Start(ctx context.Context) error {
+	w.logger.Info("watchdog started",
+		slog.Duration("interval", w.config.Interval),
+		slog.Duration("build_timeout", w.config.BuildTimeout),
+		slog.Duration("queue_timeout", w.config.QueueTimeout),
+		slog.Duration("job_timeout_grace", w.config.JobTimeoutGrace),
+		slog.Int("max_attempts", w.config.MaxAttempts),
+	)
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.logger.Debug("context cancelled, watchdog will stop")
+			return nil
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check runs a single pass of the watchdog. Errors are logged, and don't stop
+// the remaining checks.
+func (w Watchdog) Check(ctx context.Context) {
+	expired, err := w.jobRepo.ExpireLeases(ctx, w.config.MaxAttempts)
+	if err != nil {
+		w.logger.Error("failed to expire leases", slog.Any("error", err))
+	}
+	for _, job := range expired {
+		if job.Status == "queued" {
+			w.logger.Warn("lease expired, job returned to the queue", slog.Any("job", job), slog.Int("attempts", job.Attempts))
+		} else {
+			w.logger.Warn("lease expired too many times, job timed out", slog.Any("job", job), slog.Int("attempts", job.Attempts))
+		}
+	}
+
+	timedOut, err := w.jobRepo.TimeOut(ctx, w.config.JobTimeoutGrace)
+	if err != nil {
+		w.logger.Error("failed to time out jobs", slog.Any("error", err))
+	}
+	for _, job := range timedOut {
+		w.logger.Warn("job exceeded its timeout, timed out", slog.Any("job", job), slog.Int("timeout_seconds", job.Timeout))
+	}
+
+	builds, err := w.buildRepo.GetStuck(ctx, w.config.BuildTimeout, w.config.QueueTimeout)
+	if err != nil {
+		w.logger.Error("failed to get stuck builds", slog.Any("error", err))
+	}
+	for _, build := range builds {
+		cancelRequested := data.BuildEvent{BuildID: build.ID, Type: data.BuildCancelRequested, Actor: actor}
+		err = w.jobRepo.Schedule(ctx, build.ID, TimeOutBuild, cancelRequested)
+		var conflict *buildstate.ConflictError
+		if errors.As(err, &conflict) {
+			// The build is still stuck if it didn't complete in the
+			// meantime, so it's timed out on the next check.
+			w.logger.Warn("build changed concurrently, not timed out", slog.Int64("build_id", build.ID), slog.Any("error", err))
+			continue
+		}
+		if err != nil {
+			w.logger.Error("failed to time out build", slog.Int64("build_id", build.ID), slog.Any("error", err))
+			continue
+		}
+		w.logger.Warn("build exceeded the build or queue timeout, timed out", slog.Any("build", build))
+	}
+}
+
+// TimeOutBuild implements [data.ScheduleFunc]. It times out the jobs of the
+// build that are in progress and cancels the ones that haven't started yet.
+// The build's conclusion is "timed_out", unless one of its jobs failed.
+func TimeOutBuild(build data.Build, jobs []data.Job) (updates []data.JobUpdate, buildStatus string, buildConclusion *string) {
+	updates = make([]data.JobUpdate, 0)
+
+	if build.Status == "completed" {
+		return updates, build.Status, build.Conclusion
+	}
+
+	if len(jobs) == 0 {
+		conclusion := "timed_out"
+		return updates, "completed", &conclusion
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+
+		var conclusion string
+		switch job.Status {
+		case "completed":
+			continue
+		case "in_progress":
+			conclusion = "timed_out"
+		default:
+			conclusion = "canceled"
+		}
+
+		job.Status = "completed"
+		job.Conclusion = &conclusion
+		updates = append(updates, data.JobUpdate{
+			JobID:      job.ID,
+			Status:     job.Status,
+			Conclusion: job.Conclusion,
+		})
+	}
+
+	buildStatus, buildConclusion = scheduler.Derive(jobs)
+	if *buildConclusion != "failure" {
+		conclusion := "timed_out"
+		buildConclusion = &conclusion
+	}
+	return updates, buildStatus, buildConclusion
+}
@@ -0,0 +1,7 @@
+DROP TRIGGER jobs_notify_trigger ON bee_schema.jobs;
+DROP FUNCTION bee_schema.jobs_trigger();
+
+DROP TABLE bee_schema.jobs;
+
+DROP TYPE bee_schema.job_conclusion;
+DROP TYPE bee_schema.job_status;
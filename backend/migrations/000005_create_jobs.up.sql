@@ -0,0 +1,38 @@
+CREATE TYPE bee_schema.job_status AS ENUM ('pending', 'queued', 'in_progress', 'completed');
+CREATE TYPE bee_schema.job_conclusion AS ENUM ('canceled', 'failure', 'success', 'timed_out', 'skipped');
+
+CREATE TABLE bee_schema.jobs
+(
+    id              SERIAL PRIMARY KEY,
+    build_id        INTEGER                     NOT NULL,
+    name            VARCHAR(256)                NOT NULL,
+    image           VARCHAR(512)                NOT NULL,
+    commands        TEXT[]                      NOT NULL,
+    timeout_seconds INTEGER                     NOT NULL,
+    depends_on      TEXT[]                      NOT NULL DEFAULT '{}',
+    status          bee_schema.job_status       NOT NULL,
+    conclusion      bee_schema.job_conclusion,
+    created_at      TIMESTAMP WITH TIME ZONE    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP WITH TIME ZONE    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (build_id) REFERENCES bee_schema.builds (id) ON DELETE CASCADE,
+    UNIQUE (build_id, name),
+    CONSTRAINT job_status_completed_requires_conclusion CHECK (
+        conclusion IS NULL OR status = 'completed'
+    )
+);
+
+CREATE INDEX jobs_status_idx ON bee_schema.jobs (status);
+
+CREATE OR REPLACE FUNCTION bee_schema.jobs_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('jobs_channel', row_to_json(NEW)::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER jobs_notify_trigger
+    AFTER INSERT OR UPDATE
+    ON bee_schema.jobs
+    FOR EACH ROW
+EXECUTE FUNCTION bee_schema.jobs_trigger();
@@ -0,0 +1,6 @@
+ALTER TABLE bee_schema.jobs
+    DROP COLUMN check_run_id,
+    DROP COLUMN fail_fast,
+    DROP COLUMN max_parallel,
+    DROP COLUMN matrix,
+    DROP COLUMN parent_name;
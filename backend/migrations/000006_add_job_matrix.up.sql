@@ -0,0 +1,9 @@
+ALTER TABLE bee_schema.jobs
+    ADD COLUMN parent_name  VARCHAR(256) NOT NULL DEFAULT '',
+    ADD COLUMN matrix       JSONB        NOT NULL DEFAULT '{}',
+    ADD COLUMN max_parallel INTEGER      NOT NULL DEFAULT 0,
+    ADD COLUMN fail_fast    BOOLEAN      NOT NULL DEFAULT TRUE,
+    ADD COLUMN check_run_id BIGINT;
+
+UPDATE bee_schema.jobs
+SET parent_name = name;
@@ -0,0 +1,8 @@
+ALTER TABLE bee_schema.jobs
+    DROP COLUMN condition;
+
+ALTER TABLE bee_schema.builds
+    DROP COLUMN inputs,
+    DROP COLUMN labels,
+    DROP COLUMN event,
+    DROP COLUMN branch;
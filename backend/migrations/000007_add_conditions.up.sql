@@ -0,0 +1,8 @@
+ALTER TABLE bee_schema.builds
+    ADD COLUMN branch VARCHAR(256) NOT NULL DEFAULT '',
+    ADD COLUMN event  VARCHAR(64)  NOT NULL DEFAULT 'push',
+    ADD COLUMN labels TEXT[]       NOT NULL DEFAULT '{}',
+    ADD COLUMN inputs JSONB        NOT NULL DEFAULT '{}';
+
+ALTER TABLE bee_schema.jobs
+    ADD COLUMN condition TEXT NOT NULL DEFAULT '';
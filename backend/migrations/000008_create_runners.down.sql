@@ -0,0 +1,16 @@
+CREATE OR REPLACE FUNCTION bee_schema.jobs_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('jobs_channel', row_to_json(NEW)::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX bee_schema.jobs_lease_expires_at_idx;
+
+ALTER TABLE bee_schema.jobs
+    DROP COLUMN attempts,
+    DROP COLUMN lease_expires_at,
+    DROP COLUMN runner_id;
+
+DROP TABLE bee_schema.runners;
@@ -0,0 +1,31 @@
+CREATE TABLE bee_schema.runners
+(
+    id         BIGSERIAL PRIMARY KEY,
+    name       VARCHAR(256)             NOT NULL,
+    token_hash CHAR(64)                 NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE bee_schema.jobs
+    ADD COLUMN runner_id        BIGINT,
+    ADD COLUMN lease_expires_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN attempts         INTEGER NOT NULL DEFAULT 0,
+    ADD FOREIGN KEY (runner_id) REFERENCES bee_schema.runners (id) ON DELETE SET NULL;
+
+CREATE INDEX jobs_lease_expires_at_idx ON bee_schema.jobs (lease_expires_at) WHERE status = 'in_progress';
+
+-- Heartbeats only extend the lease, so don't notify listeners about updates
+-- that change neither the status, the conclusion nor the check run of a job.
+CREATE OR REPLACE FUNCTION bee_schema.jobs_trigger() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.status = OLD.status
+        AND NEW.conclusion IS NOT DISTINCT FROM OLD.conclusion
+        AND NEW.check_run_id IS NOT DISTINCT FROM OLD.check_run_id THEN
+        RETURN NEW;
+    END IF;
+    PERFORM pg_notify('jobs_channel', row_to_json(NEW)::TEXT);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,11 @@
+DROP INDEX bee_schema.jobs_runner_id_idx;
+
+ALTER TABLE bee_schema.jobs
+    DROP COLUMN runs_on;
+
+ALTER TABLE bee_schema.runners
+    DROP CONSTRAINT runners_max_concurrency_positive,
+    DROP COLUMN last_heartbeat_at,
+    DROP COLUMN version,
+    DROP COLUMN max_concurrency,
+    DROP COLUMN labels;
@@ -0,0 +1,11 @@
+ALTER TABLE bee_schema.runners
+    ADD COLUMN labels            TEXT[]                   NOT NULL DEFAULT '{}',
+    ADD COLUMN max_concurrency   INTEGER                  NOT NULL DEFAULT 1,
+    ADD COLUMN version           VARCHAR(64)              NOT NULL DEFAULT '',
+    ADD COLUMN last_heartbeat_at TIMESTAMP WITH TIME ZONE,
+    ADD CONSTRAINT runners_max_concurrency_positive CHECK (max_concurrency > 0);
+
+ALTER TABLE bee_schema.jobs
+    ADD COLUMN runs_on TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX jobs_runner_id_idx ON bee_schema.jobs (runner_id) WHERE status = 'in_progress';
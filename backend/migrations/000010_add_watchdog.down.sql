@@ -0,0 +1,11 @@
+DROP INDEX bee_schema.builds_status_idx;
+
+DROP TRIGGER jobs_set_started_at_trigger ON bee_schema.jobs;
+DROP FUNCTION bee_schema.jobs_set_started_at();
+
+ALTER TABLE bee_schema.jobs
+    DROP COLUMN started_at;
+
+ALTER TABLE bee_schema.repos
+    DROP COLUMN max_attempts,
+    DROP COLUMN build_timeout_seconds;
@@ -0,0 +1,32 @@
+-- Per-repository overrides of the watchdog's thresholds. NULL means the
+-- server-wide default is used.
+ALTER TABLE bee_schema.repos
+    ADD COLUMN build_timeout_seconds INTEGER CHECK (build_timeout_seconds > 0),
+    ADD COLUMN max_attempts          INTEGER CHECK (max_attempts > 0);
+
+ALTER TABLE bee_schema.jobs
+    ADD COLUMN started_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE bee_schema.jobs
+SET started_at = updated_at
+WHERE status = 'in_progress';
+
+-- Set in a trigger so that jobs claimed by runners that update the database
+-- directly get it too.
+CREATE OR REPLACE FUNCTION bee_schema.jobs_set_started_at() RETURNS TRIGGER AS
+$$
+BEGIN
+    IF NEW.status = 'in_progress' AND OLD.status <> 'in_progress' THEN
+        NEW.started_at = NOW();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER jobs_set_started_at_trigger
+    BEFORE UPDATE
+    ON bee_schema.jobs
+    FOR EACH ROW
+EXECUTE FUNCTION bee_schema.jobs_set_started_at();
+
+CREATE INDEX builds_status_idx ON bee_schema.builds (status) WHERE status <> 'completed';
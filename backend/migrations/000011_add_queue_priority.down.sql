@@ -0,0 +1,7 @@
+DROP INDEX bee_schema.jobs_queued_idx;
+
+ALTER TABLE bee_schema.repos
+    DROP COLUMN max_concurrent_builds;
+
+ALTER TABLE bee_schema.builds
+    DROP COLUMN priority;
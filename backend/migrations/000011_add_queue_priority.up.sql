@@ -0,0 +1,17 @@
+-- Higher priorities are claimed first: 3 – manual, 2 – pull request, 1 – push,
+-- 0 – schedule.
+ALTER TABLE bee_schema.builds
+    ADD COLUMN priority SMALLINT NOT NULL DEFAULT 1;
+
+UPDATE bee_schema.builds
+SET priority = CASE event
+                   WHEN 'manual' THEN 3
+                   WHEN 'pull_request' THEN 2
+                   WHEN 'push' THEN 1
+                   ELSE 0
+    END;
+
+ALTER TABLE bee_schema.repos
+    ADD COLUMN max_concurrent_builds INTEGER CHECK (max_concurrent_builds > 0);
+
+CREATE INDEX jobs_queued_idx ON bee_schema.jobs (build_id) WHERE status = 'queued';
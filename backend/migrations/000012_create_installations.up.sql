@@ -0,0 +1,16 @@
+-- GitHub App installations. Settings that are NULL use the server-wide
+-- default.
+CREATE TABLE bee_schema.installations
+(
+    id                 BIGINT PRIMARY KEY,
+    user_id            BIGINT                   NOT NULL,
+    log_retention_days INTEGER CHECK (log_retention_days > 0),
+    created_at         TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES bee_schema.users (id) ON DELETE CASCADE
+);
+
+INSERT INTO bee_schema.installations (id, user_id)
+SELECT DISTINCT ON (builds.installation_id) builds.installation_id, repos.user_id
+FROM bee_schema.builds builds
+         JOIN bee_schema.repos repos ON repos.id = builds.repo_id
+ORDER BY builds.installation_id, builds.id DESC;
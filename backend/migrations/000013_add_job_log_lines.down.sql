@@ -0,0 +1,2 @@
+ALTER TABLE bee_schema.jobs
+    DROP COLUMN log_lines;
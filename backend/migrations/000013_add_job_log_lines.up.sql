@@ -0,0 +1,4 @@
+-- The number of log lines of the job. Log lines are numbered from 1 in the
+-- order they were received, across attempts.
+ALTER TABLE bee_schema.jobs
+    ADD COLUMN log_lines BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,24 @@
+-- Log lines of the Postgres logs backend. Partitioned by build, so that the
+-- lines of a build are read from and deleted in a single partition.
+CREATE TABLE bee_schema.log_lines
+(
+    build_id BIGINT                   NOT NULL,
+    job_id   BIGINT                   NOT NULL,
+    step     INTEGER,
+    stream   VARCHAR(6)               NOT NULL CHECK (stream IN ('stdout', 'stderr')),
+    seq      BIGINT                   NOT NULL,
+    time     TIMESTAMP WITH TIME ZONE NOT NULL,
+    text     TEXT                     NOT NULL,
+    PRIMARY KEY (build_id, job_id, seq)
+) PARTITION BY HASH (build_id);
+
+CREATE TABLE bee_schema.log_lines_0 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 0);
+CREATE TABLE bee_schema.log_lines_1 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 1);
+CREATE TABLE bee_schema.log_lines_2 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 2);
+CREATE TABLE bee_schema.log_lines_3 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 3);
+CREATE TABLE bee_schema.log_lines_4 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 4);
+CREATE TABLE bee_schema.log_lines_5 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 5);
+CREATE TABLE bee_schema.log_lines_6 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 6);
+CREATE TABLE bee_schema.log_lines_7 PARTITION OF bee_schema.log_lines FOR VALUES WITH (MODULUS 8, REMAINDER 7);
+
+CREATE INDEX log_lines_build_id_time_idx ON bee_schema.log_lines (build_id, time);
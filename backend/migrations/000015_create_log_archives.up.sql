@@ -0,0 +1,11 @@
+-- Builds whose logs were archived to blob storage and pruned from the logs
+-- backend.
+CREATE TABLE bee_schema.log_archives
+(
+    build_id    INTEGER PRIMARY KEY,
+    blob_key    VARCHAR(1024)            NOT NULL,
+    size        BIGINT                   NOT NULL,
+    lines       BIGINT                   NOT NULL,
+    archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (build_id) REFERENCES bee_schema.builds (id) ON DELETE CASCADE
+);
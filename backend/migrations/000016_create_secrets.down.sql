@@ -0,0 +1,9 @@
+ALTER TABLE bee_schema.repos
+    DROP COLUMN secrets_for_forks;
+
+ALTER TABLE bee_schema.builds
+    DROP COLUMN from_fork;
+
+DROP TABLE bee_schema.variables;
+
+DROP TABLE bee_schema.secrets;
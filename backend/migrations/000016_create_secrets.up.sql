@@ -0,0 +1,51 @@
+-- Secrets and plain environment variables passed to the jobs of a build. Each
+-- row belongs to either a repository or an installation (a user or an
+-- organization), and repository rows override installation rows of the same
+-- name.
+--
+-- Secret values are encrypted with a data key of their own, which is in turn
+-- encrypted with the master key identified by key_id.
+CREATE TABLE bee_schema.secrets
+(
+    id              BIGSERIAL PRIMARY KEY,
+    installation_id BIGINT,
+    repo_id         BIGINT,
+    name            VARCHAR(255)             NOT NULL,
+    ciphertext      BYTEA                    NOT NULL,
+    encrypted_key   BYTEA                    NOT NULL,
+    key_id          VARCHAR(64)              NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (installation_id) REFERENCES bee_schema.installations (id) ON DELETE CASCADE,
+    FOREIGN KEY (repo_id) REFERENCES bee_schema.repos (id) ON DELETE CASCADE,
+    CONSTRAINT secrets_single_owner CHECK ((installation_id IS NULL) <> (repo_id IS NULL))
+);
+
+CREATE UNIQUE INDEX secrets_installation_id_name_key ON bee_schema.secrets (installation_id, name) WHERE installation_id IS NOT NULL;
+CREATE UNIQUE INDEX secrets_repo_id_name_key ON bee_schema.secrets (repo_id, name) WHERE repo_id IS NOT NULL;
+CREATE INDEX secrets_key_id_idx ON bee_schema.secrets (key_id);
+
+CREATE TABLE bee_schema.variables
+(
+    id              BIGSERIAL PRIMARY KEY,
+    installation_id BIGINT,
+    repo_id         BIGINT,
+    name            VARCHAR(255)             NOT NULL,
+    value           TEXT                     NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (installation_id) REFERENCES bee_schema.installations (id) ON DELETE CASCADE,
+    FOREIGN KEY (repo_id) REFERENCES bee_schema.repos (id) ON DELETE CASCADE,
+    CONSTRAINT variables_single_owner CHECK ((installation_id IS NULL) <> (repo_id IS NULL))
+);
+
+CREATE UNIQUE INDEX variables_installation_id_name_key ON bee_schema.variables (installation_id, name) WHERE installation_id IS NOT NULL;
+CREATE UNIQUE INDEX variables_repo_id_name_key ON bee_schema.variables (repo_id, name) WHERE repo_id IS NOT NULL;
+
+-- Builds of pull requests from forks run code that anyone could have written,
+-- so they only get secrets if the repository allows it.
+ALTER TABLE bee_schema.builds
+    ADD COLUMN from_fork BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE bee_schema.repos
+    ADD COLUMN secrets_for_forks BOOLEAN;
@@ -0,0 +1 @@
+DROP TABLE bee_schema.artifacts;
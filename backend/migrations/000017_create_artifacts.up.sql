@@ -0,0 +1,20 @@
+-- Files uploaded by jobs. The content is stored in blob storage under
+-- blob_key, and deleted by the sweeper once the artifact expires.
+CREATE TABLE bee_schema.artifacts
+(
+    id         BIGSERIAL PRIMARY KEY,
+    build_id   INTEGER                  NOT NULL,
+    job_id     INTEGER                  NOT NULL,
+    name       VARCHAR(255)             NOT NULL,
+    blob_key   VARCHAR(1024)            NOT NULL,
+    size       BIGINT                   NOT NULL,
+    sha256     CHAR(64)                 NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (build_id) REFERENCES bee_schema.builds (id) ON DELETE CASCADE,
+    FOREIGN KEY (job_id) REFERENCES bee_schema.jobs (id) ON DELETE CASCADE,
+    UNIQUE (job_id, name)
+);
+
+CREATE INDEX artifacts_build_id_idx ON bee_schema.artifacts (build_id);
+CREATE INDEX artifacts_expires_at_idx ON bee_schema.artifacts (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE bee_schema.repos
+    DROP COLUMN default_branch;
+
+DROP TABLE bee_schema.caches;
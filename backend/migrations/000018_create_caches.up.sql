@@ -0,0 +1,26 @@
+-- Dependency caches saved by jobs. Entries are immutable: an entry is never
+-- replaced, only evicted once its repository exceeds its size limit, least
+-- recently used first.
+CREATE TABLE bee_schema.caches
+(
+    id           BIGSERIAL PRIMARY KEY,
+    repo_id      BIGINT                   NOT NULL,
+    branch       VARCHAR(255)             NOT NULL,
+    key          VARCHAR(512)             NOT NULL,
+    blob_key     VARCHAR(1024)            NOT NULL,
+    size         BIGINT                   NOT NULL,
+    sha256       CHAR(64)                 NOT NULL,
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (repo_id) REFERENCES bee_schema.repos (id) ON DELETE CASCADE,
+    UNIQUE (repo_id, branch, key)
+);
+
+-- Restore keys are matched by prefix.
+CREATE INDEX caches_key_prefix_idx ON bee_schema.caches (repo_id, branch, key varchar_pattern_ops);
+CREATE INDEX caches_last_used_at_idx ON bee_schema.caches (repo_id, last_used_at);
+
+-- Caches of other branches fall back to those of the default branch. It's
+-- unknown until the first build of the repository.
+ALTER TABLE bee_schema.repos
+    ADD COLUMN default_branch VARCHAR(255);
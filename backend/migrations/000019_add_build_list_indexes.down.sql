@@ -0,0 +1,6 @@
+DROP INDEX bee_schema.repos_user_id_name_idx;
+DROP INDEX bee_schema.builds_repo_id_updated_at_idx;
+DROP INDEX bee_schema.builds_repo_id_created_at_idx;
+
+ALTER TABLE bee_schema.builds
+    DROP COLUMN actor;
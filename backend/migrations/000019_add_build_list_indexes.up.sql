@@ -0,0 +1,9 @@
+-- The login of the GitHub user who triggered the build.
+ALTER TABLE bee_schema.builds
+    ADD COLUMN actor VARCHAR(255) NOT NULL DEFAULT '';
+
+-- Builds and repositories are listed in pages, after the last row of the
+-- previous page in sort order.
+CREATE INDEX builds_repo_id_created_at_idx ON bee_schema.builds (repo_id, created_at, id);
+CREATE INDEX builds_repo_id_updated_at_idx ON bee_schema.builds (repo_id, updated_at, id);
+CREATE INDEX repos_user_id_name_idx ON bee_schema.repos (user_id, name, id);
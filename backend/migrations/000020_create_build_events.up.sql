@@ -0,0 +1,28 @@
+-- State changes of builds and their jobs, recorded in the same transaction as
+-- the change itself.
+CREATE TABLE bee_schema.build_events
+(
+    id         BIGSERIAL PRIMARY KEY,
+    build_id   INTEGER                  NOT NULL,
+    job_id     INTEGER,
+    runner_id  BIGINT,
+    type       VARCHAR(32)              NOT NULL,
+    actor      VARCHAR(255)             NOT NULL DEFAULT '',
+    conclusion VARCHAR(32),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (build_id) REFERENCES bee_schema.builds (id) ON DELETE CASCADE,
+    FOREIGN KEY (job_id) REFERENCES bee_schema.jobs (id) ON DELETE CASCADE,
+    FOREIGN KEY (runner_id) REFERENCES bee_schema.runners (id) ON DELETE SET NULL
+);
+
+CREATE INDEX build_events_build_id_idx ON bee_schema.build_events (build_id, id);
+
+-- Existing builds only get the events their timestamps tell.
+INSERT INTO bee_schema.build_events (build_id, type, actor, created_at)
+SELECT id, 'queued', actor, created_at
+FROM bee_schema.builds;
+
+INSERT INTO bee_schema.build_events (build_id, type, conclusion, created_at)
+SELECT id, 'completed', conclusion::TEXT, updated_at
+FROM bee_schema.builds
+WHERE status = 'completed';
@@ -0,0 +1,5 @@
+ALTER TABLE bee_schema.builds
+    DROP COLUMN number;
+
+ALTER TABLE bee_schema.repos
+    DROP COLUMN last_build_number;
@@ -0,0 +1,25 @@
+-- Builds are numbered per repository, starting at 1. The next number is
+-- allocated by incrementing last_build_number, whose row lock serializes
+-- builds created concurrently for the same repository.
+ALTER TABLE bee_schema.repos
+    ADD COLUMN last_build_number INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE bee_schema.builds
+    ADD COLUMN number INTEGER;
+
+UPDATE bee_schema.builds
+SET number = numbered.number
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY repo_id ORDER BY id) AS number
+      FROM bee_schema.builds) numbered
+WHERE builds.id = numbered.id;
+
+UPDATE bee_schema.repos
+SET last_build_number = numbered.number
+FROM (SELECT repo_id, MAX(number) AS number
+      FROM bee_schema.builds
+      GROUP BY repo_id) numbered
+WHERE repos.id = numbered.repo_id;
+
+ALTER TABLE bee_schema.builds
+    ALTER COLUMN number SET NOT NULL,
+    ADD CONSTRAINT builds_repo_id_number_key UNIQUE (repo_id, number);
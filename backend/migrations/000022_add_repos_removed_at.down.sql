@@ -0,0 +1,4 @@
+DROP INDEX bee_schema.repos_removed_at_idx;
+
+ALTER TABLE bee_schema.repos
+    DROP COLUMN removed_at;
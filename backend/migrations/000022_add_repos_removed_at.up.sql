@@ -0,0 +1,7 @@
+-- Repositories the app is removed from are hidden rather than deleted, so
+-- that their builds are kept if the app is installed on them again. They're
+-- purged once they've been removed for long enough.
+ALTER TABLE bee_schema.repos
+    ADD COLUMN removed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX repos_removed_at_idx ON bee_schema.repos (removed_at) WHERE removed_at IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX bee_schema.repos_installation_id_idx;
+
+ALTER TABLE bee_schema.repos
+    DROP COLUMN installation_id;
@@ -0,0 +1,22 @@
+-- The installation through which the app can access the repository, so that
+-- repositories can be reconciled with GitHub per installation. Existing
+-- repositories get the installation of their latest build, or the only
+-- installation of their user. The rest get theirs once they're reconciled.
+ALTER TABLE bee_schema.repos
+    ADD COLUMN installation_id BIGINT;
+
+UPDATE bee_schema.repos
+SET installation_id = latest.installation_id
+FROM (SELECT DISTINCT ON (repo_id) repo_id, installation_id
+      FROM bee_schema.builds
+      ORDER BY repo_id, id DESC) latest
+WHERE repos.id = latest.repo_id;
+
+UPDATE bee_schema.repos
+SET installation_id = installations.id
+FROM bee_schema.installations installations
+WHERE repos.installation_id IS NULL
+  AND installations.user_id = repos.user_id
+  AND (SELECT COUNT(*) FROM bee_schema.installations others WHERE others.user_id = repos.user_id) = 1;
+
+CREATE INDEX repos_installation_id_idx ON bee_schema.repos (installation_id);
@@ -0,0 +1,6 @@
+DROP INDEX bee_schema.repos_full_name_idx;
+
+ALTER TABLE bee_schema.repos
+    DROP COLUMN badge_token,
+    DROP COLUMN private,
+    DROP COLUMN full_name;
@@ -0,0 +1,18 @@
+-- Badges are looked up by the full name of the repository, for example
+-- "bee-ci/bee-ci-system". Existing repositories get the name of their user as
+-- the owner, and visibility unknown, which is treated as private, until
+-- they're reconciled with GitHub.
+ALTER TABLE bee_schema.repos
+    ADD COLUMN full_name   VARCHAR(512),
+    ADD COLUMN private     BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN badge_token VARCHAR(64);
+
+UPDATE bee_schema.repos
+SET full_name = users.username || '/' || repos.name
+FROM bee_schema.users users
+WHERE users.id = repos.user_id;
+
+ALTER TABLE bee_schema.repos
+    ALTER COLUMN full_name SET NOT NULL;
+
+CREATE INDEX repos_full_name_idx ON bee_schema.repos (LOWER(full_name));
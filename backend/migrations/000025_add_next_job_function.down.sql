@@ -0,0 +1,3 @@
+DROP FUNCTION bee_schema.next_job(TEXT[], INTEGER, INTEGER);
+
+DROP VIEW bee_schema.active_builds;
@@ -0,0 +1,64 @@
+-- The queue order and the concurrency limits live in the database, so that
+-- executors that claim jobs directly from it follow them too, not only runners
+-- that claim jobs through the runner API.
+
+-- Builds that haven't completed, whether they are running, and their turn
+-- within their installation.
+CREATE VIEW bee_schema.active_builds AS
+SELECT builds.id,
+       builds.status = 'in_progress' OR EXISTS (
+           SELECT 1
+           FROM bee_schema.jobs running
+           WHERE running.build_id = builds.id AND running.status = 'in_progress'
+       ) AS running,
+       ROW_NUMBER() OVER (
+           PARTITION BY builds.installation_id
+           ORDER BY builds.priority DESC, builds.created_at, builds.id
+       ) AS turn
+FROM bee_schema.builds builds
+WHERE builds.status <> 'completed';
+
+-- Locks and returns the ID of the queued job that is claimed next by a runner
+-- with labels, or NULL if there is none. Jobs of builds that aren't running
+-- yet are only claimed while their installation and repository run fewer
+-- builds than the limits, where 0 means no limit. The limits are checked
+-- without locking the other builds, so concurrent claims may exceed them
+-- slightly.
+CREATE FUNCTION bee_schema.next_job(labels TEXT[], max_builds_per_installation INTEGER, max_builds_per_repo INTEGER)
+    RETURNS BIGINT AS
+$$
+WITH active AS (
+    SELECT builds.id, builds.repo_id, builds.installation_id, builds.priority, builds.created_at,
+           active_builds.running, active_builds.turn
+    FROM bee_schema.builds builds
+    JOIN bee_schema.active_builds active_builds ON active_builds.id = builds.id
+),
+running_per_installation AS (
+    SELECT installation_id, COUNT(*) FILTER (WHERE running) AS running
+    FROM active
+    GROUP BY installation_id
+),
+running_per_repo AS (
+    SELECT repo_id, COUNT(*) FILTER (WHERE running) AS running
+    FROM active
+    GROUP BY repo_id
+)
+SELECT jobs.id
+FROM bee_schema.jobs jobs
+JOIN active ON active.id = jobs.build_id
+JOIN bee_schema.repos repos ON repos.id = active.repo_id
+JOIN running_per_installation installation ON installation.installation_id = active.installation_id
+JOIN running_per_repo repo ON repo.repo_id = active.repo_id
+WHERE jobs.status = 'queued'
+  AND jobs.runs_on <@ $1
+  AND (
+      active.running
+      OR (
+          ($2 = 0 OR installation.running < $2)
+          AND (COALESCE(repos.max_concurrent_builds, $3) = 0 OR repo.running < COALESCE(repos.max_concurrent_builds, $3))
+      )
+  )
+ORDER BY active.priority DESC, active.turn, active.created_at, jobs.id
+LIMIT 1
+FOR UPDATE OF jobs SKIP LOCKED
+$$ LANGUAGE sql;
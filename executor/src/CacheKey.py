@@ -0,0 +1,47 @@
+import glob
+import hashlib
+import os
+import re
+
+_HASH_FILES = re.compile(r"\{\{\s*hashFiles\(([^)]*)\)\s*\}\}")
+
+
+def hash_files(patterns: list, root: str = ".") -> str:
+    """Returns the SHA-256 of the files matching the glob patterns under root.
+
+    The hash covers the content of the files, sorted by path, so that it only
+    changes when a file changes. Returns an empty string if no file matches.
+    """
+    paths = sorted(
+        {
+            path
+            for pattern in patterns
+            for path in glob.glob(os.path.join(root, pattern), recursive=True)
+            if os.path.isfile(path)
+        }
+    )
+    if not paths:
+        return ""
+
+    digest = hashlib.sha256()
+    for path in paths:
+        file_digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            for chunk in iter(lambda: f.read(1024 * 1024), b""):
+                file_digest.update(chunk)
+        digest.update(file_digest.digest())
+    return digest.hexdigest()
+
+
+def resolve_key(template: str, root: str = ".") -> str:
+    """Replaces {{ hashFiles('pattern', ...) }} in a cache key template.
+
+    For example, "node-{{ hashFiles('package-lock.json') }}" resolves to
+    "node-" followed by the hash of package-lock.json.
+    """
+
+    def replace(match):
+        patterns = [arg.strip().strip("'\"") for arg in match.group(1).split(",") if arg.strip()]
+        return hash_files(patterns, root)
+
+    return _HASH_FILES.sub(replace, template)
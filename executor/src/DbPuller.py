@@ -1,6 +1,7 @@
 import psycopg2
 import logging
 from structures.BuildInfo import BuildInfo, BuildConclusion
+from structures.JobInfo import JobInfo
 
 
 class DbPuller:
@@ -74,6 +75,116 @@ class DbPuller:
         cursor.close()
         return None
 
+    def pull_job_from_db(self, max_builds_per_installation: int = 0, max_builds_per_repo: int = 0) -> JobInfo:
+        """Pulls a queued job and marks it as in progress.
+
+        Jobs are released to the queue by the backend once all jobs they
+        depend on have succeeded. They are pulled in the same order, and with
+        the same concurrency limits (0 means no limit), as runners using the
+        runner API claim them. Jobs that require runner labels (runs_on) are
+        left for those runners.
+        """
+        cursor = self.conn.cursor()
+        cursor.execute(
+            """
+                UPDATE bee_schema.jobs jobs
+                SET status = 'in_progress', attempts = attempts + 1, updated_at = NOW()
+                FROM (SELECT bee_schema.next_job('{}'::TEXT[], %s, %s) AS id) next
+                WHERE jobs.id = next.id
+                RETURNING jobs.id, jobs.build_id, jobs.name, jobs.image, jobs.commands, jobs.timeout_seconds, jobs.status
+            """,
+            (max_builds_per_installation, max_builds_per_repo),
+        )
+        row = cursor.fetchone()
+        if not row:
+            self.conn.commit()
+            cursor.close()
+            return None
+
+        job_info = JobInfo(*row)
+        # Recorded in the same transaction, so that the build's timeline
+        # and analytics see every job that was pulled.
+        cursor.execute(
+            """
+                INSERT INTO bee_schema.build_events (build_id, job_id, type)
+                VALUES (%s, %s, 'job_started')
+            """,
+            (job_info.build_id, job_info.job_id),
+        )
+        self.conn.commit()
+        cursor.close()
+        self.logger.info("Got job: %s", job_info)
+        return job_info
+
+    def reserve_log_lines(self, job_id: int, n: int = 1) -> int:
+        """Reserves n sequence numbers for log lines of the job and returns
+        the first of them, from the same counter the backend numbers lines of
+        runners with."""
+        cursor = self.conn.cursor()
+        cursor.execute(
+            """
+                UPDATE bee_schema.jobs
+                SET log_lines = log_lines + %s
+                WHERE id = %s
+                RETURNING log_lines - %s + 1
+            """,
+            (n, job_id, n),
+        )
+        first = cursor.fetchone()[0]
+        self.conn.commit()
+        cursor.close()
+        return first
+
+    def get_build(self, build_id: int) -> BuildInfo:
+        cursor = self.conn.cursor()
+        cursor.execute(
+            """
+                SELECT builds.id, builds.repo_id, builds.commit_sha, builds.commit_message,
+                       builds.status, builds.conclusion, builds.created_at, builds.updated_at,
+                       users.username, repos.name
+                FROM bee_schema.builds builds
+                JOIN bee_schema.repos repos ON builds.repo_id = repos.id
+                JOIN bee_schema.users users ON repos.user_id = users.id
+                WHERE builds.id = %s
+            """,
+            (build_id,),
+        )
+        row = cursor.fetchone()
+        cursor.close()
+        return BuildInfo(*row) if row else None
+
+    # update job status to finished, the backend derives the build's conclusion
+    def update_job_conclusion(self, job_id: int, conclusion: BuildConclusion):
+        conclusion_str = conclusion.value
+        cursor = self.conn.cursor()
+        # Jobs that completed in the meantime, for example because they timed
+        # out, keep their conclusion.
+        cursor.execute(
+            """
+                UPDATE bee_schema.jobs
+                SET conclusion = %s, status = 'completed', updated_at = NOW()
+                WHERE id = %s AND status = 'in_progress'
+                RETURNING build_id
+            """,
+            (conclusion_str, job_id),
+        )
+        row = cursor.fetchone()
+        updated = row is not None
+        if updated:
+            cursor.execute(
+                """
+                    INSERT INTO bee_schema.build_events (build_id, job_id, type, conclusion)
+                    VALUES (%s, %s, 'job_completed', %s)
+                """,
+                (row[0], job_id, conclusion_str),
+            )
+        self.conn.commit()
+        cursor.close()
+        if not updated:
+            self.logger.error("Job (id: %d) isn't in progress anymore, conclusion discarded", job_id)
+            return
+        self.logger.info("Job (id: %d) conclusion updated to %s", job_id, conclusion_str)
+
     # update build status to finished
     def update_conclusion(self, build_id: int, conclusion: BuildConclusion):
         conclusion_str = conclusion.value
@@ -85,14 +196,18 @@ class DbPuller:
                 WHERE id = (
                     SELECT id
                     FROM   bee_schema.builds
-                    WHERE  id = %s
+                    WHERE  id = %s AND status <> 'completed'
                     FOR    UPDATE SKIP LOCKED
                 )
             """,
             (conclusion_str, build_id),
         )
+        updated = cursor.rowcount
         self.conn.commit()
         cursor.close()
+        if not updated:
+            self.logger.error("Build (id: %d) completed already, conclusion discarded", build_id)
+            return
         self.logger.info(
             "Build (id: %d) conclusion updated to %s", build_id, conclusion_str
         )
@@ -20,9 +20,18 @@ class ExecutorTimeout(Exception):
 
 
 class DockerExecutor:
-    def __init__(self, influxdb_credentials: InfluxDBCredentials):
+    def __init__(self, influxdb_credentials: InfluxDBCredentials = None, log_function=None, reserve_log_lines=None):
+        """Logs are written to InfluxDB, numbered by reserve_log_lines, unless
+        log_function is given.
+
+        log_function is called with the build ID, the log line and the job ID.
+        """
         self.client = docker.from_env()
-        self.influxdbHandler = InfluxDBHandler(influxdb_credentials)
+        self.influxdbHandler = None
+        if log_function is None:
+            self.influxdbHandler = InfluxDBHandler(influxdb_credentials, reserve_log_lines)
+            log_function = self.influxdbHandler.log_to_influxdb
+        self.log_function = log_function
         self.logger = logging.getLogger(__name__)
         self.logger.info("DockerExecutor initialized")
 
@@ -51,7 +60,9 @@ class DockerExecutor:
             raise ExecutorFailure from e
         self.logger.debug('Image: "%s" pulled', image)
 
-    def run_container(self, build_config: BuildConfig, build_info: BuildInfo):
+    def run_container(
+        self, build_config: BuildConfig, build_info: BuildInfo, job_id: int = None, env: dict = None
+    ):
         script_path = "run.sh"
         try:
             with open(script_path, "r", encoding="utf-8"):
@@ -63,7 +74,7 @@ class DockerExecutor:
         self.pull_image(build_config.image)
 
         container = self.client.containers.create(
-            build_config.image, ["/bin/sh", "/tmp/run.sh"], detach=True
+            build_config.image, ["/bin/sh", "/tmp/run.sh"], detach=True, environment=env or {}
         )
         self.logger.info("Container created: %s", container.name)
 
@@ -77,9 +88,7 @@ class DockerExecutor:
             for line in container.logs(stream=True):
                 decoded_line = line.strip().decode("utf-8")
                 self.logger.debug(decoded_line)
-                self.influxdbHandler.log_to_influxdb(
-                    build_info.build_id, str(decoded_line)
-                )
+                self.log_function(build_info.build_id, str(decoded_line), job_id)
 
                 # Check for timeout
                 if time.time() - start_time > timeout:
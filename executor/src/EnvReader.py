@@ -1,4 +1,5 @@
 import os
+import socket
 import sys
 import logging
 
@@ -18,6 +19,11 @@ class EnvReader:
         influxdb_bucket = os.getenv("INFLUXDB_BUCKET")
         influxdb_token = os.getenv("INFLUXDB_TOKEN")
 
+        # The same limits as the server's, which runners using the runner API
+        # are held to.
+        max_builds_per_installation = int(os.getenv("MAX_CONCURRENT_BUILDS_PER_INSTALLATION") or 0)
+        max_builds_per_repo = int(os.getenv("MAX_CONCURRENT_BUILDS_PER_REPO") or 0)
+
         missing_env_vars = []
         if not db_host:
             missing_env_vars.append("DB_HOST")
@@ -55,4 +61,32 @@ class EnvReader:
             "influxdb_org": influxdb_org,
             "influxdb_bucket": influxdb_bucket,
             "influxdb_token": influxdb_token,
-        }
\ No newline at end of file
+            "max_builds_per_installation": max_builds_per_installation,
+            "max_builds_per_repo": max_builds_per_repo,
+        }
+
+    @staticmethod
+    def get_runner_api_env_variables():
+        """Returns the runner API settings, or None if SERVER_URL isn't set, in
+        which case jobs are pulled from the database directly."""
+        server_url = os.getenv("SERVER_URL")
+        if not server_url:
+            return None
+
+        runner_token = os.getenv("RUNNER_TOKEN")
+        registration_token = os.getenv("RUNNER_REGISTRATION_TOKEN")
+        if not runner_token and not registration_token:
+            logger.error("Missing environment variables: RUNNER_TOKEN or RUNNER_REGISTRATION_TOKEN")
+            sys.exit(1)
+
+        runner_name = os.getenv("RUNNER_NAME") or socket.gethostname()
+        runner_labels = [label.strip() for label in os.getenv("RUNNER_LABELS", "").split(",") if label.strip()]
+        logger.info(f"Server Url: {server_url}, Runner Name: {runner_name}, Labels: {runner_labels}")
+
+        return {
+            "server_url": server_url,
+            "runner_token": runner_token,
+            "registration_token": registration_token,
+            "runner_name": runner_name,
+            "runner_labels": runner_labels,
+        }
@@ -1,5 +1,5 @@
 import logging
-from datetime import datetime, timezone
+import time
 import influxdb_client
 from influxdb_client.client.write_api import SYNCHRONOUS
 from structures.InfluxDBCredentials import InfluxDBCredentials
@@ -8,23 +8,41 @@ logger = logging.getLogger(__name__)
 
 
 class InfluxDBHandler:
-    def __init__(self, cred: InfluxDBCredentials):
+    def __init__(self, cred: InfluxDBCredentials, reserve_log_lines):
+        """reserve_log_lines is called with a job ID and returns the sequence
+        number of its next log line, so that lines are numbered across
+        restarts of the executor like the backend numbers them."""
         self.cred = cred
         self.client = influxdb_client.InfluxDBClient(
             url=self.cred.url, token=self.cred.token, org=self.cred.org
         )
         self.write_api = self.client.write_api(write_options=SYNCHRONOUS)
+        self.reserve_log_lines = reserve_log_lines
+        # Time of the last line written per job, in nanoseconds.
+        self.last_time = {}
         logger.info("Connected to InfluxDB")
 
-    def log_to_influxdb(self, build_id: int, message: str):
+    def log_to_influxdb(self, build_id: int, message: str, job_id: int = None):
+        job_id = job_id if job_id is not None else 0
+        seq = self.reserve_log_lines(job_id)
+
+        # Points with equal tags and time overwrite each other, so every line
+        # of a job gets a later time than the one before it.
+        now = max(time.time_ns(), self.last_time.get(job_id, 0) + 1)
+        self.last_time[job_id] = now
+
         p = (
-            influxdb_client.Point(build_id)
-            .time(time=datetime.now(tz=timezone.utc))
-            .field("Log", message)
+            influxdb_client.Point("logs")
+            .tag("build_id", str(build_id))
+            .tag("job_id", str(job_id))
+            .tag("stream", "stdout")
+            .time(now)
+            .field("seq", seq)
+            .field("text", message)
         )
         self.write_api.write(bucket=self.cred.bucket, org=self.cred.org, record=p)
 
     def download_logs(self, build_id: int):
-        query = f'from(bucket: "{self.cred.bucket}") |> range(start: -1h) |> filter(fn: (r) => r["_measurement"] == "{build_id}")'
+        query = f'from(bucket: "{self.cred.bucket}") |> range(start: -1h) |> filter(fn: (r) => r["_measurement"] == "logs" and r["build_id"] == "{build_id}" and r["_field"] == "text")'
         tables = self.client.query_api().query(query, org=self.cred.org)
         return tables
@@ -0,0 +1,215 @@
+import hashlib
+import json
+import logging
+import os
+import shutil
+import threading
+import urllib.error
+import urllib.parse
+import urllib.request
+from structures.BuildInfo import BuildInfo, BuildConclusion
+from structures.JobInfo import JobInfo
+
+
+class LeaseLost(Exception):
+    """Raised when the server no longer leases the job to this runner."""
+
+    pass
+
+
+class RunnerApiClient:
+    """Claims jobs from the backend's runner API instead of the database.
+
+    Claimed jobs are leased to the runner. A background thread sends
+    heartbeats while a job is running, so that the backend returns the job to
+    the queue if the runner dies.
+    """
+
+    # Jobs are executed one at a time.
+    max_concurrency = 1
+    version = "0.1.0"
+
+    def __init__(self, server_url: str, token: str = None, registration_token: str = None, name: str = None, labels: list = None):
+        self.server_url = server_url.rstrip("/")
+        self.logger = logging.getLogger(__name__)
+        self.token = token
+        if not self.token:
+            self.token = self.register(registration_token, name, labels or [])
+        self.heartbeat_interval = 30
+        self._heartbeat_stop = None
+        self.lease_lost = threading.Event()
+
+    def _request(self, method: str, path: str, body: dict = None, token: str = None, timeout: int = 30):
+        data = json.dumps(body).encode("utf-8") if body is not None else None
+        request = urllib.request.Request(
+            self.server_url + path, data=data, method=method
+        )
+        request.add_header("Authorization", f"Bearer {token or self.token}")
+        if data is not None:
+            request.add_header("Content-Type", "application/json")
+        try:
+            with urllib.request.urlopen(request, timeout=timeout) as response:
+                if response.status == 204:
+                    return None
+                return json.loads(response.read().decode("utf-8"))
+        except urllib.error.HTTPError as e:
+            if e.code == 409:
+                raise LeaseLost(e.read().decode("utf-8")) from e
+            raise
+
+    def register(self, registration_token: str, name: str, labels: list) -> str:
+        body = {
+            "name": name,
+            "labels": labels,
+            "maxConcurrency": self.max_concurrency,
+            "version": self.version,
+        }
+        response = self._request("POST", "/runner/register", body, token=registration_token)
+        self.logger.info(
+            "Registered as runner %s (id: %d, labels: %s)", response["name"], response["id"], response["labels"]
+        )
+        return response["token"]
+
+    def pull_job(self, wait: int = 30):
+        """Claims a job, waiting for up to wait seconds for one to be queued.
+
+        Returns a (JobInfo, BuildInfo) tuple, or None if no job was queued.
+        """
+        response = self._request("POST", f"/runner/jobs/claim?wait={wait}", timeout=wait + 10)
+        if response is None:
+            return None
+
+        job = response["job"]
+        build = response["build"]
+        repo = response["repo"]
+        job_info = JobInfo(
+            job["id"], build["id"], job["name"], job["image"], job["commands"], job["timeoutSeconds"], "in_progress",
+            env={**(response.get("env") or {}), **(response.get("secrets") or {})},
+        )
+        build_info = BuildInfo(
+            build["id"], repo["id"], build["commitSha"], build["commitMessage"], "in_progress", None, None, None,
+            owner_name=repo["owner"], repo_name=repo["name"],
+        )
+        self.heartbeat_interval = response["lease"]["heartbeatIntervalSeconds"]
+        self.logger.info("Got job: %s (attempt %d)", job_info, job["attempt"])
+        return job_info, build_info
+
+    def start_heartbeat(self, job_id: int):
+        self.lease_lost.clear()
+        self._heartbeat_stop = threading.Event()
+        thread = threading.Thread(
+            target=self._heartbeat, args=(job_id, self._heartbeat_stop), daemon=True
+        )
+        thread.start()
+
+    def stop_heartbeat(self):
+        if self._heartbeat_stop:
+            self._heartbeat_stop.set()
+            self._heartbeat_stop = None
+
+    def _heartbeat(self, job_id: int, stop: threading.Event):
+        while not stop.wait(self.heartbeat_interval):
+            try:
+                self._request("POST", f"/runner/jobs/{job_id}/heartbeat")
+            except LeaseLost:
+                self.logger.error("Lost the lease on job (id: %d)", job_id)
+                self.lease_lost.set()
+                return
+            except Exception as e:
+                # The lease is long enough to survive a missed heartbeat.
+                self.logger.warning("Failed to send heartbeat for job (id: %d): %s", job_id, e)
+
+    def log(self, build_id: int, message: str, job_id: int = None):
+        if self.lease_lost.is_set():
+            raise LeaseLost(f"job (id: {job_id}) was leased to another runner")
+        self._request("POST", f"/runner/jobs/{job_id}/logs", {"lines": [{"text": message}]})
+
+    def add_masks(self, job_id: int, values: list):
+        """Registers values that the server masks in the logs of the job."""
+        self._request("POST", f"/runner/jobs/{job_id}/masks", {"values": values})
+
+    def upload_artifact(self, job_id: int, name: str, path: str, retention_days: int = None):
+        """Uploads the file at path as an artifact of the job."""
+        digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            for chunk in iter(lambda: f.read(1024 * 1024), b""):
+                digest.update(chunk)
+
+        query = f"?retentionDays={retention_days}" if retention_days else ""
+        with open(path, "rb") as f:
+            request = urllib.request.Request(
+                f"{self.server_url}/runner/jobs/{job_id}/artifacts/{urllib.parse.quote(name)}{query}",
+                data=f, method="PUT",
+            )
+            request.add_header("Authorization", f"Bearer {self.token}")
+            request.add_header("Content-Type", "application/octet-stream")
+            request.add_header("Content-Length", str(os.path.getsize(path)))
+            request.add_header("X-Checksum-SHA256", digest.hexdigest())
+            try:
+                with urllib.request.urlopen(request, timeout=300) as response:
+                    return json.loads(response.read().decode("utf-8"))
+            except urllib.error.HTTPError as e:
+                if e.code == 409:
+                    raise LeaseLost(e.read().decode("utf-8")) from e
+                raise
+
+    def restore_cache(self, job_id: int, key: str, restore_keys: list, path: str):
+        """Downloads the cache entry matching key or one of restore_keys to path.
+
+        Returns the key of the restored entry, or None if no entry matched.
+        """
+        query = urllib.parse.urlencode([("key", key)] + [("restoreKey", k) for k in restore_keys])
+        request = urllib.request.Request(f"{self.server_url}/runner/jobs/{job_id}/caches?{query}")
+        request.add_header("Authorization", f"Bearer {self.token}")
+        try:
+            with urllib.request.urlopen(request, timeout=300) as response:
+                if response.status == 204:
+                    return None
+                with open(path, "wb") as f:
+                    shutil.copyfileobj(response, f)
+                return response.headers["X-Cache-Key"]
+        except urllib.error.HTTPError as e:
+            if e.code == 409:
+                raise LeaseLost(e.read().decode("utf-8")) from e
+            raise
+
+    def save_cache(self, job_id: int, key: str, path: str) -> bool:
+        """Saves the file at path as the cache entry with key.
+
+        Returns False if an entry with key exists already.
+        """
+        digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            for chunk in iter(lambda: f.read(1024 * 1024), b""):
+                digest.update(chunk)
+
+        query = urllib.parse.urlencode({"key": key})
+        with open(path, "rb") as f:
+            request = urllib.request.Request(
+                f"{self.server_url}/runner/jobs/{job_id}/caches?{query}", data=f, method="PUT",
+            )
+            request.add_header("Authorization", f"Bearer {self.token}")
+            request.add_header("Content-Type", "application/octet-stream")
+            request.add_header("Content-Length", str(os.path.getsize(path)))
+            request.add_header("X-Checksum-SHA256", digest.hexdigest())
+            try:
+                with urllib.request.urlopen(request, timeout=300):
+                    return True
+            except urllib.error.HTTPError as e:
+                if e.code == 409:
+                    # Either the entry exists, or the lease was lost. Only the
+                    # latter has to stop the job.
+                    message = e.read().decode("utf-8")
+                    if "exists already" in message:
+                        return False
+                    raise LeaseLost(message) from e
+                raise
+
+    def update_job_conclusion(self, job_id: int, conclusion: BuildConclusion):
+        self.stop_heartbeat()
+        try:
+            self._request("POST", f"/runner/jobs/{job_id}/conclusion", {"conclusion": conclusion.value})
+        except LeaseLost:
+            self.logger.error("Job (id: %d) was leased to another runner or completed already, conclusion discarded", job_id)
+            return
+        self.logger.info("Job (id: %d) conclusion updated to %s", job_id, conclusion.value)
@@ -1,11 +1,13 @@
+import os
 import sys
 import logging
 import time
 from DockerExecutor import DockerExecutor, ExecutorFailure, ExecutorTimeout
 from DbPuller import DbPuller
-from BuildConfigPuller import BuildConfigPuller
+from RunnerApiClient import RunnerApiClient, LeaseLost
 from BuildConfigAnalyzer import BuildConfigAnalyzer
-from structures.BuildInfo import BuildInfo, BuildConclusion
+from structures.BuildInfo import BuildConclusion
+from structures.BuildConfig import BuildConfig
 from structures.InfluxDBCredentials import InfluxDBCredentials
 from EnvReader import EnvReader
 
@@ -20,16 +22,37 @@ def print_logs(executor: DockerExecutor, build_id: int):
         for record in table.records:
             logger.info(record.values.get("_value"))
 
-if __name__ == "__main__":
-    if len(sys.argv) != 1:
-        print("Usage: python main.py")
+
+def run_job(docker_executor: DockerExecutor, job_info, build_info, puller):
+    build_config = BuildConfig(job_info.image, job_info.commands, job_info.timeout)
+    BuildConfigAnalyzer.save_script(job_info.commands)
+
+    try:
+        docker_executor.run_container(build_config, build_info, job_info.job_id, env=job_info.env)
+    except ExecutorFailure:
+        logger.error("Failed to execute the job")
+        puller.update_job_conclusion(job_info.job_id, BuildConclusion.FAILURE)
+        return False
+    except ExecutorTimeout:
+        logger.error("Job execution timed out")
+        puller.update_job_conclusion(job_info.job_id, BuildConclusion.TIMED_OUT)
+        return False
+
+    puller.update_job_conclusion(job_info.job_id, BuildConclusion.SUCCESS)
+    return True
+
+
+def run_with_db(env_vars: dict):
+    # Jobs pulled from the database write their logs to InfluxDB directly, so
+    # the server can only read them with the influx logs backend. Their logs
+    # aren't masked or streamed live either, which needs the runner API.
+    log_backend = os.getenv("LOG_BACKEND") or "influx"
+    if log_backend != "influx":
+        logger.error(
+            "LOG_BACKEND is %s, but jobs pulled from the database can only log to influx - set SERVER_URL to use the runner API",
+            log_backend,
+        )
         sys.exit(1)
-    logging.basicConfig(
-        format="%(asctime)s %(name)s/%(levelname)s: %(message)s",
-        datefmt="%H:%M:%S",
-        level=logging.INFO,
-    )
-    env_vars = EnvReader.get_env_variables()
 
     db_puller = DbPuller(
         env_vars["db_host"],
@@ -44,36 +67,66 @@ if __name__ == "__main__":
         env_vars["influxdb_token"],
         env_vars["influxdb_url"],
     )
-    docker_executor = DockerExecutor(influxdb_credentials)
+    docker_executor = DockerExecutor(influxdb_credentials, reserve_log_lines=db_puller.reserve_log_lines)
     while True:
-        build_info = db_puller.pull_from_db()
-        if not build_info:
+        job_info = db_puller.pull_job_from_db(
+            env_vars["max_builds_per_installation"],
+            env_vars["max_builds_per_repo"],
+        )
+        if not job_info:
             logger.info(
-                "No available requests found in the database - sleeping for %d seconds",
+                "No available jobs found in the database - sleeping for %d seconds",
                 sleep_time,
             )
             time.sleep(sleep_time)
             continue
 
-        config_data = BuildConfigPuller.pull_config(build_info)
-        if not config_data:
-            db_puller.update_conclusion(build_info.build_id, BuildConclusion.FAILURE)
-            continue
-        build_config = BuildConfigAnalyzer.analyze(config_data)
-        if not build_config:
-            db_puller.update_conclusion(build_info.build_id, BuildConclusion.FAILURE)
-            continue
+        build_info = db_puller.get_build(job_info.build_id)
+        if run_job(docker_executor, job_info, build_info, db_puller):
+            print_logs(docker_executor, build_info.build_id)
+
 
+def run_with_runner_api(env_vars: dict):
+    api_client = RunnerApiClient(
+        env_vars["server_url"],
+        token=env_vars["runner_token"],
+        registration_token=env_vars["registration_token"],
+        name=env_vars["runner_name"],
+        labels=env_vars["runner_labels"],
+    )
+    docker_executor = DockerExecutor(log_function=api_client.log)
+    while True:
         try:
-            docker_executor.run_container(build_config, build_info)
-        except ExecutorFailure:
-            logger.error("Failed to execute the build")
-            db_puller.update_conclusion(build_info.build_id, BuildConclusion.FAILURE)
+            claimed = api_client.pull_job()
+        except Exception as e:
+            logger.error("Failed to claim a job - retrying in %d seconds: %s", sleep_time, e)
+            time.sleep(sleep_time)
             continue
-        except ExecutorTimeout:
-            logger.error("Build execution timed out")
-            db_puller.update_conclusion(build_info.build_id, BuildConclusion.TIMED_OUT)
+        if not claimed:
+            logger.info("No available jobs found - waiting again")
             continue
 
-        db_puller.update_conclusion(build_info.build_id, BuildConclusion.SUCCESS)
-        print_logs(docker_executor, build_info.build_id)
+        job_info, build_info = claimed
+        api_client.start_heartbeat(job_info.job_id)
+        try:
+            run_job(docker_executor, job_info, build_info, api_client)
+        except LeaseLost:
+            logger.error("Job (id: %d) was leased to another runner, abandoning it", job_info.job_id)
+        finally:
+            api_client.stop_heartbeat()
+
+
+if __name__ == "__main__":
+    if len(sys.argv) != 1:
+        print("Usage: python main.py")
+        sys.exit(1)
+    logging.basicConfig(
+        format="%(asctime)s %(name)s/%(levelname)s: %(message)s",
+        datefmt="%H:%M:%S",
+        level=logging.INFO,
+    )
+    api_env_vars = EnvReader.get_runner_api_env_variables()
+    if api_env_vars:
+        run_with_runner_api(api_env_vars)
+    else:
+        run_with_db(EnvReader.get_env_variables())
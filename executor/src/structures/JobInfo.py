@@ -0,0 +1,30 @@
+from structures.BuildInfo import BuildStatus
+
+# CREATE TYPE job_status AS ENUM ('pending', 'queued', 'in_progress', 'completed');
+# CREATE TYPE job_conclusion AS ENUM ('canceled', 'failure', 'success', 'timed_out', 'skipped');
+
+
+class JobInfo:
+    def __init__(
+        self,
+        job_id: int,
+        build_id: int,
+        name: str,
+        image: str,
+        commands: list,
+        timeout: int,
+        status: BuildStatus,
+        env: dict = None,
+    ):
+        self.job_id = job_id
+        self.build_id = build_id
+        self.name = name
+        self.image = image
+        self.commands = commands
+        self.timeout = timeout
+        self.status = status
+        # Environment variables of the job, secrets included. Never log them.
+        self.env = env or {}
+
+    def __str__(self):
+        return f"{self.job_id}, {self.build_id}, {self.name}, {self.image}, {self.timeout}, {self.status}"
@@ -17,7 +17,7 @@ const PipelineTableRow = ({
     <TableCell className='w-[75%]'>
       <div className='font-medium'>{pipeline.repositoryName}</div>
       <div className='text-sm text-muted-foreground md:inline'>
-        {pipeline.commitName}
+        #{pipeline.number} {pipeline.commitName}
       </div>
     </TableCell>
     <TableCell className='flex items-center justify-between gap-4 px-0'>
@@ -7,12 +7,12 @@ import { clientFetch } from '@/app/_utils/client-fetch';
 export const getMyRepositoriesDataClient = async (
   params: GetMyRepositoriesParams,
 ): Promise<GetMyRepositoriesDataDto> => {
-  const { currentPage, search } = params;
-  const pageSize = 5;
+  const { cursor, search } = params;
+  const limit = 5;
 
   const urlWithParams = new URLSearchParams();
-  urlWithParams.append('currentPage', currentPage.toString());
-  urlWithParams.append('pageSize', pageSize.toString());
+  urlWithParams.append('limit', limit.toString());
+  if (cursor) urlWithParams.append('cursor', cursor);
   if (search) urlWithParams.append('search', search);
 
   const res = await clientFetch('/my-repositories?' + urlWithParams.toString());
@@ -21,8 +21,7 @@ export const getMyRepositoriesDataClient = async (
     return {
       repositories: [],
       totalRepositories: 0,
-      totalPages: 1,
-      currentPage: 0,
+      nextCursor: '',
     };
 
   return (await res.json()) as GetMyRepositoriesDataDto;
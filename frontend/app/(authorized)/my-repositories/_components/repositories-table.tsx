@@ -28,16 +28,19 @@ import { getMyRepositoriesDataClient } from '../_api/client';
 import { Search } from './search';
 
 const RepositoriesTable = () => {
-  const [currentPage, setCurrentPage] = useState(0);
+  // Cursors of the pages before the current one, and of the current one last.
+  // The first page has an empty cursor.
+  const [cursors, setCursors] = useState<string[]>(['']);
   const [search, setSearch] = useState('');
 
   const router = useRouter();
+  const cursor = cursors[cursors.length - 1];
 
   const { data, isLoading } = useQuery<GetMyRepositoriesDataDto>({
-    queryKey: ['repositories', currentPage, search],
+    queryKey: ['repositories', cursor, search],
     queryFn: () =>
       getMyRepositoriesDataClient({
-        currentPage,
+        cursor,
         search,
       }),
   });
@@ -56,7 +59,7 @@ const RepositoriesTable = () => {
           searchValue={search}
           handleSearchChange={(value) => {
             setSearch(value);
-            setCurrentPage(0);
+            setCursors(['']);
           }}
         />
         {data !== undefined && data?.repositories.length !== 0 ? (
@@ -94,20 +97,20 @@ const RepositoriesTable = () => {
           <Loader />
         )}
       </CardContent>
-      {data && data.totalPages > 1 && (
+      {data && (cursors.length > 1 || data.nextCursor) && (
         <CardFooter className='flex flex-grow flex-col gap-2'>
           <div className='flex gap-8'>
             <Button
               variant='outline'
-              disabled={currentPage === 0}
-              onClick={() => setCurrentPage((prev) => prev - 1)}
+              disabled={cursors.length === 1}
+              onClick={() => setCursors((prev) => prev.slice(0, -1))}
             >
               <ArrowLeftIcon />
             </Button>
             <Button
               variant='outline'
-              disabled={currentPage + 1 >= data?.totalPages}
-              onClick={() => setCurrentPage((prev) => prev + 1)}
+              disabled={!data.nextCursor}
+              onClick={() => setCursors((prev) => [...prev, data.nextCursor])}
             >
               <ArrowRightIcon />
             </Button>
@@ -23,7 +23,7 @@ const PipelineInfoCard = ({ pipeline }: { pipeline: Pipeline }) => (
   <Card className='flex w-full flex-col'>
     <CardHeader className='mb-8 border-b'>
       <h2 className='text-beeci-yellow-500 dark:text-beeci-yellow-400'>
-        {pipeline.commitName}
+        #{pipeline.number} {pipeline.commitName}
       </h2>
       <CardDescription>from repo: {pipeline.repositoryName}</CardDescription>
     </CardHeader>
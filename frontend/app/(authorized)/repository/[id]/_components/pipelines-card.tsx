@@ -28,7 +28,9 @@ const PipelinesCard = ({ pipelines }: { pipelines: Pipeline[] }) => (
               className='mb-4 mr-4 flex cursor-pointer items-center gap-2 rounded-md border p-4 shadow-md hover:bg-primary-foreground'
             >
               <div className='mr-2 w-3/5'>
-                <h3 className='text-base font-medium'>{pipeline.commitName}</h3>
+                <h3 className='text-base font-medium'>
+                  #{pipeline.number} {pipeline.commitName}
+                </h3>
                 <p className='text-sm text-muted-foreground'>
                   {format(pipeline.startDate, 'HH:mm - dd MMM yyyy')}
                 </p>
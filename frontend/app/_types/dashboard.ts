@@ -3,6 +3,7 @@ import { PipelineConclusion, PipelineStatus } from './pipeline';
 
 export interface PipelineDashboardData {
   id: string;
+  number: number;
   repositoryName: string;
   commitName: string;
   status: PipelineStatus;
@@ -5,13 +5,12 @@ export interface Repository {
 }
 
 export interface GetMyRepositoriesParams {
-  currentPage: number;
+  cursor: string;
   search: string;
 }
 
 export interface GetMyRepositoriesDataDto {
   repositories: Repository[];
   totalRepositories: number;
-  totalPages: number;
-  currentPage: number;
+  nextCursor: string;
 }
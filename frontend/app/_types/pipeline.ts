@@ -11,6 +11,7 @@ export enum PipelineConclusion {
 
 export interface Pipeline {
   id: string;
+  number: number;
   repositoryName: string;
   repositoryId: string;
   commitName: string;
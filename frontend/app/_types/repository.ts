@@ -7,4 +7,5 @@ export interface GetRepositoryDto {
   url: string;
   dateOfLastUpdate: string;
   pipelines: Pipeline[];
+  nextCursor: string;
 }